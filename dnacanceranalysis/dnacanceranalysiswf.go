@@ -9,12 +9,28 @@ import (
 
 	sp "github.com/scipipe/scipipe"
 	spcomp "github.com/scipipe/scipipe/components"
+
+	"github.com/pharmbio/scipipe-demo/doctor"
+	"github.com/pharmbio/scipipe-demo/download"
+	"github.com/pharmbio/scipipe-demo/toolreg"
 )
 
+const appsURL = "https://zenodo.org/record/1336607/files/scipipe-demo-apps.tar.gz?download=1"
+
+// appsSHA256 is the expected SHA-256 checksum of the apps bundle, which is not
+// pinned yet. An empty checksum is not verified, but the checksum of the
+// downloaded file is logged, to pin it here with, and -offline runs fail
+// without one.
+const appsSHA256 = ""
+
 var (
 	maxTasks   = flag.Int("maxtasks", 2, "Max number of local cores to use")
 	procsRegex = flag.String("procs", "print_reads.*", "A regex specifying which processes (by name) to run up to")
 	plot       = flag.Bool("plot", false, "Plot graph to a .dot file, and nothing more")
+	toolConf   = flag.String("toolconf", "", "Tool config file, with the name and path of a tool on each line, for tools not in the downloaded apps bundle (see also the "+toolreg.EnvPrefix+"[NAME] environment variables)")
+	cacheDir   = flag.String("cachedir", "downloads", "Directory of the content-addressed cache of the downloaded apps bundle, or empty for no caching")
+	mirror     = flag.String("mirror", "", "Local directory with a copy of the apps bundle, to use before downloading")
+	offline    = flag.Bool("offline", false, "Take the apps bundle from the download cache or the -mirror directory only, without downloading")
 )
 
 func main() {
@@ -27,18 +43,48 @@ func main() {
 	origDataDir := appsDir + "/data"
 	dataDir := "data"
 
+	runDoctor := doctor.Requested()
+	flag.Parse()
+
+	// ------------------------------------------------
+	// Resolve tool paths
+	// ------------------------------------------------
+	tools := toolreg.NewRegistry(
+		toolreg.Tool{Name: "bwa", Default: appsDir + "/bwa-0.7.15/bwa", Bundled: true},
+		toolreg.Tool{Name: "samtools", Default: appsDir + "/samtools-1.3.1/samtools", Bundled: true},
+		toolreg.Tool{Name: "markduplicates", Default: appsDir + "/picard-tools-1.118/MarkDuplicates.jar", Bundled: true},
+		toolreg.Tool{Name: "gatk", Default: appsDir + "/gatk/GenomeAnalysisTK.jar", Bundled: true},
+		toolreg.Tool{Name: "java", Command: "java"},
+	)
+	if err := tools.Resolve(*toolConf); err != nil {
+		if !runDoctor {
+			sp.Fail(err)
+		}
+		sp.Warning.Println(err)
+	}
+	sp.Info.Println("Tools:\n" + tools.Table())
+	java := tools.ShellPath("java")
+	gatk := tools.ShellPath("gatk")
+
 	// ----------------------------------------------------------------------------
 	// Data Download part of the workflow
 	// ----------------------------------------------------------------------------
-	flag.Parse()
 	wf := sp.NewWorkflow("caw-preproc", *maxTasks)
 
-	downloadApps := wf.NewProc("download_apps", "wget https://zenodo.org/record/1336607/files/scipipe-demo-apps.tar.gz?download=1 -O {o:apps}")
-	downloadApps.SetOut("apps", dataDir+"/apps.tar.gz")
+	downloadApps := download.NewProc(wf, "download_apps", download.Conf{
+		URL:    appsURL,
+		SHA256: appsSHA256,
+		Path:   dataDir + "/apps.tar.gz",
+		Cache: download.Cache{
+			Dir:       *cacheDir,
+			MirrorDir: *mirror,
+			Offline:   *offline,
+		},
+	})
 
 	unTgzApps := wf.NewProc("untgz_apps", "tar -zxvf {i:tgz} -C ../"+dataDir+" && echo untar_done > {o:done}")
 	unTgzApps.SetOut("done", dataDir+"/apps/done.flag")
-	unTgzApps.In("tgz").From(downloadApps.Out("apps"))
+	unTgzApps.In("tgz").From(downloadApps.Out("file"))
 
 	// ----------------------------------------------------------------------------
 	// Main Workflow
@@ -70,10 +116,10 @@ func main() {
 			// --------------------------------------------------------------------------------
 			// Align samples
 			// --------------------------------------------------------------------------------
-			alignSamples := wf.NewProc("align_samples_"+sampleType+"_idx"+idx, "../"+appsDir+`/bwa-0.7.15/bwa mem \
+			alignSamples := wf.NewProc("align_samples_"+sampleType+"_idx"+idx, tools.ShellPath("bwa")+` mem \
 			-R "@RG\tID:`+sampleType+`_{p:index}\tSM:`+sampleType+`\tLB:`+sampleType+`\tPL:illumina" -B 3 -t 4 -M ../`+refFasta+` {i:reads1} {i:reads2} \
-				| ../`+appsDir+`/samtools-1.3.1/samtools view -bS -t ../`+refIndex+` - \
-				| ../`+appsDir+`/samtools-1.3.1/samtools sort - > {o:bam} # {i:untardone}`)
+				| `+tools.ShellPath("samtools")+` view -bS -t ../`+refIndex+` - \
+				| `+tools.ShellPath("samtools")+` sort - > {o:bam} # {i:untardone}`)
 			alignSamples.In("reads1").From(readsSourceFastQ1.Out())
 			alignSamples.In("reads2").From(readsSourceFastQ2.Out())
 			alignSamples.In("untardone").From(unTgzApps.Out("done"))
@@ -86,7 +132,7 @@ func main() {
 		// --------------------------------------------------------------------------------
 		// Merge BAMs
 		// --------------------------------------------------------------------------------
-		mergeBams := wf.NewProc("merge_bams_"+sampleType, "../"+appsDir+"/samtools-1.3.1/samtools merge -f {o:mergedbam} {i:bams|join: }")
+		mergeBams := wf.NewProc("merge_bams_"+sampleType, tools.ShellPath("samtools")+" merge -f {o:mergedbam} {i:bams|join: }")
 		mergeBams.In("bams").From(streamToSubstream[sampleType].OutSubStream())
 		mergeBams.SetOut("mergedbam", tmpDir+"/"+sampleType+".bam")
 
@@ -94,7 +140,7 @@ func main() {
 		// Mark Duplicates
 		// --------------------------------------------------------------------------------
 		markDuplicates := wf.NewProc("mark_dupes_"+sampleType,
-			`java -Xmx15g -jar ../`+appsDir+`/picard-tools-1.118/MarkDuplicates.jar \
+			java+` -Xmx15g -jar `+tools.ShellPath("markduplicates")+` \
 				INPUT={i:inbam} \
 				METRICS_FILE=../`+tmpDir+`/`+sampleType+`_`+si+`.md.bam \
 				TMP_DIR=../`+tmpDir+` \
@@ -112,7 +158,7 @@ func main() {
 	// Re-align Reads - Create Targets
 	// --------------------------------------------------------------------------------
 	realignCreateTargets := wf.NewProc("realign_create_targets",
-		`java -Xmx3g -jar ../`+appsDir+`/gatk/GenomeAnalysisTK.jar -T RealignerTargetCreator  \
+		java+` -Xmx3g -jar `+gatk+` -T RealignerTargetCreator  \
 				-I {i:bamnormal} \
 				-I {i:bamtumor} \
 				-R ../`+refDir+`/human_g1k_v37_decoy.chr1.fasta \
@@ -128,7 +174,7 @@ func main() {
 	// Re-align Reads - Re-align Indels
 	// --------------------------------------------------------------------------------
 	realignIndels := wf.NewProc("realign_indels",
-		`java -Xmx3g -jar ../`+appsDir+`/gatk/GenomeAnalysisTK.jar -T IndelRealigner \
+		java+` -Xmx3g -jar `+gatk+` -T IndelRealigner \
 			-I {i:bamnormal} \
 			-I {i:bamtumor} \
 			-R ../`+refDir+`/human_g1k_v37_decoy.chr1.fasta \
@@ -149,7 +195,7 @@ func main() {
 	for _, sampleType := range []string{"normal", "tumor"} {
 		// Re-calibrate
 		reCalibrate := wf.NewProc("recalibrate_"+sampleType,
-			`java -Xmx3g -Djava.io.tmpdir=../`+tmpDir+` -jar ../`+appsDir+`/gatk/GenomeAnalysisTK.jar -T BaseRecalibrator \
+			java+` -Xmx3g -Djava.io.tmpdir=../`+tmpDir+` -jar `+gatk+` -T BaseRecalibrator \
 				-R ../`+refDir+`/human_g1k_v37_decoy.chr1.fasta \
 				-I {i:realbam} \
 				-knownSites ../`+refDir+`/dbsnp_138.b37.chr1.vcf.gz \
@@ -163,7 +209,7 @@ func main() {
 
 		// Print reads
 		printReads := wf.NewProc("print_reads_"+sampleType,
-			`java -Xmx3g -jar ../`+appsDir+`/gatk/GenomeAnalysisTK.jar -T PrintReads \
+			java+` -Xmx3g -jar `+gatk+` -T PrintReads \
 				-R ../`+refDir+`/human_g1k_v37_decoy.chr1.fasta \
 				-nct 4 \
 				-I {i:realbam} \
@@ -188,6 +234,20 @@ func main() {
 		os.Exit(1)
 	}
 
+	if runDoctor {
+		d := doctor.New(tools)
+		d.AddWorkflow(wf)
+		// GATK 3 runs on Java 8 only
+		javaCheck := d.Versions["java"]
+		javaCheck.Max = "8"
+		d.Versions["java"] = javaCheck
+		d.AddCheck("libgomp", doctor.CheckLibrary("libgomp.so.1"))
+		if !doctor.WriteTable(os.Stdout, d.Run()) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *plot {
 		wf.PlotGraph("cawpre.dot")
 		return
@@ -0,0 +1,113 @@
+package doctor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CheckLibrary returns a check that the shared library name, such as
+// libgomp.so.1, is installed, in the ldconfig cache or the usual library
+// directories
+func CheckLibrary(name string) func() (string, error) {
+	return func() (string, error) {
+		for _, ldconfig := range []string{"ldconfig", "/sbin/ldconfig"} {
+			out, err := exec.Command(ldconfig, "-p").Output()
+			if err != nil {
+				continue
+			}
+			for _, line := range strings.Split(string(out), "\n") {
+				if fields := strings.Fields(line); len(fields) > 0 && fields[0] == name {
+					return fields[len(fields)-1], nil
+				}
+			}
+		}
+		for _, dir := range []string{"/lib*", "/lib*/*", "/usr/lib*", "/usr/lib*/*", "/usr/local/lib", "/opt/homebrew/lib/gcc/*"} {
+			if paths, _ := filepath.Glob(filepath.Join(dir, name)); len(paths) > 0 {
+				return paths[0], nil
+			}
+		}
+		return "", fmt.Errorf("%s not found", name)
+	}
+}
+
+// CheckPythonModule returns a check that the Python module module can be
+// imported with the python executable python
+func CheckPythonModule(python string, module string) func() (string, error) {
+	return func() (string, error) {
+		script := fmt.Sprintf("import %s; print(getattr(%s, '__version__', ''))", module, module)
+		out, err := exec.Command(python, "-c", script).CombinedOutput()
+		if err != nil {
+			// The last line of a traceback is the error
+			lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+			msg := strings.TrimSpace(lines[len(lines)-1])
+			if msg == "" {
+				msg = err.Error()
+			}
+			return "", fmt.Errorf("can not import %s with %s: %s", module, python, msg)
+		}
+		if version := strings.TrimSpace(string(out)); version != "" {
+			return module + " " + version, nil
+		}
+		return module, nil
+	}
+}
+
+// physicalMemory returns the size of the physical memory in bytes, from
+// /proc/meminfo on Linux, or sysctl on Mac
+func physicalMemory() (int64, error) {
+	if f, err := os.Open("/proc/meminfo"); err == nil {
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) >= 2 && fields[0] == "MemTotal:" {
+				kb, err := strconv.ParseInt(fields[1], 10, 64)
+				if err != nil {
+					return 0, fmt.Errorf("invalid MemTotal in /proc/meminfo: %s", fields[1])
+				}
+				return kb * 1024, nil
+			}
+		}
+	}
+	out, err := exec.Command("sysctl", "-n", "hw.memsize").Output()
+	if err != nil {
+		return 0, fmt.Errorf("neither /proc/meminfo nor sysctl hw.memsize available")
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+}
+
+// parseSize parses a JVM memory size, such as 15g, 512m or 1024k, or a
+// number of bytes, into bytes
+func parseSize(size string) (int64, error) {
+	multiplier := int64(1)
+	if size != "" {
+		switch size[len(size)-1] {
+		case 'k', 'K':
+			multiplier = 1 << 10
+		case 'm', 'M':
+			multiplier = 1 << 20
+		case 'g', 'G':
+			multiplier = 1 << 30
+		case 't', 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			size = size[:len(size)-1]
+		}
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory size: %q", size)
+	}
+	return n * multiplier, nil
+}
+
+// formatSize formats a number of bytes in GB, with one decimal
+func formatSize(bytes int64) string {
+	return fmt.Sprintf("%.1f GB", float64(bytes)/(1<<30))
+}
@@ -0,0 +1,151 @@
+package doctor
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	placeholderPattern = regexp.MustCompile(`\{[iop]:[^}]*\}`)
+	commentPattern     = regexp.MustCompile(`(^|[ \t])#[^\n]*`)
+)
+
+// shellBuiltins are the shell builtins and keywords that are not looked for
+// as executables
+var shellBuiltins = map[string]bool{
+	".": true, ":": true, "[": true, "cd": true, "do": true, "done": true,
+	"echo": true, "else": true, "eval": true, "exit": true, "export": true,
+	"false": true, "fi": true, "for": true, "if": true, "printf": true,
+	"read": true, "set": true, "source": true, "test": true, "then": true,
+	"true": true, "unset": true, "wait": true, "while": true,
+}
+
+// Commands returns the words of the simple commands in a shell command, or
+// SciPipe command pattern: the commands in pipes, lists, subshells and
+// command substitutions. Quoted strings are emptied, except quoted absolute
+// paths, such as tool paths with spaces, which are kept as one word. SciPipe
+// placeholders are replaced by {}, comments removed and leading variable
+// assignments skipped. Go processes, with a comment as command, have no
+// commands.
+func Commands(cmd string) [][]string {
+	cmd = stripShellQuotes(cmd)
+	cmd = placeholderPattern.ReplaceAllString(cmd, "{}")
+	cmd = commentPattern.ReplaceAllString(cmd, "$1")
+	for _, sep := range []string{"&&", "||", "|", ";", "$(", "(", ")", "\\\n", "\n"} {
+		cmd = strings.Replace(cmd, sep, "\x00", -1)
+	}
+	commands := [][]string{}
+	for _, segment := range strings.Split(cmd, "\x00") {
+		words := strings.Fields(segment)
+		for i, word := range words {
+			words[i] = strings.Replace(word, quotedSpace, " ", -1)
+		}
+		// Skip variable assignments
+		for len(words) > 0 && strings.Contains(words[0], "=") && !strings.HasPrefix(words[0], "-") {
+			words = words[1:]
+		}
+		if len(words) == 0 || strings.ContainsAny(words[0][:1], "{'\"-<>$&") {
+			continue
+		}
+		commands = append(commands, words)
+	}
+	return commands
+}
+
+// quotedSpace stands in for the spaces in quoted paths kept by
+// stripShellQuotes, until commands are split into words
+const quotedSpace = "\x01"
+
+// stripShellQuotes replaces the content of single- and double-quoted strings
+// in a shell command, such as awk programs, with empty quotes. Single-quoted
+// absolute paths, as written by toolreg.Quote, are unquoted instead, with
+// their spaces replaced by quotedSpace.
+func stripShellQuotes(cmd string) string {
+	var sb, quoted strings.Builder
+	var quote rune
+	for _, r := range cmd {
+		switch {
+		case quote != 0 && r == quote:
+			if content := quoted.String(); quote == '\'' && strings.HasPrefix(content, "/") && !strings.Contains(content, "\n") {
+				sb.WriteString(strings.Replace(content, " ", quotedSpace, -1))
+			} else {
+				sb.WriteString("''")
+			}
+			quote = 0
+			quoted.Reset()
+		case quote != 0:
+			quoted.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// Executables returns the executables run by a shell command, as written in
+// the command, without shell builtins. The commands run by /usr/bin/time,
+// the jars run by java -jar and the scripts run by python are included, after
+// the executable running them.
+func Executables(cmd string) []string {
+	executables := []string{}
+	seen := map[string]bool{}
+	for _, words := range Commands(cmd) {
+		for _, exe := range CommandExecutables(words) {
+			if !seen[exe] {
+				seen[exe] = true
+				executables = append(executables, exe)
+			}
+		}
+	}
+	return executables
+}
+
+// CommandExecutables returns the executables run by the simple command with
+// the words words, as returned by Commands
+func CommandExecutables(words []string) []string {
+	exe, args := words[0], words[1:]
+	if shellBuiltins[exe] {
+		return nil
+	}
+	executables := []string{exe}
+	switch ToolKey(exe) {
+	case "time":
+		// Skip the options, and the values of -f and -o
+		for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+			if (args[0] == "-f" || args[0] == "-o") && len(args) > 1 {
+				args = args[1:]
+			}
+			args = args[1:]
+		}
+		if len(args) > 0 {
+			executables = append(executables, CommandExecutables(args)...)
+		}
+	case "java":
+		for i, arg := range args {
+			if arg == "-jar" && i+1 < len(args) {
+				executables = append(executables, args[i+1])
+				break
+			}
+		}
+	case "python":
+		for _, arg := range args {
+			if arg == "-c" || arg == "-m" {
+				break
+			}
+			if !strings.HasPrefix(arg, "-") {
+				executables = append(executables, arg)
+				break
+			}
+		}
+	}
+	return executables
+}
+
+// ToolKey returns the name of the tool at path, without directory and
+// version suffix, such as python for /usr/bin/python2.7
+func ToolKey(path string) string {
+	return strings.TrimRight(filepath.Base(path), "0123456789.")
+}
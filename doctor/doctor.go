@@ -0,0 +1,288 @@
+// Package doctor checks the external dependencies of the workflows before
+// they are run: the executables and jars used in the command patterns of the
+// processes, the versions of the tools known to cause trouble, the memory
+// needed for the largest JVM heap, and other requirements, such as libraries
+// and Python modules. The results are printed as a pass/fail table:
+//
+//	d := doctor.New(tools)
+//	d.AddWorkflow(wf)
+//	d.AddCheck("libgomp", doctor.CheckLibrary("libgomp.so.1"))
+//	if !doctor.WriteTable(os.Stdout, d.Run()) {
+//		os.Exit(1)
+//	}
+package doctor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pharmbio/scipipe-demo/toolreg"
+	sp "github.com/scipipe/scipipe"
+)
+
+// Command is the name of the doctor subcommand of the workflows
+const Command = "doctor"
+
+// Requested returns true if the workflow was run with the doctor subcommand,
+// as its first argument, which it removes from os.Args, so that the flags
+// after it can be parsed as usual
+func Requested() bool {
+	if len(os.Args) < 2 || os.Args[1] != Command {
+		return false
+	}
+	os.Args = append(os.Args[:1], os.Args[2:]...)
+	return true
+}
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusFail Status = "FAIL"
+	// StatusSkip is for dependencies that can not be checked yet, such as
+	// tools installed by the workflow itself
+	StatusSkip Status = "skip"
+)
+
+// Result is the result of checking a dependency
+type Result struct {
+	Status Status
+	Name   string
+	Detail string
+	// Procs are the names of the processes using the dependency
+	Procs []string
+}
+
+// Doctor checks the dependencies of workflows
+type Doctor struct {
+	// Versions are the version checks of tools, by tool name without
+	// directory and version suffix. Defaults to a copy of DefaultVersions.
+	Versions map[string]VersionCheck
+	tools    *toolreg.Registry
+	deps     []string
+	depProcs map[string][]string
+	heap     heap
+	checks   []check
+}
+
+// heap is the largest JVM heap used by a workflow
+type heap struct {
+	bytes int64
+	xmx   string
+	java  string
+	proc  string
+}
+
+// check is an additional check
+type check struct {
+	name string
+	run  func() (string, error)
+}
+
+// New returns a new Doctor. Tools, if not nil, are the tools the workflows
+// were built with, which is used to skip the bundled tools that are installed
+// by the workflows.
+func New(tools *toolreg.Registry) *Doctor {
+	versions := map[string]VersionCheck{}
+	for name, vc := range DefaultVersions {
+		versions[name] = vc
+	}
+	return &Doctor{
+		Versions: versions,
+		tools:    tools,
+		depProcs: map[string][]string{},
+	}
+}
+
+// AddWorkflow adds the executables used in the command patterns of the
+// processes of wf, and their JVM heap sizes
+func (d *Doctor) AddWorkflow(wf *sp.Workflow) {
+	procNames := []string{}
+	for name := range wf.Procs() {
+		procNames = append(procNames, name)
+	}
+	sort.Strings(procNames)
+	for _, name := range procNames {
+		proc, ok := wf.Procs()[name].(*sp.Process)
+		if !ok {
+			continue
+		}
+		for _, exe := range Executables(proc.CommandPattern) {
+			if _, ok := d.depProcs[exe]; !ok {
+				d.deps = append(d.deps, exe)
+			}
+			d.depProcs[exe] = append(d.depProcs[exe], name)
+		}
+		for _, words := range Commands(proc.CommandPattern) {
+			if ToolKey(words[0]) != "java" {
+				continue
+			}
+			for _, arg := range words[1:] {
+				if !strings.HasPrefix(arg, "-Xmx") {
+					continue
+				}
+				bytes, err := parseSize(strings.TrimPrefix(arg, "-Xmx"))
+				if err == nil && bytes > d.heap.bytes {
+					d.heap = heap{bytes, arg, words[0], name}
+				}
+			}
+		}
+	}
+}
+
+// AddExecutable adds an executable that is not in the command patterns of
+// the processes procs, such as a tool run by Go processes
+func (d *Doctor) AddExecutable(exe string, procs ...string) {
+	if _, ok := d.depProcs[exe]; !ok {
+		d.deps = append(d.deps, exe)
+	}
+	d.depProcs[exe] = append(d.depProcs[exe], procs...)
+}
+
+// AddCheck adds a check, which returns a detail to show, such as a version
+// or path, and an error if the check fails
+func (d *Doctor) AddCheck(name string, run func() (string, error)) {
+	d.checks = append(d.checks, check{name, run})
+}
+
+// Run runs all checks, and returns their results, with the executables in
+// the order they were first used, followed by the JVM memory check and the
+// added checks
+func (d *Doctor) Run() []Result {
+	results := []Result{}
+	for _, dep := range d.deps {
+		res := d.checkExecutable(dep)
+		res.Procs = d.depProcs[dep]
+		results = append(results, res)
+	}
+	if d.heap.bytes > 0 {
+		results = append(results, d.checkHeap())
+	}
+	for _, c := range d.checks {
+		res := Result{Status: StatusPass, Name: c.name}
+		detail, err := c.run()
+		res.Detail = detail
+		if err != nil {
+			res.Status, res.Detail = StatusFail, err.Error()
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// checkExecutable checks that the executable or jar exe, as written in a
+// command pattern, exists, and that its version is compatible, if known
+func (d *Doctor) checkExecutable(exe string) Result {
+	res := Result{Status: StatusFail, Name: exe}
+	path := exe
+	if strings.Contains(path, "/") {
+		// Tasks are run in subdirectories of the workflow directory
+		path = strings.TrimPrefix(path, "../")
+		info, err := os.Stat(path)
+		if err != nil {
+			if d.isBundled(path) {
+				res.Status, res.Detail = StatusSkip, "installed by the workflow"
+				return res
+			}
+			res.Detail = "not found"
+			return res
+		}
+		if info.IsDir() || (!strings.HasSuffix(path, ".jar") && info.Mode()&0111 == 0) {
+			res.Detail = "not an executable file"
+			return res
+		}
+	} else {
+		found, err := exec.LookPath(path)
+		if err != nil {
+			res.Detail = "not found in PATH"
+			return res
+		}
+		path = found
+	}
+	res.Status, res.Detail = StatusPass, path
+	if vc, ok := d.Versions[ToolKey(path)]; ok && !strings.HasSuffix(path, ".jar") {
+		version, err := vc.Check(path)
+		if err != nil {
+			res.Status, res.Detail = StatusFail, err.Error()
+			return res
+		}
+		res.Detail = fmt.Sprintf("%s (version %s)", path, version)
+	}
+	return res
+}
+
+// isBundled returns true if path is the default path of a bundled tool,
+// which is installed by the workflow
+func (d *Doctor) isBundled(path string) bool {
+	if d.tools == nil {
+		return false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, res := range d.tools.Resolved() {
+		if res.Bundled && res.Source == toolreg.SourceDefault && res.Path == absPath {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHeap checks that the largest JVM heap fits in the physical memory,
+// and that java can start with it
+func (d *Doctor) checkHeap() Result {
+	res := Result{Status: StatusFail, Name: "JVM memory", Procs: []string{d.heap.proc}}
+	mem, err := physicalMemory()
+	if err != nil {
+		res.Status, res.Detail = StatusSkip, fmt.Sprintf("%s needed, could not find the physical memory: %v", d.heap.xmx, err)
+		return res
+	}
+	if d.heap.bytes > mem {
+		res.Detail = fmt.Sprintf("%s needed, only %s physical memory", d.heap.xmx, formatSize(mem))
+		return res
+	}
+	java := strings.TrimPrefix(d.heap.java, "../")
+	if out, err := exec.Command(java, d.heap.xmx, "-version").CombinedOutput(); err != nil {
+		res.Detail = fmt.Sprintf("java can not start with %s: %s", d.heap.xmx, firstLine(string(out)+err.Error()))
+		return res
+	}
+	res.Status, res.Detail = StatusPass, fmt.Sprintf("%s needed, %s physical memory", d.heap.xmx, formatSize(mem))
+	return res
+}
+
+// WriteTable writes results as a table to w, and returns true if no check
+// failed
+func WriteTable(w io.Writer, results []Result) bool {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tDEPENDENCY\tDETAIL\tUSED BY")
+	failCnt := 0
+	for _, res := range results {
+		usedBy := ""
+		switch len(res.Procs) {
+		case 0:
+		case 1:
+			usedBy = res.Procs[0]
+		default:
+			usedBy = fmt.Sprintf("%s (+%d more)", res.Procs[0], len(res.Procs)-1)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.Status, res.Name, res.Detail, usedBy)
+		if res.Status == StatusFail {
+			failCnt++
+		}
+	}
+	tw.Flush()
+	if failCnt == 0 {
+		fmt.Fprintf(w, "\nAll %d checks passed\n", len(results))
+	} else {
+		fmt.Fprintf(w, "\n%d of %d checks failed\n", failCnt, len(results))
+	}
+	return failCnt == 0
+}
@@ -0,0 +1,153 @@
+package doctor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+func TestExecutables(t *testing.T) {
+	for _, tc := range []struct {
+		cmd      string
+		expected []string
+	}{
+		{"/usr/bin/time -f%e -o {o:traintime} ../bin/lin-train -s {p:solvertype} -c {p:cost} -q {i:traindata} {o:model}", []string{"/usr/bin/time", "../bin/lin-train"}},
+		{"time -f %e -o out.time lin-train a b", []string{"time", "lin-train"}},
+		{"java -Xmx3g -Djava.io.tmpdir=../tmp -jar /apps/gatk/GenomeAnalysisTK.jar -T PrintReads \\\n\t-I {i:realbam} \\\n\t-o {o:recalbam} \\\n\t&& fname={o:recalbam}", []string{"java", "/apps/gatk/GenomeAnalysisTK.jar"}},
+		{"export PYTHONPATH=../lib:$PYTHONPATH && \\\n\tpython ../apps/multiqc -f \\\n\t-o $(o={o:report}; echo ${o%/multiqc_report.html}) # Depend: {i:count_features|join: }", []string{"python", "../apps/multiqc"}},
+		{"python -c 'import markupsafe'", []string{"python"}},
+		{`linesperfold=$(echo "$linecnt / $foldscnt" | bc) && awk -v tststart=$tststart '(NR < tststart) { print }' {i:in} > {o:traindata}`, []string{"bc", "awk"}},
+		{`(echo "# {p:title}" && echo && cat {i:sections|join: }) > {o:report}`, []string{"cat"}},
+		{"bwa mem -R \"@RG\\tID:normal\" ref.fa {i:reads1} \\\n\t| samtools view -bS - \\\n\t| samtools sort - > {o:bam} # {i:untardone}", []string{"bwa", "samtools"}},
+		{"# Go applicability domain: {i:traindata} {o:summary}", []string{}},
+		{"'/opt/my tools/time' -f%e -o {o:traintime} '/opt/my tools/lin-train' -s 12 {i:traindata} {o:model}", []string{"/opt/my tools/time", "/opt/my tools/lin-train"}},
+		{"'/opt/my tools/java' -jar '/opt/my tools/Sample.jar' -inputfile {i:signatures} && awk -F '\\t' '{ print $1 }' {i:in}", []string{"/opt/my tools/java", "/opt/my tools/Sample.jar", "awk"}},
+	} {
+		if executables := Executables(tc.cmd); !reflect.DeepEqual(executables, tc.expected) {
+			t.Errorf("Wrong executables for %q:\nEXPECTED: %q\nACTUAL: %q\n", tc.cmd, tc.expected, executables)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a        string
+		b        string
+		expected int
+	}{
+		{"2.7.18", "2.7", 0},
+		{"3.11.7", "2.7", 1},
+		{"2.6.9", "2.7", -1},
+		{javaVersion("1.8.0_191"), "8", 0},
+		{javaVersion("11.0.2"), "8", 1},
+		{javaVersion("1.7.0_80"), "8", -1},
+		{"9.1", "8.25", 1},
+		{"UNKNOWN", "1", -1},
+	} {
+		if cmp := compareVersions(tc.a, tc.b); cmp != tc.expected {
+			t.Errorf("Expected compareVersions(%q, %q) to be %d, got %d", tc.a, tc.b, tc.expected, cmp)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for size, expected := range map[string]int64{
+		"15g":     15 << 30,
+		"512m":    512 << 20,
+		"1024K":   1 << 20,
+		"1048576": 1 << 20,
+	} {
+		if bytes, err := parseSize(size); err != nil || bytes != expected {
+			t.Errorf("Expected %d bytes for %s, got %d (%v)", expected, size, bytes, err)
+		}
+	}
+	if _, err := parseSize("lots"); err == nil {
+		t.Error("Expected an error for an invalid size")
+	}
+}
+
+func TestRun(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "doctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	writeScript := func(name string, script string) string {
+		path := filepath.Join(tmpDir, name)
+		if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	oldTool := writeScript("oldtool", "echo 'oldtool 1.2'")
+	newTool := writeScript("newtool", "echo 'newtool 2.0.1' >&2")
+	plainTool := writeScript("plaintool", "exit 1")
+	java := writeScript("java", "exit 0")
+	jar := filepath.Join(tmpDir, "tool.jar")
+	if err := ioutil.WriteFile(jar, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wf := sp.NewWorkflow("doctor", 1)
+	wf.NewProc("old", oldTool+" {i:in} > {o:out}")
+	wf.NewProc("new", newTool+" {i:in} | "+plainTool+" > {o:out}")
+	wf.NewProc("plain", plainTool+" {i:in} > {o:out}")
+	wf.NewProc("missing", filepath.Join(tmpDir, "missing")+" {i:in} > {o:out}")
+	wf.NewProc("jar", java+" -Xmx1m -jar "+jar+" {i:in} > {o:out}")
+	wf.NewProc("go", "# Go processing: {i:in} {o:out}")
+
+	d := New(nil)
+	d.Versions = map[string]VersionCheck{
+		"oldtool": {Args: []string{"--version"}, Pattern: regexp.MustCompile(`oldtool (\S+)`), Min: "2"},
+		"newtool": {Args: []string{"--version"}, Pattern: regexp.MustCompile(`newtool (\S+)`), Min: "2", Max: "2.0"},
+	}
+	d.AddWorkflow(wf)
+	d.AddExecutable(plainTool, "go")
+	d.AddCheck("extra", func() (string, error) { return "fine", nil })
+	results := d.Run()
+
+	summary := []string{}
+	for _, res := range results {
+		summary = append(summary, string(res.Status)+" "+strings.TrimPrefix(res.Name, tmpDir+"/")+" "+strings.Join(res.Procs, ","))
+	}
+	expected := []string{
+		"pass java jar",
+		"pass tool.jar jar",
+		"FAIL missing missing",
+		"pass newtool new",
+		"pass plaintool new,plain,go",
+		"FAIL oldtool old",
+		"pass JVM memory jar",
+		"pass extra ",
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("Wrong results:\nEXPECTED: %q\nACTUAL: %q", expected, summary)
+	}
+	for _, res := range results {
+		switch strings.TrimPrefix(res.Name, tmpDir+"/") {
+		case "newtool":
+			if !strings.HasSuffix(res.Detail, "(version 2.0.1)") {
+				t.Errorf("Expected the version of newtool in the detail, got %q", res.Detail)
+			}
+		case "oldtool":
+			if res.Detail != "version 1.2 is older than 2" {
+				t.Errorf("Wrong detail for oldtool: %q", res.Detail)
+			}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if WriteTable(buf, results) {
+		t.Error("Expected WriteTable to return false, with failed checks")
+	}
+	if !strings.HasPrefix(buf.String(), "STATUS") || !strings.Contains(buf.String(), "checks failed") {
+		t.Errorf("Unexpected table:\n%s", buf.String())
+	}
+}
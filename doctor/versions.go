@@ -0,0 +1,139 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VersionCheck checks that a tool reports a compatible version
+type VersionCheck struct {
+	// Args are the arguments that make the tool print its version
+	Args []string
+	// Pattern matches the version in the output of the tool, with the
+	// version as its first group
+	Pattern *regexp.Regexp
+	// Normalize, if set, converts the version to a comparable one
+	Normalize func(version string) string
+	// Min and Max are the oldest and newest compatible versions, or empty
+	// for no limit. Only the parts of the version given in Max are compared
+	// with it, so that Max 2.7 allows 2.7.18.
+	Min string
+	Max string
+	// Hint explains which tool is needed, if the output does not match
+	Hint string
+}
+
+// DefaultVersions are the version checks of the tools used by the
+// workflows, by tool name, without directory and version suffix
+var DefaultVersions = map[string]VersionCheck{
+	"bc": {
+		Args:    []string{"--version"},
+		Pattern: regexp.MustCompile(`bc (\S+)`),
+	},
+	"shuf": {
+		Args:    []string{"--version"},
+		Pattern: regexp.MustCompile(`shuf \(GNU coreutils\) (\S+)`),
+		Hint:    "GNU shuf is needed, for --random-source",
+	},
+	"time": {
+		Args:    []string{"--version"},
+		Pattern: regexp.MustCompile(`GNU [Tt]ime\)? *(\S+)`),
+		Hint:    "GNU time is needed, for -f and -o",
+	},
+	"java": {
+		Args:      []string{"-version"},
+		Pattern:   regexp.MustCompile(`version "([^"]+)"`),
+		Normalize: javaVersion,
+		Min:       "8",
+	},
+	"python": {
+		Args:    []string{"--version"},
+		Pattern: regexp.MustCompile(`Python (\S+)`),
+	},
+}
+
+// javaVersion returns a Java version without the 1. prefix of Java 8 and
+// older, such as 8.0_191 for 1.8.0_191
+func javaVersion(version string) string {
+	return strings.TrimPrefix(version, "1.")
+}
+
+// Check runs the tool at path, and returns the version it reports, and an
+// error if the version can not be found in its output, or is incompatible
+func (vc VersionCheck) Check(path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	// The exit status is not checked, as some tools exit with an error after
+	// printing their version
+	out, _ := exec.CommandContext(ctx, path, vc.Args...).CombinedOutput()
+	m := vc.Pattern.FindStringSubmatch(string(out))
+	if m == nil {
+		msg := fmt.Sprintf("no version in the output of %s %s: %q", path, strings.Join(vc.Args, " "), firstLine(string(out)))
+		if vc.Hint != "" {
+			msg = vc.Hint + ", " + msg
+		}
+		return "", errors.New(msg)
+	}
+	version := m[1]
+	cmpVersion := version
+	if vc.Normalize != nil {
+		cmpVersion = vc.Normalize(version)
+	}
+	if vc.Min != "" && compareVersions(cmpVersion, vc.Min) < 0 {
+		return version, fmt.Errorf("version %s is older than %s", version, vc.Min)
+	}
+	if vc.Max != "" && compareVersions(cmpVersion, vc.Max) > 0 {
+		return version, fmt.Errorf("version %s is newer than %s", version, vc.Max)
+	}
+	return version, nil
+}
+
+// compareVersions compares the numeric parts of version a with those of
+// version b, up to the number of parts in b, and returns -1, 0 or 1 if a is
+// older, the same or newer. Missing or non-numeric parts count as 0.
+func compareVersions(a string, b string) int {
+	aParts, bParts := versionParts(a), versionParts(b)
+	for i, bPart := range bParts {
+		aPart := 0
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if aPart < bPart {
+			return -1
+		}
+		if aPart > bPart {
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionParts returns the numeric parts of a version, up to the first
+// non-numeric part
+func versionParts(version string) []int {
+	parts := []int{}
+	for _, part := range strings.FieldsFunc(version, func(r rune) bool { return r == '.' || r == '_' || r == '-' }) {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// firstLine returns the first non-empty line of s
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,199 @@
+// Package download fetches the files used by the workflows, such as tools
+// bundles and datasets, from HTTP(S) URLs or local paths, and verifies their
+// SHA-256 checksums. Downloaded files are kept in a content-addressed cache,
+// so that later runs, and runs without network access, can use them:
+//
+//	cache := download.Cache{Dir: "downloads", Offline: *offline}
+//	downloadApps := download.NewProc(wf, "download_apps", download.Conf{
+//		URL:    appsURL,
+//		SHA256: appsSHA256,
+//		Path:   "data/apps.tar.gz",
+//		Cache:  cache,
+//	})
+package download
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+// Conf contains parameters for initializing a download process with NewProc
+type Conf struct {
+	// URL is the http:// or https:// URL to download the file from
+	URL string
+	// SHA256 is the expected hex-encoded SHA-256 checksum of the file
+	SHA256 string
+	// Path is the path to write the file to
+	Path string
+	// Cache is the download cache to resolve the file from
+	Cache Cache
+}
+
+// NewProc returns a new process that downloads a file via a Cache, and
+// verifies its SHA-256 checksum. The file is written to the out-port "file".
+func NewProc(wf *sp.Workflow, name string, conf Conf) *sp.Process {
+	p := wf.NewProc(name, "# Go download: {o:file}")
+	p.SetOut("file", conf.Path)
+	p.CustomExecute = func(t *sp.Task) {
+		if err := conf.Cache.Fetch(conf.URL, conf.SHA256, t.OutIP("file").TempPath()); err != nil {
+			sp.Failf("Could not download %s: %v", conf.URL, err)
+		}
+	}
+	return p
+}
+
+// Cache is a content-addressed cache of downloaded files, where a file is
+// stored under its SHA-256 checksum, as [Dir]/sha256/[checksum]
+type Cache struct {
+	// Dir is the cache directory, or empty for no caching
+	Dir string
+	// MirrorDir is a local directory with copies of the downloaded files, to
+	// use before downloading, or empty for none. A file is looked up by its
+	// SHA-256 checksum, by its URL host and path (as mirrored by wget -x),
+	// and by the file name of its URL.
+	MirrorDir string
+	// Offline makes Fetch resolve files from the cache and the mirror
+	// directory only, without downloading. Files must then have a declared
+	// checksum, to find and verify them by.
+	Offline bool
+}
+
+// Fetch writes the content of source, a URL or a local path, to outPath,
+// from the cache or the mirror directory if there, and returns an error if
+// its SHA-256 checksum is not wantSHA256. Without wantSHA256, a downloaded
+// file is not verified, but its checksum is logged, to declare it with, and
+// offline, it is an error. Downloaded files are added to the cache.
+func (c Cache) Fetch(source string, wantSHA256 string, outPath string) error {
+	if !IsURL(source) {
+		_, err := fetchFile(source, wantSHA256, outPath)
+		return err
+	}
+	if c.Offline && wantSHA256 == "" {
+		return fmt.Errorf("offline, and no SHA-256 checksum declared, to look it up in the cache %q or the mirror directory %q and verify it with", c.Dir, c.MirrorDir)
+	}
+	for _, local := range c.localCopies(source, wantSHA256) {
+		if _, err := os.Stat(local); err != nil {
+			continue
+		}
+		if _, err := fetchFile(local, wantSHA256, outPath); err != nil {
+			return fmt.Errorf("%s: %v", local, err)
+		}
+		sp.Info.Printf("Using %s for %s\n", local, source)
+		return nil
+	}
+	if c.Offline {
+		return fmt.Errorf("offline, and not in the cache %q or the mirror directory %q", c.Dir, c.MirrorDir)
+	}
+
+	gotSHA256, err := fetchFile(source, wantSHA256, outPath)
+	if err != nil {
+		return err
+	}
+	if wantSHA256 == "" {
+		sp.Warning.Printf("No SHA-256 checksum declared for %s, which has checksum %s\n", source, gotSHA256)
+	}
+	if c.Dir != "" {
+		if err := c.store(outPath, gotSHA256); err != nil {
+			sp.Warning.Printf("Could not add %s to the download cache: %v\n", source, err)
+		}
+	}
+	return nil
+}
+
+// localCopies returns the paths where source may be found in the cache and
+// in the mirror directory, in order of preference
+func (c Cache) localCopies(source string, wantSHA256 string) []string {
+	paths := []string{}
+	if c.Dir != "" && wantSHA256 != "" {
+		paths = append(paths, c.path(wantSHA256))
+	}
+	if c.MirrorDir != "" {
+		if wantSHA256 != "" {
+			paths = append(paths, filepath.Join(c.MirrorDir, wantSHA256))
+		}
+		if u, err := url.Parse(source); err == nil && strings.Trim(u.Path, "/") != "" {
+			paths = append(paths,
+				filepath.Join(c.MirrorDir, u.Host, filepath.FromSlash(u.Path)),
+				filepath.Join(c.MirrorDir, path.Base(u.Path)))
+		}
+	}
+	return paths
+}
+
+// path returns the cache path of a file with the given SHA-256 checksum
+func (c Cache) path(sha256 string) string {
+	return filepath.Join(c.Dir, "sha256", sha256)
+}
+
+// store copies the file at filePath, with the SHA-256 checksum sha256, into
+// the cache, via a temporary file, so that the cache never has partial files
+func (c Cache) store(filePath string, sha256 string) error {
+	cachePath := c.path(sha256)
+	if _, err := os.Stat(cachePath); err == nil {
+		return nil
+	}
+	tmpPath := fmt.Sprintf("%s.tmp%d", cachePath, os.Getpid())
+	if _, err := fetchFile(filePath, sha256, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, cachePath)
+}
+
+// IsURL returns true if source is an HTTP(S) URL rather than a local path
+func IsURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// fetchFile writes the content of source, a URL or a local path, to outPath,
+// and returns its SHA-256 checksum, or an error if that is not wantSHA256
+// (unless that is empty)
+func fetchFile(source string, wantSHA256 string, outPath string) (string, error) {
+	var in io.ReadCloser
+	if IsURL(source) {
+		resp, err := http.Get(source)
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return "", fmt.Errorf("HTTP status %s", resp.Status)
+		}
+		in = resp.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return "", err
+		}
+		in = f
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return "", err
+	}
+	out, err := os.Create(outPath)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hash), in); err != nil {
+		return "", err
+	}
+	gotSHA256 := hex.EncodeToString(hash.Sum(nil))
+	if wantSHA256 != "" && !strings.EqualFold(gotSHA256, wantSHA256) {
+		return "", fmt.Errorf("SHA-256 checksum mismatch: expected %s, got %s", wantSHA256, gotSHA256)
+	}
+	return gotSHA256, out.Close()
+}
@@ -0,0 +1,67 @@
+package download
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheFetch(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+
+	content := "CCO\t1.5\n"
+	hash := sha256.Sum256([]byte(content))
+	checksum := hex.EncodeToString(hash[:])
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+	url := server.URL + "/files/testdataset.smi?download=1"
+
+	cache := Cache{Dir: path("cache")}
+	if err := cache.Fetch(url, "0000", path("wrong.smi")); err == nil {
+		t.Errorf("Expected an error for a checksum mismatch")
+	}
+	if err := cache.Fetch(url, checksum, path("first.smi")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "cache", "sha256", checksum)); err != nil {
+		t.Errorf("Downloaded file not in cache: %v", err)
+	}
+
+	cache.Offline = true
+	if err := cache.Fetch(url, checksum, path("second.smi")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(path("second.smi")); string(got) != content {
+		t.Errorf("Wrong content from cache: %q", got)
+	}
+	if err := cache.Fetch(url, "", path("third.smi")); err == nil {
+		t.Errorf("Expected an error offline, without a checksum or a mirror")
+	}
+
+	os.MkdirAll(path("mirror"), 0755)
+	ioutil.WriteFile(path("mirror/testdataset.smi"), []byte(content), 0644)
+	mirrored := Cache{MirrorDir: path("mirror"), Offline: true}
+	if err := mirrored.Fetch(url, checksum, path("fourth.smi")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mirrored.Fetch(url, "", path("fifth.smi")); err == nil {
+		t.Errorf("Expected an error offline, without a checksum, for a mirrored file")
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 requests to the server, got %d", requests)
+	}
+}
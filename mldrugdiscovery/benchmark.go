@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	sp "github.com/scipipe/scipipe"
+	spcomp "github.com/scipipe/scipipe/components"
+
+	"github.com/pharmbio/scipipe-demo/mldrugdiscovery/mlcomp"
+	"github.com/pharmbio/scipipe-demo/sweepgraph"
+)
+
+// BenchmarkWorkflow runs the same cross-validation protocol on a number of
+// datasets, each in its own directory, and ranks the datasets in a
+// leaderboard
+type BenchmarkWorkflow struct {
+	*sp.Workflow
+	// Sweeps has the sweep dimensions of the process names, for collapsed
+	// workflow graphs
+	Sweeps *sweepgraph.Sweeps
+}
+
+// BenchmarkDataset is a dataset to include in a benchmark
+type BenchmarkDataset struct {
+	// Name is used for the directory and the process names of the dataset
+	Name string
+	// Source is an http:// or https:// URL, or a local path
+	Source string
+	// SHA256 is the hex-encoded SHA-256 checksum of the dataset, or empty to
+	// skip verification
+	SHA256 string
+}
+
+var datasetNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// readBenchmarkDatasets reads a list of datasets from a tab-separated file,
+// with the name, the source and optionally the SHA-256 checksum of a dataset
+// on each line. Lines starting with # are ignored.
+func readBenchmarkDatasets(path string) ([]BenchmarkDataset, error) {
+	datasets := []BenchmarkDataset{}
+	names := map[string]bool{}
+	err := mlcomp.ForEachLine(path, func(lineNo int, line string) error {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			return nil
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return fmt.Errorf("%s, line %d: expected name, source and optionally SHA-256 checksum", path, lineNo)
+		}
+		ds := BenchmarkDataset{Name: fields[0], Source: fields[1]}
+		if len(fields) == 3 {
+			ds.SHA256 = fields[2]
+		}
+		if !datasetNamePattern.MatchString(ds.Name) {
+			return fmt.Errorf("%s, line %d: invalid dataset name: %q", path, lineNo, ds.Name)
+		}
+		if names[ds.Name] {
+			return fmt.Errorf("%s, line %d: duplicate dataset name: %q", path, lineNo, ds.Name)
+		}
+		names[ds.Name] = true
+		datasets = append(datasets, ds)
+		return nil
+	})
+	return datasets, err
+}
+
+// NewBenchmarkWorkflow returns a workflow cross-validating models on every
+// dataset in datasets, with params as for NewCrossValidateWorkflow, except
+// for the dataset name, file, format and data directory. Results for a
+// dataset are written in data/[name]/.
+func NewBenchmarkWorkflow(maxTasks int, datasets []BenchmarkDataset, params CrossValidateWorkflowParams) *BenchmarkWorkflow {
+	wf := sp.NewWorkflow("benchmark", maxTasks)
+
+	sweeps := sweepgraph.New()
+	resultsSubstr := spcomp.NewStreamToSubStream(wf, "benchmark_results_substr")
+	for _, ds := range datasets {
+		dsDir := dataDir + ds.Name + "/"
+		fetch := mlcomp.NewFetchDataset(wf, "fetch_dataset_"+ds.Name, mlcomp.FetchDatasetConf{
+			Source: ds.Source,
+			SHA256: ds.SHA256,
+			Path:   dsDir + ds.Name + mlcomp.SourceExt(ds.Source),
+			Cache:  params.Downloads,
+		})
+
+		dsParams := params
+		dsParams.DatasetName = ds.Name
+		dsParams.DatasetFile = ""
+		dsParams.DatasetSource = ds.Source
+		dsParams.DataDir = dsDir
+		dsParams.DatasetLoad.Format = mlcomp.DatasetFormatFromPath(mlcomp.SourceExt(ds.Source))
+		crossVal := newCrossValidation(wf, dsParams, sweeps, fetch.OutDataset())
+		resultsSubstr.In().From(crossVal.results.Out("results"))
+	}
+
+	results := wf.NewProc("benchmark_results", "cat {i:results|join: } > {o:results}")
+	results.SetOut("results", fs("%s%s/benchmark_results.tsv", dataDir, params.RunID))
+	results.In("results").From(resultsSubstr.OutSubStream())
+
+	leaderboard := mlcomp.NewLeaderboard(wf, "leaderboard", mlcomp.LeaderboardConf{
+		Title: fs("Benchmark run %s, %d datasets", params.RunID, len(datasets)),
+	})
+	leaderboard.InResults().From(results.Out("results"))
+	return &BenchmarkWorkflow{wf, sweeps}
+}
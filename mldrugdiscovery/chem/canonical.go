@@ -0,0 +1,285 @@
+package chem
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CanonicalSMILES returns a SMILES string that is the same for all SMILES
+// strings describing the same molecular graph. Atoms are ranked by iterative
+// refinement of atom invariants over their neighbourhoods, with ties broken
+// arbitrarily, and the SMILES is then written with a depth first traversal in
+// rank order. Stereo information is not kept, and aromaticity is taken as
+// written, so that Kekulé and aromatic forms of the same ring system give
+// different canonical strings.
+func (m *Molecule) CanonicalSMILES() string {
+	ranks := m.canonicalRanks()
+	byRank := make([]int, len(m.Atoms))
+	for atomIdx, rank := range ranks {
+		byRank[rank] = atomIdx
+	}
+	w := &smilesWriter{
+		mol:       m,
+		ranks:     ranks,
+		visited:   make([]bool, len(m.Atoms)),
+		children:  make([][]int, len(m.Atoms)),
+		closures:  make([][]int, len(m.Atoms)),
+		isClosure: make([]bool, len(m.Bonds)),
+		ringNums:  map[int]int{},
+	}
+	parts := []string{}
+	for _, atomIdx := range byRank {
+		if w.visited[atomIdx] {
+			continue
+		}
+		w.traverse(atomIdx, -1)
+		var sb strings.Builder
+		w.write(&sb, atomIdx)
+		parts = append(parts, sb.String())
+	}
+	return strings.Join(parts, ".")
+}
+
+// canonicalRanks returns a unique rank, from 0 to the number of atoms - 1,
+// for each atom
+func (m *Molecule) canonicalRanks() []int {
+	keys := make([]string, len(m.Atoms))
+	for i, a := range m.Atoms {
+		keys[i] = fmt.Sprintf("%s|%t|%d|%d|%d|%d", a.Symbol, a.Aromatic, a.Charge, a.Isotope, a.HCount, len(m.atomBonds[i]))
+	}
+	ranks := m.refineRanks(denseRanks(keys))
+	for {
+		// Break the lowest tie, if any, by letting the first tied atom
+		// get a lower rank than the rest, and refine again
+		cnt := map[int]int{}
+		for _, r := range ranks {
+			cnt[r]++
+		}
+		tiedRank := -1
+		for r, c := range cnt {
+			if c > 1 && (tiedRank < 0 || r < tiedRank) {
+				tiedRank = r
+			}
+		}
+		if tiedRank < 0 {
+			return ranks
+		}
+		broken := false
+		for i := range ranks {
+			ranks[i] *= 2
+			if ranks[i] == 2*tiedRank && !broken {
+				ranks[i]--
+				broken = true
+			}
+		}
+		ranks = m.refineRanks(ranks)
+	}
+}
+
+// refineRanks iteratively refines ranks by the ranks of neighbouring atoms,
+// until the number of distinct ranks does not grow anymore
+func (m *Molecule) refineRanks(ranks []int) []int {
+	ranks = denseRanks(intKeys(ranks))
+	for {
+		distinct := countDistinct(ranks)
+		keys := make([]string, len(m.Atoms))
+		for i := range m.Atoms {
+			nbrs := []string{}
+			for _, bi := range m.atomBonds[i] {
+				bond := m.Bonds[bi]
+				nbrs = append(nbrs, fmt.Sprintf("%d:%08d", bond.Order, ranks[bond.Other(i)]))
+			}
+			sort.Strings(nbrs)
+			keys[i] = fmt.Sprintf("%08d|%s", ranks[i], strings.Join(nbrs, ","))
+		}
+		ranks = denseRanks(keys)
+		if countDistinct(ranks) == distinct {
+			return ranks
+		}
+	}
+}
+
+// denseRanks returns the rank of each key among the sorted distinct keys
+func denseRanks(keys []string) []int {
+	uniq := map[string]bool{}
+	for _, k := range keys {
+		uniq[k] = true
+	}
+	sorted := make([]string, 0, len(uniq))
+	for k := range uniq {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	rankOf := map[string]int{}
+	for i, k := range sorted {
+		rankOf[k] = i
+	}
+	ranks := make([]int, len(keys))
+	for i, k := range keys {
+		ranks[i] = rankOf[k]
+	}
+	return ranks
+}
+
+func intKeys(vals []int) []string {
+	// Offset by one, since tie breaking may produce rank -1
+	keys := make([]string, len(vals))
+	for i, v := range vals {
+		keys[i] = fmt.Sprintf("%08d", v+1)
+	}
+	return keys
+}
+
+func countDistinct(vals []int) int {
+	uniq := map[int]bool{}
+	for _, v := range vals {
+		uniq[v] = true
+	}
+	return len(uniq)
+}
+
+type smilesWriter struct {
+	mol       *Molecule
+	ranks     []int
+	visited   []bool
+	children  [][]int
+	closures  [][]int
+	isClosure []bool
+	ringNums  map[int]int
+}
+
+// sortedBonds returns the bonds of an atom, sorted on the rank of the atom at
+// the other end
+func (w *smilesWriter) sortedBonds(atomIdx int) []int {
+	bonds := append([]int{}, w.mol.atomBonds[atomIdx]...)
+	sort.Slice(bonds, func(i, j int) bool {
+		return w.ranks[w.mol.Bonds[bonds[i]].Other(atomIdx)] < w.ranks[w.mol.Bonds[bonds[j]].Other(atomIdx)]
+	})
+	return bonds
+}
+
+// traverse does the depth first traversal, recording tree bonds and ring
+// closure bonds, so that ring closure digits can be written at both ends
+func (w *smilesWriter) traverse(atomIdx int, parentBond int) {
+	w.visited[atomIdx] = true
+	for _, bi := range w.sortedBonds(atomIdx) {
+		if bi == parentBond || w.isClosure[bi] {
+			continue
+		}
+		other := w.mol.Bonds[bi].Other(atomIdx)
+		if w.visited[other] {
+			w.isClosure[bi] = true
+			w.closures[other] = append(w.closures[other], bi)
+			w.closures[atomIdx] = append(w.closures[atomIdx], bi)
+			continue
+		}
+		w.children[atomIdx] = append(w.children[atomIdx], bi)
+		w.traverse(other, bi)
+	}
+}
+
+func (w *smilesWriter) write(sb *strings.Builder, atomIdx int) {
+	sb.WriteString(w.mol.smilesAtom(atomIdx))
+	for _, bi := range w.closures[atomIdx] {
+		if num, ok := w.ringNums[bi]; ok {
+			sb.WriteString(ringNumStr(num))
+			delete(w.ringNums, bi)
+			continue
+		}
+		num := w.freeRingNum()
+		w.ringNums[bi] = num
+		sb.WriteString(w.mol.smilesBond(bi))
+		sb.WriteString(ringNumStr(num))
+	}
+	for i, bi := range w.children[atomIdx] {
+		last := i == len(w.children[atomIdx])-1
+		if !last {
+			sb.WriteString("(")
+		}
+		sb.WriteString(w.mol.smilesBond(bi))
+		w.write(sb, w.mol.Bonds[bi].Other(atomIdx))
+		if !last {
+			sb.WriteString(")")
+		}
+	}
+}
+
+func (w *smilesWriter) freeRingNum() int {
+	used := map[int]bool{}
+	for _, num := range w.ringNums {
+		used[num] = true
+	}
+	num := 1
+	for used[num] {
+		num++
+	}
+	return num
+}
+
+func ringNumStr(num int) string {
+	if num > 9 {
+		return fmt.Sprintf("%%%02d", num)
+	}
+	return fmt.Sprintf("%d", num)
+}
+
+func (m *Molecule) smilesBond(bondIdx int) string {
+	bond := m.Bonds[bondIdx]
+	bothAromatic := m.Atoms[bond.A].Aromatic && m.Atoms[bond.B].Aromatic
+	switch bond.Order {
+	case BondSingle:
+		if bothAromatic {
+			return "-"
+		}
+		return ""
+	case BondAromatic:
+		if bothAromatic {
+			return ""
+		}
+		return ":"
+	}
+	return bondSymbol(bond.Order)
+}
+
+func (m *Molecule) smilesAtom(atomIdx int) string {
+	atom := m.Atoms[atomIdx]
+	sym := atom.Symbol
+	if atom.Aromatic {
+		sym = strings.ToLower(sym)
+	}
+	_, organic := normalValences[atom.Symbol]
+	if atom.Symbol == "*" {
+		organic = true
+	}
+	if organic && (!atom.Aromatic || len(sym) == 1) && atom.Charge == 0 && atom.Isotope == 0 &&
+		atom.Class == 0 && atom.HCount == m.implicitHydrogens(atomIdx) {
+		return sym
+	}
+	var sb strings.Builder
+	sb.WriteString("[")
+	if atom.Isotope > 0 {
+		fmt.Fprintf(&sb, "%d", atom.Isotope)
+	}
+	sb.WriteString(sym)
+	if atom.HCount == 1 {
+		sb.WriteString("H")
+	} else if atom.HCount > 1 {
+		fmt.Fprintf(&sb, "H%d", atom.HCount)
+	}
+	switch {
+	case atom.Charge == 1:
+		sb.WriteString("+")
+	case atom.Charge == -1:
+		sb.WriteString("-")
+	case atom.Charge > 1:
+		fmt.Fprintf(&sb, "+%d", atom.Charge)
+	case atom.Charge < -1:
+		fmt.Fprintf(&sb, "%d", atom.Charge)
+	}
+	if atom.Class > 0 {
+		fmt.Fprintf(&sb, ":%d", atom.Class)
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
@@ -0,0 +1,61 @@
+package chem
+
+import (
+	"testing"
+)
+
+func TestCanonicalSMILES(t *testing.T) {
+	for _, equivalent := range [][]string{
+		{"CCO", "OCC", "C(O)C"},
+		{"OC(=O)c1ccccc1N", "Nc1ccccc1C(O)=O", "c1ccc(N)c(C(=O)O)c1"},
+		{"C1CC2CCC1CC2", "C1CC2CCC1CC2", "C2CC1CCC2CC1"},
+		{"c1cc[nH]c1", "[nH]1cccc1"},
+		{"[NH4+].[Cl-]", "[Cl-].[NH4+]"},
+		{"CC(C)(C)C", "C(C)(C)(C)C"},
+		{"C%10CCCCC%10", "C1CCCCC1"},
+	} {
+		expected := mustCanonical(t, equivalent[0])
+		for _, smiles := range equivalent[1:] {
+			if actual := mustCanonical(t, smiles); actual != expected {
+				t.Errorf("Different canonical SMILES for %s and %s:\n%s\n%s\n", equivalent[0], smiles, expected, actual)
+			}
+		}
+		// The canonical SMILES should parse back to itself
+		if again := mustCanonical(t, expected); again != expected {
+			t.Errorf("Canonical SMILES %s is not stable, got %s", expected, again)
+		}
+	}
+	if mustCanonical(t, "CCO") == mustCanonical(t, "COC") {
+		t.Errorf("Expected different canonical SMILES for different molecules")
+	}
+}
+
+func TestStripSalts(t *testing.T) {
+	for smiles, expected := range map[string]struct {
+		smiles  string
+		removed int
+	}{
+		"CC(=O)[O-].[Na+]":      {"CC(=O)[O-]", 1},
+		"[Cl-].c1ccccc1C[NH3+]": {"c1ccccc1C[NH3+]", 1},
+		"CCO":                   {"CCO", 0},
+		"O.O.CCN(CC)CC.Cl":      {"CCN(CC)CC", 3},
+	} {
+		mol, err := ParseSMILES(smiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stripped, removed := StripSalts(mol)
+		if stripped.CanonicalSMILES() != mustCanonical(t, expected.smiles) || removed != expected.removed {
+			t.Errorf("Wrong salt stripping of %s: got %s (%d removed), expected %s (%d removed)",
+				smiles, stripped.CanonicalSMILES(), removed, expected.smiles, expected.removed)
+		}
+	}
+}
+
+func mustCanonical(t *testing.T, smiles string) string {
+	mol, err := ParseSMILES(smiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mol.CanonicalSMILES()
+}
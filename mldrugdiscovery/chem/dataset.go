@@ -0,0 +1,176 @@
+package chem
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ------------------------------------------------------------------------
+// Signature records
+// ------------------------------------------------------------------------
+
+// SignatureRecord is one line in a signatures file: a molecule, its response
+// value and the counts of its atom environments. On file it is stored as
+// tab-separated fields:
+//
+//	SMILES <tab> response <tab> signature count <tab> signature count ...
+type SignatureRecord struct {
+	SMILES     string
+	Response   string
+	Signatures map[string]int
+}
+
+// String formats the record as a line (without newline) in a signatures file,
+// with signatures sorted for reproducible output
+func (r SignatureRecord) String() string {
+	sigs := make([]string, 0, len(r.Signatures))
+	for sig := range r.Signatures {
+		sigs = append(sigs, sig)
+	}
+	sort.Strings(sigs)
+	fields := []string{r.SMILES, r.Response}
+	for _, sig := range sigs {
+		fields = append(fields, sig+" "+strconv.Itoa(r.Signatures[sig]))
+	}
+	return strings.Join(fields, "\t")
+}
+
+// ParseSignatureRecord parses a line in a signatures file
+func ParseSignatureRecord(line string) (SignatureRecord, error) {
+	fields := strings.Split(strings.TrimRight(line, "\r\n"), "\t")
+	if len(fields) < 2 {
+		return SignatureRecord{}, fmt.Errorf("signature record needs at least SMILES and response, got: %q", line)
+	}
+	rec := SignatureRecord{SMILES: fields[0], Response: fields[1], Signatures: map[string]int{}}
+	for _, field := range fields[2:] {
+		sepIdx := strings.LastIndexByte(field, ' ')
+		if sepIdx < 0 {
+			return rec, fmt.Errorf("signature field without count: %q", field)
+		}
+		cnt, err := strconv.Atoi(field[sepIdx+1:])
+		if err != nil {
+			return rec, fmt.Errorf("invalid signature count in field %q: %v", field, err)
+		}
+		rec.Signatures[field[:sepIdx]] += cnt
+	}
+	return rec, nil
+}
+
+// ------------------------------------------------------------------------
+// Sparse datasets
+// ------------------------------------------------------------------------
+
+// Vocabulary maps signatures to (1-based) columns in a sparse dataset. On
+// file, it is stored with one "column <tab> signature" pair per line.
+type Vocabulary struct {
+	columns    map[string]int
+	signatures []string
+}
+
+// NewVocabulary returns an empty Vocabulary
+func NewVocabulary() *Vocabulary {
+	return &Vocabulary{columns: map[string]int{}}
+}
+
+// Len returns the number of signatures in the vocabulary
+func (v *Vocabulary) Len() int {
+	return len(v.signatures)
+}
+
+// Column returns the column for a signature, and whether it was found
+func (v *Vocabulary) Column(sig string) (int, bool) {
+	col, ok := v.columns[sig]
+	return col, ok
+}
+
+// Signature returns the signature for a (1-based) column
+func (v *Vocabulary) Signature(col int) (string, bool) {
+	if col < 1 || col > len(v.signatures) {
+		return "", false
+	}
+	return v.signatures[col-1], true
+}
+
+// Add adds a signature, if not already existing, and returns its column
+func (v *Vocabulary) Add(sig string) int {
+	if col, ok := v.columns[sig]; ok {
+		return col
+	}
+	v.signatures = append(v.signatures, sig)
+	v.columns[sig] = len(v.signatures)
+	return len(v.signatures)
+}
+
+// Write writes the vocabulary in column order
+func (v *Vocabulary) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for i, sig := range v.signatures {
+		if _, err := fmt.Fprintf(bw, "%d\t%s\n", i+1, sig); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadVocabulary reads a vocabulary written by Vocabulary.Write. Lines with
+// only a signature are also accepted, in which case the line number is taken
+// as the column.
+func ReadVocabulary(r io.Reader) (*Vocabulary, error) {
+	v := NewVocabulary()
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		sig := line
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) == 2 {
+			if col, err := strconv.Atoi(parts[0]); err == nil {
+				if col != v.Len()+1 {
+					return nil, fmt.Errorf("vocabulary line %d: expected column %d, got %d", lineNo, v.Len()+1, col)
+				}
+				sig = parts[1]
+			}
+		}
+		v.Add(sig)
+	}
+	return v, sc.Err()
+}
+
+// SparseRow formats a signature record as a row in the sparse (LIBLINEAR /
+// SVMLight) format, "response col:count col:count ...", with columns in
+// ascending order. If grow is true, signatures not in the vocabulary are
+// added to it, otherwise they are skipped, as is needed for test data.
+func SparseRow(rec SignatureRecord, voc *Vocabulary, grow bool) string {
+	sigs := make([]string, 0, len(rec.Signatures))
+	for sig := range rec.Signatures {
+		sigs = append(sigs, sig)
+	}
+	// Sort for deterministic column assignment when growing the vocabulary
+	sort.Strings(sigs)
+	type colCnt struct{ col, cnt int }
+	cols := []colCnt{}
+	for _, sig := range sigs {
+		col, ok := voc.Column(sig)
+		if !ok {
+			if !grow {
+				continue
+			}
+			col = voc.Add(sig)
+		}
+		cols = append(cols, colCnt{col, rec.Signatures[sig]})
+	}
+	sort.Slice(cols, func(i, j int) bool { return cols[i].col < cols[j].col })
+	var sb strings.Builder
+	sb.WriteString(rec.Response)
+	for _, cc := range cols {
+		fmt.Fprintf(&sb, " %d:%d", cc.col, cc.cnt)
+	}
+	return sb.String()
+}
@@ -0,0 +1,256 @@
+package chem
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SDFRecord is one record in an SD file: a molecule with its data items
+type SDFRecord struct {
+	Title string
+	// Mol is nil if the molecule block could not be parsed, in which case
+	// MolErr holds the reason
+	Mol    *Molecule
+	MolErr error
+	Props  map[string]string
+}
+
+// SDFReader reads records from SD files with V2000 molecule blocks
+type SDFReader struct {
+	sc     *bufio.Scanner
+	lineNo int
+}
+
+// NewSDFReader returns a new SDFReader
+func NewSDFReader(r io.Reader) *SDFReader {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	return &SDFReader{sc: sc}
+}
+
+// Next returns the next record, or io.EOF when there are no more records.
+// Errors in the molecule block do not stop reading, but are reported in
+// the MolErr field of the record.
+func (r *SDFReader) Next() (SDFRecord, error) {
+	molLines := []string{}
+	for {
+		line, ok := r.scan()
+		if !ok {
+			if err := r.sc.Err(); err != nil {
+				return SDFRecord{}, err
+			}
+			if len(molLines) > 0 && strings.TrimSpace(strings.Join(molLines, "")) != "" {
+				return SDFRecord{}, fmt.Errorf("unexpected end of file in record ending at line %d", r.lineNo)
+			}
+			return SDFRecord{}, io.EOF
+		}
+		molLines = append(molLines, line)
+		if strings.HasPrefix(line, "M  END") {
+			break
+		}
+		if strings.HasPrefix(line, "$$$$") {
+			// Record without M  END, which we can not parse
+			return SDFRecord{Title: molLines[0], MolErr: fmt.Errorf("missing M  END before line %d", r.lineNo), Props: map[string]string{}}, nil
+		}
+	}
+	rec := SDFRecord{Title: strings.TrimSpace(molLines[0]), Props: map[string]string{}}
+	rec.Mol, rec.MolErr = ParseMolBlock(strings.Join(molLines, "\n"))
+
+	// Data items
+	propName := ""
+	for {
+		line, ok := r.scan()
+		if !ok || strings.HasPrefix(line, "$$$$") {
+			return rec, r.sc.Err()
+		}
+		switch {
+		case strings.HasPrefix(line, ">"):
+			start := strings.Index(line, "<")
+			end := strings.LastIndex(line, ">")
+			if start < 0 || end < start {
+				return rec, fmt.Errorf("invalid data header on line %d: %q", r.lineNo, line)
+			}
+			propName = line[start+1 : end]
+		case strings.TrimSpace(line) == "":
+			propName = ""
+		case propName != "":
+			if val, ok := rec.Props[propName]; ok {
+				rec.Props[propName] = val + "\n" + line
+			} else {
+				rec.Props[propName] = line
+			}
+		}
+	}
+}
+
+func (r *SDFReader) scan() (string, bool) {
+	if !r.sc.Scan() {
+		return "", false
+	}
+	r.lineNo++
+	return strings.TrimRight(r.sc.Text(), "\r"), true
+}
+
+// molfileCharges maps the charge codes in the atom block to charges
+var molfileCharges = map[int]int{0: 0, 1: 3, 2: 2, 3: 1, 4: 0, 5: -1, 6: -2, 7: -3}
+
+// ParseMolBlock parses a V2000 molecule block (MDL molfile). Explicit
+// hydrogen atoms are turned into hydrogen counts on their neighbours, and
+// implicit hydrogens are added for organic subset atoms.
+func ParseMolBlock(block string) (*Molecule, error) {
+	lines := strings.Split(block, "\n")
+	if len(lines) < 4 {
+		return nil, fmt.Errorf("molecule block too short")
+	}
+	counts := lines[3]
+	if strings.Contains(counts, "V3000") {
+		return nil, fmt.Errorf("V3000 molecule blocks are not supported")
+	}
+	atomCnt, err1 := strconv.Atoi(strings.TrimSpace(fixedField(counts, 0, 3)))
+	bondCnt, err2 := strconv.Atoi(strings.TrimSpace(fixedField(counts, 3, 6)))
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("invalid counts line: %q", counts)
+	}
+	if len(lines) < 4+atomCnt+bondCnt {
+		return nil, fmt.Errorf("molecule block has fewer lines than the %d atoms and %d bonds in the counts line", atomCnt, bondCnt)
+	}
+
+	all := &Molecule{}
+	for i := 0; i < atomCnt; i++ {
+		fields := strings.Fields(lines[4+i])
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("invalid atom line %d: %q", i+1, lines[4+i])
+		}
+		atom := Atom{Symbol: fields[3]}
+		if !elements[atom.Symbol] && atom.Symbol != "*" {
+			return nil, fmt.Errorf("unknown element on atom line %d: %s", i+1, atom.Symbol)
+		}
+		if len(fields) >= 6 {
+			code, err := strconv.Atoi(fields[5])
+			if err != nil {
+				return nil, fmt.Errorf("invalid charge on atom line %d: %v", i+1, err)
+			}
+			atom.Charge = molfileCharges[code]
+		}
+		all.addAtom(atom)
+	}
+	for i := 0; i < bondCnt; i++ {
+		line := lines[4+atomCnt+i]
+		a, errA := strconv.Atoi(strings.TrimSpace(fixedField(line, 0, 3)))
+		b, errB := strconv.Atoi(strings.TrimSpace(fixedField(line, 3, 6)))
+		typ, errT := strconv.Atoi(strings.TrimSpace(fixedField(line, 6, 9)))
+		if errA != nil || errB != nil || errT != nil || a < 1 || b < 1 || a > atomCnt || b > atomCnt {
+			return nil, fmt.Errorf("invalid bond line %d: %q", i+1, line)
+		}
+		order := map[int]BondOrder{1: BondSingle, 2: BondDouble, 3: BondTriple, 4: BondAromatic}[typ]
+		if order == 0 {
+			return nil, fmt.Errorf("unsupported bond type %d on bond line %d", typ, i+1)
+		}
+		if order == BondAromatic {
+			all.Atoms[a-1].Aromatic = true
+			all.Atoms[b-1].Aromatic = true
+		}
+		if err := all.addBond(a-1, b-1, order); err != nil {
+			return nil, fmt.Errorf("bond line %d: %v", i+1, err)
+		}
+	}
+	// Properties block. Charge and isotope properties override the atom block.
+	chargesReset, isotopesReset := false, false
+	for _, line := range lines[4+atomCnt+bondCnt:] {
+		if strings.HasPrefix(line, "M  END") {
+			break
+		}
+		if !strings.HasPrefix(line, "M  CHG") && !strings.HasPrefix(line, "M  ISO") {
+			continue
+		}
+		fields := strings.Fields(line)
+		for j := 3; j+1 < len(fields); j += 2 {
+			atomNo, errA := strconv.Atoi(fields[j])
+			val, errV := strconv.Atoi(fields[j+1])
+			if errA != nil || errV != nil || atomNo < 1 || atomNo > atomCnt {
+				return nil, fmt.Errorf("invalid property line: %q", line)
+			}
+			if fields[1] == "CHG" {
+				if !chargesReset {
+					for k := range all.Atoms {
+						all.Atoms[k].Charge = 0
+					}
+					chargesReset = true
+				}
+				all.Atoms[atomNo-1].Charge = val
+			} else {
+				if !isotopesReset {
+					for k := range all.Atoms {
+						all.Atoms[k].Isotope = 0
+					}
+					isotopesReset = true
+				}
+				all.Atoms[atomNo-1].Isotope = val
+			}
+		}
+	}
+
+	// Turn explicit hydrogens into hydrogen counts, keeping hydrogens that
+	// are charged, isotopes, or not bonded to exactly one heavy atom
+	keep := []int{}
+	explicitH := make([]int, atomCnt)
+	for i, atom := range all.Atoms {
+		if atom.Symbol == "H" && atom.Charge == 0 && atom.Isotope == 0 && len(all.atomBonds[i]) == 1 {
+			bond := all.Bonds[all.atomBonds[i][0]]
+			other := bond.Other(i)
+			if all.Atoms[other].Symbol != "H" && bond.Order == BondSingle {
+				explicitH[other]++
+				continue
+			}
+		}
+		keep = append(keep, i)
+	}
+	mol := all.SubMolecule(keep)
+	for newIdx, oldIdx := range keep {
+		atom := &mol.Atoms[newIdx]
+		valences := chargedValences(atom.Symbol, atom.Charge)
+		atom.HCount = explicitH[oldIdx] + implicitHydrogens(valences, mol.bondOrderSum(newIdx)+explicitH[oldIdx], atom.Aromatic)
+	}
+	return mol, nil
+}
+
+// chargedValences returns the normal valences of an element, adjusted for
+// the charge of the atom
+func chargedValences(symbol string, charge int) []int {
+	valences := normalValences[symbol]
+	if charge == 0 {
+		return valences
+	}
+	delta := charge
+	switch symbol {
+	case "C":
+		// Both carbocations and carbanions have valence 3
+		if charge > 0 {
+			delta = -charge
+		}
+	case "B":
+		delta = -charge
+	}
+	adjusted := []int{}
+	for _, v := range valences {
+		if v+delta >= 0 {
+			adjusted = append(adjusted, v+delta)
+		}
+	}
+	return adjusted
+}
+
+// fixedField returns the characters from start to end in a fixed width
+// line, or as many of them as exist
+func fixedField(line string, start, end int) string {
+	if start >= len(line) {
+		return ""
+	}
+	if end > len(line) {
+		end = len(line)
+	}
+	return line[start:end]
+}
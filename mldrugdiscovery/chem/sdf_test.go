@@ -0,0 +1,79 @@
+package chem
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+const testSDF = `ethanol
+  test
+
+  3  2  0  0  0  0  0  0  0  0999 V2000
+    0.0000    0.0000    0.0000 C   0  0  0  0  0  0  0  0  0  0  0  0
+    1.0000    0.0000    0.0000 C   0  0  0  0  0  0  0  0  0  0  0  0
+    2.0000    0.0000    0.0000 O   0  0  0  0  0  0  0  0  0  0  0  0
+  1  2  1  0
+  2  3  1  0
+M  END
+> <IC50_nM>
+100
+
+> <ID>
+CHEMBL545
+
+$$$$
+ammonium
+  test
+
+  2  1  0  0  0  0  0  0  0  0999 V2000
+    0.0000    0.0000    0.0000 N   0  3  0  0  0  0  0  0  0  0  0  0
+    1.0000    0.0000    0.0000 H   0  0  0  0  0  0  0  0  0  0  0  0
+  1  2  1  0
+M  CHG  1   1   1
+M  END
+> <IC50_nM>
+5
+
+$$$$
+broken
+  test
+
+  2  1  0  0  0  0  0  0  0  0999 V2000
+    0.0000    0.0000    0.0000 C   0  0  0  0  0  0  0  0  0  0  0  0
+  1  2  1  0
+M  END
+$$$$
+`
+
+func TestSDFReader(t *testing.T) {
+	r := NewSDFReader(strings.NewReader(testSDF))
+
+	rec, err := r.Next()
+	if err != nil || rec.MolErr != nil {
+		t.Fatalf("Could not read first record: %v, %v", err, rec.MolErr)
+	}
+	if rec.Title != "ethanol" || rec.Props["IC50_nM"] != "100" || rec.Props["ID"] != "CHEMBL545" {
+		t.Errorf("Wrong title or properties: %s, %v", rec.Title, rec.Props)
+	}
+	if rec.Mol.CanonicalSMILES() != mustCanonical(t, "CCO") {
+		t.Errorf("Wrong molecule: %s", rec.Mol.CanonicalSMILES())
+	}
+
+	rec, err = r.Next()
+	if err != nil || rec.MolErr != nil {
+		t.Fatalf("Could not read second record: %v, %v", err, rec.MolErr)
+	}
+	if rec.Mol.CanonicalSMILES() != mustCanonical(t, "[NH4+]") {
+		t.Errorf("Wrong molecule for charged atom with explicit hydrogen: %s", rec.Mol.CanonicalSMILES())
+	}
+
+	rec, err = r.Next()
+	if err != nil || rec.MolErr == nil {
+		t.Errorf("Expected molecule error, but not reading error, for broken record: %v, %v", err, rec.MolErr)
+	}
+
+	if _, err = r.Next(); err != io.EOF {
+		t.Errorf("Expected EOF after last record, got: %v", err)
+	}
+}
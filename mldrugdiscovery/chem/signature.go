@@ -0,0 +1,244 @@
+package chem
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// FingerprintType selects the kind of circular atom environments generated
+type FingerprintType string
+
+const (
+	// FingerprintSignature generates canonical, human readable strings
+	// describing the atom environment, in the spirit of molecular signatures
+	FingerprintSignature FingerprintType = "sign"
+	// FingerprintECFP generates hashed, ECFP-style (Morgan) identifiers
+	FingerprintECFP FingerprintType = "ecfp"
+)
+
+// FingerprintConf contains parameters for generating circular atom environments
+type FingerprintConf struct {
+	Type FingerprintType
+	// MinHeight and MaxHeight give the (inclusive) range of heights for
+	// signatures, which is the same as the radius range for ECFP
+	MinHeight int
+	MaxHeight int
+}
+
+// Fingerprint returns the circular atom environments, with their counts, for
+// all atoms in the molecule and for all heights in the configured range
+func Fingerprint(m *Molecule, conf FingerprintConf) (map[string]int, error) {
+	atomFeatures, err := AtomFingerprints(m, conf)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, features := range atomFeatures {
+		for _, feature := range features {
+			counts[feature]++
+		}
+	}
+	return counts, nil
+}
+
+// AtomFingerprints returns, for each atom, the circular atom environments
+// rooted at that atom, for all heights in the configured range
+func AtomFingerprints(m *Molecule, conf FingerprintConf) ([][]string, error) {
+	if conf.MinHeight < 0 || conf.MaxHeight < conf.MinHeight {
+		return nil, fmt.Errorf("invalid height range %d-%d", conf.MinHeight, conf.MaxHeight)
+	}
+	switch conf.Type {
+	case FingerprintSignature, "":
+		return signatures(m, conf.MinHeight, conf.MaxHeight), nil
+	case FingerprintECFP:
+		return ecfp(m, conf.MinHeight, conf.MaxHeight), nil
+	}
+	return nil, fmt.Errorf("unknown fingerprint type: %s", conf.Type)
+}
+
+// ------------------------------------------------------------------------
+// Signatures
+// ------------------------------------------------------------------------
+
+func signatures(m *Molecule, minHeight, maxHeight int) [][]string {
+	atomSigs := make([][]string, len(m.Atoms))
+	for atomIdx := range m.Atoms {
+		for h := minHeight; h <= maxHeight; h++ {
+			atomSigs[atomIdx] = append(atomSigs[atomIdx], m.AtomSignature(atomIdx, h))
+		}
+	}
+	return atomSigs
+}
+
+// AtomSignature returns a canonical string describing the environment of
+// atom atomIdx, up to height bonds away. The environment is unfolded into a
+// tree rooted at the atom, where the children of every node are sorted, so
+// that equivalent environments always give the same string.
+func (m *Molecule) AtomSignature(atomIdx int, height int) string {
+	return m.signatureTree(atomIdx, -1, height)
+}
+
+func (m *Molecule) signatureTree(atomIdx int, parentBond int, height int) string {
+	label := m.atomLabel(atomIdx)
+	if height == 0 {
+		return label
+	}
+	children := []string{}
+	for _, bi := range m.atomBonds[atomIdx] {
+		if bi == parentBond {
+			continue
+		}
+		bond := m.Bonds[bi]
+		children = append(children, bondSymbol(bond.Order)+m.signatureTree(bond.Other(atomIdx), bi, height-1))
+	}
+	if len(children) == 0 {
+		return label
+	}
+	sort.Strings(children)
+	return label + "(" + strings.Join(children, "") + ")"
+}
+
+func (m *Molecule) atomLabel(atomIdx int) string {
+	atom := m.Atoms[atomIdx]
+	sym := atom.Symbol
+	if atom.Aromatic {
+		sym = strings.ToLower(sym)
+	}
+	switch {
+	case atom.Charge == 1:
+		sym += "+"
+	case atom.Charge == -1:
+		sym += "-"
+	case atom.Charge > 1:
+		sym += fmt.Sprintf("+%d", atom.Charge)
+	case atom.Charge < -1:
+		sym += fmt.Sprintf("%d", atom.Charge)
+	}
+	return "[" + sym + "]"
+}
+
+func bondSymbol(order BondOrder) string {
+	switch order {
+	case BondDouble:
+		return "="
+	case BondTriple:
+		return "#"
+	case BondQuadruple:
+		return "$"
+	case BondAromatic:
+		return ":"
+	}
+	return ""
+}
+
+// ------------------------------------------------------------------------
+// ECFP
+// ------------------------------------------------------------------------
+
+func ecfp(m *Molecule, minRadius, maxRadius int) [][]string {
+	ringBonds := m.RingBonds()
+	ids := make([]uint32, len(m.Atoms))
+	for i, atom := range m.Atoms {
+		inRing := 0
+		for _, bi := range m.atomBonds[i] {
+			if ringBonds[bi] {
+				inRing = 1
+				break
+			}
+		}
+		aromatic := 0
+		if atom.Aromatic {
+			aromatic = 1
+		}
+		ids[i] = hashInts(hashString(atom.Symbol), len(m.atomBonds[i]), atom.HCount, atom.Charge, atom.Isotope, inRing, aromatic)
+	}
+
+	atomIDs := make([][]string, len(m.Atoms))
+	for r := 0; r <= maxRadius; r++ {
+		if r > 0 {
+			next := make([]uint32, len(ids))
+			for i := range m.Atoms {
+				nbrs := [][2]int{}
+				for _, bi := range m.atomBonds[i] {
+					bond := m.Bonds[bi]
+					nbrs = append(nbrs, [2]int{int(bond.Order), int(ids[bond.Other(i)])})
+				}
+				sort.Slice(nbrs, func(a, b int) bool {
+					if nbrs[a][0] != nbrs[b][0] {
+						return nbrs[a][0] < nbrs[b][0]
+					}
+					return nbrs[a][1] < nbrs[b][1]
+				})
+				vals := []int{r, int(ids[i])}
+				for _, nbr := range nbrs {
+					vals = append(vals, nbr[0], nbr[1])
+				}
+				next[i] = hashInts(vals...)
+			}
+			ids = next
+		}
+		if r >= minRadius {
+			for i, id := range ids {
+				atomIDs[i] = append(atomIDs[i], fmt.Sprintf("%08x", id))
+			}
+		}
+	}
+	return atomIDs
+}
+
+func hashString(s string) int {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return int(h.Sum32())
+}
+
+func hashInts(vals ...int) uint32 {
+	h := fnv.New32a()
+	for _, v := range vals {
+		h.Write([]byte(fmt.Sprintf("%d,", v)))
+	}
+	return h.Sum32()
+}
+
+// RingBonds returns, for each bond index, whether the bond is part of a ring.
+// Bonds not part of any ring are exactly the bridges of the molecular graph.
+func (m *Molecule) RingBonds() []bool {
+	inRing := make([]bool, len(m.Bonds))
+	for i := range inRing {
+		inRing[i] = true
+	}
+	disc := make([]int, len(m.Atoms))
+	low := make([]int, len(m.Atoms))
+	time := 0
+	var visit func(atomIdx, parentBond int)
+	visit = func(atomIdx, parentBond int) {
+		time++
+		disc[atomIdx] = time
+		low[atomIdx] = time
+		for _, bi := range m.atomBonds[atomIdx] {
+			if bi == parentBond {
+				continue
+			}
+			nbr := m.Bonds[bi].Other(atomIdx)
+			if disc[nbr] == 0 {
+				visit(nbr, bi)
+				if low[nbr] < low[atomIdx] {
+					low[atomIdx] = low[nbr]
+				}
+				if low[nbr] > disc[atomIdx] {
+					inRing[bi] = false
+				}
+			} else if disc[nbr] < low[atomIdx] {
+				low[atomIdx] = disc[nbr]
+			}
+		}
+	}
+	for i := range m.Atoms {
+		if disc[i] == 0 {
+			visit(i, -1)
+		}
+	}
+	return inRing
+}
@@ -0,0 +1,97 @@
+package chem
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAtomSignature(t *testing.T) {
+	mol, err := ParseSMILES("CC(=O)O")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for height, expected := range map[int]string{
+		0: "[C]",
+		1: "[C]([C])",
+		2: "[C]([C](=[O][O]))",
+	} {
+		actual := mol.AtomSignature(0, height)
+		if actual != expected {
+			t.Errorf("Wrong signature for height %d:\nEXPECTED: %s\nACTUAL: %s\n", height, expected, actual)
+		}
+	}
+}
+
+func TestFingerprintIsCanonical(t *testing.T) {
+	for _, fpType := range []FingerprintType{FingerprintSignature, FingerprintECFP} {
+		conf := FingerprintConf{Type: fpType, MinHeight: 0, MaxHeight: 3}
+		fp1 := mustFingerprint(t, "OC(=O)c1ccccc1N", conf)
+		fp2 := mustFingerprint(t, "Nc1ccccc1C(O)=O", conf)
+		if len(fp1) != len(fp2) {
+			t.Fatalf("%s: different number of features for equivalent SMILES: %d vs %d", fpType, len(fp1), len(fp2))
+		}
+		for feature, cnt := range fp1 {
+			if fp2[feature] != cnt {
+				t.Errorf("%s: feature %s has count %d and %d for equivalent SMILES", fpType, feature, cnt, fp2[feature])
+			}
+		}
+	}
+}
+
+func TestFingerprintHeights(t *testing.T) {
+	fp := mustFingerprint(t, "CCO", FingerprintConf{Type: FingerprintSignature, MinHeight: 1, MaxHeight: 2})
+	total := 0
+	for sig, cnt := range fp {
+		if !strings.Contains(sig, "(") {
+			t.Errorf("Did not expect height 0 signature %s, for min height 1", sig)
+		}
+		total += cnt
+	}
+	if total != 6 {
+		t.Errorf("Expected 6 signatures (3 atoms, 2 heights), got %d", total)
+	}
+	if _, err := Fingerprint(&Molecule{}, FingerprintConf{MinHeight: 2, MaxHeight: 1}); err == nil {
+		t.Errorf("Expected error for invalid height range")
+	}
+}
+
+func TestRingBonds(t *testing.T) {
+	mol, err := ParseSMILES("CC1CC1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []bool{false, true, true, true}
+	for i, inRing := range mol.RingBonds() {
+		if inRing != expected[i] {
+			t.Errorf("Wrong ring membership for bond %d: expected %v", i, expected[i])
+		}
+	}
+}
+
+func TestSparseRow(t *testing.T) {
+	voc := NewVocabulary()
+	rec := SignatureRecord{SMILES: "CC", Response: "1.5", Signatures: map[string]int{"[C]": 2, "[C]([C])": 2}}
+	if row := SparseRow(rec, voc, true); row != "1.5 1:2 2:2" {
+		t.Errorf("Wrong sparse train row: %s", row)
+	}
+	rec = SignatureRecord{SMILES: "CO", Response: "-1", Signatures: map[string]int{"[C]": 1, "[O]": 1}}
+	if row := SparseRow(rec, voc, false); row != "-1 1:1" {
+		t.Errorf("Wrong sparse test row: %s", row)
+	}
+	parsed, err := ParseSignatureRecord(rec.String())
+	if err != nil || parsed.Signatures["[O]"] != 1 || parsed.Response != "-1" {
+		t.Errorf("Signature record did not survive a round trip: %+v, %v", parsed, err)
+	}
+}
+
+func mustFingerprint(t *testing.T, smiles string, conf FingerprintConf) map[string]int {
+	mol, err := ParseSMILES(smiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp, err := Fingerprint(mol, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fp
+}
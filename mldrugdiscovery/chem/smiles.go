@@ -0,0 +1,487 @@
+// Package chem contains a small, dependency free SMILES parser and generators
+// for height-bounded circular atom environments (signature-like strings, and
+// ECFP-style identifiers), together with readers and writers for the
+// signature and sparse dataset files used by the drug discovery workflow.
+// It is meant as a pure Go alternative to the GenerateSignatures.jar and
+// CreateSparseDataset.jar tools, so that the workflow can run without Java.
+package chem
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BondOrder is the order (or type) of a bond between two atoms
+type BondOrder int
+
+const (
+	BondSingle    BondOrder = 1
+	BondDouble    BondOrder = 2
+	BondTriple    BondOrder = 3
+	BondQuadruple BondOrder = 4
+	BondAromatic  BondOrder = 5
+)
+
+// Atom is an atom in a Molecule
+type Atom struct {
+	Symbol   string
+	Aromatic bool
+	Bracket  bool
+	Isotope  int
+	Charge   int
+	HCount   int
+	Class    int
+}
+
+// Bond connects the atoms with index A and B in a Molecule
+type Bond struct {
+	A     int
+	B     int
+	Order BondOrder
+}
+
+// Other returns the index of the atom at the other end of the bond
+func (b Bond) Other(atomIdx int) int {
+	if b.A == atomIdx {
+		return b.B
+	}
+	return b.A
+}
+
+// Molecule is a molecular graph, as parsed from a SMILES string
+type Molecule struct {
+	Atoms []Atom
+	Bonds []Bond
+	// atomBonds holds, for each atom, the indices of the bonds it takes part in
+	atomBonds [][]int
+}
+
+// AtomBonds returns the indices of the bonds connected to atom atomIdx
+func (m *Molecule) AtomBonds(atomIdx int) []int {
+	return m.atomBonds[atomIdx]
+}
+
+// HeavyDegree returns the number of explicit (non-hydrogen) neighbours of
+// atom atomIdx
+func (m *Molecule) HeavyDegree(atomIdx int) int {
+	return len(m.atomBonds[atomIdx])
+}
+
+func (m *Molecule) addAtom(a Atom) int {
+	m.Atoms = append(m.Atoms, a)
+	m.atomBonds = append(m.atomBonds, []int{})
+	return len(m.Atoms) - 1
+}
+
+func (m *Molecule) addBond(a, b int, order BondOrder) error {
+	if a == b {
+		return fmt.Errorf("atom %d can not be bonded to itself", a)
+	}
+	for _, bi := range m.atomBonds[a] {
+		if m.Bonds[bi].Other(a) == b {
+			return fmt.Errorf("atoms %d and %d are bonded more than once", a, b)
+		}
+	}
+	m.Bonds = append(m.Bonds, Bond{A: a, B: b, Order: order})
+	bi := len(m.Bonds) - 1
+	m.atomBonds[a] = append(m.atomBonds[a], bi)
+	m.atomBonds[b] = append(m.atomBonds[b], bi)
+	return nil
+}
+
+// elements lists all element symbols allowed inside bracket atoms
+var elements = map[string]bool{}
+
+func init() {
+	for _, sym := range strings.Fields(`H He Li Be B C N O F Ne Na Mg Al Si P S Cl Ar
+		K Ca Sc Ti V Cr Mn Fe Co Ni Cu Zn Ga Ge As Se Br Kr Rb Sr Y Zr Nb Mo Tc Ru
+		Rh Pd Ag Cd In Sn Sb Te I Xe Cs Ba La Ce Pr Nd Pm Sm Eu Gd Tb Dy Ho Er Tm
+		Yb Lu Hf Ta W Re Os Ir Pt Au Hg Tl Pb Bi Po At Rn Fr Ra Ac Th Pa U Np Pu Am
+		Cm Bk Cf Es Fm Md No Lr Rf Db Sg Bh Hs Mt Ds Rg Cn Nh Fl Mc Lv Ts Og`) {
+		elements[sym] = true
+	}
+}
+
+// aromaticBracketSymbols are the aromatic symbols allowed inside brackets
+var aromaticBracketSymbols = []string{"se", "as", "te", "b", "c", "n", "o", "p", "s"}
+
+// normalValences holds the default valences for the organic subset, used to
+// calculate implicit hydrogens
+var normalValences = map[string][]int{
+	"B":  {3},
+	"C":  {4},
+	"N":  {3, 5},
+	"O":  {2},
+	"P":  {3, 5},
+	"S":  {2, 4, 6},
+	"F":  {1},
+	"Cl": {1},
+	"Br": {1},
+	"I":  {1},
+}
+
+// ParseSMILES parses a SMILES string into a Molecule. Stereo information
+// (chirality and directional bonds) is accepted but ignored. Implicit
+// hydrogens are calculated for atoms in the organic subset.
+func ParseSMILES(smiles string) (*Molecule, error) {
+	p := &smilesParser{
+		s:     smiles,
+		mol:   &Molecule{},
+		prev:  -1,
+		rings: map[int]ringBond{},
+	}
+	if err := p.parse(); err != nil {
+		return nil, fmt.Errorf("could not parse SMILES %q: %v", smiles, err)
+	}
+	return p.mol, nil
+}
+
+type ringBond struct {
+	atom  int
+	order BondOrder
+}
+
+type smilesParser struct {
+	s           string
+	pos         int
+	mol         *Molecule
+	prev        int
+	branches    []int
+	rings       map[int]ringBond
+	pendingBond BondOrder
+}
+
+func (p *smilesParser) parse() error {
+	if strings.TrimSpace(p.s) == "" {
+		return fmt.Errorf("empty SMILES string")
+	}
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == '(':
+			if p.prev < 0 {
+				return p.errorf("branch opened without a preceding atom")
+			}
+			if p.pendingBond != 0 {
+				return p.errorf("bond symbol before branch")
+			}
+			p.branches = append(p.branches, p.prev)
+			p.pos++
+		case c == ')':
+			if len(p.branches) == 0 {
+				return p.errorf("unbalanced closing parenthesis")
+			}
+			if p.pendingBond != 0 {
+				return p.errorf("bond symbol at end of branch")
+			}
+			p.prev = p.branches[len(p.branches)-1]
+			p.branches = p.branches[:len(p.branches)-1]
+			p.pos++
+		case c == '.':
+			if p.pendingBond != 0 {
+				return p.errorf("bond symbol before dot")
+			}
+			if len(p.branches) > 0 {
+				return p.errorf("dot inside branch")
+			}
+			p.prev = -1
+			p.pos++
+		case strings.IndexByte("-=#$:/\\", c) >= 0:
+			if p.pendingBond != 0 {
+				return p.errorf("two consecutive bond symbols")
+			}
+			if p.prev < 0 {
+				return p.errorf("bond symbol without a preceding atom")
+			}
+			p.pendingBond = map[byte]BondOrder{
+				'-': BondSingle, '/': BondSingle, '\\': BondSingle,
+				'=': BondDouble, '#': BondTriple, '$': BondQuadruple, ':': BondAromatic,
+			}[c]
+			p.pos++
+		case c == '%' || (c >= '0' && c <= '9'):
+			if err := p.parseRingBond(); err != nil {
+				return err
+			}
+		case c == '[':
+			atom, err := p.parseBracketAtom()
+			if err != nil {
+				return err
+			}
+			if err := p.addAtom(atom); err != nil {
+				return err
+			}
+		default:
+			atom, err := p.parseOrganicAtom()
+			if err != nil {
+				return err
+			}
+			if err := p.addAtom(atom); err != nil {
+				return err
+			}
+		}
+	}
+	if p.pendingBond != 0 {
+		return fmt.Errorf("bond symbol at end of string")
+	}
+	if len(p.branches) > 0 {
+		return fmt.Errorf("%d unclosed branch(es)", len(p.branches))
+	}
+	if len(p.rings) > 0 {
+		return fmt.Errorf("%d unclosed ring bond(s)", len(p.rings))
+	}
+	p.mol.setImplicitHydrogens()
+	return nil
+}
+
+func (p *smilesParser) errorf(msg string, v ...interface{}) error {
+	return fmt.Errorf("%s at position %d", fmt.Sprintf(msg, v...), p.pos)
+}
+
+func (p *smilesParser) addAtom(atom Atom) error {
+	idx := p.mol.addAtom(atom)
+	if p.prev >= 0 {
+		if err := p.mol.addBond(p.prev, idx, p.bondOrder(p.prev, idx, p.pendingBond)); err != nil {
+			return p.errorf("%v", err)
+		}
+	}
+	p.pendingBond = 0
+	p.prev = idx
+	return nil
+}
+
+// bondOrder returns the explicit order if set, or else the default order for
+// a bond between the two atoms
+func (p *smilesParser) bondOrder(a, b int, explicit BondOrder) BondOrder {
+	if explicit != 0 {
+		return explicit
+	}
+	if p.mol.Atoms[a].Aromatic && p.mol.Atoms[b].Aromatic {
+		return BondAromatic
+	}
+	return BondSingle
+}
+
+func (p *smilesParser) parseRingBond() error {
+	if p.prev < 0 {
+		return p.errorf("ring bond without a preceding atom")
+	}
+	var num int
+	if p.s[p.pos] == '%' {
+		if p.pos+2 >= len(p.s) || !isDigit(p.s[p.pos+1]) || !isDigit(p.s[p.pos+2]) {
+			return p.errorf("expected two digits after %%")
+		}
+		num = int(p.s[p.pos+1]-'0')*10 + int(p.s[p.pos+2]-'0')
+		p.pos += 3
+	} else {
+		num = int(p.s[p.pos] - '0')
+		p.pos++
+	}
+	open, ok := p.rings[num]
+	if !ok {
+		p.rings[num] = ringBond{atom: p.prev, order: p.pendingBond}
+		p.pendingBond = 0
+		return nil
+	}
+	delete(p.rings, num)
+	order := p.pendingBond
+	if order == 0 {
+		order = open.order
+	} else if open.order != 0 && open.order != order {
+		return p.errorf("conflicting bond symbols for ring bond %d", num)
+	}
+	p.pendingBond = 0
+	if err := p.mol.addBond(open.atom, p.prev, p.bondOrder(open.atom, p.prev, order)); err != nil {
+		return p.errorf("%v", err)
+	}
+	return nil
+}
+
+func (p *smilesParser) parseOrganicAtom() (Atom, error) {
+	rest := p.s[p.pos:]
+	for _, sym := range []string{"Cl", "Br", "B", "C", "N", "O", "P", "S", "F", "I"} {
+		if strings.HasPrefix(rest, sym) {
+			p.pos += len(sym)
+			return Atom{Symbol: sym, HCount: -1}, nil
+		}
+	}
+	for _, sym := range []string{"b", "c", "n", "o", "p", "s"} {
+		if strings.HasPrefix(rest, sym) {
+			p.pos += len(sym)
+			return Atom{Symbol: strings.ToUpper(sym), Aromatic: true, HCount: -1}, nil
+		}
+	}
+	if rest[0] == '*' {
+		p.pos++
+		return Atom{Symbol: "*"}, nil
+	}
+	return Atom{}, p.errorf("unexpected character %q", rest[0])
+}
+
+func (p *smilesParser) parseBracketAtom() (Atom, error) {
+	end := strings.IndexByte(p.s[p.pos:], ']')
+	if end < 0 {
+		return Atom{}, p.errorf("unclosed bracket atom")
+	}
+	body := p.s[p.pos+1 : p.pos+end]
+	atom, err := parseBracketBody(body)
+	if err != nil {
+		return Atom{}, p.errorf("invalid bracket atom [%s]: %v", body, err)
+	}
+	p.pos += end + 1
+	return atom, nil
+}
+
+func parseBracketBody(body string) (Atom, error) {
+	atom := Atom{Bracket: true}
+	i := 0
+	// Isotope
+	for i < len(body) && isDigit(body[i]) {
+		atom.Isotope = atom.Isotope*10 + int(body[i]-'0')
+		i++
+	}
+	// Symbol
+	rest := body[i:]
+	switch {
+	case strings.HasPrefix(rest, "*"):
+		atom.Symbol = "*"
+		i++
+	default:
+		for _, sym := range aromaticBracketSymbols {
+			if strings.HasPrefix(rest, sym) {
+				atom.Symbol = strings.ToUpper(sym[:1]) + sym[1:]
+				atom.Aromatic = true
+				i += len(sym)
+				break
+			}
+		}
+		if atom.Symbol == "" {
+			if len(rest) >= 2 && elements[rest[:2]] {
+				atom.Symbol = rest[:2]
+			} else if len(rest) >= 1 && elements[rest[:1]] {
+				atom.Symbol = rest[:1]
+			} else {
+				return atom, fmt.Errorf("unknown element")
+			}
+			i += len(atom.Symbol)
+		}
+	}
+	// Chirality
+	if strings.HasPrefix(body[i:], "@@") {
+		i += 2
+	} else if strings.HasPrefix(body[i:], "@") {
+		i++
+		for _, class := range []string{"TH", "AL", "SP", "TB", "OH"} {
+			if strings.HasPrefix(body[i:], class) {
+				i += len(class)
+				for i < len(body) && isDigit(body[i]) {
+					i++
+				}
+				break
+			}
+		}
+	}
+	// Hydrogen count
+	if i < len(body) && body[i] == 'H' {
+		i++
+		atom.HCount = 1
+		if i < len(body) && isDigit(body[i]) {
+			atom.HCount = int(body[i] - '0')
+			i++
+		}
+	}
+	// Charge
+	if i < len(body) && (body[i] == '+' || body[i] == '-') {
+		sign := 1
+		if body[i] == '-' {
+			sign = -1
+		}
+		sym := body[i]
+		i++
+		switch {
+		case i < len(body) && isDigit(body[i]):
+			n := 0
+			for i < len(body) && isDigit(body[i]) {
+				n = n*10 + int(body[i]-'0')
+				i++
+			}
+			atom.Charge = sign * n
+		default:
+			atom.Charge = sign
+			for i < len(body) && body[i] == sym {
+				atom.Charge += sign
+				i++
+			}
+		}
+	}
+	// Atom class
+	if i < len(body) && body[i] == ':' {
+		i++
+		if i == len(body) || !isDigit(body[i]) {
+			return atom, fmt.Errorf("expected digits after ':'")
+		}
+		for i < len(body) && isDigit(body[i]) {
+			atom.Class = atom.Class*10 + int(body[i]-'0')
+			i++
+		}
+	}
+	if i != len(body) {
+		return atom, fmt.Errorf("unexpected %q", body[i:])
+	}
+	return atom, nil
+}
+
+// setImplicitHydrogens calculates hydrogen counts for organic subset atoms,
+// which are marked with HCount -1 during parsing
+func (m *Molecule) setImplicitHydrogens() {
+	for i := range m.Atoms {
+		if m.Atoms[i].HCount < 0 {
+			m.Atoms[i].HCount = m.implicitHydrogens(i)
+		}
+	}
+}
+
+// implicitHydrogens returns the number of hydrogens that atom atomIdx would
+// get if written as an organic subset atom, without brackets
+func (m *Molecule) implicitHydrogens(atomIdx int) int {
+	atom := m.Atoms[atomIdx]
+	return implicitHydrogens(normalValences[atom.Symbol], m.bondOrderSum(atomIdx), atom.Aromatic)
+}
+
+// bondOrderSum returns the sum of bond orders for an atom, counting aromatic
+// bonds as single bonds
+func (m *Molecule) bondOrderSum(atomIdx int) int {
+	bondSum := 0
+	for _, bi := range m.atomBonds[atomIdx] {
+		order := m.Bonds[bi].Order
+		if order == BondAromatic {
+			order = BondSingle
+		}
+		bondSum += int(order)
+	}
+	return bondSum
+}
+
+// implicitHydrogens returns the number of hydrogens needed to reach the
+// lowest of the valences that can hold the bonds of an atom
+func implicitHydrogens(valences []int, bondSum int, aromatic bool) int {
+	if len(valences) == 0 {
+		return 0
+	}
+	if aromatic {
+		// One electron goes to the aromatic system
+		if bondSum+1 <= valences[0] {
+			return valences[0] - (bondSum + 1)
+		}
+		return 0
+	}
+	for _, v := range valences {
+		if bondSum <= v {
+			return v - bondSum
+		}
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
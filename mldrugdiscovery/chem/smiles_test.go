@@ -0,0 +1,79 @@
+package chem
+
+import (
+	"testing"
+)
+
+func TestParseSMILES(t *testing.T) {
+	for smiles, expected := range map[string]struct {
+		atoms  int
+		bonds  int
+		hCount int
+	}{
+		"C":                 {1, 0, 4},
+		"CCO":               {3, 2, 6},
+		"C=C":               {2, 1, 4},
+		"C#N":               {2, 1, 1},
+		"c1ccccc1":          {6, 6, 6},
+		"c1ccncc1":          {6, 6, 5},
+		"c1cc[nH]c1":        {5, 5, 5},
+		"c1ccsc1":           {5, 5, 4},
+		"CC(=O)O":           {4, 3, 4},
+		"C1CC2CCC1CC2":      {8, 9, 14},
+		"C%10CCCCC%10":      {6, 6, 12},
+		"[NH4+].[Cl-]":      {2, 0, 4},
+		"N[C@@H](C)C(=O)O":  {6, 5, 7},
+		"F/C=C/F":           {4, 3, 2},
+		"[13CH4]":           {1, 0, 4},
+		"CS(=O)(=O)C":       {5, 4, 6},
+		"OC(=O)c1ccccc1Br":  {10, 10, 5},
+		"C1=CC=CC=C1.[Na+]": {7, 6, 6},
+	} {
+		mol, err := ParseSMILES(smiles)
+		if err != nil {
+			t.Errorf("Could not parse %s: %v", smiles, err)
+			continue
+		}
+		hCount := 0
+		for _, atom := range mol.Atoms {
+			hCount += atom.HCount
+		}
+		if len(mol.Atoms) != expected.atoms || len(mol.Bonds) != expected.bonds || hCount != expected.hCount {
+			t.Errorf("Wrong molecule for %s:\nEXPECTED: atoms %d, bonds %d, hydrogens %d\nACTUAL: atoms %d, bonds %d, hydrogens %d\n",
+				smiles, expected.atoms, expected.bonds, expected.hCount, len(mol.Atoms), len(mol.Bonds), hCount)
+		}
+	}
+}
+
+func TestParseSMILESBracketAtom(t *testing.T) {
+	mol, err := ParseSMILES("[15NH2+:3]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Atom{Symbol: "N", Bracket: true, Isotope: 15, Charge: 1, HCount: 2, Class: 3}
+	if mol.Atoms[0] != expected {
+		t.Errorf("Wrong atom:\nEXPECTED: %+v\nACTUAL: %+v\n", expected, mol.Atoms[0])
+	}
+}
+
+func TestParseSMILESInvalid(t *testing.T) {
+	for _, smiles := range []string{
+		"",
+		"C(",
+		"C)",
+		"C1CC",
+		"(C)",
+		"C==C",
+		"C=",
+		"[Xx]",
+		"[C",
+		"C1CC1=",
+		"Q",
+		"C11",
+		"C=1CC-1",
+	} {
+		if _, err := ParseSMILES(smiles); err == nil {
+			t.Errorf("Expected error for invalid SMILES %q", smiles)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package chem
+
+// Fragments returns the atom indices of each connected component (fragment)
+// of the molecule, in order of their first atom
+func (m *Molecule) Fragments() [][]int {
+	fragIdx := make([]int, len(m.Atoms))
+	for i := range fragIdx {
+		fragIdx[i] = -1
+	}
+	frags := [][]int{}
+	for start := range m.Atoms {
+		if fragIdx[start] >= 0 {
+			continue
+		}
+		frag := []int{}
+		stack := []int{start}
+		fragIdx[start] = len(frags)
+		for len(stack) > 0 {
+			atomIdx := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			frag = append(frag, atomIdx)
+			for _, bi := range m.atomBonds[atomIdx] {
+				other := m.Bonds[bi].Other(atomIdx)
+				if fragIdx[other] < 0 {
+					fragIdx[other] = len(frags)
+					stack = append(stack, other)
+				}
+			}
+		}
+		frags = append(frags, frag)
+	}
+	return frags
+}
+
+// SubMolecule returns a new molecule with only the given atoms, and the bonds
+// between them
+func (m *Molecule) SubMolecule(atomIdxs []int) *Molecule {
+	sub := &Molecule{}
+	newIdx := map[int]int{}
+	for _, atomIdx := range atomIdxs {
+		newIdx[atomIdx] = sub.addAtom(m.Atoms[atomIdx])
+	}
+	for _, bond := range m.Bonds {
+		a, okA := newIdx[bond.A]
+		b, okB := newIdx[bond.B]
+		if okA && okB {
+			// Can not fail, since the bond was valid in m
+			sub.addBond(a, b, bond.Order)
+		}
+	}
+	return sub
+}
+
+// StripSalts returns the largest fragment of the molecule, by number of
+// heavy atoms, removing counter ions and solvents. Ties are broken on
+// canonical SMILES, to not depend on the input order. The number of removed
+// fragments is also returned.
+func StripSalts(m *Molecule) (*Molecule, int) {
+	frags := m.Fragments()
+	if len(frags) <= 1 {
+		return m, 0
+	}
+	var largest *Molecule
+	largestSize := -1
+	largestSMILES := ""
+	for _, frag := range frags {
+		sub := m.SubMolecule(frag)
+		size := 0
+		for _, atom := range sub.Atoms {
+			if atom.Symbol != "H" {
+				size++
+			}
+		}
+		smiles := sub.CanonicalSMILES()
+		if size > largestSize || (size == largestSize && smiles < largestSMILES) {
+			largest, largestSize, largestSMILES = sub, size, smiles
+		}
+	}
+	return largest, len(frags) - 1
+}
@@ -0,0 +1,453 @@
+package mlcomp
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pharmbio/scipipe-demo/mldrugdiscovery/chem"
+	sp "github.com/scipipe/scipipe"
+)
+
+// ApplicabilityDomain estimates whether predictions are within the
+// applicability domain of a model, based on its sparse train data. Three
+// criteria are used:
+//
+//   - Signature coverage: the fraction of the signature occurrences of a
+//     compound that were seen in the train data
+//   - Nearest neighbour distance: the Tanimoto (MinMax) distance to the most
+//     similar train compound
+//   - Leverage: the leverage of the compound, computed on the most frequent
+//     signatures in the train data
+//
+// Each prediction is annotated with the values, and an applicability domain
+// score, which is the fraction of the criteria met. A prediction is in the
+// domain only if all criteria are met. Prediction metrics are summarized
+// for compounds in and out of the domain.
+//
+// The compounds are read from a signatures file, in the same order as the
+// predictions, so that predictions of other models, such as the mean
+// predictions of PredictEnsemble, are annotated in the same way as those of
+// the final model.
+type ApplicabilityDomain struct {
+	*Process
+}
+
+// ApplicabilityDomainConf contains parameters for initializing an
+// ApplicabilityDomain process
+type ApplicabilityDomainConf struct {
+	// Title is used as the heading of the summary
+	Title string
+	// MinCoverage is the minimum signature coverage in the domain
+	MinCoverage float64
+	// MaxNNDistance is the maximum nearest neighbour distance in the domain.
+	// If zero, it is set to the 95th percentile of the nearest neighbour
+	// distances within the train data.
+	MaxNNDistance float64
+	// LeverageFeatures is the number of most frequent train signatures to
+	// compute leverages on. The maximum leverage in the domain is the common
+	// warning leverage 3(p+1)/n, for p features and n train compounds.
+	LeverageFeatures int
+}
+
+// NewApplicabilityDomain returns a new ApplicabilityDomain process
+func NewApplicabilityDomain(wf *sp.Workflow, name string, params ApplicabilityDomainConf) *ApplicabilityDomain {
+	p := newProcess(wf, name, "# Go applicability domain: {i:traindata} {i:signatures} {i:testdata} {i:prediction} {o:annotated} {o:summary}")
+	p.SetOut("annotated", "{i:prediction}.ad.tsv")
+	p.SetOut("summary", "{i:prediction}.ad_summary.md")
+	p.CustomExecute = func(t *sp.Task) {
+		err := annotateAppDomain(params,
+			t.InPath("traindata"),
+			t.InPath("signatures"),
+			t.InPath("testdata"),
+			t.InPath("prediction"),
+			t.OutIP("annotated").TempPath(),
+			t.OutIP("summary").TempPath())
+		if err != nil {
+			sp.Failf("Could not estimate applicability domain for %s: %v", t.InPath("prediction"), err)
+		}
+	}
+	return &ApplicabilityDomain{p}
+}
+
+// InTrainData returns the TrainData in-port, taking an (un-gzipped) sparse
+// train dataset
+func (p *ApplicabilityDomain) InTrainData() *sp.InPort {
+	return p.In("traindata")
+}
+
+// InSignatures returns the Signatures in-port, taking the signatures file
+// written by CreateSparseTrain for the train data
+func (p *ApplicabilityDomain) InSignatures() *sp.InPort {
+	return p.In("signatures")
+}
+
+// InTestData returns the TestData in-port, taking the signatures of the
+// predicted compounds
+func (p *ApplicabilityDomain) InTestData() *sp.InPort {
+	return p.In("testdata")
+}
+
+// InPrediction returns the Prediction in-port
+func (p *ApplicabilityDomain) InPrediction() *sp.InPort {
+	return p.In("prediction")
+}
+
+// OutAnnotated returns the Annotated out-port, with the predictions and
+// their applicability domain values
+func (p *ApplicabilityDomain) OutAnnotated() *sp.OutPort {
+	return p.Out("annotated")
+}
+
+// OutSummary returns the Summary out-port, with a Markdown summary of
+// metrics in and out of the domain
+func (p *ApplicabilityDomain) OutSummary() *sp.OutPort {
+	return p.Out("summary")
+}
+
+// appDomain is an applicability domain estimated from train data
+type appDomain struct {
+	conf      ApplicabilityDomainConf
+	trainRows [][]sparseEntry
+	// levCols maps train columns to indices in the leverage features, which
+	// are offset by one for the intercept
+	levCols map[int]int
+	// levChol is the Cholesky factor of the (regularized) X'X matrix of the
+	// leverage features
+	levChol       [][]float64
+	maxLeverage   float64
+	maxNNDistance float64
+}
+
+func newAppDomain(trainRows [][]sparseEntry, conf ApplicabilityDomainConf) *appDomain {
+	ad := &appDomain{conf: conf, trainRows: trainRows, maxNNDistance: conf.MaxNNDistance}
+	if ad.maxNNDistance == 0 {
+		ad.maxNNDistance = ad.calibrateNNDistance(500, 0.95)
+	}
+
+	// Select the most frequent columns for leverages
+	colFreqs := map[int]int{}
+	for _, row := range trainRows {
+		for _, e := range row {
+			colFreqs[e.col]++
+		}
+	}
+	cols := make([]int, 0, len(colFreqs))
+	for col := range colFreqs {
+		cols = append(cols, col)
+	}
+	sort.Slice(cols, func(i, j int) bool {
+		if colFreqs[cols[i]] != colFreqs[cols[j]] {
+			return colFreqs[cols[i]] > colFreqs[cols[j]]
+		}
+		return cols[i] < cols[j]
+	})
+	levCnt := conf.LeverageFeatures
+	if levCnt > len(cols) {
+		levCnt = len(cols)
+	}
+	// Leverages are not meaningful with fewer compounds than parameters
+	if levCnt+1 >= len(trainRows) {
+		levCnt = 0
+	}
+	if levCnt == 0 {
+		return ad
+	}
+	ad.levCols = map[int]int{}
+	for i, col := range cols[:levCnt] {
+		ad.levCols[col] = i + 1
+	}
+	dim := levCnt + 1
+	xtx := make([][]float64, dim)
+	for i := range xtx {
+		xtx[i] = make([]float64, dim)
+	}
+	for _, row := range trainRows {
+		x := ad.leverageVector(row)
+		for i := range x {
+			if x[i] == 0 {
+				continue
+			}
+			for j := range x {
+				xtx[i][j] += x[i] * x[j]
+			}
+		}
+	}
+	trace := 0.0
+	for i := range xtx {
+		trace += xtx[i][i]
+	}
+	for i := range xtx {
+		xtx[i][i] += 1e-6 * trace / float64(dim)
+	}
+	ad.levChol = cholesky(xtx)
+	ad.maxLeverage = 3 * float64(dim) / float64(len(trainRows))
+	return ad
+}
+
+// calibrateNNDistance returns the given quantile of nearest neighbour
+// distances within the train data, for at most sampleSize train compounds
+func (ad *appDomain) calibrateNNDistance(sampleSize int, quantile float64) float64 {
+	n := len(ad.trainRows)
+	if n < 2 {
+		return 1
+	}
+	if sampleSize > n {
+		sampleSize = n
+	}
+	dists := make([]float64, 0, sampleSize)
+	for i := 0; i < sampleSize; i++ {
+		rowIdx := i * n / sampleSize
+		dists = append(dists, ad.nnDistance(ad.trainRows[rowIdx], rowIdx))
+	}
+	sort.Float64s(dists)
+	return dists[int(quantile*float64(len(dists)-1))]
+}
+
+// nnDistance returns the Tanimoto distance to the nearest train compound,
+// except the one at index skipIdx
+func (ad *appDomain) nnDistance(row []sparseEntry, skipIdx int) float64 {
+	maxSim := 0.0
+	for i, trainRow := range ad.trainRows {
+		if i == skipIdx {
+			continue
+		}
+		if sim := tanimoto(row, trainRow); sim > maxSim {
+			maxSim = sim
+		}
+	}
+	return 1 - maxSim
+}
+
+func (ad *appDomain) leverageVector(row []sparseEntry) []float64 {
+	x := make([]float64, len(ad.levCols)+1)
+	x[0] = 1
+	for _, e := range row {
+		if i, ok := ad.levCols[e.col]; ok {
+			x[i] = e.val
+		}
+	}
+	return x
+}
+
+// leverage returns x'(X'X)^-1 x for the leverage features of a compound, or
+// 0 if leverages are not used
+func (ad *appDomain) leverage(row []sparseEntry) float64 {
+	if ad.levChol == nil {
+		return 0
+	}
+	// Solve L y = x, so that x'(LL')^-1 x = y'y
+	x := ad.leverageVector(row)
+	h := 0.0
+	for i := range x {
+		sum := x[i]
+		for j := 0; j < i; j++ {
+			sum -= ad.levChol[i][j] * x[j]
+		}
+		x[i] = sum / ad.levChol[i][i]
+		h += x[i] * x[i]
+	}
+	return h
+}
+
+// appDomainValues are the applicability domain values for one compound
+type appDomainValues struct {
+	coverage   float64
+	nnDistance float64
+	leverage   float64
+}
+
+// Score returns the fraction of the applicability domain criteria met
+func (ad *appDomain) Score(vals appDomainValues) float64 {
+	met := 0
+	if vals.coverage >= ad.conf.MinCoverage {
+		met++
+	}
+	if vals.nnDistance <= ad.maxNNDistance {
+		met++
+	}
+	if ad.levChol == nil || vals.leverage <= ad.maxLeverage {
+		met++
+	}
+	return float64(met) / 3
+}
+
+// tanimoto returns the Tanimoto (MinMax) similarity of two sparse count
+// vectors, sorted by column
+func tanimoto(a []sparseEntry, b []sparseEntry) float64 {
+	minSum, maxSum := 0.0, 0.0
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i].col < b[j].col):
+			maxSum += a[i].val
+			i++
+		case i == len(a) || b[j].col < a[i].col:
+			maxSum += b[j].val
+			j++
+		default:
+			minSum += math.Min(a[i].val, b[j].val)
+			maxSum += math.Max(a[i].val, b[j].val)
+			i++
+			j++
+		}
+	}
+	if maxSum == 0 {
+		return 0
+	}
+	return minSum / maxSum
+}
+
+// cholesky returns the lower triangular Cholesky factor of a symmetric,
+// positive definite matrix
+func cholesky(a [][]float64) [][]float64 {
+	l := make([][]float64, len(a))
+	for i := range a {
+		l[i] = make([]float64, len(a))
+		for j := 0; j <= i; j++ {
+			sum := a[i][j]
+			for k := 0; k < j; k++ {
+				sum -= l[i][k] * l[j][k]
+			}
+			if i == j {
+				l[i][i] = math.Sqrt(math.Max(sum, 1e-12))
+			} else {
+				l[i][j] = sum / l[j][j]
+			}
+		}
+	}
+	return l
+}
+
+func annotateAppDomain(conf ApplicabilityDomainConf, trainPath string, vocPath string, testPath string, predPath string, annotatedPath string, summaryPath string) error {
+	_, trainRows, err := readSparseDataset(trainPath)
+	if err != nil {
+		return err
+	}
+	vocFile, err := os.Open(vocPath)
+	if err != nil {
+		return err
+	}
+	voc, err := chem.ReadVocabulary(vocFile)
+	vocFile.Close()
+	if err != nil {
+		return fmt.Errorf("could not read signatures in %s: %v", vocPath, err)
+	}
+	preds, err := readPredictions(predPath)
+	if err != nil {
+		return err
+	}
+
+	records, err := readSignatureRecords(testPath)
+	if err != nil {
+		return err
+	}
+	if len(records) != len(preds) {
+		return fmt.Errorf("%d compounds in %s, but %d predictions in %s", len(records), testPath, len(preds), predPath)
+	}
+
+	ad := newAppDomain(trainRows, conf)
+
+	annotatedFile, err := createFile(annotatedPath)
+	if err != nil {
+		return err
+	}
+	defer annotatedFile.Close()
+	annotated := bufio.NewWriter(annotatedFile)
+	fmt.Fprintln(annotated, "row\tsmiles\tobserved\tpredicted\tcoverage\tnn_distance\tleverage\tad_score\tin_domain")
+	var all, inDomain, outDomain predMetrics
+	for i, rec := range records {
+		row := []sparseEntry{}
+		total, known := 0, 0
+		for sig, cnt := range rec.Signatures {
+			total += cnt
+			if col, ok := voc.Column(sig); ok {
+				known += cnt
+				row = append(row, sparseEntry{col, float64(cnt)})
+			}
+		}
+		sort.Slice(row, func(a, b int) bool { return row[a].col < row[b].col })
+		vals := appDomainValues{nnDistance: ad.nnDistance(row, -1), leverage: ad.leverage(row)}
+		if total > 0 {
+			vals.coverage = float64(known) / float64(total)
+		}
+		score := ad.Score(vals)
+		observed := math.NaN()
+		fmt.Sscan(rec.Response, &observed)
+		fmt.Fprintf(annotated, "%d\t%s\t%s\t%g\t%.4f\t%.4f\t%.4f\t%.3f\t%t\n",
+			i+1, rec.SMILES, rec.Response, preds[i], vals.coverage, vals.nnDistance, vals.leverage, score, score == 1)
+		all.add(observed, preds[i])
+		if score == 1 {
+			inDomain.add(observed, preds[i])
+		} else {
+			outDomain.add(observed, preds[i])
+		}
+	}
+	if err := annotated.Flush(); err != nil {
+		return err
+	}
+
+	summaryFile, err := createFile(summaryPath)
+	if err != nil {
+		return err
+	}
+	defer summaryFile.Close()
+	leverageLimit := "not used"
+	if ad.levChol != nil {
+		leverageLimit = fmt.Sprintf("≤ %.4f (%d signatures)", ad.maxLeverage, len(ad.levCols))
+	}
+	_, err = fmt.Fprintf(summaryFile, "## %s\n\n"+
+		"Domain criteria: signature coverage ≥ %g, nearest neighbour Tanimoto distance ≤ %.4f, leverage %s\n\n"+
+		"| Subset | Compounds | RMSD | MAE | R² |\n"+
+		"|---|---:|---:|---:|---:|\n"+
+		"%s%s%s\n",
+		conf.Title, conf.MinCoverage, ad.maxNNDistance, leverageLimit,
+		all.row("All"), inDomain.row("In domain"), outDomain.row("Out of domain"))
+	return err
+}
+
+// predMetrics accumulates regression metrics for observed and predicted
+// values
+type predMetrics struct {
+	n                   int
+	sumSqErr, sumAbsErr float64
+	sumObs, sumSqObs    float64
+}
+
+func (m *predMetrics) add(observed float64, predicted float64) {
+	if math.IsNaN(observed) {
+		return
+	}
+	diff := predicted - observed
+	m.n++
+	m.sumSqErr += diff * diff
+	m.sumAbsErr += math.Abs(diff)
+	m.sumObs += observed
+	m.sumSqObs += observed * observed
+}
+
+// cells returns the count, RMSD, MAE and R² formatted for a table
+func (m *predMetrics) cells() []string {
+	if m.n == 0 {
+		return []string{"0", "-", "-", "-"}
+	}
+	n := float64(m.n)
+	r2 := "-"
+	if ssTot := m.sumSqObs - m.sumObs*m.sumObs/n; ssTot > 0 {
+		r2 = fmt.Sprintf("%.3f", 1-m.sumSqErr/ssTot)
+	}
+	return []string{fmt.Sprintf("%d", m.n), fmt.Sprintf("%.4f", math.Sqrt(m.sumSqErr/n)), fmt.Sprintf("%.4f", m.sumAbsErr/n), r2}
+}
+
+// row formats the metrics as a row in a Markdown table
+func (m *predMetrics) row(label string) string {
+	return "| " + label + " | " + strings.Join(m.cells(), " | ") + " |\n"
+}
+
+// htmlRow formats the metrics as a row in an HTML table
+func (m *predMetrics) htmlRow() string {
+	return "<tr><td>" + strings.Join(m.cells(), "</td><td>") + "</td></tr>\n"
+}
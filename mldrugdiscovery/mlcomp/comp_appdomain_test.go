@@ -0,0 +1,143 @@
+package mlcomp
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTanimoto(t *testing.T) {
+	for _, tc := range []struct {
+		a        []sparseEntry
+		b        []sparseEntry
+		expected float64
+	}{
+		{[]sparseEntry{{1, 1}, {2, 2}}, []sparseEntry{{1, 1}, {2, 2}}, 1},
+		{[]sparseEntry{{1, 1}}, []sparseEntry{{2, 1}}, 0},
+		{[]sparseEntry{{1, 2}, {2, 1}}, []sparseEntry{{1, 1}, {3, 1}}, 0.25},
+		{[]sparseEntry{{1, 3}}, []sparseEntry{{1, 1}}, 1.0 / 3},
+		{[]sparseEntry{}, []sparseEntry{}, 0},
+	} {
+		if sim := tanimoto(tc.a, tc.b); math.Abs(sim-tc.expected) > 1e-12 {
+			t.Errorf("Wrong Tanimoto similarity of %v and %v:\nEXPECTED: %g\nACTUAL: %g", tc.a, tc.b, tc.expected, sim)
+		}
+	}
+}
+
+func TestAppDomain(t *testing.T) {
+	// Leverages on column 1 and the intercept are those of a simple linear
+	// regression on x = 1, 2, 3, 4: 1/n + (x - 2.5)^2 / 5
+	trainRows := [][]sparseEntry{
+		{{1, 1}},
+		{{1, 2}},
+		{{1, 3}},
+		{{1, 4}, {2, 1}},
+	}
+	ad := newAppDomain(trainRows, ApplicabilityDomainConf{MinCoverage: 0.8, LeverageFeatures: 1})
+	// The nearest neighbour distances within the train data are 1/2, 1/3, 1/3
+	// and 2/5, of which the 95th percentile is taken
+	if math.Abs(ad.maxNNDistance-0.4) > 1e-12 {
+		t.Errorf("Expected a calibrated max nearest neighbour distance of 0.4, got %g", ad.maxNNDistance)
+	}
+	if math.Abs(ad.maxLeverage-1.5) > 1e-12 {
+		t.Errorf("Expected a max leverage of 3*2/4 = 1.5, got %g", ad.maxLeverage)
+	}
+
+	for _, tc := range []struct {
+		row                []sparseEntry
+		skipIdx            int
+		coverage           float64
+		expectedNNDistance float64
+		expectedLeverage   float64
+		expectedScore      float64
+	}{
+		{[]sparseEntry{{1, 2}}, -1, 1, 0, 0.3, 1},
+		// Without the identical train compound, the nearest is x = 3
+		{[]sparseEntry{{1, 2}}, 1, 1, 1.0 / 3, 0.3, 1},
+		{[]sparseEntry{{1, 1}}, -1, 1, 0, 0.7, 1},
+		{[]sparseEntry{{1, 4}}, -1, 0.5, 0.2, 0.7, 2.0 / 3},
+		// Extrapolating beyond the train data gives a high leverage
+		{[]sparseEntry{{1, 8}}, -1, 0.5, 5.0 / 9, 6.3, 0},
+		{[]sparseEntry{{1, 0.5}}, -1, 1, 0.5, 1.05, 2.0 / 3},
+	} {
+		vals := appDomainValues{
+			coverage:   tc.coverage,
+			nnDistance: ad.nnDistance(tc.row, tc.skipIdx),
+			leverage:   ad.leverage(tc.row),
+		}
+		if math.Abs(vals.nnDistance-tc.expectedNNDistance) > 1e-12 {
+			t.Errorf("Wrong nearest neighbour distance for %v:\nEXPECTED: %g\nACTUAL: %g", tc.row, tc.expectedNNDistance, vals.nnDistance)
+		}
+		// The X'X matrix is slightly regularized
+		if math.Abs(vals.leverage-tc.expectedLeverage) > 1e-3 {
+			t.Errorf("Wrong leverage for %v:\nEXPECTED: %g\nACTUAL: %g", tc.row, tc.expectedLeverage, vals.leverage)
+		}
+		if score := ad.Score(vals); math.Abs(score-tc.expectedScore) > 1e-12 {
+			t.Errorf("Wrong applicability domain score for %v:\nEXPECTED: %g\nACTUAL: %g", tc.row, tc.expectedScore, score)
+		}
+	}
+
+	// Too few train compounds for the leverage features
+	if ad := newAppDomain(trainRows[:2], ApplicabilityDomainConf{LeverageFeatures: 1}); ad.levChol != nil || ad.leverage(trainRows[0]) != 0 {
+		t.Error("Expected leverages not to be used with two train compounds")
+	}
+}
+
+func TestAnnotateAppDomain(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "appdomain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	files := map[string]string{
+		"train.sparse": "1.0 1:1\n2.0 1:2\n3.0 1:3\n4.0 1:4 2:1\n",
+		"train.signs":  "1\t[C]\n2\t[O]\n",
+		// The second compound has a signature not seen in training
+		"test.signs": "CC\t2.0\t[C] 2\nCCN\t1.0\t[C] 1\t[N] 1\n",
+		"test.pred":  "2.5\n1.0\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+	conf := ApplicabilityDomainConf{Title: "Test set", MinCoverage: 0.8, LeverageFeatures: 1}
+	if err := annotateAppDomain(conf, path("train.sparse"), path("train.signs"), path("test.signs"), path("test.pred"), path("test.ad.tsv"), path("test.ad_summary.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	annotated := readTSV(t, path("test.ad.tsv"))
+	for i, expected := range [][]string{
+		{"1", "CC", "2.0", "2.5", "1.0000", "0.0000", "0.3000", "1.000", "true"},
+		{"2", "CCN", "1.0", "1", "0.5000", "0.0000", "0.7000", "0.667", "false"},
+	} {
+		if strings.Join(annotated[i+1], "\t") != strings.Join(expected, "\t") {
+			t.Errorf("Wrong annotated row %d:\nEXPECTED: %q\nACTUAL: %q", i+1, expected, annotated[i+1])
+		}
+	}
+	summary, err := ioutil.ReadFile(path("test.ad_summary.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []string{
+		"nearest neighbour Tanimoto distance ≤ 0.4000, leverage ≤ 1.5000 (1 signatures)",
+		"| All | 2 | 0.3536 | 0.2500 | 0.500 |",
+		"| In domain | 1 | 0.5000 | 0.5000 | - |",
+		"| Out of domain | 1 | 0.0000 | 0.0000 | - |",
+	} {
+		if !strings.Contains(string(summary), row) {
+			t.Errorf("Expected the summary to contain %q, got:\n%s", row, summary)
+		}
+	}
+
+	if err := ioutil.WriteFile(path("test.pred"), []byte("2.5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := annotateAppDomain(conf, path("train.sparse"), path("train.signs"), path("test.signs"), path("test.pred"), path("test.ad.tsv"), path("test.ad_summary.md")); err == nil {
+		t.Error("Expected an error for fewer predictions than compounds")
+	}
+}
@@ -1,27 +1,35 @@
-package main
+package mlcomp
 
 import (
 	sp "github.com/scipipe/scipipe"
 )
 
-// AssessLibLinear does blabla ...
+// AssessLibLinear computes the RMSD of predictions against the responses of
+// a sparse test dataset, and writes it with the cost of the model
 type AssessLibLinear struct {
-	*sp.Process
+	*Process
 }
 
 // AssessLibLinearConf contains parameters for initializing a
 // AssessLibLinear process
 type AssessLibLinearConf struct {
+	// Fold is an optional label for the cross-validation fold, which is then
+	// written after the RMSD and cost
+	Fold string
 }
 
 // NewAssessLibLinear returns a new AssessLibLinear process
 func NewAssessLibLinear(wf *sp.Workflow, name string, params AssessLibLinearConf) *AssessLibLinear {
+	foldCol := ""
+	if params.Fold != "" {
+		foldCol = "\t" + params.Fold
+	}
 	cmd := `rmsd=$(awk 'FNR==NR { pred[FNR]=$1; next } ` +
 		`{ sqdiffsum += (pred[FNR]-$1)^2; valcnt++ } ` +
 		`END { rmsd=sqrt(sqdiffsum/valcnt); print rmsd }' ` +
 		`{i:prediction} {i:testdata}) && ` + "\\\n" +
-		`echo "$rmsd	{p:cost}" > {o:rmsd_cost}`
-	p := wf.NewProc(name, cmd)
+		`echo "$rmsd	{p:cost}` + foldCol + `" > {o:rmsd_cost}`
+	p := newProcess(wf, name, cmd)
 	p.SetOut("rmsd_cost", "{i:prediction}.rmsd_cost")
 	return &AssessLibLinear{p}
 }
@@ -0,0 +1,79 @@
+package mlcomp
+
+import (
+	"bufio"
+	"math/rand"
+	"os"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+// Bootstrap draws a bootstrap sample from the rows of a sparse dataset, that
+// is, as many rows as in the dataset, with replacement, for training members
+// of bagged ensembles. As the columns are kept, all samples from a dataset
+// share its signatures file.
+type Bootstrap struct {
+	*Process
+}
+
+// BootstrapConf contains parameters for initializing a Bootstrap process
+type BootstrapConf struct {
+	Seed int64
+}
+
+// NewBootstrap returns a new Bootstrap process
+func NewBootstrap(wf *sp.Workflow, name string, params BootstrapConf) *Bootstrap {
+	p := newProcess(wf, name, "# Go bootstrap sampling: {i:in} {o:sample} {p:seed}")
+	p.InParam("seed").FromInt(int(params.Seed))
+	p.SetOut("sample", "{i:in}.bs{p:seed}")
+	p.CustomExecute = func(t *sp.Task) {
+		if err := bootstrapSample(t.InPath("in"), t.OutIP("sample").TempPath(), params.Seed); err != nil {
+			sp.Failf("Could not draw bootstrap sample from %s: %v", t.InPath("in"), err)
+		}
+	}
+	return &Bootstrap{p}
+}
+
+// InData returns the Data in-port
+func (p *Bootstrap) InData() *sp.InPort {
+	return p.In("in")
+}
+
+// OutSample returns the Sample out-port
+func (p *Bootstrap) OutSample() *sp.OutPort {
+	return p.Out("sample")
+}
+
+func bootstrapSample(inPath string, outPath string, seed int64) error {
+	inFile, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+	rows := []string{}
+	sc := bufio.NewScanner(inFile)
+	sc.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for sc.Scan() {
+		if sc.Text() != "" {
+			rows = append(rows, sc.Text())
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	rnd := rand.New(rand.NewSource(seed))
+	outFile, err := createFile(outPath)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(outFile)
+	for range rows {
+		bw.WriteString(rows[rnd.Intn(len(rows))] + "\n")
+	}
+	if err := bw.Flush(); err != nil {
+		outFile.Close()
+		return err
+	}
+	return outFile.Close()
+}
@@ -0,0 +1,192 @@
+package mlcomp
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pharmbio/scipipe-demo/mldrugdiscovery/chem"
+	sp "github.com/scipipe/scipipe"
+)
+
+// CheckLeakage verifies that a train and a test dataset have no compounds in
+// common, and fails the workflow if they do. With compound IDs, it also
+// fails if an ID is in both datasets, such as for one compound entered with
+// two different structures. It writes a short log of the check when the
+// datasets are disjoint.
+type CheckLeakage struct {
+	*Process
+}
+
+// LeakageKey is what identifies a compound when checking for leakage
+type LeakageKey string
+
+const (
+	// LeakageKeySMILES identifies compounds in signature files, or rows
+	// written by CompoundRows, by the canonical form of their SMILES, which
+	// is also what compound IDs from the input dataset are mapped to
+	LeakageKeySMILES LeakageKey = "smiles"
+	// LeakageKeyRow identifies compounds in sparse datasets by their full
+	// row, that is, their response value and all their signature counts.
+	// Different compounds can have the same row, so SMILES are to be
+	// preferred, such as from the rows written by CompoundRows.
+	LeakageKeyRow LeakageKey = "row"
+)
+
+// CheckLeakageConf contains parameters for initializing a CheckLeakage process
+type CheckLeakageConf struct {
+	KeyBy LeakageKey
+	// WithIDs should be true if the IDs in-port is connected, to also check
+	// the compound IDs from the ids file of LoadDataset. Requires
+	// LeakageKeySMILES.
+	WithIDs bool
+}
+
+// NewCheckLeakage returns a new CheckLeakage process
+func NewCheckLeakage(wf *sp.Workflow, name string, params CheckLeakageConf) *CheckLeakage {
+	cmd := "# Go train/test leakage check (" + string(params.KeyBy) + "): {i:train} {i:test} {o:log}"
+	if params.WithIDs {
+		cmd += " {i:ids}"
+	}
+	p := newProcess(wf, name, cmd)
+	p.SetOut("log", "{i:test}.leakcheck")
+	p.CustomExecute = func(t *sp.Task) {
+		idsPath := ""
+		if params.WithIDs {
+			idsPath = t.InPath("ids")
+		}
+		if err := checkLeakage(t.InPath("train"), t.InPath("test"), params.KeyBy, idsPath, t.OutIP("log").TempPath()); err != nil {
+			sp.Fail(err)
+		}
+	}
+	return &CheckLeakage{p}
+}
+
+// InTrain returns the Train in-port
+func (p *CheckLeakage) InTrain() *sp.InPort {
+	return p.In("train")
+}
+
+// InTest returns the Test in-port
+func (p *CheckLeakage) InTest() *sp.InPort {
+	return p.In("test")
+}
+
+// InIDs returns the IDs in-port, only used if WithIDs is set
+func (p *CheckLeakage) InIDs() *sp.InPort {
+	return p.In("ids")
+}
+
+// OutLog returns the Log out-port
+func (p *CheckLeakage) OutLog() *sp.OutPort {
+	return p.Out("log")
+}
+
+// checkLeakage returns an error listing compounds of the test data at
+// testPath that are also in the train data at trainPath, or, with the ids
+// file at idsPath, unless empty, compound IDs in both, or else writes a log
+// of the check to logPath
+func checkLeakage(trainPath string, testPath string, keyBy LeakageKey, idsPath string, logPath string) error {
+	if idsPath != "" && keyBy != LeakageKeySMILES {
+		return fmt.Errorf("compound IDs can only be checked with %s keys, not %s", LeakageKeySMILES, keyBy)
+	}
+	trainKeys, err := readLeakageKeys(trainPath, keyBy)
+	if err != nil {
+		return err
+	}
+	testKeys, err := readLeakageKeys(testPath, keyBy)
+	if err != nil {
+		return err
+	}
+	overlap := []string{}
+	for key := range testKeys {
+		if trainKeys[key] {
+			overlap = append(overlap, key)
+		}
+	}
+	if len(overlap) > 0 {
+		sort.Strings(overlap)
+		examples := overlap
+		if len(examples) > 5 {
+			examples = examples[:5]
+		}
+		return fmt.Errorf("train/test leakage: %d of %d compounds in test data %s are also in train data %s, for example:\n%s",
+			len(overlap), len(testKeys), testPath, trainPath, strings.Join(examples, "\n"))
+	}
+	idsLog := ""
+	if idsPath != "" {
+		ids, err := readCompoundIDs(idsPath)
+		if err != nil {
+			return err
+		}
+		// The train structure of each ID
+		trainIDs := map[string]string{}
+		for key := range trainKeys {
+			for _, id := range ids.idsOf(key) {
+				trainIDs[id] = key
+			}
+		}
+		idOverlap := []string{}
+		for key := range testKeys {
+			for _, id := range ids.idsOf(key) {
+				if trainKey, ok := trainIDs[id]; ok {
+					idOverlap = append(idOverlap, fmt.Sprintf("%s: %s (test), %s (train)", id, key, trainKey))
+				}
+			}
+		}
+		if len(idOverlap) > 0 {
+			sort.Strings(idOverlap)
+			examples := idOverlap
+			if len(examples) > 5 {
+				examples = examples[:5]
+			}
+			return fmt.Errorf("train/test leakage: %d compound IDs in test data %s are also in train data %s, with other structures, for example:\n%s",
+				len(idOverlap), testPath, trainPath, strings.Join(examples, "\n"))
+		}
+		idsLog = fmt.Sprintf("ids: %s\nid overlap: 0\n", idsPath)
+	}
+	logFile, err := createFile(logPath)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(logFile, "train: %s\ntest: %s\nkey: %s\ntrain compounds: %d\ntest compounds: %d\noverlap: 0\n%s",
+		trainPath, testPath, keyBy, len(trainKeys), len(testKeys), idsLog)
+	if err != nil {
+		logFile.Close()
+		return err
+	}
+	return logFile.Close()
+}
+
+// readLeakageKeys returns the set of keys identifying the compounds in a file
+func readLeakageKeys(path string, keyBy LeakageKey) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	keys := map[string]bool{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		switch keyBy {
+		case LeakageKeySMILES:
+			smiles := strings.Fields(line)[0]
+			if mol, err := chem.ParseSMILES(smiles); err == nil {
+				smiles = mol.CanonicalSMILES()
+			}
+			keys[smiles] = true
+		case LeakageKeyRow:
+			keys[strings.Join(strings.Fields(line), " ")] = true
+		default:
+			return nil, fmt.Errorf("unknown leakage key: %s", keyBy)
+		}
+	}
+	return keys, sc.Err()
+}
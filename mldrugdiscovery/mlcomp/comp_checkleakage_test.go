@@ -0,0 +1,142 @@
+package mlcomp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadLeakageKeys(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "leakage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, tc := range []struct {
+		keyBy        LeakageKey
+		train        string
+		test         string
+		expectedKeys int
+		overlapping  bool
+	}{
+		{LeakageKeySMILES, "CCO\t1.0\t[C] 2\n", "c1ccccc1\t2.0\t[c] 6\n", 1, false},
+		// The same structure written differently must be caught
+		{LeakageKeySMILES, "CCO\t1.0\t[C] 2\n", "OCC\t1.5\t[C] 2\n", 1, true},
+		{LeakageKeyRow, "1.0 1:2 3:1\n2.0 2:1\n", "1.0 1:2  3:1\n", 2, true},
+		{LeakageKeyRow, "1.0 1:2 3:1\n", "1.5 1:2 3:1\n", 1, false},
+	} {
+		trainPath := filepath.Join(tmpDir, "train")
+		testPath := filepath.Join(tmpDir, "test")
+		ioutil.WriteFile(trainPath, []byte(tc.train), 0644)
+		ioutil.WriteFile(testPath, []byte(tc.test), 0644)
+		trainKeys, err := readLeakageKeys(trainPath, tc.keyBy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testKeys, err := readLeakageKeys(testPath, tc.keyBy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(trainKeys) != tc.expectedKeys {
+			t.Errorf("Expected %d train keys, got %d: %v", tc.expectedKeys, len(trainKeys), trainKeys)
+		}
+		overlapping := false
+		for key := range testKeys {
+			overlapping = overlapping || trainKeys[key]
+		}
+		if overlapping != tc.overlapping {
+			t.Errorf("Expected overlap %t for train %q and test %q", tc.overlapping, tc.train, tc.test)
+		}
+	}
+}
+
+func TestCheckLeakage(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "leakage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+	// Rows written by CompoundRows for the folds of sparse data. The leaking
+	// test fold has a train compound, and another with its structure
+	// written differently.
+	files := map[string]string{
+		"fld_trn":      "CCO\t1\nc1ccccc1\t2\nCCN\t3\n",
+		"fld_tst":      "CCOC\t4\nCCCO\t5\n",
+		"fld_tst_leak": "OCC\t4\nCCN\t5\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(path(name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := checkLeakage(path("fld_trn"), path("fld_tst"), LeakageKeySMILES, "", path("fld_tst.leakcheck")); err != nil {
+		t.Fatalf("Expected no leakage between disjoint folds, got: %v", err)
+	}
+	if log, err := ioutil.ReadFile(path("fld_tst.leakcheck")); err != nil || !strings.Contains(string(log), "train compounds: 3\ntest compounds: 2\noverlap: 0\n") {
+		t.Errorf("Unexpected leakage check log: %q (%v)", log, err)
+	}
+
+	err = checkLeakage(path("fld_trn"), path("fld_tst_leak"), LeakageKeySMILES, "", path("fld_tst_leak.leakcheck"))
+	if err == nil {
+		t.Fatal("Expected an error for compounds in both the train and the test fold")
+	}
+	for _, expected := range []string{"2 of 2 compounds in test data", "\nC(C)N\nC(C)O"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected the leakage error to contain %q, got: %v", expected, err)
+		}
+	}
+	if _, err := os.Stat(path("fld_tst_leak.leakcheck")); !os.IsNotExist(err) {
+		t.Errorf("Expected no log when leakage is found")
+	}
+
+	// With compound IDs, as written by LoadDataset, an ID given to both a
+	// train and a test structure is leakage too
+	ids := "id\tsmiles\nA1\tCCO\nA2\tc1ccccc1\nA3\tCCN\nB1\tCCOC\nB2\tCCCO\n"
+	if err := ioutil.WriteFile(path("ids"), []byte(ids), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkLeakage(path("fld_trn"), path("fld_tst"), LeakageKeySMILES, path("ids"), path("fld_tst.leakcheck")); err != nil {
+		t.Fatalf("Expected no leakage between folds with different IDs, got: %v", err)
+	}
+	if log, err := ioutil.ReadFile(path("fld_tst.leakcheck")); err != nil || !strings.Contains(string(log), "id overlap: 0\n") {
+		t.Errorf("Expected the ID check in the leakage check log, got: %q (%v)", log, err)
+	}
+	if err := ioutil.WriteFile(path("ids"), []byte(ids+"A1\tCCCO\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = checkLeakage(path("fld_trn"), path("fld_tst"), LeakageKeySMILES, path("ids"), path("fld_tst.leakcheck"))
+	if err == nil || !strings.Contains(err.Error(), "1 compound IDs in test data") || !strings.Contains(err.Error(), "A1: C(CO)C (test), C(C)O (train)") {
+		t.Errorf("Expected an error for the ID of both a train and a test compound, got: %v", err)
+	}
+	if err := checkLeakage(path("fld_trn"), path("fld_tst"), LeakageKeyRow, path("ids"), path("fld_tst.leakcheck")); err == nil {
+		t.Error("Expected an error for checking IDs of sparse rows")
+	}
+}
+
+func TestWriteCompoundRows(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "compoundrows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+	ioutil.WriteFile(path("train.sparse"), []byte("1.0 1:2\n1.0 1:2\n2.0 2:1\n"), 0644)
+	ioutil.WriteFile(path("train.signs"), []byte("CCO\t1.0\t[C] 2\nCOC\t1.0\t[C] 2\nCCN\t2.0\t[N] 1\n"), 0644)
+	ioutil.WriteFile(path("short.signs"), []byte("CCO\t1.0\t[C] 2\n"), 0644)
+
+	if err := writeCompoundRows(path("train.sparse"), path("train.signs"), path("train.sparse.rows")); err != nil {
+		t.Fatal(err)
+	}
+	expected := "CCO\t1\nCOC\t2\nCCN\t3\n"
+	if rows, err := ioutil.ReadFile(path("train.sparse.rows")); err != nil || string(rows) != expected {
+		t.Errorf("Wrong compound rows:\nEXPECTED: %q\nACTUAL: %q (%v)", expected, rows, err)
+	}
+	if err := writeCompoundRows(path("train.sparse"), path("short.signs"), path("short.rows")); err == nil {
+		t.Error("Expected an error for a signatures file with fewer compounds than rows")
+	}
+}
@@ -0,0 +1,171 @@
+package mlcomp
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+// CompareCosts compares the per-fold RMSDs of the best cost with those of
+// every other cost, with paired tests: the Wilcoxon signed-rank test and the
+// corrected resampled t-test, which accounts for the overlap between the
+// train sets of the folds. The result is written as a Markdown section.
+type CompareCosts struct {
+	*Process
+}
+
+// CompareCostsConf contains parameters for initializing a CompareCosts
+// process
+type CompareCostsConf struct {
+	Title string
+}
+
+// NewCompareCosts returns a new CompareCosts process
+func NewCompareCosts(wf *sp.Workflow, name string, params CompareCostsConf) *CompareCosts {
+	p := newProcess(wf, name, "# Go cost comparison: {i:costrmsds} {i:bestcost} {o:comparison}")
+	p.SetOut("comparison", "{i:costrmsds}.comparison.md")
+	p.CustomExecute = func(t *sp.Task) {
+		if err := compareCosts(params.Title, t.InPath("costrmsds"), t.InPath("bestcost"), t.OutIP("comparison").TempPath()); err != nil {
+			sp.Failf("Could not compare costs in %s: %v", t.InPath("costrmsds"), err)
+		}
+	}
+	return &CompareCosts{p}
+}
+
+// InCostRMSDs returns the CostRMSDs in-port, taking a table with the mean,
+// standard deviation and per-fold RMSDs of each cost
+func (p *CompareCosts) InCostRMSDs() *sp.InPort {
+	return p.In("costrmsds")
+}
+
+// InBestCost returns the BestCost in-port
+func (p *CompareCosts) InBestCost() *sp.InPort {
+	return p.In("bestcost")
+}
+
+// OutComparison returns the Comparison out-port
+func (p *CompareCosts) OutComparison() *sp.OutPort {
+	return p.Out("comparison")
+}
+
+// costRMSDs are the cross-validation RMSDs for one cost and train size
+type costRMSDs struct {
+	trainSize int
+	cost      float64
+	mean      float64
+	sd        float64
+	// folds maps fold labels to RMSDs
+	folds map[string]float64
+}
+
+// readCostRMSDs reads a table with one cost on each line, with the columns
+// train size, mean RMSD, cost, RMSD standard deviation, and a comma-separated
+// list of fold:RMSD pairs
+func readCostRMSDs(path string) ([]costRMSDs, error) {
+	rows := []costRMSDs{}
+	err := ForEachLine(path, func(lineNo int, line string) error {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			return fmt.Errorf("%s, line %d: expected train size, mean RMSD, cost, SD and fold RMSDs", path, lineNo)
+		}
+		row := costRMSDs{folds: map[string]float64{}}
+		var err error
+		if row.trainSize, err = strconv.Atoi(fields[0]); err != nil {
+			return fmt.Errorf("%s, line %d: %v", path, lineNo, err)
+		}
+		for i, val := range []*float64{&row.mean, &row.cost, &row.sd} {
+			if *val, err = strconv.ParseFloat(fields[i+1], 64); err != nil {
+				return fmt.Errorf("%s, line %d: %v", path, lineNo, err)
+			}
+		}
+		for _, foldRMSD := range strings.Split(fields[4], ",") {
+			parts := strings.SplitN(foldRMSD, ":", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("%s, line %d: invalid fold RMSD: %q", path, lineNo, foldRMSD)
+			}
+			if row.folds[parts[0]], err = strconv.ParseFloat(parts[1], 64); err != nil {
+				return fmt.Errorf("%s, line %d: %v", path, lineNo, err)
+			}
+		}
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, err
+}
+
+func compareCosts(title string, costRMSDsPath string, bestCostPath string, outPath string) error {
+	rows, err := readCostRMSDs(costRMSDsPath)
+	if err != nil {
+		return err
+	}
+	bestCost, err := readBestCost(bestCostPath)
+	if err != nil {
+		return err
+	}
+	var best *costRMSDs
+	for i := range rows {
+		if sameCost(rows[i].cost, bestCost) {
+			best = &rows[i]
+		}
+	}
+	if best == nil {
+		return fmt.Errorf("best cost %g not found in %s", bestCost, costRMSDsPath)
+	}
+
+	outFile, err := createFile(outPath)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+	bw := bufio.NewWriter(outFile)
+	fmt.Fprintf(bw, "## %s\n\n"+
+		"Paired tests of the per-fold RMSDs of each cost against the selected cost %g. "+
+		"Low p-values mean that the cost is significantly different from the selected one.\n\n"+
+		"| Cost | Mean RMSD | SD | Difference | Wilcoxon p | Corrected t-test p |\n"+
+		"|---:|---:|---:|---:|---:|---:|\n", title, bestCost)
+	for _, row := range rows {
+		if row.cost == best.cost {
+			fmt.Fprintf(bw, "| **%g** | %.4f | %.4f | - | - | - |\n", row.cost, row.mean, row.sd)
+			continue
+		}
+		diffs := []float64{}
+		for fold, rmsd := range row.folds {
+			if bestRMSD, ok := best.folds[fold]; ok {
+				diffs = append(diffs, rmsd-bestRMSD)
+			}
+		}
+		fmt.Fprintf(bw, "| %g | %.4f | %.4f | %+.4f | %.4f | %.4f |\n", row.cost, row.mean, row.sd, row.mean-best.mean,
+			wilcoxonSignedRank(diffs), correctedResampledTTest(diffs, 1/float64(len(best.folds))))
+	}
+	fmt.Fprintln(bw)
+	return bw.Flush()
+}
+
+// readBestCost reads the cost from a file with the train size, the RMSD and
+// the cost of the best cost value
+func readBestCost(path string) (float64, error) {
+	bestCostBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(bestCostBytes))
+	if len(fields) < 3 {
+		return 0, fmt.Errorf("unexpected best cost file content in %s: %q", path, bestCostBytes)
+	}
+	cost, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cost in %s: %v", path, err)
+	}
+	return cost, nil
+}
+
+// sameCost returns true if two cost values are equal, up to differences from
+// formatting them as text
+func sameCost(a float64, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
@@ -0,0 +1,86 @@
+package mlcomp
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+// CompoundRows writes the compound of every row in a sparse dataset, as its
+// SMILES and 1-based row number, taken from the signatures file the dataset
+// was created from. Shuffled and split with the same random bytes and line
+// counts as the dataset, it identifies the compounds in the folds of
+// cross-validation, where rows can not be told apart by their content.
+type CompoundRows struct {
+	*Process
+}
+
+// CompoundRowsConf contains parameters for initializing a CompoundRows
+// process
+type CompoundRowsConf struct {
+}
+
+// NewCompoundRows returns a new CompoundRows process
+func NewCompoundRows(wf *sp.Workflow, name string, params CompoundRowsConf) *CompoundRows {
+	p := newProcess(wf, name, "# Go compound rows: {i:data} {i:signatures} {o:rows}")
+	p.SetOut("rows", "{i:data}.rows")
+	p.CustomExecute = func(t *sp.Task) {
+		if err := writeCompoundRows(t.InPath("data"), t.InPath("signatures"), t.OutIP("rows").TempPath()); err != nil {
+			sp.Failf("Could not write compound rows for %s: %v", t.InPath("data"), err)
+		}
+	}
+	return &CompoundRows{p}
+}
+
+// InData returns the Data in-port, taking an (un-gzipped) sparse dataset
+func (p *CompoundRows) InData() *sp.InPort {
+	return p.In("data")
+}
+
+// InSignatures returns the Signatures in-port, taking the signatures file the
+// sparse dataset was created from, with a compound on each line
+func (p *CompoundRows) InSignatures() *sp.InPort {
+	return p.In("signatures")
+}
+
+// OutRows returns the Rows out-port, with the SMILES and row number of a
+// compound, separated by a tab, on each line
+func (p *CompoundRows) OutRows() *sp.OutPort {
+	return p.Out("rows")
+}
+
+func writeCompoundRows(dataPath string, signsPath string, rowsPath string) error {
+	rowCnt := 0
+	if err := ForEachLine(dataPath, func(lineNo int, line string) error {
+		rowCnt++
+		return nil
+	}); err != nil {
+		return err
+	}
+	smiles := []string{}
+	if err := ForEachLine(signsPath, func(lineNo int, line string) error {
+		smiles = append(smiles, strings.Fields(line)[0])
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(smiles) != rowCnt {
+		return fmt.Errorf("%d rows in %s, but %d compounds in %s", rowCnt, dataPath, len(smiles), signsPath)
+	}
+
+	rowsFile, err := createFile(rowsPath)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(rowsFile)
+	for i, smi := range smiles {
+		fmt.Fprintf(bw, "%s\t%d\n", smi, i+1)
+	}
+	if err := bw.Flush(); err != nil {
+		rowsFile.Close()
+		return err
+	}
+	return rowsFile.Close()
+}
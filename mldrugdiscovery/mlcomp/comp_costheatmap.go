@@ -0,0 +1,114 @@
+package mlcomp
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+// CostHeatmap plots the mean cross-validation RMSD for every combination of
+// cost and train size as a heatmap, in SVG format, and writes a Markdown
+// section including it
+type CostHeatmap struct {
+	*Process
+}
+
+// CostHeatmapConf contains parameters for initializing a CostHeatmap process
+type CostHeatmapConf struct {
+	Title string
+	// ReportDir is the directory of the report that the Markdown section is
+	// included in, which the link to the SVG file is made relative to
+	ReportDir string
+}
+
+// NewCostHeatmap returns a new CostHeatmap process
+func NewCostHeatmap(wf *sp.Workflow, name string, params CostHeatmapConf) *CostHeatmap {
+	p := newProcess(wf, name, "# Go cost heatmap: {i:costrmsds} {o:svg} {o:section}")
+	p.SetOut("svg", "{i:costrmsds}.heatmap.svg")
+	p.SetOut("section", "{i:costrmsds}.heatmap.md")
+	p.CustomExecute = func(t *sp.Task) {
+		rows, err := readCostRMSDs(t.InPath("costrmsds"))
+		if err != nil {
+			sp.Fail(err)
+		}
+		svgFile, err := createFile(t.OutIP("svg").TempPath())
+		if err != nil {
+			sp.Fail(err)
+		}
+		defer svgFile.Close()
+		if _, err := svgFile.WriteString(costHeatmapSVG(params.Title, rows)); err != nil {
+			sp.Fail(err)
+		}
+		sectionFile, err := createFile(t.OutIP("section").TempPath())
+		if err != nil {
+			sp.Fail(err)
+		}
+		defer sectionFile.Close()
+		svgLink, err := filepath.Rel(params.ReportDir, t.OutIP("svg").Path())
+		if err != nil {
+			svgLink = t.OutIP("svg").Path()
+		}
+		fmt.Fprintf(sectionFile, "## %s\n\nMean cross-validation RMSD per cost and train size. "+
+			"The lowest RMSD for each train size is outlined.\n\n![%s](%s)\n\n",
+			params.Title, params.Title, svgLink)
+	}
+	return &CostHeatmap{p}
+}
+
+// InCostRMSDs returns the CostRMSDs in-port, taking a table as read by
+// readCostRMSDs, for any number of train sizes
+func (p *CostHeatmap) InCostRMSDs() *sp.InPort {
+	return p.In("costrmsds")
+}
+
+// OutSVG returns the SVG out-port
+func (p *CostHeatmap) OutSVG() *sp.OutPort {
+	return p.Out("svg")
+}
+
+// OutSection returns the Section out-port, with a Markdown section for the
+// run report
+func (p *CostHeatmap) OutSection() *sp.OutPort {
+	return p.Out("section")
+}
+
+func costHeatmapSVG(title string, rows []costRMSDs) string {
+	costSet, trainSizeSet := map[float64]bool{}, map[int]bool{}
+	for _, row := range rows {
+		costSet[row.cost] = true
+		trainSizeSet[row.trainSize] = true
+	}
+	costs := []float64{}
+	for cost := range costSet {
+		costs = append(costs, cost)
+	}
+	sort.Float64s(costs)
+	trainSizes := []int{}
+	for trainSize := range trainSizeSet {
+		trainSizes = append(trainSizes, trainSize)
+	}
+	sort.Ints(trainSizes)
+
+	values := make([][]float64, len(costs))
+	costLabels := make([]string, len(costs))
+	for i, cost := range costs {
+		costLabels[i] = fmt.Sprintf("%g", cost)
+		values[i] = make([]float64, len(trainSizes))
+		for j := range values[i] {
+			values[i][j] = math.NaN()
+		}
+	}
+	trainSizeLabels := make([]string, len(trainSizes))
+	for j, trainSize := range trainSizes {
+		trainSizeLabels[j] = fmt.Sprintf("%d", trainSize)
+	}
+	for _, row := range rows {
+		i := sort.SearchFloat64s(costs, row.cost)
+		j := sort.SearchInts(trainSizes, row.trainSize)
+		values[i][j] = row.mean
+	}
+	return svgHeatmap(title, "Train size", "Cost", trainSizeLabels, costLabels, values)
+}
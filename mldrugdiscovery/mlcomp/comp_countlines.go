@@ -1,12 +1,12 @@
-package main
+package mlcomp
 
 import (
 	sp "github.com/scipipe/scipipe"
 )
 
-// CountLines does blabla ...
+// CountLines counts the lines in a file, optionally gzipped
 type CountLines struct {
-	*sp.Process
+	*Process
 }
 
 // CountLinesConf contains parameters for initializing a
@@ -21,7 +21,7 @@ func NewCountLines(wf *sp.Workflow, name string, params CountLinesConf) *CountLi
 	if params.UnGzip {
 		cmd = "z" + cmd
 	}
-	p := wf.NewProc(name, cmd)
+	p := newProcess(wf, name, cmd)
 	p.SetOut("linecnt", "{i:in}.linecnt")
 	return &CountLines{p}
 }
@@ -1,12 +1,13 @@
-package main
+package mlcomp
 
 import (
 	sp "github.com/scipipe/scipipe"
 )
 
-// CreateFolds does blabla ...
+// CreateFolds splits a dataset into the train and test data of one
+// cross-validation fold
 type CreateFolds struct {
-	*sp.Process
+	*Process
 }
 
 // CreateFoldsConf contains parameters for initializing a
@@ -33,7 +34,7 @@ func NewCreateFolds(wf *sp.Workflow, name string, params CreateFoldsConf) *Creat
 	// Create test dataset
 	cmd += `awk -v tststart=$tststart -v tstend=$tstend '(NR >= tststart && NR < tstend) { print }' {i:in} > {o:testdata}`
 
-	p := wf.NewProc(name, cmd)
+	p := newProcess(wf, name, cmd)
 	p.SetOut("foldinfo", fs("{i:in}.fld%02d_info", params.FoldIdx))
 	p.SetOut("traindata", fs("{i:in}.fld%02d_trn", params.FoldIdx))
 	p.SetOut("testdata", fs("{i:in}.fld%02d_tst", params.FoldIdx))
@@ -0,0 +1,89 @@
+package mlcomp
+
+import (
+	"os"
+
+	"github.com/pharmbio/scipipe-demo/mldrugdiscovery/chem"
+	sp "github.com/scipipe/scipipe"
+)
+
+// CreateSparseTest creates a sparse test dataset from a signatures file,
+// with the columns of the signatures of the train dataset
+type CreateSparseTest struct {
+	*Process
+}
+
+// CreateSparseTestConf contains parameters for initializing a
+// CreateSparseTest process
+type CreateSparseTestConf struct {
+	ReplicateID string
+	Engine      SignatureEngine
+	// ToolPath is the path of CreateSparseDataset.jar, defaults to
+	// DefaultBinDir + "CreateSparseDataset.jar"
+	ToolPath string
+	// JavaPath is the path of the java command, defaults to java in PATH
+	JavaPath string
+}
+
+// NewCreateSparseTest returns a new CreateSparseTest process
+func NewCreateSparseTest(wf *sp.Workflow, name string, params CreateSparseTestConf) *CreateSparseTest {
+	cmd := commandPath(params.JavaPath, "java") + ` -jar ` + toolPath(params.ToolPath, "CreateSparseDataset.jar") + ` \
+	-inputfile {i:testdata} \
+	-signaturesinfile {i:signaturesinfile} \
+	-datasetfile {o:sparsetest} \
+	-signaturesoutfile {o:signatures} \
+	-silent`
+	if params.Engine.IsGo() {
+		cmd = `# Go sparse dataset creation: {i:testdata} {i:signaturesinfile} {o:sparsetest} {o:signatures} {o:log}`
+	}
+	p := newProcess(wf, name, cmd)
+	p.SetOut("sparsetest", "{i:testdata}.csr")
+	p.SetOut("signatures", "{i:testdata}.sign")
+	p.SetOut("log", "{i:testdata}.csr.log")
+	if params.Engine.IsGo() {
+		p.CustomExecute = func(t *sp.Task) {
+			vocFile, err := os.Open(t.InPath("signaturesinfile"))
+			if err != nil {
+				sp.Failf("Could not open signatures file: %v", err)
+			}
+			voc, err := chem.ReadVocabulary(vocFile)
+			vocFile.Close()
+			if err != nil {
+				sp.Failf("Could not read signatures file %s: %v", t.InPath("signaturesinfile"), err)
+			}
+			err = CreateSparseDataset(t.InPath("testdata"), voc, false,
+				t.OutIP("sparsetest").TempPath(),
+				t.OutIP("signatures").TempPath(),
+				t.OutIP("log").TempPath())
+			if err != nil {
+				sp.Failf("Could not create sparse test dataset from %s: %v", t.InPath("testdata"), err)
+			}
+		}
+	}
+	return &CreateSparseTest{p}
+}
+
+// InTestdata returns the Testdata in-port
+func (p *CreateSparseTest) InTestdata() *sp.InPort {
+	return p.In("testdata")
+}
+
+// InSignatures returns the Testdata in-port
+func (p *CreateSparseTest) InSignatures() *sp.InPort {
+	return p.In("signaturesinfile")
+}
+
+// OutSparseTestdata returns the SparseTestdata out-port
+func (p *CreateSparseTest) OutSparseTestdata() *sp.OutPort {
+	return p.Out("sparsetest")
+}
+
+// OutSignatures returns the Signatures out-port
+func (p *CreateSparseTest) OutSignatures() *sp.OutPort {
+	return p.Out("signatures")
+}
+
+// OutLog returns the Log out-port
+func (p *CreateSparseTest) OutLog() *sp.OutPort {
+	return p.Out("log")
+}
@@ -0,0 +1,139 @@
+package mlcomp
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"os"
+
+	"github.com/pharmbio/scipipe-demo/mldrugdiscovery/chem"
+	sp "github.com/scipipe/scipipe"
+)
+
+// CreateSparseTrain creates a sparse train dataset from a signatures file,
+// and the signatures file defining its columns
+type CreateSparseTrain struct {
+	*Process
+}
+
+// CreateSparseTrainConf contains parameters for initializing a
+// CreateSparseTrain process
+type CreateSparseTrainConf struct {
+	ReplicateID string
+	Engine      SignatureEngine
+	// ToolPath is the path of CreateSparseDataset.jar, defaults to
+	// DefaultBinDir + "CreateSparseDataset.jar"
+	ToolPath string
+	// JavaPath is the path of the java command, defaults to java in PATH
+	JavaPath string
+}
+
+// NewCreateSparseTrain returns a new CreateSparseTrain process
+func NewCreateSparseTrain(wf *sp.Workflow, name string, params CreateSparseTrainConf) *CreateSparseTrain {
+	cmd := commandPath(params.JavaPath, "java") + ` -jar ` + toolPath(params.ToolPath, "CreateSparseDataset.jar") + ` \
+	-inputfile {i:traindata} \
+	-datasetfile {o:sparsetrain} \
+	-signaturesoutfile {o:signatures} \
+	-silent`
+	if params.Engine.IsGo() {
+		cmd = `# Go sparse dataset creation: {i:traindata} {o:sparsetrain} {o:signatures} {o:log}`
+	}
+	p := newProcess(wf, name, cmd)
+	p.SetOut("sparsetrain", "{i:traindata}.csr")
+	p.SetOut("signatures", "{i:traindata}.sign")
+	p.SetOut("log", "{i:traindata}.csr.log")
+	if params.Engine.IsGo() {
+		p.CustomExecute = func(t *sp.Task) {
+			voc := chem.NewVocabulary()
+			err := CreateSparseDataset(t.InPath("traindata"), voc, true,
+				t.OutIP("sparsetrain").TempPath(),
+				t.OutIP("signatures").TempPath(),
+				t.OutIP("log").TempPath())
+			if err != nil {
+				sp.Failf("Could not create sparse train dataset from %s: %v", t.InPath("traindata"), err)
+			}
+		}
+	}
+	return &CreateSparseTrain{p}
+}
+
+// InTraindata returns the Traindata in-port
+func (p *CreateSparseTrain) InTraindata() *sp.InPort {
+	return p.In("traindata")
+}
+
+// OutSparseTraindata returns the SparseTraindata out-port
+func (p *CreateSparseTrain) OutSparseTraindata() *sp.OutPort {
+	return p.Out("sparsetrain")
+}
+
+// OutSignatures returns the Signatures out-port
+func (p *CreateSparseTrain) OutSignatures() *sp.OutPort {
+	return p.Out("signatures")
+}
+
+// OutLog returns the Log out-port
+func (p *CreateSparseTrain) OutLog() *sp.OutPort {
+	return p.Out("log")
+}
+
+// CreateSparseDataset converts a signatures file into a gzipped sparse
+// dataset, using the columns in voc, which is extended with new signatures
+// if grow is true. The resulting vocabulary and a short log are also written.
+func CreateSparseDataset(signPath string, voc *chem.Vocabulary, grow bool, datasetPath string, vocPath string, logPath string) error {
+	inFile, err := os.Open(signPath)
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+
+	datasetFile, err := createFile(datasetPath)
+	if err != nil {
+		return err
+	}
+	defer datasetFile.Close()
+	gzw := gzip.NewWriter(datasetFile)
+	bw := bufio.NewWriter(gzw)
+
+	rows := 0
+	startCols := voc.Len()
+	sc := bufio.NewScanner(inFile)
+	sc.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		if sc.Text() == "" {
+			continue
+		}
+		rec, err := chem.ParseSignatureRecord(sc.Text())
+		if err != nil {
+			return fmt.Errorf("line %d in %s: %v", lineNo, signPath, err)
+		}
+		fmt.Fprintln(bw, chem.SparseRow(rec, voc, grow))
+		rows++
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if err := gzw.Close(); err != nil {
+		return err
+	}
+
+	vocFile, err := createFile(vocPath)
+	if err != nil {
+		return err
+	}
+	defer vocFile.Close()
+	if err := voc.Write(vocFile); err != nil {
+		return err
+	}
+
+	logFile, err := createFile(logPath)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	_, err = fmt.Fprintf(logFile, "records: %d\nsignatures: %d\nnew signatures: %d\n", rows, voc.Len(), voc.Len()-startCols)
+	return err
+}
@@ -0,0 +1,41 @@
+package mlcomp
+
+import (
+	"github.com/pharmbio/scipipe-demo/download"
+	sp "github.com/scipipe/scipipe"
+)
+
+// Download downloads a file, such as the tools tarball or the test dataset,
+// via a download cache, and verifies its SHA-256 checksum
+type Download struct {
+	*Process
+}
+
+// DownloadConf contains parameters for initializing a Download process
+type DownloadConf struct {
+	// URL is the http:// or https:// URL to download the file from
+	URL string
+	// SHA256 is the expected hex-encoded SHA-256 checksum of the file
+	SHA256 string
+	// Path is the path to write the file to
+	Path string
+	// Cache is the download cache to resolve the file from
+	Cache download.Cache
+}
+
+// NewDownload returns a new Download process
+func NewDownload(wf *sp.Workflow, name string, params DownloadConf) *Download {
+	p := newProcess(wf, name, "# Go download: {o:file}")
+	p.SetOut("file", params.Path)
+	p.CustomExecute = func(t *sp.Task) {
+		if err := params.Cache.Fetch(params.URL, params.SHA256, t.OutIP("file").TempPath()); err != nil {
+			sp.Failf("Could not download %s: %v", params.URL, err)
+		}
+	}
+	return &Download{p}
+}
+
+// OutFile returns the File out-port
+func (p *Download) OutFile() *sp.OutPort {
+	return p.Out("file")
+}
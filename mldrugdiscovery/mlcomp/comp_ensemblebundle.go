@@ -0,0 +1,56 @@
+package mlcomp
+
+import (
+	sp "github.com/scipipe/scipipe"
+)
+
+// EnsembleBundle stores the members of a bagged ensemble as a single tar
+// bundle, with each member model and the signatures file its columns refer
+// to. See ensemble.go for the layout of the bundle.
+type EnsembleBundle struct {
+	*Process
+}
+
+// EnsembleBundleConf contains parameters for initializing an EnsembleBundle
+// process
+type EnsembleBundleConf struct {
+	Method EnsembleMethod
+	// Keys identify the ensemble. The replicate is empty for replicate
+	// ensembles.
+	Keys ResultKeys
+}
+
+// NewEnsembleBundle returns a new EnsembleBundle process
+func NewEnsembleBundle(wf *sp.Workflow, name string, params EnsembleBundleConf) *EnsembleBundle {
+	p := newProcess(wf, name, "# Go ensemble bundle: {i:members} {o:bundle}")
+	p.SetOut("bundle", "{i:members|%.members.tsv}.tar")
+	p.CustomExecute = func(t *sp.Task) {
+		keys := params.Keys
+		info := [][2]string{
+			{"method", string(params.Method)},
+			{"run_id", keys.RunID},
+			{"dataset", keys.Dataset},
+			{"replicate", keys.Replicate},
+			{"heights", keys.Heights},
+			{"train_size", fs("%d", keys.TrainSize)},
+		}
+		if keys.Endpoint != "" {
+			info = append(info, [2]string{"endpoint", keys.Endpoint})
+		}
+		if err := writeEnsembleBundle(t.InPath("members"), t.OutIP("bundle").TempPath(), info); err != nil {
+			sp.Failf("Could not bundle the ensemble members in %s: %v", t.InPath("members"), err)
+		}
+	}
+	return &EnsembleBundle{p}
+}
+
+// InMembers returns the Members in-port, taking a file with the path of a
+// member model and the path of its signatures file on each line
+func (p *EnsembleBundle) InMembers() *sp.InPort {
+	return p.In("members")
+}
+
+// OutBundle returns the Bundle out-port
+func (p *EnsembleBundle) OutBundle() *sp.OutPort {
+	return p.Out("bundle")
+}
@@ -0,0 +1,317 @@
+package mlcomp
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pharmbio/scipipe-demo/mldrugdiscovery/chem"
+	sp "github.com/scipipe/scipipe"
+)
+
+// ExportDataset writes the sampled train and test sets, with compound IDs and
+// responses, in formats readable by common machine learning tools: SVMLight,
+// MatrixMarket, NumPy .npz (in the format of scipy.sparse.save_npz) and, for
+// small sets, dense CSV. The files are written to a directory, together with
+// the signature vocabulary.
+type ExportDataset struct {
+	*Process
+}
+
+// ExportDatasetConf contains parameters for initializing an ExportDataset
+// process
+type ExportDatasetConf struct {
+	// WithIDs should be true if the IDs in-port is connected, to take
+	// compound IDs from the ids file of LoadDataset. Otherwise compounds are
+	// identified by their SMILES.
+	WithIDs bool
+	// MaxDenseCells is the maximum number of cells (rows times signatures)
+	// of a set for writing it as dense CSV
+	MaxDenseCells int
+}
+
+// NewExportDataset returns a new ExportDataset process
+func NewExportDataset(wf *sp.Workflow, name string, params ExportDatasetConf) *ExportDataset {
+	cmd := "# Go dataset export: {i:traindata} {i:testdata} {i:trainsigns} {i:testsigns} {i:signatures} {o:export}"
+	if params.WithIDs {
+		cmd += " {i:ids}"
+	}
+	p := newProcess(wf, name, cmd)
+	p.SetOut("export", "{i:traindata}.export")
+	p.CustomExecute = func(t *sp.Task) {
+		var ids compoundIDIndex
+		if params.WithIDs {
+			var err error
+			if ids, err = readCompoundIDs(t.InPath("ids")); err != nil {
+				sp.Fail(err)
+			}
+		}
+		vocFile, err := os.Open(t.InPath("signatures"))
+		if err != nil {
+			sp.Fail(err)
+		}
+		voc, err := chem.ReadVocabulary(vocFile)
+		vocFile.Close()
+		if err != nil {
+			sp.Failf("Could not read signatures in %s: %v", t.InPath("signatures"), err)
+		}
+		exportDir := t.OutIP("export").TempPath()
+		vocOut, err := createFile(filepath.Join(exportDir, "vocabulary.tsv"))
+		if err != nil {
+			sp.Fail(err)
+		}
+		if err := voc.Write(vocOut); err != nil {
+			sp.Fail(err)
+		}
+		vocOut.Close()
+		for _, split := range []struct{ name, sparse, signs string }{
+			{"train", t.InPath("traindata"), t.InPath("trainsigns")},
+			{"test", t.InPath("testdata"), t.InPath("testsigns")},
+		} {
+			set, err := readExportSet(split.sparse, split.signs, ids, voc.Len())
+			if err != nil {
+				sp.Failf("Could not read %s data for export: %v", split.name, err)
+			}
+			if err := set.write(filepath.Join(exportDir, split.name), voc, params.MaxDenseCells); err != nil {
+				sp.Failf("Could not export %s data: %v", split.name, err)
+			}
+		}
+	}
+	return &ExportDataset{p}
+}
+
+// InTrainData returns the TrainData in-port, taking the (un-gzipped) sparse
+// train data
+func (p *ExportDataset) InTrainData() *sp.InPort {
+	return p.In("traindata")
+}
+
+// InTestData returns the TestData in-port, taking the (un-gzipped) sparse
+// test data
+func (p *ExportDataset) InTestData() *sp.InPort {
+	return p.In("testdata")
+}
+
+// InTrainSigns returns the TrainSigns in-port, taking the signatures file
+// the sparse train data was created from
+func (p *ExportDataset) InTrainSigns() *sp.InPort {
+	return p.In("trainsigns")
+}
+
+// InTestSigns returns the TestSigns in-port, taking the signatures file the
+// sparse test data was created from
+func (p *ExportDataset) InTestSigns() *sp.InPort {
+	return p.In("testsigns")
+}
+
+// InSignatures returns the Signatures in-port, taking the signatures file
+// written by CreateSparseTrain
+func (p *ExportDataset) InSignatures() *sp.InPort {
+	return p.In("signatures")
+}
+
+// InIDs returns the IDs in-port, only used if WithIDs is set
+func (p *ExportDataset) InIDs() *sp.InPort {
+	return p.In("ids")
+}
+
+// OutExport returns the Export out-port, with the directory of exported
+// files
+func (p *ExportDataset) OutExport() *sp.OutPort {
+	return p.Out("export")
+}
+
+// exportSet is a sparse dataset with the compounds of its rows
+type exportSet struct {
+	ids       []string
+	smiles    []string
+	responses []float64
+	rows      [][]sparseEntry
+	colCnt    int
+}
+
+// readExportSet reads a sparse dataset and the signatures file it was created
+// from, which has the compounds in the same order
+func readExportSet(sparsePath string, signsPath string, ids compoundIDIndex, colCnt int) (*exportSet, error) {
+	responses, rows, err := readSparseDataset(sparsePath)
+	if err != nil {
+		return nil, err
+	}
+	set := &exportSet{responses: responses, rows: rows, colCnt: colCnt}
+	if err := ForEachLine(signsPath, func(lineNo int, line string) error {
+		smiles := strings.Fields(line)[0]
+		id := smiles
+		if ids != nil {
+			id = ids.lookup(smiles)
+		}
+		set.smiles = append(set.smiles, smiles)
+		set.ids = append(set.ids, id)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if len(set.smiles) != len(rows) {
+		return nil, fmt.Errorf("%d compounds in %s, but %d rows in %s", len(set.smiles), signsPath, len(rows), sparsePath)
+	}
+	for _, row := range rows {
+		for _, e := range row {
+			if e.col > set.colCnt {
+				set.colCnt = e.col
+			}
+		}
+	}
+	return set, nil
+}
+
+func (s *exportSet) nonZeroCnt() int {
+	n := 0
+	for _, row := range s.rows {
+		n += len(row)
+	}
+	return n
+}
+
+// write writes the set to files starting with basePath
+func (s *exportSet) write(basePath string, voc *chem.Vocabulary, maxDenseCells int) error {
+	for _, w := range []func(string) error{s.writeCompounds, s.writeSVMLight, s.writeMatrixMarket, s.writeNPZ} {
+		if err := w(basePath); err != nil {
+			return err
+		}
+	}
+	if cells := len(s.rows) * s.colCnt; cells > maxDenseCells {
+		sp.Info.Printf("Not writing %s.csv, with %d cells (maximum %d)\n", basePath, cells, maxDenseCells)
+		return nil
+	}
+	return s.writeDenseCSV(basePath, voc)
+}
+
+// writeCompounds writes the row number, ID, SMILES and response of each row
+func (s *exportSet) writeCompounds(basePath string) error {
+	f, err := createFile(basePath + ".compounds.tsv")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+	fmt.Fprintln(bw, "row\tid\tsmiles\tresponse")
+	for i := range s.rows {
+		fmt.Fprintf(bw, "%d\t%s\t%s\t%g\n", i+1, s.ids[i], s.smiles[i], s.responses[i])
+	}
+	return bw.Flush()
+}
+
+// writeSVMLight writes the rows in the SVMLight format, with 1-based columns
+// as in the vocabulary, and the compound ID as a comment
+func (s *exportSet) writeSVMLight(basePath string) error {
+	f, err := createFile(basePath + ".svmlight")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+	for i, row := range s.rows {
+		fmt.Fprintf(bw, "%g", s.responses[i])
+		for _, e := range row {
+			fmt.Fprintf(bw, " %d:%g", e.col, e.val)
+		}
+		fmt.Fprintf(bw, " # %s\n", s.ids[i])
+	}
+	return bw.Flush()
+}
+
+// writeMatrixMarket writes the rows as a sparse matrix in the MatrixMarket
+// coordinate format, and the responses as a dense MatrixMarket vector
+func (s *exportSet) writeMatrixMarket(basePath string) error {
+	f, err := createFile(basePath + ".mtx")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+	fmt.Fprintf(bw, "%%%%MatrixMarket matrix coordinate real general\n%d %d %d\n", len(s.rows), s.colCnt, s.nonZeroCnt())
+	for i, row := range s.rows {
+		for _, e := range row {
+			fmt.Fprintf(bw, "%d %d %g\n", i+1, e.col, e.val)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	respFile, err := createFile(basePath + ".response.mtx")
+	if err != nil {
+		return err
+	}
+	defer respFile.Close()
+	rw := bufio.NewWriter(respFile)
+	fmt.Fprintf(rw, "%%%%MatrixMarket matrix array real general\n%d 1\n", len(s.responses))
+	for _, resp := range s.responses {
+		fmt.Fprintf(rw, "%g\n", resp)
+	}
+	return rw.Flush()
+}
+
+// writeNPZ writes the rows as a CSR matrix, loadable with
+// scipy.sparse.load_npz, with 0-based columns. The responses, IDs and SMILES
+// are included as the arrays y, ids and smiles.
+func (s *exportSet) writeNPZ(basePath string) error {
+	data, indices, indptr := []float64{}, []int{}, []int{0}
+	for _, row := range s.rows {
+		for _, e := range row {
+			data = append(data, e.val)
+			indices = append(indices, e.col-1)
+		}
+		indptr = append(indptr, len(data))
+	}
+	return writeNPZ(basePath+".npz", []npyArray{
+		npyInt32s("indices", indices),
+		npyInt32s("indptr", indptr),
+		npyByteString("format", "csr"),
+		npyInt64s("shape", []int{len(s.rows), s.colCnt}),
+		npyFloat64s("data", data),
+		npyFloat64s("y", s.responses),
+		npyStrings("ids", s.ids),
+		npyStrings("smiles", s.smiles),
+	})
+}
+
+// writeDenseCSV writes the rows as a dense table, with the ID, SMILES,
+// response and a column per signature
+func (s *exportSet) writeDenseCSV(basePath string, voc *chem.Vocabulary) error {
+	f, err := createFile(basePath + ".csv")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cw := csv.NewWriter(f)
+	header := []string{"id", "smiles", "response"}
+	for col := 1; col <= s.colCnt; col++ {
+		sig, ok := voc.Signature(col)
+		if !ok {
+			sig = fmt.Sprintf("col%d", col)
+		}
+		header = append(header, sig)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(header))
+	for i, row := range s.rows {
+		record[0], record[1], record[2] = s.ids[i], s.smiles[i], strconv.FormatFloat(s.responses[i], 'g', -1, 64)
+		for j := 3; j < len(record); j++ {
+			record[j] = "0"
+		}
+		for _, e := range row {
+			record[2+e.col] = strconv.FormatFloat(e.val, 'g', -1, 64)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
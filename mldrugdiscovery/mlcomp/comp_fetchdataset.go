@@ -0,0 +1,57 @@
+package mlcomp
+
+import (
+	"net/url"
+	"path"
+
+	"github.com/pharmbio/scipipe-demo/download"
+	sp "github.com/scipipe/scipipe"
+)
+
+// FetchDataset downloads a dataset from an HTTP(S) URL, via a download cache,
+// or copies it from a local path, and verifies its SHA-256 checksum
+type FetchDataset struct {
+	*Process
+}
+
+// FetchDatasetConf contains parameters for initializing a FetchDataset
+// process
+type FetchDatasetConf struct {
+	// Source is an http:// or https:// URL, or a local path
+	Source string
+	// SHA256 is the expected hex-encoded SHA-256 checksum of the dataset, or
+	// empty to skip verification
+	SHA256 string
+	// Path is the path to write the dataset to
+	Path string
+	// Cache is the download cache to resolve URLs from
+	Cache download.Cache
+}
+
+// NewFetchDataset returns a new FetchDataset process
+func NewFetchDataset(wf *sp.Workflow, name string, params FetchDatasetConf) *FetchDataset {
+	p := newProcess(wf, name, "# Go fetch dataset: {o:dataset}")
+	p.SetOut("dataset", params.Path)
+	p.CustomExecute = func(t *sp.Task) {
+		if err := params.Cache.Fetch(params.Source, params.SHA256, t.OutIP("dataset").TempPath()); err != nil {
+			sp.Failf("Could not fetch dataset %s: %v", params.Source, err)
+		}
+	}
+	return &FetchDataset{p}
+}
+
+// OutDataset returns the Dataset out-port
+func (p *FetchDataset) OutDataset() *sp.OutPort {
+	return p.Out("dataset")
+}
+
+// SourceExt returns the file extension of a URL or a path, ignoring any URL
+// query string
+func SourceExt(source string) string {
+	if download.IsURL(source) {
+		if u, err := url.Parse(source); err == nil {
+			return path.Ext(u.Path)
+		}
+	}
+	return path.Ext(source)
+}
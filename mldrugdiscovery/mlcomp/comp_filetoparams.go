@@ -0,0 +1,237 @@
+package mlcomp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+// FileToParams reads values from a file written by an upstream process, and
+// sends them on out-param ports, for parameters that depend on data, such as
+// a cost selected by cross-validation. Values are read from a column of a TSV
+// file, a path in a JSON file, or a key in a file with key=value lines, and
+// checked against their type, and optionally a validation function. The
+// process fails with an error naming the file and the parameter if a value
+// is missing or invalid.
+type FileToParams struct {
+	*Process
+}
+
+// ParamFormat is the format of the file to read parameters from
+type ParamFormat string
+
+const (
+	// ParamFormatTSV is for tab-separated values, read from the first
+	// non-empty line that is not a # comment
+	ParamFormatTSV ParamFormat = "tsv"
+	// ParamFormatJSON is for JSON documents
+	ParamFormatJSON ParamFormat = "json"
+	// ParamFormatKeyValue is for key=value lines, with optional # comments
+	ParamFormatKeyValue ParamFormat = "keyvalue"
+)
+
+// ParamType is the type of a parameter value
+type ParamType string
+
+const (
+	// ParamTypeString accepts any non-empty value
+	ParamTypeString ParamType = "string"
+	// ParamTypeInt accepts integers
+	ParamTypeInt ParamType = "int"
+	// ParamTypeFloat accepts finite numbers
+	ParamTypeFloat ParamType = "float"
+)
+
+// FileParam describes a parameter to read from a file
+type FileParam struct {
+	// Name is the name of the out-param port
+	Name string
+	// Column is the (1-based) column, for TSV files
+	Column int
+	// Key is the key, for key=value files, or the dot-separated path, for
+	// JSON files, such as "best.cost" or "folds.0.rmsd"
+	Key  string
+	Type ParamType
+	// Validate optionally checks the value, after the type check
+	Validate func(value string) error
+}
+
+// FileToParamsConf contains parameters for initializing a FileToParams
+// process
+type FileToParamsConf struct {
+	Format ParamFormat
+	Params []FileParam
+}
+
+// NewFileToParams returns a new FileToParams process, with an out-param port
+// for each parameter in params.Params, named as the parameter
+func NewFileToParams(wf *sp.Workflow, name string, params FileToParamsConf) *FileToParams {
+	p := newProcess(wf, name, "# Go file to params ("+string(params.Format)+"): {i:file}")
+	for _, param := range params.Params {
+		p.InitOutParamPort(p.Process, param.Name)
+	}
+	p.CustomExecute = func(t *sp.Task) {
+		content, err := ioutil.ReadFile(t.InPath("file"))
+		if err != nil {
+			sp.Fail(err)
+		}
+		values, err := parseFileParams(params, string(content))
+		if err != nil {
+			sp.Failf("Could not read parameters from %s: %v", t.InPath("file"), err)
+		}
+		for _, param := range params.Params {
+			t.Process.OutParam(param.Name).Send(values[param.Name])
+		}
+	}
+	return &FileToParams{p}
+}
+
+// InFile returns the File in-port
+func (p *FileToParams) InFile() *sp.InPort {
+	return p.In("file")
+}
+
+// parseFileParams returns the values of the parameters in conf, read from
+// content, by parameter name
+func parseFileParams(conf FileToParamsConf, content string) (map[string]string, error) {
+	var lookup func(param FileParam) (string, error)
+	switch conf.Format {
+	case ParamFormatTSV:
+		var fields []string
+		for _, line := range strings.Split(content, "\n") {
+			if line = strings.TrimRight(line, "\r"); strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "#") {
+				fields = strings.Split(line, "\t")
+				break
+			}
+		}
+		if fields == nil {
+			return nil, fmt.Errorf("no TSV line found")
+		}
+		lookup = func(param FileParam) (string, error) {
+			if param.Column < 1 || param.Column > len(fields) {
+				return "", fmt.Errorf("no column %d, the line has %d columns", param.Column, len(fields))
+			}
+			return strings.TrimSpace(fields[param.Column-1]), nil
+		}
+	case ParamFormatJSON:
+		var doc interface{}
+		if err := json.Unmarshal([]byte(content), &doc); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+		lookup = func(param FileParam) (string, error) {
+			return jsonPathValue(doc, param.Key)
+		}
+	case ParamFormatKeyValue:
+		keyValues := map[string]string{}
+		for lineNo, line := range strings.Split(content, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("line %d: expected key=value, got: %q", lineNo+1, line)
+			}
+			key := strings.TrimSpace(kv[0])
+			if _, ok := keyValues[key]; ok {
+				return nil, fmt.Errorf("line %d: duplicate key %s", lineNo+1, key)
+			}
+			keyValues[key] = strings.TrimSpace(kv[1])
+		}
+		lookup = func(param FileParam) (string, error) {
+			value, ok := keyValues[param.Key]
+			if !ok {
+				return "", fmt.Errorf("no key %s", param.Key)
+			}
+			return value, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown parameter file format: %q", conf.Format)
+	}
+
+	values := map[string]string{}
+	for _, param := range conf.Params {
+		value, err := lookup(param)
+		if err == nil {
+			err = checkParamValue(param, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %v", param.Name, err)
+		}
+		values[param.Name] = value
+	}
+	return values, nil
+}
+
+// jsonPathValue returns the scalar value at a dot-separated path in a JSON
+// document, with numbers for array indexes
+func jsonPathValue(doc interface{}, path string) (string, error) {
+	val := doc
+	for _, part := range strings.Split(path, ".") {
+		switch node := val.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if val, ok = node[part]; !ok {
+				return "", fmt.Errorf("no %q in JSON path %s", part, path)
+			}
+		case []interface{}:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return "", fmt.Errorf("no index %q, in an array of %d elements, in JSON path %s", part, len(node), path)
+			}
+			val = node[idx]
+		default:
+			return "", fmt.Errorf("no %q in JSON path %s, as its parent is not an object or array", part, path)
+		}
+	}
+	switch v := val.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("the value at JSON path %s is not a string, number or boolean", path)
+}
+
+// checkParamValue checks a value against the type of param, and its
+// validation function
+func checkParamValue(param FileParam, value string) error {
+	if value == "" {
+		return fmt.Errorf("empty value")
+	}
+	switch param.Type {
+	case ParamTypeString, "":
+	case ParamTypeInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("expected an integer, got %q", value)
+		}
+	case ParamTypeFloat:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("expected a number, got %q", value)
+		}
+	default:
+		return fmt.Errorf("unknown parameter type: %q", param.Type)
+	}
+	if param.Validate != nil {
+		if err := param.Validate(value); err != nil {
+			return fmt.Errorf("invalid value %q: %v", value, err)
+		}
+	}
+	return nil
+}
+
+// ValidatePositive checks that a numeric parameter value is above zero
+func ValidatePositive(value string) error {
+	if f, err := strconv.ParseFloat(value, 64); err != nil || f <= 0 {
+		return fmt.Errorf("must be above zero")
+	}
+	return nil
+}
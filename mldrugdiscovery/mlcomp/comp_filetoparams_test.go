@@ -0,0 +1,72 @@
+package mlcomp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFileParams(t *testing.T) {
+	for _, tc := range []struct {
+		conf     FileToParamsConf
+		content  string
+		expected map[string]string
+	}{
+		{
+			FileToParamsConf{ParamFormatTSV, []FileParam{
+				{Name: "cost", Column: 3, Type: ParamTypeFloat, Validate: ValidatePositive},
+				{Name: "trainsize", Column: 1, Type: ParamTypeInt},
+			}},
+			"# train size, RMSD, cost\n500\t0.8\t0.1\n",
+			map[string]string{"cost": "0.1", "trainsize": "500"},
+		},
+		{
+			FileToParamsConf{ParamFormatJSON, []FileParam{
+				{Name: "cost", Key: "best.cost", Type: ParamTypeFloat},
+				{Name: "fold", Key: "folds.1.name"},
+			}},
+			`{"best": {"cost": 0.25}, "folds": [{"name": "a"}, {"name": "b"}]}`,
+			map[string]string{"cost": "0.25", "fold": "b"},
+		},
+		{
+			FileToParamsConf{ParamFormatKeyValue, []FileParam{
+				{Name: "heights", Key: "heights"},
+				{Name: "solver", Key: "solver_type", Type: ParamTypeInt},
+			}},
+			"# Model parameters\nheights = 1-3\nsolver_type=12\n",
+			map[string]string{"heights": "1-3", "solver": "12"},
+		},
+	} {
+		values, err := parseFileParams(tc.conf, tc.content)
+		if err != nil {
+			t.Errorf("Could not parse %s content %q: %v", tc.conf.Format, tc.content, err)
+			continue
+		}
+		if !reflect.DeepEqual(values, tc.expected) {
+			t.Errorf("Wrong %s values:\nEXPECTED: %v\nACTUAL: %v\n", tc.conf.Format, tc.expected, values)
+		}
+	}
+}
+
+func TestParseFileParamsErrors(t *testing.T) {
+	cost := FileParam{Name: "cost", Column: 3, Key: "cost", Type: ParamTypeFloat, Validate: ValidatePositive}
+	for _, tc := range []struct {
+		format        ParamFormat
+		content       string
+		expectedError string
+	}{
+		{ParamFormatTSV, "500\t0.8\n", "parameter cost: no column 3, the line has 2 columns"},
+		{ParamFormatTSV, "500\t0.8\tNaN\n", `parameter cost: expected a number, got "NaN"`},
+		{ParamFormatTSV, "500\t0.8\t0\n", `parameter cost: invalid value "0": must be above zero`},
+		{ParamFormatTSV, "\n", "no TSV line found"},
+		{ParamFormatJSON, `{"cost": [0.1]}`, "parameter cost: the value at JSON path cost is not a string, number or boolean"},
+		{ParamFormatJSON, `{"cost": 0.1`, "invalid JSON"},
+		{ParamFormatKeyValue, "cost=0.1\ncost=0.2\n", "line 2: duplicate key cost"},
+		{ParamFormatKeyValue, "costs=0.1\n", "parameter cost: no key cost"},
+	} {
+		_, err := parseFileParams(FileToParamsConf{tc.format, []FileParam{cost}}, tc.content)
+		if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+			t.Errorf("Expected error %q for %s content %q, got: %v", tc.expectedError, tc.format, tc.content, err)
+		}
+	}
+}
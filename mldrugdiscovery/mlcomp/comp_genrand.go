@@ -1,12 +1,12 @@
-package main
+package mlcomp
 
 import (
 	sp "github.com/scipipe/scipipe"
 )
 
-// GenRandBytes does blabla ...
+// GenRandBytes writes a file of random bytes, for shuffling
 type GenRandBytes struct {
-	*sp.Process
+	*Process
 }
 
 // GenRandBytesConf contains parameters for initializing a
@@ -23,7 +23,7 @@ func NewGenRandBytes(wf *sp.Workflow, name string, params GenRandBytesConf) *Gen
 		`of={o:randbytes} ` +
 		`bs=1048576 ` +
 		`count={p:sizemb} # {i:basepath}`
-	p := wf.NewProc(name, cmd)
+	p := newProcess(wf, name, cmd)
 	p.InParam("sizemb").FromInt(params.SizeMB)
 	p.InParam("replid").FromStr(params.ReplicateID)
 	p.SetOut("randbytes", "{i:basepath}.{p:replid}.rand")
@@ -0,0 +1,206 @@
+package mlcomp
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pharmbio/scipipe-demo/mldrugdiscovery/chem"
+	sp "github.com/scipipe/scipipe"
+)
+
+// SignatureEngine selects the implementation used for generating signatures
+// and sparse datasets
+type SignatureEngine string
+
+const (
+	// SignatureEngineJava uses GenerateSignatures.jar and
+	// CreateSparseDataset.jar (the default)
+	SignatureEngineJava SignatureEngine = "java"
+	// SignatureEngineGoSign uses the pure Go chem package, with
+	// signature-like atom environments
+	SignatureEngineGoSign SignatureEngine = "gosign"
+	// SignatureEngineGoECFP uses the pure Go chem package, with ECFP-style
+	// atom environments
+	SignatureEngineGoECFP SignatureEngine = "goecfp"
+)
+
+// IsGo returns true if the engine is implemented in Go rather than Java
+func (e SignatureEngine) IsGo() bool {
+	return e == SignatureEngineGoSign || e == SignatureEngineGoECFP
+}
+
+// FingerprintType returns the type of atom environments generated by a Go
+// engine
+func (e SignatureEngine) FingerprintType() chem.FingerprintType {
+	if e == SignatureEngineGoECFP {
+		return chem.FingerprintECFP
+	}
+	return chem.FingerprintSignature
+}
+
+// GenSignFilterSubst generates signatures for the substances in a SMILES
+// file, filtering out those that can not be processed
+type GenSignFilterSubst struct {
+	*Process
+}
+
+// GenSignFilterSubstConf contains parameters for initializing a
+// GenSignFilterSubst process
+type GenSignFilterSubstConf struct {
+	ReplicateID string
+	ThreadsCnt  int
+	MinHeight   int
+	MaxHeight   int
+	SilentMode  bool
+	Engine      SignatureEngine
+	// ToolPath is the path of GenerateSignatures.jar, defaults to
+	// DefaultBinDir + "GenerateSignatures.jar"
+	ToolPath string
+	// JavaPath is the path of the java command, defaults to java in PATH
+	JavaPath string
+}
+
+// NewGenSignFilterSubst returns a new GenSignFilterSubstConf process
+func NewGenSignFilterSubst(wf *sp.Workflow, name string, params GenSignFilterSubstConf) *GenSignFilterSubst {
+	cmd := commandPath(params.JavaPath, "java") + ` -jar ` + toolPath(params.ToolPath, "GenerateSignatures.jar") + ` \
+		-inputfile {i:smiles} \
+		-threads {p:threads} \
+		-minheight {p:minheight} \
+		-maxheight {p:maxheight} \
+		-outputfile {o:signatures}`
+	if params.SilentMode {
+		cmd += ` \
+		-silent`
+	}
+	if params.Engine.IsGo() {
+		cmd = `# Go signature generation: {i:smiles} {p:threads} {p:minheight} {p:maxheight} {o:signatures}`
+	}
+	p := newProcess(wf, name, cmd)
+	p.InParam("threads").FromInt(params.ThreadsCnt)
+	p.InParam("minheight").FromInt(params.MinHeight)
+	p.InParam("maxheight").FromInt(params.MaxHeight)
+	if params.Engine == SignatureEngineGoECFP {
+		// Keep file names apart from the signature based ones
+		p.SetOut("signatures", "{i:smiles}.{p:minheight}_{p:maxheight}.ecfp.sign")
+	} else {
+		p.SetOut("signatures", "{i:smiles}.{p:minheight}_{p:maxheight}.sign")
+	}
+	if params.Engine.IsGo() {
+		fpType := params.Engine.FingerprintType()
+		p.CustomExecute = func(t *sp.Task) {
+			threads, _ := strconv.Atoi(t.Param("threads"))
+			minHeight, _ := strconv.Atoi(t.Param("minheight"))
+			maxHeight, _ := strconv.Atoi(t.Param("maxheight"))
+			skipped, err := GenSignatures(t.InPath("smiles"), t.OutIP("signatures").TempPath(), threads,
+				chem.FingerprintConf{Type: fpType, MinHeight: minHeight, MaxHeight: maxHeight})
+			if err != nil {
+				sp.Failf("Could not generate signatures for %s: %v", t.InPath("smiles"), err)
+			}
+			if skipped > 0 {
+				sp.Warning.Printf("Skipped %d substances in %s that could not be processed\n", skipped, t.InPath("smiles"))
+			}
+		}
+	}
+	return &GenSignFilterSubst{p}
+}
+
+// InSmiles takes input file in SMILES format
+func (p *GenSignFilterSubst) InSmiles() *sp.InPort {
+	return p.In("smiles")
+}
+
+// OutSignatures returns output files as text files with signatures
+func (p *GenSignFilterSubst) OutSignatures() *sp.OutPort {
+	return p.Out("signatures")
+}
+
+// GenSignatures reads a SMILES file, with a SMILES string and a response
+// value on each line, and writes a signatures file for the substances that
+// could be parsed, using threads goroutines. It returns the number of
+// skipped substances.
+func GenSignatures(smilesPath string, outPath string, threads int, conf chem.FingerprintConf) (int, error) {
+	inFile, err := os.Open(smilesPath)
+	if err != nil {
+		return 0, err
+	}
+	defer inFile.Close()
+	lines := []string{}
+	sc := bufio.NewScanner(inFile)
+	sc.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for sc.Scan() {
+		if strings.TrimSpace(sc.Text()) != "" {
+			lines = append(lines, sc.Text())
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return 0, err
+	}
+
+	if threads < 1 {
+		threads = 1
+	}
+	records := make([]string, len(lines))
+	lineIdxs := make(chan int)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range lineIdxs {
+				rec, err := smilesLineToSignatures(lines[idx], conf)
+				if err != nil {
+					sp.Debug.Printf("Skipping line %d in %s: %v\n", idx+1, smilesPath, err)
+					continue
+				}
+				records[idx] = rec.String()
+			}
+		}()
+	}
+	for idx := range lines {
+		lineIdxs <- idx
+	}
+	close(lineIdxs)
+	wg.Wait()
+
+	outFile, err := createFile(outPath)
+	if err != nil {
+		return 0, err
+	}
+	bw := bufio.NewWriter(outFile)
+	skipped := 0
+	for _, rec := range records {
+		if rec == "" {
+			skipped++
+			continue
+		}
+		fmt.Fprintln(bw, rec)
+	}
+	if err := bw.Flush(); err != nil {
+		outFile.Close()
+		return 0, err
+	}
+	return skipped, outFile.Close()
+}
+
+func smilesLineToSignatures(line string, conf chem.FingerprintConf) (chem.SignatureRecord, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return chem.SignatureRecord{}, fmt.Errorf("expected SMILES and response value, got: %q", line)
+	}
+	if _, err := strconv.ParseFloat(fields[1], 64); err != nil {
+		return chem.SignatureRecord{}, fmt.Errorf("invalid response value: %v", err)
+	}
+	mol, err := chem.ParseSMILES(fields[0])
+	if err != nil {
+		return chem.SignatureRecord{}, err
+	}
+	sigs, err := chem.Fingerprint(mol, conf)
+	if err != nil {
+		return chem.SignatureRecord{}, err
+	}
+	return chem.SignatureRecord{SMILES: fields[0], Response: fields[1], Signatures: sigs}, nil
+}
@@ -0,0 +1,185 @@
+package mlcomp
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/pharmbio/scipipe-demo/mldrugdiscovery/chem"
+	sp "github.com/scipipe/scipipe"
+)
+
+// InterpretModel maps the weights of a linear LIBLINEAR model back to the
+// signatures of the columns they belong to, and lists the signatures with the
+// most positive and most negative weights. For a given set of compounds, it
+// also lists the contribution of each atom to the predicted value, which is
+// the sum of the weights of the signatures rooted at that atom.
+type InterpretModel struct {
+	*Process
+}
+
+// InterpretModelConf contains parameters for initializing an InterpretModel
+// process
+type InterpretModelConf struct {
+	// TopN is the number of positive and negative signatures to list
+	TopN int
+	// Compounds are SMILES strings of compounds to list atom contributions
+	// for. This requires one of the Go signature engines, as the signatures
+	// of the Java engine can not be traced back to atoms here.
+	Compounds []string
+	Engine    SignatureEngine
+	MinHeight int
+	MaxHeight int
+}
+
+// NewInterpretModel returns a new InterpretModel process
+func NewInterpretModel(wf *sp.Workflow, name string, params InterpretModelConf) *InterpretModel {
+	p := newProcess(wf, name, "# Go model interpretation: {i:model} {i:signatures} {o:weights} {o:atomcontrib} {p:topn}")
+	p.InParam("topn").FromInt(params.TopN)
+	p.SetOut("weights", "{i:model}.weights.tsv")
+	p.SetOut("atomcontrib", "{i:model}.atomcontrib.tsv")
+	p.CustomExecute = func(t *sp.Task) {
+		model, err := readLibLinearModel(t.InPath("model"))
+		if err != nil {
+			sp.Fail(err)
+		}
+		vocFile, err := os.Open(t.InPath("signatures"))
+		if err != nil {
+			sp.Fail(err)
+		}
+		voc, err := chem.ReadVocabulary(vocFile)
+		vocFile.Close()
+		if err != nil {
+			sp.Failf("Could not read signatures in %s: %v", t.InPath("signatures"), err)
+		}
+		if err := writeTopWeights(model, voc, params.TopN, t.OutIP("weights").TempPath()); err != nil {
+			sp.Failf("Could not write weights for %s: %v", t.InPath("model"), err)
+		}
+		if len(params.Compounds) > 0 && !params.Engine.IsGo() {
+			sp.Warning.Printf("Atom contributions can only be computed with the Go signature engines, not %s\n", params.Engine)
+		}
+		fpConf := chem.FingerprintConf{
+			Type:      params.Engine.FingerprintType(),
+			MinHeight: params.MinHeight,
+			MaxHeight: params.MaxHeight,
+		}
+		compounds := params.Compounds
+		if !params.Engine.IsGo() {
+			compounds = nil
+		}
+		if err := writeAtomContributions(model, voc, compounds, fpConf, t.OutIP("atomcontrib").TempPath()); err != nil {
+			sp.Failf("Could not write atom contributions for %s: %v", t.InPath("model"), err)
+		}
+	}
+	return &InterpretModel{p}
+}
+
+// InModel returns the Model in-port
+func (p *InterpretModel) InModel() *sp.InPort {
+	return p.In("model")
+}
+
+// InSignatures returns the Signatures in-port, taking the signatures file
+// written by CreateSparseTrain for the model's train data
+func (p *InterpretModel) InSignatures() *sp.InPort {
+	return p.In("signatures")
+}
+
+// OutWeights returns the Weights out-port, with the top positive and
+// negative signatures
+func (p *InterpretModel) OutWeights() *sp.OutPort {
+	return p.Out("weights")
+}
+
+// OutAtomContributions returns the AtomContributions out-port
+func (p *InterpretModel) OutAtomContributions() *sp.OutPort {
+	return p.Out("atomcontrib")
+}
+
+// writeTopWeights writes the topN signatures with the most positive, and the
+// topN with the most negative weights, as a TSV file
+func writeTopWeights(model *libLinearModel, voc *chem.Vocabulary, topN int, outPath string) error {
+	cols := []int{}
+	for col := 1; col <= len(model.Weights); col++ {
+		if model.Weight(col) != 0 {
+			cols = append(cols, col)
+		}
+	}
+	sort.SliceStable(cols, func(i, j int) bool { return model.Weight(cols[i]) > model.Weight(cols[j]) })
+
+	outFile, err := createFile(outPath)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(outFile)
+	fmt.Fprintln(bw, "direction\trank\tcolumn\tweight\tsignature")
+	write := func(direction string, rank int, col int) {
+		sig, ok := voc.Signature(col)
+		if !ok {
+			sig = "?"
+		}
+		fmt.Fprintf(bw, "%s\t%d\t%d\t%g\t%s\n", direction, rank, col, model.Weight(col), sig)
+	}
+	for i := 0; i < topN && i < len(cols) && model.Weight(cols[i]) > 0; i++ {
+		write("positive", i+1, cols[i])
+	}
+	for i := 0; i < topN && i < len(cols) && model.Weight(cols[len(cols)-1-i]) < 0; i++ {
+		write("negative", i+1, cols[len(cols)-1-i])
+	}
+	if err := bw.Flush(); err != nil {
+		outFile.Close()
+		return err
+	}
+	return outFile.Close()
+}
+
+// writeAtomContributions writes, for every atom in every compound, the sum of
+// the weights of the signatures rooted at the atom. Atoms are numbered from 1,
+// in the order they appear in the SMILES string. Summed over all atoms, and
+// with the bias term added, the contributions add up to the prediction.
+func writeAtomContributions(model *libLinearModel, voc *chem.Vocabulary, compounds []string, fpConf chem.FingerprintConf, outPath string) error {
+	outFile, err := createFile(outPath)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(outFile)
+	fmt.Fprintln(bw, "compound\tsmiles\tatom\telement\tcontribution\tknown_signatures\tprediction")
+	for compIdx, smiles := range compounds {
+		mol, err := chem.ParseSMILES(smiles)
+		if err != nil {
+			outFile.Close()
+			return fmt.Errorf("compound %d: %v", compIdx+1, err)
+		}
+		atomFeatures, err := chem.AtomFingerprints(mol, fpConf)
+		if err != nil {
+			outFile.Close()
+			return err
+		}
+		contribs := make([]float64, len(mol.Atoms))
+		known := make([]int, len(mol.Atoms))
+		prediction := model.Bias * model.BiasWeight
+		if model.Bias < 0 {
+			prediction = 0
+		}
+		for atomIdx, features := range atomFeatures {
+			for _, feature := range features {
+				if col, ok := voc.Column(feature); ok {
+					contribs[atomIdx] += model.Weight(col)
+					known[atomIdx]++
+				}
+			}
+			prediction += contribs[atomIdx]
+		}
+		for atomIdx, atom := range mol.Atoms {
+			fmt.Fprintf(bw, "%d\t%s\t%d\t%s\t%g\t%d/%d\t%g\n", compIdx+1, smiles, atomIdx+1,
+				atom.Symbol, contribs[atomIdx],
+				known[atomIdx], len(atomFeatures[atomIdx]), prediction)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		outFile.Close()
+		return err
+	}
+	return outFile.Close()
+}
@@ -0,0 +1,147 @@
+package mlcomp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pharmbio/scipipe-demo/mldrugdiscovery/chem"
+)
+
+func TestInterpretModel(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "interpret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Train signatures, with a column for each, as CreateSparseTrain writes
+	// them, and a model with a distinct, non-zero weight for every column
+	fpConf := chem.FingerprintConf{Type: SignatureEngineGoSign.FingerprintType(), MinHeight: 0, MaxHeight: 2}
+	trainVoc := chem.NewVocabulary()
+	for _, smiles := range []string{"CCO", "c1ccccc1O", "CC(=O)N"} {
+		mol, err := chem.ParseSMILES(smiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts, err := chem.Fingerprint(mol, fpConf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chem.SparseRow(chem.SignatureRecord{SMILES: smiles, Response: "1", Signatures: counts}, trainVoc, true)
+	}
+	vocBuf := &bytes.Buffer{}
+	if err := trainVoc.Write(vocBuf); err != nil {
+		t.Fatal(err)
+	}
+	voc, err := chem.ReadVocabulary(vocBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modelText := "solver_type L2R_L2LOSS_SVR\nnr_class 2\nnr_feature " + strconv.Itoa(voc.Len()) + "\nbias 1\nw\n"
+	for col := 1; col <= voc.Len(); col++ {
+		weight := 0.1 * float64(col)
+		if col%2 == 0 {
+			weight = -weight
+		}
+		modelText += strconv.FormatFloat(weight, 'g', -1, 64) + "\n"
+	}
+	modelText += "0.5\n"
+	model, err := parseLibLinearModel(strings.NewReader(modelText), "model")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The top weights are joined with the signatures of their columns
+	weightsPath := filepath.Join(tmpDir, "weights.tsv")
+	if err := writeTopWeights(model, voc, 2, weightsPath); err != nil {
+		t.Fatal(err)
+	}
+	weightRows := readTSV(t, weightsPath)
+	lastCol := voc.Len()
+	topPos, topNeg := lastCol, lastCol-1
+	if lastCol%2 == 0 {
+		topPos, topNeg = lastCol-1, lastCol
+	}
+	for i, expected := range []struct {
+		direction string
+		col       int
+	}{
+		{"positive", topPos},
+		{"positive", topPos - 2},
+		{"negative", topNeg},
+		{"negative", topNeg - 2},
+	} {
+		sig, _ := voc.Signature(expected.col)
+		expectedRow := []string{expected.direction, strconv.Itoa(i%2 + 1), strconv.Itoa(expected.col), strconv.FormatFloat(model.Weight(expected.col), 'g', -1, 64), sig}
+		if i+1 >= len(weightRows) || strings.Join(weightRows[i+1], "\t") != strings.Join(expectedRow, "\t") {
+			t.Errorf("Wrong weights row %d:\nEXPECTED: %q\nACTUAL: %q", i+1, expectedRow, weightRows)
+		}
+	}
+
+	// The atom contributions plus the bias term add up to the prediction of
+	// the compound's sparse row, for a train compound and for a compound
+	// with signatures the model has not seen
+	compounds := []string{"CCO", "CC(=O)Nc1ccccc1"}
+	contribPath := filepath.Join(tmpDir, "atomcontrib.tsv")
+	if err := writeAtomContributions(model, voc, compounds, fpConf, contribPath); err != nil {
+		t.Fatal(err)
+	}
+	contribRows := readTSV(t, contribPath)[1:]
+	for compIdx, smiles := range compounds {
+		mol, err := chem.ParseSMILES(smiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts, err := chem.Fingerprint(mol, fpConf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, row, err := parseSparseRow(chem.SparseRow(chem.SignatureRecord{SMILES: smiles, Response: "0", Signatures: counts}, voc, false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedPrediction := model.Predict(row)
+
+		sum := model.Bias * model.BiasWeight
+		atomCnt := 0
+		for _, fields := range contribRows {
+			if fields[0] != strconv.Itoa(compIdx+1) {
+				continue
+			}
+			atomCnt++
+			contrib, err := strconv.ParseFloat(fields[4], 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum += contrib
+			if prediction, err := strconv.ParseFloat(fields[6], 64); err != nil || math.Abs(prediction-expectedPrediction) > 1e-9 {
+				t.Errorf("Expected prediction %g for %s, got %s", expectedPrediction, smiles, fields[6])
+			}
+		}
+		if atomCnt != len(mol.Atoms) {
+			t.Errorf("Expected contributions for %d atoms of %s, got %d", len(mol.Atoms), smiles, atomCnt)
+		}
+		if math.Abs(sum-expectedPrediction) > 1e-9 {
+			t.Errorf("Expected the contributions of %s to add up to the prediction %g, got %g", smiles, expectedPrediction, sum)
+		}
+	}
+}
+
+// readTSV reads the rows of a TSV file, as lists of fields
+func readTSV(t *testing.T, path string) [][]string {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]string{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(dat), "\n"), "\n") {
+		rows = append(rows, strings.Split(line, "\t"))
+	}
+	return rows
+}
@@ -0,0 +1,199 @@
+package mlcomp
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+// Leaderboard ranks datasets by the test RMSD of their best model
+// configuration (height range and train size), selected by the
+// cross-validation RMSD averaged over replicates. The endpoints of
+// multi-endpoint datasets are ranked separately. It writes the ranking as a
+// table and as a Markdown report.
+type Leaderboard struct {
+	*Process
+}
+
+// LeaderboardConf contains parameters for initializing a Leaderboard process
+type LeaderboardConf struct {
+	Title string
+}
+
+// NewLeaderboard returns a new Leaderboard process
+func NewLeaderboard(wf *sp.Workflow, name string, params LeaderboardConf) *Leaderboard {
+	p := newProcess(wf, name, "# Go leaderboard: {i:results} {o:table} {o:report}")
+	p.SetOut("table", "{i:results|%.tsv}.leaderboard.tsv")
+	p.SetOut("report", "{i:results|%.tsv}.leaderboard.md")
+	p.CustomExecute = func(t *sp.Task) {
+		rows, err := readResultRows(t.InPath("results"))
+		if err != nil {
+			sp.Fail(err)
+		}
+		entries := rankLeaderboard(rows)
+		if err := writeLeaderboard(params.Title, entries, t.OutIP("table").TempPath(), t.OutIP("report").TempPath()); err != nil {
+			sp.Failf("Could not write leaderboard for %s: %v", t.InPath("results"), err)
+		}
+	}
+	return &Leaderboard{p}
+}
+
+// InResults returns the Results in-port, taking the result tables of all
+// datasets, concatenated
+func (p *Leaderboard) InResults() *sp.InPort {
+	return p.In("results")
+}
+
+// OutTable returns the Table out-port
+func (p *Leaderboard) OutTable() *sp.OutPort {
+	return p.Out("table")
+}
+
+// OutReport returns the Report out-port
+func (p *Leaderboard) OutReport() *sp.OutPort {
+	return p.Out("report")
+}
+
+// resultRow is the result of one final model
+type resultRow struct {
+	dataset   string
+	replicate string
+	heights   string
+	trainSize int
+	cost      float64
+	cvRMSD    float64
+	testRMSD  float64
+	endpoint  string
+}
+
+// readResultRows reads a results table, with the dataset, replicate, height
+// range, train size, selected cost, cross-validation RMSD and test RMSD, and
+// optionally the endpoint, on each line
+func readResultRows(path string) ([]resultRow, error) {
+	rows := []resultRow{}
+	err := ForEachLine(path, func(lineNo int, line string) error {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			return fmt.Errorf("%s, line %d: expected 7 columns, got %d", path, lineNo, len(fields))
+		}
+		row := resultRow{dataset: fields[0], replicate: fields[1], heights: fields[2]}
+		if len(fields) > 7 {
+			row.endpoint = strings.TrimSpace(fields[7])
+		}
+		var err error
+		if row.trainSize, err = strconv.Atoi(fields[3]); err != nil {
+			return fmt.Errorf("%s, line %d: %v", path, lineNo, err)
+		}
+		for i, val := range []*float64{&row.cost, &row.cvRMSD, &row.testRMSD} {
+			if *val, err = strconv.ParseFloat(strings.TrimSpace(fields[i+4]), 64); err != nil {
+				return fmt.Errorf("%s, line %d: %v", path, lineNo, err)
+			}
+		}
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, err
+}
+
+// leaderboardEntry is the best model configuration for a dataset, or an
+// endpoint of a dataset, with RMSDs averaged over replicates
+type leaderboardEntry struct {
+	dataset    string
+	heights    string
+	trainSize  int
+	replicates int
+	cvRMSD     float64
+	testRMSD   float64
+	endpoint   string
+}
+
+// label returns the dataset name, with the endpoint, if any
+func (e leaderboardEntry) label() string {
+	if e.endpoint == "" {
+		return e.dataset
+	}
+	return e.dataset + " (" + e.endpoint + ")"
+}
+
+// rankLeaderboard selects the configuration with the lowest mean
+// cross-validation RMSD for each dataset, and sorts the datasets by the mean
+// test RMSD of that configuration
+func rankLeaderboard(rows []resultRow) []leaderboardEntry {
+	type configKey struct {
+		dataset   string
+		endpoint  string
+		heights   string
+		trainSize int
+	}
+	configs := map[configKey]*leaderboardEntry{}
+	keys := []configKey{}
+	for _, row := range rows {
+		key := configKey{row.dataset, row.endpoint, row.heights, row.trainSize}
+		entry, ok := configs[key]
+		if !ok {
+			entry = &leaderboardEntry{dataset: row.dataset, endpoint: row.endpoint, heights: row.heights, trainSize: row.trainSize}
+			configs[key] = entry
+			keys = append(keys, key)
+		}
+		entry.replicates++
+		entry.cvRMSD += row.cvRMSD
+		entry.testRMSD += row.testRMSD
+	}
+
+	best := map[string]*leaderboardEntry{}
+	datasets := []string{}
+	for _, key := range keys {
+		entry := configs[key]
+		entry.cvRMSD /= float64(entry.replicates)
+		entry.testRMSD /= float64(entry.replicates)
+		current, ok := best[entry.label()]
+		if !ok {
+			datasets = append(datasets, entry.label())
+		}
+		// Prefer larger train sizes among equally good configurations
+		if !ok || entry.cvRMSD < current.cvRMSD || (entry.cvRMSD == current.cvRMSD && entry.trainSize > current.trainSize) {
+			best[entry.label()] = entry
+		}
+	}
+
+	entries := []leaderboardEntry{}
+	for _, dataset := range datasets {
+		entries = append(entries, *best[dataset])
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].testRMSD < entries[j].testRMSD })
+	return entries
+}
+
+func writeLeaderboard(title string, entries []leaderboardEntry, tablePath string, reportPath string) error {
+	tableFile, err := createFile(tablePath)
+	if err != nil {
+		return err
+	}
+	defer tableFile.Close()
+	reportFile, err := createFile(reportPath)
+	if err != nil {
+		return err
+	}
+	defer reportFile.Close()
+
+	table := bufio.NewWriter(tableFile)
+	report := bufio.NewWriter(reportFile)
+	fmt.Fprintln(table, "rank\tdataset\theights\ttrainsize\treplicates\tcv_rmsd\ttest_rmsd")
+	fmt.Fprintf(report, "# %s\n\n"+
+		"The model configuration with the lowest cross-validation RMSD for each dataset, averaged over replicates, "+
+		"ranked by the test RMSD.\n\n"+
+		"| Rank | Dataset | Heights | Train size | Replicates | CV RMSD | Test RMSD |\n"+
+		"|---:|---|---|---:|---:|---:|---:|\n", title)
+	for i, entry := range entries {
+		fmt.Fprintf(table, "%d\t%s\t%s\t%d\t%d\t%.4f\t%.4f\n", i+1, entry.label(), entry.heights, entry.trainSize, entry.replicates, entry.cvRMSD, entry.testRMSD)
+		fmt.Fprintf(report, "| %d | %s | %s | %d | %d | %.4f | %.4f |\n", i+1, entry.label(), entry.heights, entry.trainSize, entry.replicates, entry.cvRMSD, entry.testRMSD)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	return report.Flush()
+}
@@ -0,0 +1,33 @@
+package mlcomp
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRankLeaderboard(t *testing.T) {
+	rows := []resultRow{
+		{dataset: "chembl1", replicate: "r1", heights: "1-3", trainSize: 500, cvRMSD: 0.9, testRMSD: 1.0},
+		{dataset: "chembl1", replicate: "r2", heights: "1-3", trainSize: 500, cvRMSD: 0.7, testRMSD: 0.8},
+		{dataset: "chembl1", replicate: "r1", heights: "0-2", trainSize: 500, cvRMSD: 0.85, testRMSD: 0.5},
+		{dataset: "chembl1", replicate: "r2", heights: "0-2", trainSize: 500, cvRMSD: 0.85, testRMSD: 0.5},
+		{dataset: "chembl2", replicate: "r1", heights: "1-3", trainSize: 500, cvRMSD: 0.6, testRMSD: 0.7},
+		// Equally good as the smaller train size, so preferred
+		{dataset: "chembl2", replicate: "r1", heights: "1-3", trainSize: 1000, cvRMSD: 0.6, testRMSD: 0.6},
+	}
+	entries := rankLeaderboard(rows)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 leaderboard entries, got %d: %v", len(entries), entries)
+	}
+	for i, expected := range []leaderboardEntry{
+		{dataset: "chembl2", heights: "1-3", trainSize: 1000, replicates: 1, cvRMSD: 0.6, testRMSD: 0.6},
+		// Selected by the mean CV RMSD (0.8 vs 0.85), not the test RMSD
+		{dataset: "chembl1", heights: "1-3", trainSize: 500, replicates: 2, cvRMSD: 0.8, testRMSD: 0.9},
+	} {
+		got := entries[i]
+		if got.dataset != expected.dataset || got.heights != expected.heights || got.trainSize != expected.trainSize || got.replicates != expected.replicates ||
+			math.Abs(got.cvRMSD-expected.cvRMSD) > 1e-9 || math.Abs(got.testRMSD-expected.testRMSD) > 1e-9 {
+			t.Errorf("Expected leaderboard entry %d to be %v, got %v", i+1, expected, got)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+package mlcomp
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pharmbio/scipipe-demo/mldrugdiscovery/chem"
+	sp "github.com/scipipe/scipipe"
+)
+
+// LoadDataset converts a dataset in CSV, TSV or SDF format, into the SMILES
+// format used in the rest of the workflow, with a SMILES string and a
+// response value on each line. Compound IDs are written to a separate file.
+// Datasets with several endpoints (response columns) also get a table with
+// the values of all endpoints.
+type LoadDataset struct {
+	*Process
+}
+
+// DatasetFormat is the file format of an input dataset
+type DatasetFormat string
+
+const (
+	DatasetFormatSmi DatasetFormat = "smi"
+	DatasetFormatCSV DatasetFormat = "csv"
+	DatasetFormatTSV DatasetFormat = "tsv"
+	DatasetFormatSDF DatasetFormat = "sdf"
+)
+
+// DatasetFormatFromPath returns the dataset format implied by the file
+// extension, defaulting to the SMILES format
+func DatasetFormatFromPath(path string) DatasetFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return DatasetFormatCSV
+	case ".tsv", ".tab", ".txt":
+		return DatasetFormatTSV
+	case ".sdf", ".sd":
+		return DatasetFormatSDF
+	}
+	return DatasetFormatSmi
+}
+
+// ResponseTransform is a unit conversion applied to response values
+type ResponseTransform string
+
+const (
+	ResponseAsIs ResponseTransform = ""
+	// ResponsePFromNanoMolar converts e.g. IC50 in nM into pIC50
+	ResponsePFromNanoMolar ResponseTransform = "p-nM"
+	// ResponsePFromMicroMolar converts e.g. IC50 in µM into pIC50
+	ResponsePFromMicroMolar ResponseTransform = "p-uM"
+	// ResponsePFromMolar converts e.g. IC50 in M into pIC50
+	ResponsePFromMolar ResponseTransform = "p-M"
+	// ResponseLog10 takes the base 10 logarithm
+	ResponseLog10 ResponseTransform = "log10"
+)
+
+// Apply applies the transform to a value
+func (tr ResponseTransform) Apply(val float64) (float64, error) {
+	molarFactor := map[ResponseTransform]float64{
+		ResponsePFromNanoMolar:  1e-9,
+		ResponsePFromMicroMolar: 1e-6,
+		ResponsePFromMolar:      1,
+	}
+	switch tr {
+	case ResponseAsIs:
+		return val, nil
+	case ResponsePFromNanoMolar, ResponsePFromMicroMolar, ResponsePFromMolar, ResponseLog10:
+		if val <= 0 {
+			return 0, fmt.Errorf("can not take logarithm of non-positive value %g", val)
+		}
+		if tr == ResponseLog10 {
+			return math.Log10(val), nil
+		}
+		return -math.Log10(val * molarFactor[tr]), nil
+	}
+	return 0, fmt.Errorf("unknown response transform: %s", tr)
+}
+
+// LoadDatasetConf contains parameters for initializing a LoadDataset process
+type LoadDatasetConf struct {
+	Format DatasetFormat
+	// SmilesColumn, IDColumn and ResponseColumn are column names in the
+	// header of CSV and TSV files. For SDF files, ResponseColumn and IDColumn
+	// are the names of data items, and the record title is used as ID if
+	// IDColumn is empty.
+	SmilesColumn   string
+	IDColumn       string
+	ResponseColumn string
+	// DateColumn is the name of an optional column, or data item, with dates
+	// to include in the IDs file, for temporal sampling
+	DateColumn string
+	Transform  ResponseTransform
+	// EndpointColumns are the response columns, or data items, of a dataset
+	// with several endpoints, such as assays on the same compounds. If set,
+	// ResponseColumn is not used. The values of all endpoints are written to
+	// the endpoints table, and the response in the SMILES file is the value
+	// of the first endpoint that a compound has a value for.
+	EndpointColumns []string
+}
+
+// NewLoadDataset returns a new LoadDataset process
+func NewLoadDataset(wf *sp.Workflow, name string, params LoadDatasetConf) *LoadDataset {
+	cmd := "# Go dataset conversion (" + string(params.Format) + "): {i:dataset} {o:smiles} {o:ids}"
+	if len(params.EndpointColumns) > 0 {
+		cmd += " {o:endpoints}"
+	}
+	p := newProcess(wf, name, cmd)
+	p.SetOut("smiles", "{i:dataset}.smi")
+	p.SetOut("ids", "{i:dataset}.ids.tsv")
+	if len(params.EndpointColumns) > 0 {
+		p.SetOut("endpoints", "{i:dataset}.endpoints.tsv")
+	}
+	p.CustomExecute = func(t *sp.Task) {
+		endpointsPath := ""
+		if len(params.EndpointColumns) > 0 {
+			endpointsPath = t.OutIP("endpoints").TempPath()
+		}
+		skipped, err := loadDataset(t.InPath("dataset"), params,
+			t.OutIP("smiles").TempPath(),
+			t.OutIP("ids").TempPath(),
+			endpointsPath)
+		if err != nil {
+			sp.Failf("Could not convert dataset %s: %v", t.InPath("dataset"), err)
+		}
+		if skipped > 0 {
+			sp.Warning.Printf("Skipped %d records in %s with missing or invalid values\n", skipped, t.InPath("dataset"))
+		}
+	}
+	return &LoadDataset{p}
+}
+
+// InDataset returns the Dataset in-port
+func (p *LoadDataset) InDataset() *sp.InPort {
+	return p.In("dataset")
+}
+
+// OutSmiles returns the Smiles out-port
+func (p *LoadDataset) OutSmiles() *sp.OutPort {
+	return p.Out("smiles")
+}
+
+// OutIDs returns the IDs out-port, with compound ID, SMILES and response,
+// and the date if DateColumn is set, on each line
+func (p *LoadDataset) OutIDs() *sp.OutPort {
+	return p.Out("ids")
+}
+
+// OutEndpoints returns the Endpoints out-port, with a header line, and the
+// SMILES and the value of each endpoint, or an empty string, on each line.
+// Only available if EndpointColumns is set.
+func (p *LoadDataset) OutEndpoints() *sp.OutPort {
+	return p.Out("endpoints")
+}
+
+// datasetRecord is a compound read from an input dataset
+type datasetRecord struct {
+	id       string
+	smiles   string
+	response string
+	date     string
+	// endpoints are the values of the endpoint columns, if any
+	endpoints []string
+}
+
+func loadDataset(inPath string, conf LoadDatasetConf, smilesPath string, idsPath string, endpointsPath string) (int, error) {
+	inFile, err := os.Open(inPath)
+	if err != nil {
+		return 0, err
+	}
+	defer inFile.Close()
+
+	smilesFile, err := createFile(smilesPath)
+	if err != nil {
+		return 0, err
+	}
+	defer smilesFile.Close()
+	smilesOut := bufio.NewWriter(smilesFile)
+
+	idsFile, err := createFile(idsPath)
+	if err != nil {
+		return 0, err
+	}
+	defer idsFile.Close()
+	idsOut := bufio.NewWriter(idsFile)
+	if conf.DateColumn != "" {
+		fmt.Fprintln(idsOut, "id\tsmiles\tresponse\tdate")
+	} else {
+		fmt.Fprintln(idsOut, "id\tsmiles\tresponse")
+	}
+
+	var endpointsOut *bufio.Writer
+	if endpointsPath != "" {
+		endpointsFile, err := createFile(endpointsPath)
+		if err != nil {
+			return 0, err
+		}
+		defer endpointsFile.Close()
+		endpointsOut = bufio.NewWriter(endpointsFile)
+		fmt.Fprintln(endpointsOut, "smiles\t"+strings.Join(conf.EndpointColumns, "\t"))
+	}
+
+	skipped := 0
+	write := func(rec datasetRecord) {
+		var resp string
+		var err error
+		if conf.EndpointColumns != nil {
+			resp, err = transformEndpoints(rec.endpoints, conf.Transform)
+		} else {
+			resp, err = transformResponse(rec.response, conf.Transform)
+		}
+		if err != nil || rec.smiles == "" {
+			sp.Debug.Printf("Skipping record %s in %s: %v\n", rec.id, inPath, err)
+			skipped++
+			return
+		}
+		if endpointsOut != nil {
+			fmt.Fprintf(endpointsOut, "%s\t%s\n", rec.smiles, strings.Join(rec.endpoints, "\t"))
+		}
+		fmt.Fprintf(smilesOut, "%s\t%s\n", rec.smiles, resp)
+		if conf.DateColumn != "" {
+			fmt.Fprintf(idsOut, "%s\t%s\t%s\t%s\n", rec.id, rec.smiles, resp, rec.date)
+		} else {
+			fmt.Fprintf(idsOut, "%s\t%s\t%s\n", rec.id, rec.smiles, resp)
+		}
+	}
+
+	switch conf.Format {
+	case DatasetFormatCSV, DatasetFormatTSV:
+		err = readDelimited(inFile, conf, write)
+	case DatasetFormatSDF:
+		err = readSDF(inFile, conf, write)
+	default:
+		err = fmt.Errorf("unsupported dataset format: %s", conf.Format)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := smilesOut.Flush(); err != nil {
+		return 0, err
+	}
+	if endpointsOut != nil {
+		if err := endpointsOut.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return skipped, idsOut.Flush()
+}
+
+// transformResponse parses a response value, and applies tr to it
+func transformResponse(value string, tr ResponseTransform) (string, error) {
+	val, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return "", err
+	}
+	if val, err = tr.Apply(val); err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(val, 'g', -1, 64), nil
+}
+
+// transformEndpoints applies tr to the endpoint values of a record, in place,
+// with missing or invalid values replaced by empty strings, and returns the
+// first value. It fails if there are no valid values.
+func transformEndpoints(values []string, tr ResponseTransform) (string, error) {
+	first := ""
+	for i, value := range values {
+		values[i], _ = transformResponse(value, tr)
+		if first == "" {
+			first = values[i]
+		}
+	}
+	if first == "" {
+		return "", fmt.Errorf("no valid endpoint values: %q", values)
+	}
+	return first, nil
+}
+
+func readDelimited(r io.Reader, conf LoadDatasetConf, write func(datasetRecord)) error {
+	cr := csv.NewReader(r)
+	if conf.Format == DatasetFormatTSV {
+		cr.Comma = '\t'
+		cr.LazyQuotes = true
+	}
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("could not read header: %v", err)
+	}
+	colIdx := map[string]int{}
+	for i, col := range header {
+		colIdx[strings.TrimSpace(col)] = i
+	}
+	cols := map[string]string{"SMILES": conf.SmilesColumn}
+	if conf.EndpointColumns != nil {
+		for _, col := range conf.EndpointColumns {
+			cols["endpoint "+col] = col
+		}
+	} else {
+		cols["response"] = conf.ResponseColumn
+	}
+	if conf.IDColumn != "" {
+		cols["ID"] = conf.IDColumn
+	}
+	if conf.DateColumn != "" {
+		cols["date"] = conf.DateColumn
+	}
+	for what, col := range cols {
+		if _, ok := colIdx[col]; !ok {
+			return fmt.Errorf("%s column %q not found in header: %s", what, col, strings.Join(header, ", "))
+		}
+	}
+	field := func(row []string, col string) string {
+		if i, ok := colIdx[col]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	for rowNo := 1; ; rowNo++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rec := datasetRecord{
+			id:       fmt.Sprintf("row%d", rowNo),
+			smiles:   field(row, conf.SmilesColumn),
+			response: field(row, conf.ResponseColumn),
+		}
+		if conf.IDColumn != "" {
+			rec.id = field(row, conf.IDColumn)
+		}
+		if conf.DateColumn != "" {
+			rec.date = field(row, conf.DateColumn)
+		}
+		for _, col := range conf.EndpointColumns {
+			rec.endpoints = append(rec.endpoints, field(row, col))
+		}
+		write(rec)
+	}
+}
+
+func readSDF(r io.Reader, conf LoadDatasetConf, write func(datasetRecord)) error {
+	sdf := chem.NewSDFReader(r)
+	for recNo := 1; ; recNo++ {
+		sdfRec, err := sdf.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rec := datasetRecord{
+			id:       sdfRec.Title,
+			response: sdfRec.Props[conf.ResponseColumn],
+			date:     strings.TrimSpace(sdfRec.Props[conf.DateColumn]),
+		}
+		if conf.IDColumn != "" {
+			rec.id = sdfRec.Props[conf.IDColumn]
+		}
+		for _, col := range conf.EndpointColumns {
+			rec.endpoints = append(rec.endpoints, strings.TrimSpace(sdfRec.Props[col]))
+		}
+		if rec.id == "" {
+			rec.id = fmt.Sprintf("record%d", recNo)
+		}
+		if sdfRec.Mol == nil {
+			sp.Debug.Printf("Could not parse molecule %s: %v\n", rec.id, sdfRec.MolErr)
+		} else {
+			rec.smiles = sdfRec.Mol.CanonicalSMILES()
+		}
+		write(rec)
+	}
+}
+
+// compoundIDIndex maps standardized SMILES to the compound IDs in an ids file
+// written by LoadDataset
+type compoundIDIndex map[string][]string
+
+func readCompoundIDs(path string) (compoundIDIndex, error) {
+	ids := compoundIDIndex{}
+	err := ForEachLine(path, func(lineNo int, line string) error {
+		fields := strings.Split(line, "\t")
+		if lineNo == 1 || len(fields) < 2 {
+			return nil
+		}
+		if canon, _, err := standardizedSMILES(fields[1]); err == nil {
+			ids[canon] = append(ids[canon], fields[0])
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// lookup returns the comma-separated IDs of the compound with the given
+// SMILES. The SMILES in the workflow are standardized already, but possibly
+// with another canonicalization than the one used here, so they are
+// standardized again.
+func (ids compoundIDIndex) lookup(smiles string) string {
+	return strings.Join(ids.idsOf(smiles), ",")
+}
+
+// idsOf returns the IDs of the compound with the given SMILES, standardized
+// again as by lookup
+func (ids compoundIDIndex) idsOf(smiles string) []string {
+	canon, _, err := standardizedSMILES(smiles)
+	if err != nil {
+		canon = smiles
+	}
+	return ids[canon]
+}
+
+// dateLayouts are the accepted formats of dates in datasets
+var dateLayouts = []string{"2006-01-02", time.RFC3339, "2006-01-02 15:04:05", "2006/01/02", "2006-01", "2006"}
+
+// parseDate parses a date in one of the formats in dateLayouts
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date: %q", s)
+}
+
+// readCompoundDates reads the dates in an ids file written by LoadDataset
+// with a date column, indexed by standardized SMILES. If a compound occurs
+// more than once, the earliest date is used.
+func readCompoundDates(path string) (map[string]time.Time, error) {
+	dates := map[string]time.Time{}
+	err := ForEachLine(path, func(lineNo int, line string) error {
+		fields := strings.Split(line, "\t")
+		if lineNo == 1 {
+			if len(fields) < 4 || fields[3] != "date" {
+				return fmt.Errorf("%s has no date column", path)
+			}
+			return nil
+		}
+		if len(fields) < 4 || strings.TrimSpace(fields[3]) == "" {
+			return nil
+		}
+		date, err := parseDate(fields[3])
+		if err != nil {
+			return fmt.Errorf("%s, line %d: %v", path, lineNo, err)
+		}
+		canon, _, err := standardizedSMILES(fields[1])
+		if err != nil {
+			return nil
+		}
+		if prev, ok := dates[canon]; !ok || date.Before(prev) {
+			dates[canon] = date
+		}
+		return nil
+	})
+	return dates, err
+}
@@ -0,0 +1,405 @@
+package mlcomp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pharmbio/scipipe-demo/doctor"
+	sp "github.com/scipipe/scipipe"
+)
+
+// ModelCard writes a human-readable model card for a final model, in
+// Markdown and HTML, with the dataset provenance and checksum, the sampling
+// and training parameters, the cross-validation curve over costs, the test
+// set metrics, the applicability domain summary and the software tools used
+// to create the model. The tools are collected from the SciPipe audit files
+// of the test set assessment and everything upstream of it.
+type ModelCard struct {
+	*Process
+}
+
+// ModelCardConf contains parameters for initializing a ModelCard process
+type ModelCardConf struct {
+	Keys ResultKeys
+	// DatasetSource is the URL or path the dataset was obtained from
+	DatasetSource   string
+	SamplingMethod  SamplingMethod
+	SignatureEngine SignatureEngine
+	SolverType      int
+	FoldsCount      int
+	TestSize        int
+}
+
+// NewModelCard returns a new ModelCard process
+func NewModelCard(wf *sp.Workflow, name string, params ModelCardConf) *ModelCard {
+	p := newProcess(wf, name, "# Go model card: {i:dataset} {i:model} {i:costrmsds} {i:bestcost} {i:testrmsd} {i:adsummary} {o:markdown} {o:html}")
+	p.SetOut("markdown", "{i:model}.card.md")
+	p.SetOut("html", "{i:model}.card.html")
+	p.CustomExecute = func(t *sp.Task) {
+		card, err := newModelCard(params, t.InPath("dataset"), t.InPath("model"), t.InPath("costrmsds"), t.InPath("bestcost"), t.InPath("testrmsd"), t.InPath("adsummary"))
+		if err != nil {
+			sp.Failf("Could not create model card for %s: %v", t.InPath("model"), err)
+		}
+		if err := ioutil.WriteFile(t.OutIP("markdown").TempPath(), []byte(card.markdown()), 0644); err != nil {
+			sp.Fail(err)
+		}
+		if err := ioutil.WriteFile(t.OutIP("html").TempPath(), []byte(card.html()), 0644); err != nil {
+			sp.Fail(err)
+		}
+	}
+	return &ModelCard{p}
+}
+
+// InDataset returns the Dataset in-port, taking the original dataset file,
+// for the checksum
+func (p *ModelCard) InDataset() *sp.InPort {
+	return p.In("dataset")
+}
+
+// InModel returns the Model in-port, taking the final model
+func (p *ModelCard) InModel() *sp.InPort {
+	return p.In("model")
+}
+
+// InCostRMSDs returns the CostRMSDs in-port, taking the cost grid results
+func (p *ModelCard) InCostRMSDs() *sp.InPort {
+	return p.In("costrmsds")
+}
+
+// InBestCost returns the BestCost in-port
+func (p *ModelCard) InBestCost() *sp.InPort {
+	return p.In("bestcost")
+}
+
+// InTestRMSD returns the TestRMSD in-port, taking the assessment of the final
+// model on the test set
+func (p *ModelCard) InTestRMSD() *sp.InPort {
+	return p.In("testrmsd")
+}
+
+// InAppDomainSummary returns the AppDomainSummary in-port, taking the
+// Markdown summary written by ApplicabilityDomain for the test set
+func (p *ModelCard) InAppDomainSummary() *sp.InPort {
+	return p.In("adsummary")
+}
+
+// OutMarkdown returns the Markdown out-port
+func (p *ModelCard) OutMarkdown() *sp.OutPort {
+	return p.Out("markdown")
+}
+
+// OutHTML returns the HTML out-port
+func (p *ModelCard) OutHTML() *sp.OutPort {
+	return p.Out("html")
+}
+
+// modelCard is a model card, as sections with Markdown content. The HTML
+// version also gets the plots of the sections.
+type modelCard struct {
+	title    string
+	sections []modelCardSection
+}
+
+type modelCardSection struct {
+	title    string
+	markdown string
+	svg      string
+}
+
+func newModelCard(conf ModelCardConf, datasetPath string, modelPath string, costRMSDsPath string, bestCostPath string, testRMSDPath string, adSummaryPath string) (*modelCard, error) {
+	keys := conf.Keys
+	card := &modelCard{title: fs("Model card: %s, run %s, replicate %s, heights %s, train size %d",
+		keys.Dataset, keys.RunID, keys.Replicate, keys.Heights, keys.TrainSize)}
+	if keys.Endpoint != "" {
+		card.title += ", endpoint " + keys.Endpoint
+	}
+
+	// Dataset provenance
+	checksum, err := fileSHA256(datasetPath)
+	if err != nil {
+		return nil, err
+	}
+	source := conf.DatasetSource
+	if source == "" {
+		source = datasetPath
+	}
+	card.sections = append(card.sections, modelCardSection{title: "Dataset", markdown: fs(
+		"| | |\n|---|---|\n| Name | %s |\n| Source | `%s` |\n| File | `%s` |\n| SHA-256 | `%s` |\n",
+		keys.Dataset, source, datasetPath, checksum)})
+
+	// Training parameters
+	bestCost, err := readBestCost(bestCostPath)
+	if err != nil {
+		return nil, err
+	}
+	samplingMethod := conf.SamplingMethod
+	if samplingMethod == "" {
+		samplingMethod = SamplingMethodRandom
+	}
+	card.sections = append(card.sections, modelCardSection{title: "Model", markdown: fs(
+		"| | |\n|---|---|\n| Model file | `%s` |\n| Sampling method | %s |\n| Train size | %d |\n| Test size | %d |\n"+
+			"| Signature engine | %s |\n| Signature heights | %s |\n| Solver | LIBLINEAR solver type %d |\n| Cost | %g |\n",
+		modelPath, samplingMethod, keys.TrainSize, conf.TestSize, conf.SignatureEngine, keys.Heights, conf.SolverType, bestCost)})
+
+	// Cross-validation curve
+	costRows, err := readCostRMSDs(costRMSDsPath)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(costRows, func(i, j int) bool { return costRows[i].cost < costRows[j].cost })
+	var cvCurve strings.Builder
+	fmt.Fprintf(&cvCurve, "Mean and standard deviation of the RMSDs of %d cross-validation folds, for each cost.\n\n", conf.FoldsCount)
+	cvCurve.WriteString("| Cost | Mean RMSD | SD | Selected |\n|---:|---:|---:|---|\n")
+	logCosts, means := []float64{}, []float64{}
+	var cvRMSD, cvSD float64
+	for _, row := range costRows {
+		selected := ""
+		if sameCost(row.cost, bestCost) {
+			selected = "✓"
+			cvRMSD, cvSD = row.mean, row.sd
+		}
+		fmt.Fprintf(&cvCurve, "| %g | %.4f | %.4f | %s |\n", row.cost, row.mean, row.sd, selected)
+		logCosts = append(logCosts, math.Log10(row.cost))
+		means = append(means, row.mean)
+	}
+	card.sections = append(card.sections, modelCardSection{
+		title:    "Cross-validation",
+		markdown: cvCurve.String(),
+		svg:      svgScatter("Cross-validation RMSD", "log10(cost)", "Mean RMSD", logCosts, means, false),
+	})
+
+	// Final metrics
+	testRMSDBytes, err := ioutil.ReadFile(testRMSDPath)
+	if err != nil {
+		return nil, err
+	}
+	testFields := strings.Fields(string(testRMSDBytes))
+	if len(testFields) == 0 {
+		return nil, fmt.Errorf("empty test RMSD file: %s", testRMSDPath)
+	}
+	card.sections = append(card.sections, modelCardSection{title: "Metrics", markdown: fs(
+		"| Metric | Value |\n|---|---:|\n| Cross-validation RMSD | %.4f |\n| Cross-validation RMSD SD | %.4f |\n| Test set RMSD | %s |\n",
+		cvRMSD, cvSD, testFields[0])})
+
+	// Applicability domain, from the summary without its heading
+	adSummary, err := ioutil.ReadFile(adSummaryPath)
+	if err != nil {
+		return nil, err
+	}
+	adLines := strings.Split(strings.TrimSpace(string(adSummary)), "\n")
+	if len(adLines) > 0 && strings.HasPrefix(adLines[0], "#") {
+		adLines = adLines[1:]
+	}
+	card.sections = append(card.sections, modelCardSection{title: "Applicability domain", markdown: strings.TrimSpace(strings.Join(adLines, "\n")) + "\n\n" +
+		"Predictions for compounds out of the domain, on any of the criteria, should be used with care.\n"})
+
+	// Software tools, from the audit trail
+	tools, err := auditTools(testRMSDPath, keys.Dataset)
+	if err != nil {
+		return nil, err
+	}
+	var toolList strings.Builder
+	fmt.Fprintf(&toolList, "Workflow built with %s, signature engine %s.\n\n", runtime.Version(), conf.SignatureEngine)
+	if len(tools) == 0 {
+		toolList.WriteString("No audit information found for the steps creating the model.\n")
+	} else {
+		toolList.WriteString("| Tool | Used by |\n|---|---|\n")
+		for _, tool := range tools {
+			fmt.Fprintf(&toolList, "| `%s` | %s |\n", tool.name, strings.Join(tool.procs, ", "))
+		}
+	}
+	card.sections = append(card.sections, modelCardSection{title: "Software", markdown: toolList.String()})
+	card.sections = append(card.sections, modelCardSection{title: "Generated", markdown: time.Now().Format(time.RFC3339) + "\n"})
+	return card, nil
+}
+
+func (c *modelCard) markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", c.title)
+	for _, s := range c.sections {
+		fmt.Fprintf(&sb, "## %s\n\n%s\n", s.title, s.markdown)
+	}
+	return sb.String()
+}
+
+func (c *modelCard) html() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n"+
+		"<style>body { font-family: sans-serif; } table { border-collapse: collapse; } td, th { border: 1px solid #ccc; padding: 2px 6px; }</style>\n"+
+		"</head>\n<body>\n<h1>%s</h1>\n", html.EscapeString(c.title), html.EscapeString(c.title))
+	for _, s := range c.sections {
+		fmt.Fprintf(&sb, "<h2>%s</h2>\n%s%s", html.EscapeString(s.title), markdownHTML(s.markdown), s.svg)
+	}
+	sb.WriteString("</body>\n</html>\n")
+	return sb.String()
+}
+
+// markdownHTML converts the Markdown used in model cards and summaries to
+// HTML: paragraphs, tables, and inline code
+func markdownHTML(md string) string {
+	var sb strings.Builder
+	inTable := false
+	for _, block := range strings.Split(strings.TrimSpace(md), "\n\n") {
+		for _, line := range strings.Split(strings.TrimSpace(block), "\n") {
+			if !strings.HasPrefix(line, "|") {
+				fmt.Fprintf(&sb, "<p>%s</p>\n", markdownInlineHTML(line))
+				continue
+			}
+			cells := strings.Split(strings.Trim(line, "|"), "|")
+			if strings.Trim(line, "|-: ") == "" {
+				continue // Separator row
+			}
+			cellTag := "td"
+			if !inTable {
+				sb.WriteString("<table>\n")
+				inTable = true
+				cellTag = "th"
+			}
+			sb.WriteString("<tr>")
+			for _, cell := range cells {
+				fmt.Fprintf(&sb, "<%s>%s</%s>", cellTag, markdownInlineHTML(strings.TrimSpace(cell)), cellTag)
+			}
+			sb.WriteString("</tr>\n")
+		}
+		if inTable {
+			sb.WriteString("</table>\n")
+			inTable = false
+		}
+	}
+	return sb.String()
+}
+
+// markdownInlineHTML escapes text for HTML, and converts `code` spans
+func markdownInlineHTML(text string) string {
+	parts := strings.Split(text, "`")
+	for i, part := range parts {
+		parts[i] = html.EscapeString(part)
+		if i%2 == 1 && i < len(parts)-1 {
+			parts[i] = "<code>" + parts[i] + "</code>"
+		} else if i%2 == 1 {
+			parts[i] = "`" + parts[i]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 checksum of a file
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// auditRecord contains the fields used here, of the audit information that
+// SciPipe writes next to every output file, as <path>.audit.json
+type auditRecord struct {
+	ProcessName string
+	Command     string
+	Upstream    map[string]*auditRecord
+}
+
+// auditTool is a software tool, with the (deduplicated) processes using it
+type auditTool struct {
+	name  string
+	procs []string
+}
+
+// auditTools returns the software tools run by the process writing path, and
+// all processes upstream of it, sorted by name. Process names are shortened
+// by removing the part from the dataset name. If path has no audit file, no
+// tools are returned.
+func auditTools(path string, datasetName string) ([]auditTool, error) {
+	auditBytes, err := ioutil.ReadFile(path + ".audit.json")
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	root := &auditRecord{}
+	if err := json.Unmarshal(auditBytes, root); err != nil {
+		return nil, fmt.Errorf("invalid audit file for %s: %v", path, err)
+	}
+	toolProcs := map[string]map[string]bool{}
+	var visit func(rec *auditRecord)
+	visit = func(rec *auditRecord) {
+		if rec == nil {
+			return
+		}
+		procName := rec.ProcessName
+		if idx := strings.Index(procName, "_"+datasetName); datasetName != "" && idx > 0 {
+			procName = procName[:idx]
+		}
+		for _, tool := range commandTools(rec.Command) {
+			if toolProcs[tool] == nil {
+				toolProcs[tool] = map[string]bool{}
+			}
+			toolProcs[tool][procName] = true
+		}
+		for _, upstream := range rec.Upstream {
+			visit(upstream)
+		}
+	}
+	visit(root)
+	tools := []auditTool{}
+	for name, procs := range toolProcs {
+		tool := auditTool{name: name}
+		for proc := range procs {
+			tool.procs = append(tool.procs, proc)
+		}
+		sort.Strings(tool.procs)
+		tools = append(tools, tool)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].name < tools[j].name })
+	return tools, nil
+}
+
+// commandTools returns the programs run by a shell command: the executables
+// of each of its commands (see doctor.CommandExecutables), including the
+// commands run by time, and the jar files run with java -jar, as one tool
+// with the java executable. Go processes, with a comment as command, are
+// returned as their description.
+func commandTools(cmd string) []string {
+	cmd = strings.TrimSpace(cmd)
+	if strings.HasPrefix(cmd, "#") {
+		desc := strings.TrimSpace(strings.TrimPrefix(cmd, "#"))
+		if idx := strings.Index(desc, ":"); idx >= 0 {
+			desc = desc[:idx]
+		}
+		return []string{desc}
+	}
+	tools := []string{}
+	seen := map[string]bool{}
+	for _, words := range doctor.Commands(cmd) {
+		exes := doctor.CommandExecutables(words)
+		for i := 0; i < len(exes); i++ {
+			tool := exes[i]
+			if doctor.ToolKey(tool) == "java" && i+1 < len(exes) {
+				tool += " -jar " + exes[i+1]
+				i++
+			}
+			if !seen[tool] {
+				seen[tool] = true
+				tools = append(tools, tool)
+			}
+		}
+	}
+	return tools
+}
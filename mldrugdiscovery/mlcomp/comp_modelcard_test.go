@@ -0,0 +1,91 @@
+package mlcomp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommandTools(t *testing.T) {
+	for _, tc := range []struct {
+		cmd      string
+		expected []string
+	}{
+		{"java -jar bin/GenerateSignatures.jar -inputfile a.smi -silent", []string{"java -jar bin/GenerateSignatures.jar"}},
+		{"/usr/lib/jvm/bin/java -Xmx2g -jar '/opt/my tools/GenerateSignatures.jar' -silent", []string{"/usr/lib/jvm/bin/java -jar /opt/my tools/GenerateSignatures.jar"}},
+		{"/usr/bin/time -f '%e' -o {o:time} /opt/bin/lin-train -s 12 {i:train} {o:model}", []string{"/usr/bin/time", "/opt/bin/lin-train"}},
+		{"time java -jar a.jar && /opt/java8/bin/java -jar b.jar", []string{"time", "java -jar a.jar", "/opt/java8/bin/java -jar b.jar"}},
+		{"zcat {i:orig} > {o:ungzipped}", []string{"zcat"}},
+		{`rmsd=$(awk 'FNR==NR { pred[FNR]=$1; next } { n++ }' a b) && echo "$rmsd	0.1" > c`, []string{"awk"}},
+		{"cat a b | sort -g -k3 > c", []string{"cat", "sort"}},
+		{"# Go applicability domain: {i:traindata} {o:summary}", []string{"Go applicability domain"}},
+	} {
+		if tools := commandTools(tc.cmd); !reflect.DeepEqual(tools, tc.expected) {
+			t.Errorf("Wrong tools for %q:\nEXPECTED: %q\nACTUAL: %q\n", tc.cmd, tc.expected, tools)
+		}
+	}
+}
+
+func TestNewModelCard(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "modelcard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	files := map[string]string{
+		"dataset.smi":           "CCO\t1.5\n",
+		"model.linmdl":          "w\n0.5\n",
+		"cost_rmsds.tsv":        "500\t0.8\t0.1\t0.05\t0:0.75,1:0.85\n500\t0.9\t1\t0.1\t0:0.8,1:1.0\n",
+		"best_cost.txt":         "500\t0.8\t0.1\n",
+		"final.rmsd":            "0.95\t0.1\n",
+		"ad_summary.md":         "## Applicability domain\n\nDomain criteria: signature coverage ≥ 0.7\n\n| Subset | Compounds |\n|---|---:|\n| All | 1 |\n",
+		"final.rmsd.audit.json": `{"ProcessName": "assess_final_testdataset_r1_h1_3_tr500", "Command": "awk '{ print }' a > b", "Upstream": {"pred": {"ProcessName": "pred_final_testdataset_r1_h1_3_tr500", "Command": "predict -s 12 a b c"}}}`,
+	}
+	for name, content := range files {
+		ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644)
+	}
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+	conf := ModelCardConf{
+		Keys:            ResultKeys{RunID: "testrun", Dataset: "testdataset", Replicate: "r1", Heights: "1-3", TrainSize: 500},
+		DatasetSource:   "https://example.org/testdataset.smi",
+		SamplingMethod:  SamplingMethodCluster,
+		SignatureEngine: SignatureEngineGoSign,
+		SolverType:      12,
+		FoldsCount:      2,
+		TestSize:        100,
+	}
+	card, err := newModelCard(conf, path("dataset.smi"), path("model.linmdl"), path("cost_rmsds.tsv"), path("best_cost.txt"), path("final.rmsd"), path("ad_summary.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := fileSHA256(path("dataset.smi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	markdown := card.markdown()
+	for _, expected := range []string{
+		"| SHA-256 | `" + checksum + "` |",
+		"| Sampling method | cluster |",
+		"| 0.1 | 0.8000 | 0.0500 | ✓ |",
+		"| Test set RMSD | 0.95 |",
+		"Domain criteria: signature coverage ≥ 0.7",
+		"| `awk` | assess_final |",
+		"| `predict` | pred_final |",
+	} {
+		if !strings.Contains(markdown, expected) {
+			t.Errorf("Expected %q in model card:\n%s", expected, markdown)
+		}
+	}
+	if strings.Contains(markdown, "## Applicability domain\n\n## ") {
+		t.Errorf("Expected the heading of the applicability domain summary to be removed:\n%s", markdown)
+	}
+	htmlCard := card.html()
+	for _, expected := range []string{"<th>Cost</th>", "<td><code>predict</code></td>", "<svg"} {
+		if !strings.Contains(htmlCard, expected) {
+			t.Errorf("Expected %q in HTML model card:\n%s", expected, htmlCard)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package mlcomp
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+// OOFReport collects the out-of-fold predictions from cross-validation, for
+// the selected cost, and joins them back to the compounds and their observed
+// values. It writes them as a table, and an HTML report with residual
+// diagnostics: predicted versus observed values, the distribution of
+// residuals, and the worst predicted compounds.
+type OOFReport struct {
+	*Process
+}
+
+// OOFReportConf contains parameters for initializing an OOFReport process
+type OOFReportConf struct {
+	Title string
+	// WithIDs should be true if the IDs in-port is connected, to take
+	// compound IDs from the ids file of LoadDataset. Otherwise compounds are
+	// identified by their SMILES.
+	WithIDs bool
+	// WorstCnt is the number of worst predicted compounds to list
+	WorstCnt int
+}
+
+// NewOOFReport returns a new OOFReport process
+func NewOOFReport(wf *sp.Workflow, name string, params OOFReportConf) *OOFReport {
+	cmd := "# Go out-of-fold report: {i:oof} {i:bestcost} {i:traindata} {i:trainsigns} {o:table} {o:html} {o:summary}"
+	if params.WithIDs {
+		cmd += " {i:ids}"
+	}
+	p := newProcess(wf, name, cmd)
+	p.SetOut("table", "{i:traindata}.oof.tsv")
+	p.SetOut("html", "{i:traindata}.oof.html")
+	p.SetOut("summary", "{i:traindata}.oof.md")
+	p.CustomExecute = func(t *sp.Task) {
+		idsPath := ""
+		if params.WithIDs {
+			idsPath = t.InPath("ids")
+		}
+		err := writeOOFReport(params, t.InPath("oof"), t.InPath("bestcost"), t.InPath("traindata"), t.InPath("trainsigns"), idsPath,
+			t.OutIP("table").TempPath(),
+			t.OutIP("html").TempPath(),
+			t.OutIP("summary").TempPath(),
+			t.OutIP("html").Path())
+		if err != nil {
+			sp.Failf("Could not create out-of-fold report for %s: %v", t.InPath("traindata"), err)
+		}
+	}
+	return &OOFReport{p}
+}
+
+// InOOF returns the OOF in-port, taking the out-of-fold predictions for all
+// costs, with the cost, the prediction, the 1-based number of the train row
+// (as written by CompoundRows) and the sparse test row, separated by tabs, on
+// each line
+func (p *OOFReport) InOOF() *sp.InPort {
+	return p.In("oof")
+}
+
+// InBestCost returns the BestCost in-port
+func (p *OOFReport) InBestCost() *sp.InPort {
+	return p.In("bestcost")
+}
+
+// InTrainData returns the TrainData in-port, taking the (un-gzipped) sparse
+// train data that the folds were created from
+func (p *OOFReport) InTrainData() *sp.InPort {
+	return p.In("traindata")
+}
+
+// InTrainSigns returns the TrainSigns in-port, taking the signatures file
+// the sparse train data was created from
+func (p *OOFReport) InTrainSigns() *sp.InPort {
+	return p.In("trainsigns")
+}
+
+// InIDs returns the IDs in-port, only used if WithIDs is set
+func (p *OOFReport) InIDs() *sp.InPort {
+	return p.In("ids")
+}
+
+// OutTable returns the Table out-port
+func (p *OOFReport) OutTable() *sp.OutPort {
+	return p.Out("table")
+}
+
+// OutHTML returns the HTML out-port
+func (p *OOFReport) OutHTML() *sp.OutPort {
+	return p.Out("html")
+}
+
+// OutSummary returns the Summary out-port, with a Markdown section for the
+// run report
+func (p *OOFReport) OutSummary() *sp.OutPort {
+	return p.Out("summary")
+}
+
+// oofPrediction is an out-of-fold prediction for a train compound
+type oofPrediction struct {
+	rowIdx    int
+	id        string
+	smiles    string
+	observed  float64
+	predicted float64
+}
+
+func (p oofPrediction) residual() float64 {
+	return p.predicted - p.observed
+}
+
+func writeOOFReport(conf OOFReportConf, oofPath string, bestCostPath string, trainPath string, trainSignsPath string, idsPath string, tablePath string, htmlPath string, summaryPath string, finalHTMLPath string) error {
+	bestCost, err := readBestCost(bestCostPath)
+	if err != nil {
+		return err
+	}
+
+	trainRows := []string{}
+	if err := ForEachLine(trainPath, func(lineNo int, line string) error {
+		trainRows = append(trainRows, strings.Join(strings.Fields(line), " "))
+		return nil
+	}); err != nil {
+		return err
+	}
+	smiles := []string{}
+	if err := ForEachLine(trainSignsPath, func(lineNo int, line string) error {
+		smiles = append(smiles, strings.Fields(line)[0])
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(smiles) != len(trainRows) {
+		return fmt.Errorf("%d rows in %s, but %d compounds in %s", len(trainRows), trainPath, len(smiles), trainSignsPath)
+	}
+	var ids compoundIDIndex
+	if idsPath != "" {
+		if ids, err = readCompoundIDs(idsPath); err != nil {
+			return err
+		}
+	}
+
+	preds := []oofPrediction{}
+	seenRows := map[int]bool{}
+	if err := ForEachLine(oofPath, func(lineNo int, line string) error {
+		fields := strings.SplitN(line, "\t", 4)
+		if len(fields) < 4 {
+			return fmt.Errorf("%s, line %d: expected cost, prediction, row number and row", oofPath, lineNo)
+		}
+		cost, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return fmt.Errorf("%s, line %d: invalid cost: %v", oofPath, lineNo, err)
+		}
+		if !sameCost(cost, bestCost) {
+			return nil
+		}
+		pred := oofPrediction{}
+		if pred.predicted, err = strconv.ParseFloat(strings.TrimSpace(fields[1]), 64); err != nil {
+			return fmt.Errorf("%s, line %d: invalid prediction: %v", oofPath, lineNo, err)
+		}
+		rowNo, err := strconv.Atoi(fields[2])
+		if err != nil || rowNo < 1 || rowNo > len(trainRows) {
+			return fmt.Errorf("%s, line %d: invalid row number %q, for %d train rows", oofPath, lineNo, fields[2], len(trainRows))
+		}
+		pred.rowIdx = rowNo - 1
+		if seenRows[pred.rowIdx] {
+			return fmt.Errorf("%s, line %d: more than one prediction for row %d", oofPath, lineNo, rowNo)
+		}
+		seenRows[pred.rowIdx] = true
+		// The folds are created from the train rows as they are, so any
+		// difference means that the row numbers are not for these rows
+		if strings.Join(strings.Fields(fields[3]), " ") != trainRows[pred.rowIdx] {
+			return fmt.Errorf("%s, line %d: row does not match row %d in %s", oofPath, lineNo, rowNo, trainPath)
+		}
+		if pred.observed, _, err = parseSparseRow(fields[3]); err != nil {
+			return fmt.Errorf("%s, line %d: %v", oofPath, lineNo, err)
+		}
+		pred.smiles = smiles[pred.rowIdx]
+		pred.id = pred.smiles
+		if ids != nil {
+			pred.id = ids.lookup(pred.smiles)
+		}
+		preds = append(preds, pred)
+		return nil
+	}); err != nil {
+		return err
+	}
+	sort.SliceStable(preds, func(i, j int) bool { return preds[i].rowIdx < preds[j].rowIdx })
+
+	tableFile, err := createFile(tablePath)
+	if err != nil {
+		return err
+	}
+	defer tableFile.Close()
+	table := bufio.NewWriter(tableFile)
+	fmt.Fprintln(table, "row\tid\tsmiles\tobserved\tpredicted\tresidual")
+	var metrics predMetrics
+	observed, predicted, residuals := []float64{}, []float64{}, []float64{}
+	for _, pred := range preds {
+		fmt.Fprintf(table, "%d\t%s\t%s\t%g\t%g\t%.4g\n", pred.rowIdx+1, pred.id, pred.smiles, pred.observed, pred.predicted, pred.residual())
+		metrics.add(pred.observed, pred.predicted)
+		observed = append(observed, pred.observed)
+		predicted = append(predicted, pred.predicted)
+		residuals = append(residuals, pred.residual())
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	worst := append([]oofPrediction{}, preds...)
+	sort.SliceStable(worst, func(i, j int) bool { return math.Abs(worst[i].residual()) > math.Abs(worst[j].residual()) })
+	if len(worst) > conf.WorstCnt {
+		worst = worst[:conf.WorstCnt]
+	}
+
+	htmlFile, err := createFile(htmlPath)
+	if err != nil {
+		return err
+	}
+	defer htmlFile.Close()
+	hw := bufio.NewWriter(htmlFile)
+	fmt.Fprintf(hw, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n"+
+		"<style>body { font-family: sans-serif; } table { border-collapse: collapse; } td, th { border: 1px solid #ccc; padding: 2px 6px; }</style>\n"+
+		"</head>\n<body>\n<h1>%s</h1>\n", html.EscapeString(conf.Title), html.EscapeString(conf.Title))
+	fmt.Fprintf(hw, "<p>Out-of-fold predictions from cross-validation with the selected cost %g, for %d compounds.</p>\n", bestCost, len(preds))
+	fmt.Fprintf(hw, "<table>\n<tr><th>Compounds</th><th>RMSD</th><th>MAE</th><th>R²</th></tr>\n%s</table>\n", metrics.htmlRow())
+	fmt.Fprintf(hw, "<h2>Residual diagnostics</h2>\n%s%s",
+		svgScatter("Predicted vs observed", "Observed", "Predicted", observed, predicted, true),
+		svgHistogram("Residuals", "Predicted - observed", residuals, 30))
+	fmt.Fprintf(hw, "<h2>Worst predicted compounds</h2>\n<table>\n<tr><th>ID</th><th>SMILES</th><th>Observed</th><th>Predicted</th><th>Residual</th></tr>\n")
+	for _, pred := range worst {
+		fmt.Fprintf(hw, "<tr><td>%s</td><td>%s</td><td>%g</td><td>%g</td><td>%.3f</td></tr>\n",
+			html.EscapeString(pred.id), html.EscapeString(pred.smiles), pred.observed, pred.predicted, pred.residual())
+	}
+	fmt.Fprintf(hw, "</table>\n</body>\n</html>\n")
+	if err := hw.Flush(); err != nil {
+		return err
+	}
+
+	summaryFile, err := createFile(summaryPath)
+	if err != nil {
+		return err
+	}
+	defer summaryFile.Close()
+	_, err = fmt.Fprintf(summaryFile, "## %s\n\n"+
+		"Selected cost: %g. Residual diagnostics: `%s`\n\n"+
+		"| Subset | Compounds | RMSD | MAE | R² |\n"+
+		"|---|---:|---:|---:|---:|\n"+
+		"%s\n",
+		conf.Title, bestCost, finalHTMLPath, metrics.row("Out-of-fold"))
+	return err
+}
@@ -0,0 +1,76 @@
+package mlcomp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteOOFReport(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "oofreport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+	// The first and last compounds have identical sparse rows
+	files := map[string]string{
+		"bestcost":   "20\t0.5\t1\n",
+		"train":      "1.5 1:1 2:1\n2.0 3:2\n1.5 1:1 2:1\n",
+		"trainsigns": "CCO\t1.5\t[C] 1\t[O] 1\nCCN\t2.0\t[N] 2\nCOC\t1.5\t[C] 1\t[O] 1\n",
+		"ids":        "id\tsmiles\nA1\tCCO\nA2\tCCN\nA3\tCOC\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(path(name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeReport := func(oof string) error {
+		if err := ioutil.WriteFile(path("oof"), []byte(oof), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return writeOOFReport(OOFReportConf{Title: "OOF", WithIDs: true, WorstCnt: 2},
+			path("oof"), path("bestcost"), path("train"), path("trainsigns"), path("ids"),
+			path("oof.tsv"), path("oof.html"), path("oof.md"), "oof.html")
+	}
+
+	// Predictions in fold order, for two costs
+	err = writeReport("0.5\t9\t1\t1.5 1:1 2:1\n" +
+		"1\t1.25\t3\t1.5 1:1 2:1\n" +
+		"1\t2.5\t2\t2.0 3:2\n" +
+		"1\t1\t1\t1.5 1:1 2:1\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := readTSV(t, path("oof.tsv"))
+	for i, expected := range [][]string{
+		{"row", "id", "smiles", "observed", "predicted", "residual"},
+		{"1", "A1", "CCO", "1.5", "1", "-0.5"},
+		{"2", "A2", "CCN", "2", "2.5", "0.5"},
+		{"3", "A3", "COC", "1.5", "1.25", "-0.25"},
+	} {
+		if i >= len(table) || strings.Join(table[i], "\t") != strings.Join(expected, "\t") {
+			t.Errorf("Wrong out-of-fold table:\nEXPECTED row %d: %q\nACTUAL: %q", i, expected, table)
+		}
+	}
+	if summary, err := ioutil.ReadFile(path("oof.md")); err != nil || !strings.Contains(string(summary), "| Out-of-fold | 3 |") {
+		t.Errorf("Expected 3 compounds in the summary, got: %s (%v)", summary, err)
+	}
+
+	for _, tc := range []struct {
+		oof      string
+		expected string
+	}{
+		{"1\t1\t4\t1.5 1:1 2:1\n", "invalid row number"},
+		{"1\t1\t\t1.5 1:1 2:1\n", "invalid row number"},
+		{"1\t1\t2\t1.5 1:1 2:1\n", "does not match row 2"},
+		{"1\t1\t1\t1.5 1:1 2:1\n1\t1.2\t1\t1.5 1:1 2:1\n", "more than one prediction for row 1"},
+		{"1\t1\t1.5 1:1 2:1\n", "expected cost, prediction, row number and row"},
+	} {
+		if err := writeReport(tc.oof); err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("Expected an error containing %q for out-of-fold predictions %q, got: %v", tc.expected, tc.oof, err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package mlcomp
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"sort"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+// PredictEnsemble predicts the response of compounds with an ensemble
+// bundle, written by EnsembleBundle, as the mean of the predictions of its
+// members. The standard deviation of the member predictions is kept next to
+// the mean, as an estimate of the uncertainty. The mean predictions are
+// written in the same format as by PredictLibLinear, so that they can be
+// assessed in the same way.
+//
+// The compounds are read from a signatures file, such as the test data
+// written by SampleTrainAndTest. If the file has response values, the summary
+// compares the errors for the compounds with the lowest and highest spread.
+type PredictEnsemble struct {
+	*Process
+}
+
+// PredictEnsembleConf contains parameters for initializing a PredictEnsemble
+// process
+type PredictEnsembleConf struct {
+	// Title is used as the heading of the summary
+	Title string
+	// Note is added to the summary, below the heading, such as a caveat about
+	// the predicted compounds
+	Note string
+}
+
+// NewPredictEnsemble returns a new PredictEnsemble process
+func NewPredictEnsemble(wf *sp.Workflow, name string, params PredictEnsembleConf) *PredictEnsemble {
+	p := newProcess(wf, name, "# Go ensemble prediction: {i:bundle} {i:compounds} {o:prediction} {o:spread} {o:summary}")
+	p.SetOut("prediction", "{i:bundle}.pred")
+	p.SetOut("spread", "{i:bundle}.pred_spread.tsv")
+	p.SetOut("summary", "{i:bundle}.pred_summary.md")
+	p.CustomExecute = func(t *sp.Task) {
+		err := writeEnsemblePredictions(params,
+			t.InPath("bundle"),
+			t.InPath("compounds"),
+			t.OutIP("prediction").TempPath(),
+			t.OutIP("spread").TempPath(),
+			t.OutIP("summary").TempPath())
+		if err != nil {
+			sp.Failf("Could not predict %s with ensemble %s: %v", t.InPath("compounds"), t.InPath("bundle"), err)
+		}
+	}
+	return &PredictEnsemble{p}
+}
+
+// InBundle returns the Bundle in-port
+func (p *PredictEnsemble) InBundle() *sp.InPort {
+	return p.In("bundle")
+}
+
+// InCompounds returns the Compounds in-port, taking a signatures file
+func (p *PredictEnsemble) InCompounds() *sp.InPort {
+	return p.In("compounds")
+}
+
+// OutPrediction returns the Prediction out-port, with the mean prediction of
+// each compound
+func (p *PredictEnsemble) OutPrediction() *sp.OutPort {
+	return p.Out("prediction")
+}
+
+// OutSpread returns the Spread out-port, with the observed value, and the
+// mean, standard deviation, min and max of the member predictions of each
+// compound
+func (p *PredictEnsemble) OutSpread() *sp.OutPort {
+	return p.Out("spread")
+}
+
+// OutSummary returns the Summary out-port, with a Markdown summary
+func (p *PredictEnsemble) OutSummary() *sp.OutPort {
+	return p.Out("summary")
+}
+
+func writeEnsemblePredictions(conf PredictEnsembleConf, bundlePath string, compoundsPath string, predPath string, spreadPath string, summaryPath string) error {
+	members, info, err := readEnsembleBundle(bundlePath)
+	if err != nil {
+		return err
+	}
+	records, err := readSignatureRecords(compoundsPath)
+	if err != nil {
+		return err
+	}
+
+	predFile, err := createFile(predPath)
+	if err != nil {
+		return err
+	}
+	defer predFile.Close()
+	predWriter := bufio.NewWriter(predFile)
+	spreadFile, err := createFile(spreadPath)
+	if err != nil {
+		return err
+	}
+	defer spreadFile.Close()
+	spreadWriter := bufio.NewWriter(spreadFile)
+	fmt.Fprintln(spreadWriter, "row\tsmiles\tobserved\tpredicted\tsd\tmin\tmax")
+
+	type predError struct {
+		observed float64
+		pred     ensemblePrediction
+	}
+	withObserved := []predError{}
+	var all predMetrics
+	sds := []float64{}
+	for i, rec := range records {
+		pred := predictEnsemble(members, rec.Signatures)
+		fmt.Fprintf(predWriter, "%g\n", pred.mean)
+		fmt.Fprintf(spreadWriter, "%d\t%s\t%s\t%g\t%.4f\t%g\t%g\n", i+1, rec.SMILES, rec.Response, pred.mean, pred.sd, pred.min, pred.max)
+		sds = append(sds, pred.sd)
+		observed := math.NaN()
+		fmt.Sscan(rec.Response, &observed)
+		if !math.IsNaN(observed) {
+			all.add(observed, pred.mean)
+			withObserved = append(withObserved, predError{observed, pred})
+		}
+	}
+	if err := predWriter.Flush(); err != nil {
+		return err
+	}
+	if err := spreadWriter.Flush(); err != nil {
+		return err
+	}
+
+	// Compare the errors of the half of the compounds with the lowest spread,
+	// to the half with the highest
+	sort.SliceStable(withObserved, func(i, j int) bool { return withObserved[i].pred.sd < withObserved[j].pred.sd })
+	var lowSpread, highSpread predMetrics
+	for i, pe := range withObserved {
+		if i < len(withObserved)/2 {
+			lowSpread.add(pe.observed, pe.pred.mean)
+		} else {
+			highSpread.add(pe.observed, pe.pred.mean)
+		}
+	}
+	meanSpread, _ := meanSD(sds)
+
+	summaryFile, err := createFile(summaryPath)
+	if err != nil {
+		return err
+	}
+	defer summaryFile.Close()
+	note := ""
+	if conf.Note != "" {
+		note = conf.Note + "\n\n"
+	}
+	_, err = fmt.Fprintf(summaryFile, "## %s\n\n%s"+
+		"Mean of %d %s ensemble members, for %d compounds, with a mean member standard deviation of %.4f. Bundle: `%s`\n\n"+
+		"| Subset | Compounds | RMSD | MAE | R² |\n"+
+		"|---|---:|---:|---:|---:|\n"+
+		"%s%s%s\n",
+		conf.Title, note, len(members), info["method"], len(records), meanSpread, bundlePath,
+		all.row("All"), lowSpread.row("Lowest spread half"), highSpread.row("Highest spread half"))
+	return err
+}
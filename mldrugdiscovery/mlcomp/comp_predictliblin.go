@@ -1,25 +1,29 @@
-package main
+package mlcomp
 
 import sp "github.com/scipipe/scipipe"
 
-// PredictLibLinear does blabla ...
+// PredictLibLinear predicts the responses of a sparse dataset with a
+// LIBLINEAR model
 type PredictLibLinear struct {
-	*sp.Process
+	*Process
 }
 
 // PredictLibLinearConf contains parameters for initializing a
 // PredictLibLinear process
 type PredictLibLinearConf struct {
 	ReplicateID string
+	// ToolPath is the path of the LIBLINEAR predict command, defaults to
+	// DefaultBinDir + "lin-predict"
+	ToolPath string
 }
 
 // NewPredictLibLinear returns a new PredictLibLinear process
 func NewPredictLibLinear(wf *sp.Workflow, name string, params PredictLibLinearConf) *PredictLibLinear {
-	cmd := `../bin/lin-predict ` +
+	cmd := toolPath(params.ToolPath, "lin-predict") + ` ` +
 		`{i:testdata} ` +
 		`{i:model} ` +
 		`{o:prediction} `
-	p := wf.NewProc(name, cmd)
+	p := newProcess(wf, name, cmd)
 	p.SetOut("prediction", "{i:model}.pred")
 
 	return &PredictLibLinear{p}
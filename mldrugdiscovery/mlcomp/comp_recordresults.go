@@ -0,0 +1,176 @@
+package mlcomp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+// RecordResults records the numbers in a result file, together with the
+// parameters of the step that wrote it, in a SQLite database, with the
+// sqlite3 command line tool. Rows are keyed by run ID, dataset, endpoint,
+// replicate, variant, height range, train size, cost and fold (as
+// applicable), and replaced when a step is re-run. The SQL statements are
+// written to an output file, as a record of what was inserted.
+type RecordResults struct {
+	*Process
+}
+
+// ResultKind is the kind of result file to record, which is also the name of
+// the database table
+type ResultKind string
+
+const (
+	// ResultFoldRMSD is the RMSD of a cross-validation fold, as written by
+	// AssessLibLinear with a fold label
+	ResultFoldRMSD ResultKind = "fold_rmsd"
+	// ResultCostRMSD is the mean and standard deviation of the RMSDs of all
+	// folds for a cost
+	ResultCostRMSD ResultKind = "cost_rmsd"
+	// ResultBestCost is the selected cost, with its mean RMSD
+	ResultBestCost ResultKind = "best_cost"
+	// ResultFinalRMSD is the test set RMSD of a final model, as written by
+	// AssessLibLinear without a fold label
+	ResultFinalRMSD ResultKind = "final_rmsd"
+)
+
+// ResultKeys are the parameters identifying a result
+type ResultKeys struct {
+	RunID     string
+	Dataset   string
+	Replicate string
+	// Variant is empty for real models, and identifies control runs, such as
+	// Y-randomizations
+	Variant   string
+	Heights   string
+	TrainSize int
+	// Endpoint is the endpoint of multi-endpoint datasets, or empty
+	Endpoint string
+}
+
+// RecordResultsConf contains parameters for initializing a RecordResults
+// process
+type RecordResultsConf struct {
+	DBPath string
+	Kind   ResultKind
+	Keys   ResultKeys
+	// SQLitePath is the path of the sqlite3 command line tool, which
+	// defaults to sqlite3 in the PATH
+	SQLitePath string
+}
+
+// NewRecordResults returns a new RecordResults process
+func NewRecordResults(wf *sp.Workflow, name string, params RecordResultsConf) *RecordResults {
+	p := newProcess(wf, name, "# Go SQLite recording ("+string(params.Kind)+"): {i:result} {o:sql}")
+	p.SetOut("sql", "{i:result}."+string(params.Kind)+".sql")
+	p.CustomExecute = func(t *sp.Task) {
+		content, err := ioutil.ReadFile(t.InPath("result"))
+		if err != nil {
+			sp.Fail(err)
+		}
+		sql, err := resultSQL(params.Kind, params.Keys, string(content))
+		if err != nil {
+			sp.Failf("Could not record %s: %v", t.InPath("result"), err)
+		}
+		if err := ioutil.WriteFile(t.OutIP("sql").TempPath(), []byte(sql), 0644); err != nil {
+			sp.Fail(err)
+		}
+		if err := execSQLite(params.SQLitePath, params.DBPath, sql); err != nil {
+			sp.Failf("Could not record %s in %s: %v", t.InPath("result"), params.DBPath, err)
+		}
+	}
+	return &RecordResults{p}
+}
+
+// InResult returns the Result in-port
+func (p *RecordResults) InResult() *sp.InPort {
+	return p.In("result")
+}
+
+// OutSQL returns the SQL out-port, with the executed SQL statements
+func (p *RecordResults) OutSQL() *sp.OutPort {
+	return p.Out("sql")
+}
+
+// resultKeyColumns are the key columns common to all result tables
+const resultKeyColumns = "run_id TEXT NOT NULL, dataset TEXT NOT NULL, endpoint TEXT NOT NULL, replicate TEXT NOT NULL, variant TEXT NOT NULL, " +
+	"heights TEXT NOT NULL, train_size INTEGER NOT NULL"
+
+// resultTables maps result kinds to their value columns, and the columns
+// added to the common key columns in the primary key
+var resultTables = map[ResultKind]struct {
+	columns []string
+	keys    []string
+}{
+	ResultFoldRMSD:  {[]string{"cost REAL NOT NULL", "fold TEXT NOT NULL", "rmsd REAL"}, []string{"cost", "fold"}},
+	ResultCostRMSD:  {[]string{"cost REAL NOT NULL", "mean_rmsd REAL", "sd_rmsd REAL"}, []string{"cost"}},
+	ResultBestCost:  {[]string{"cost REAL NOT NULL", "mean_rmsd REAL"}, []string{}},
+	ResultFinalRMSD: {[]string{"cost REAL NOT NULL", "rmsd REAL"}, []string{}},
+}
+
+// resultSQL returns SQL statements creating the table for kind, if missing,
+// and inserting the values in content, the content of a result file
+func resultSQL(kind ResultKind, keys ResultKeys, content string) (string, error) {
+	table, ok := resultTables[kind]
+	if !ok {
+		return "", fmt.Errorf("unknown result kind: %s", kind)
+	}
+	fields := strings.Fields(content)
+	// Field indexes of the values, in the order of the value columns
+	fieldIdxs := map[ResultKind][]int{
+		ResultFoldRMSD:  {1, 2, 0},
+		ResultCostRMSD:  {1, 0, 2},
+		ResultBestCost:  {2, 1},
+		ResultFinalRMSD: {1, 0},
+	}[kind]
+	values := []string{sqlQuote(keys.RunID), sqlQuote(keys.Dataset), sqlQuote(keys.Endpoint), sqlQuote(keys.Replicate), sqlQuote(keys.Variant),
+		sqlQuote(keys.Heights), strconv.Itoa(keys.TrainSize)}
+	for i, fieldIdx := range fieldIdxs {
+		if fieldIdx >= len(fields) {
+			return "", fmt.Errorf("expected at least %d fields for %s, got: %q", fieldIdx+1, kind, content)
+		}
+		if strings.HasPrefix(table.columns[i], "fold ") {
+			values = append(values, sqlQuote(fields[fieldIdx]))
+			continue
+		}
+		val, err := strconv.ParseFloat(fields[fieldIdx], 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s value: %v", strings.Fields(table.columns[i])[0], err)
+		}
+		values = append(values, strconv.FormatFloat(val, 'g', -1, 64))
+	}
+	primaryKey := append([]string{"run_id", "dataset", "endpoint", "replicate", "variant", "heights", "train_size"}, table.keys...)
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s, %s, recorded_at TEXT DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY (%s));\n"+
+		"INSERT OR REPLACE INTO %s VALUES (%s, CURRENT_TIMESTAMP);\n",
+		kind, resultKeyColumns, strings.Join(table.columns, ", "), strings.Join(primaryKey, ", "),
+		kind, strings.Join(values, ", ")), nil
+}
+
+// sqlQuote returns s as an SQL string literal
+func sqlQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// execSQLite executes SQL statements on the database at dbPath, which is
+// created if missing, with the sqlite3 tool at sqlitePath, or in the PATH if
+// empty. Concurrent writers wait for each other for up to a minute.
+func execSQLite(sqlitePath string, dbPath string, sql string) error {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return err
+	}
+	if sqlitePath == "" {
+		sqlitePath = "sqlite3"
+	}
+	cmd := exec.Command(sqlitePath, "-bail", "-cmd", ".timeout 60000", dbPath)
+	cmd.Stdin = strings.NewReader("BEGIN IMMEDIATE;\n" + sql + "COMMIT;\n")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
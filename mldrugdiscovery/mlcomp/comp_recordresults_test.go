@@ -0,0 +1,35 @@
+package mlcomp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResultSQL(t *testing.T) {
+	keys := ResultKeys{RunID: "run'1", Dataset: "testdataset", Replicate: "r1", Heights: "1-3", TrainSize: 500}
+	for _, tc := range []struct {
+		kind           ResultKind
+		content        string
+		expectedValues string
+	}{
+		{ResultFoldRMSD, "0.82\t0.5\t3\n", "'1-3', 500, 0.5, '3', 0.82, CURRENT_TIMESTAMP"},
+		{ResultCostRMSD, "0.8\t0.5\t0.05\t0:0.75,1:0.85\n", "'1-3', 500, 0.5, 0.8, 0.05, CURRENT_TIMESTAMP"},
+		{ResultBestCost, "500\t0.8\t0.5\n", "'1-3', 500, 0.5, 0.8, CURRENT_TIMESTAMP"},
+		{ResultFinalRMSD, "0.9\t0.5\n", "'1-3', 500, 0.5, 0.9, CURRENT_TIMESTAMP"},
+	} {
+		sql, err := resultSQL(tc.kind, keys, tc.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(sql, "CREATE TABLE IF NOT EXISTS "+string(tc.kind)+" ") {
+			t.Errorf("Expected the %s table to be created, in:\n%s", tc.kind, sql)
+		}
+		expectedInsert := "INSERT OR REPLACE INTO " + string(tc.kind) + " VALUES ('run''1', 'testdataset', '', 'r1', '', " + tc.expectedValues + ");"
+		if !strings.Contains(sql, expectedInsert) {
+			t.Errorf("Wrong insert statement:\nEXPECTED: %s\nACTUAL: %s\n", expectedInsert, sql)
+		}
+	}
+	if _, err := resultSQL(ResultFinalRMSD, keys, "0.9\n"); err == nil {
+		t.Errorf("Expected an error for a result file without cost")
+	}
+}
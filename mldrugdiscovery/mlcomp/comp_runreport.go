@@ -0,0 +1,40 @@
+package mlcomp
+
+import (
+	sp "github.com/scipipe/scipipe"
+	spcomp "github.com/scipipe/scipipe/components"
+)
+
+// RunReport collects Markdown sections, written by other processes, into a
+// single report for the workflow run
+type RunReport struct {
+	*Process
+	sections *spcomp.StreamToSubStream
+}
+
+// RunReportConf contains parameters for initializing a RunReport process
+type RunReportConf struct {
+	Title      string
+	ReportPath string
+}
+
+// NewRunReport returns a new RunReport process
+func NewRunReport(wf *sp.Workflow, name string, params RunReportConf) *RunReport {
+	sections := spcomp.NewStreamToSubStream(wf, name+"_sections")
+	p := newProcess(wf, name, `(echo "# {p:title}" && echo && cat {i:sections|join: }) > {o:report}`)
+	p.InParam("title").FromStr(params.Title)
+	p.SetOut("report", params.ReportPath)
+	p.In("sections").From(sections.OutSubStream())
+	return &RunReport{p, sections}
+}
+
+// InSection returns the in-port for Markdown sections to include in the
+// report. Sections are included in the order they are finished.
+func (p *RunReport) InSection() *sp.InPort {
+	return p.sections.In()
+}
+
+// OutReport returns the Report out-port
+func (p *RunReport) OutReport() *sp.OutPort {
+	return p.Out("report")
+}
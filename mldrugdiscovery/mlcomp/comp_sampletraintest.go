@@ -0,0 +1,294 @@
+package mlcomp
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pharmbio/scipipe-demo/mldrugdiscovery/chem"
+	sp "github.com/scipipe/scipipe"
+)
+
+// SampleTrainAndTest samples train and test datasets from an input dataset
+// consisting of a text file with row-wise values.
+type SampleTrainAndTest struct {
+	*Process
+}
+
+type SamplingMethod string
+
+const (
+	SamplingMethodSignCnt SamplingMethod = "signcnt"
+	SamplingMethodRandom  SamplingMethod = "rand"
+	// SamplingMethodTemporal puts the most recent compounds in the test set,
+	// and samples the train set from older compounds
+	SamplingMethodTemporal SamplingMethod = "temporal"
+	// SamplingMethodCluster puts whole Butina clusters in the test set, and
+	// samples the train set from the other clusters
+	SamplingMethodCluster SamplingMethod = "cluster"
+	// SamplingMethodStratified samples randomly, with the same fraction from
+	// each range of response values
+	SamplingMethodStratified SamplingMethod = "stratified"
+)
+
+// IsGo returns true for sampling methods implemented in Go, rather than by
+// the Java tools
+func (m SamplingMethod) IsGo() bool {
+	return m == SamplingMethodTemporal || m == SamplingMethodCluster || m == SamplingMethodStratified
+}
+
+// SampleTrainAndTestConf contains parameters for initializing a
+// SampleTrainAndTest process
+type SampleTrainAndTestConf struct {
+	ReplicateID    string
+	TestSize       int
+	TrainSize      int
+	Seed           int
+	SamplingMethod SamplingMethod
+	// ClusterDistance is the Tanimoto distance within which compounds are
+	// neighbours, for the cluster method
+	ClusterDistance float64
+	// StrataCnt is the number of response ranges for the stratified method
+	StrataCnt int
+	// ToolPath is the path of the sampling jar of the rand and signcnt
+	// methods, defaults to DefaultBinDir + "SampleTrainingAndTest.jar" or
+	// DefaultBinDir + "SampleTrainingAndTestSizeBased.jar"
+	ToolPath string
+	// JavaPath is the path of the java command, defaults to java in PATH
+	JavaPath string
+}
+
+// NewSampleTrainAndTest return a new SampleTrainAndTestConf process
+func NewSampleTrainAndTest(wf *sp.Workflow, name string, params SampleTrainAndTestConf) *SampleTrainAndTest {
+	jarFile := map[SamplingMethod]string{
+		SamplingMethodRandom:  "SampleTrainingAndTest",
+		SamplingMethodSignCnt: "SampleTrainingAndTestSizeBased",
+	}[params.SamplingMethod]
+
+	cmd := fmt.Sprintf(`%s -jar %s \
+		-inputfile {i:signatures} \
+		-testfile {o:testdata} \
+		-trainingfile {o:traindata} \
+		-testsize %d \
+		-trainingsize %d \
+		-silent`,
+		commandPath(params.JavaPath, "java"),
+		toolPath(params.ToolPath, jarFile+".jar"),
+		params.TestSize,
+		params.TrainSize)
+	if params.Seed != 0 {
+		cmd += fmt.Sprintf(` \
+		-seed %d`, params.Seed)
+	}
+
+	if params.SamplingMethod.IsGo() {
+		cmd = "# Go sampling (" + string(params.SamplingMethod) + "): {i:signatures} {o:traindata} {o:testdata} {o:log}"
+		if params.SamplingMethod == SamplingMethodTemporal {
+			cmd += " {i:dates}"
+		}
+	}
+
+	p := newProcess(wf, name, cmd)
+	if params.SamplingMethod.IsGo() {
+		p.CustomExecute = func(t *sp.Task) {
+			datesPath := ""
+			if params.SamplingMethod == SamplingMethodTemporal {
+				datesPath = t.InPath("dates")
+			}
+			err := sampleTrainAndTest(params, t.InPath("signatures"), datesPath,
+				t.OutIP("traindata").TempPath(),
+				t.OutIP("testdata").TempPath(),
+				t.OutIP("log").TempPath())
+			if err != nil {
+				sp.Failf("Could not sample train and test data from %s: %v", t.InPath("signatures"), err)
+			}
+		}
+	}
+	fmtBasePath := func(t *sp.Task) string {
+		signPath := t.InPath("signatures")
+		trainTestSampl := fs("%d_%d_%s", params.TestSize, params.TrainSize, params.SamplingMethod)
+		return filepath.Dir(signPath) + "/sampletraintest_" + trainTestSampl + "/" + filepath.Base(signPath) + "." + trainTestSampl
+	}
+	p.SetOutFunc("traindata", func(t *sp.Task) string {
+		return fmtBasePath(t) + "_trn"
+	})
+	p.SetOutFunc("testdata", func(t *sp.Task) string {
+		return fmtBasePath(t) + "_tst"
+	})
+	p.SetOutFunc("log", func(t *sp.Task) string {
+		return fmtBasePath(t) + "_trn.log"
+	})
+	return &SampleTrainAndTest{p}
+}
+
+// InSignatures returns the Signatures in-port
+func (p *SampleTrainAndTest) InSignatures() *sp.InPort {
+	return p.In("signatures")
+}
+
+// InDates returns the Dates in-port, only used for the temporal method,
+// taking an IDs file written by LoadDataset with a date column
+func (p *SampleTrainAndTest) InDates() *sp.InPort {
+	return p.In("dates")
+}
+
+// OutTraindata returns the Traindata out-port
+func (p *SampleTrainAndTest) OutTraindata() *sp.OutPort {
+	return p.Out("traindata")
+}
+
+// OutTestdata returns the Testdata out-port
+func (p *SampleTrainAndTest) OutTestdata() *sp.OutPort {
+	return p.Out("testdata")
+}
+
+// OutLog returns the Log out-port
+func (p *SampleTrainAndTest) OutLog() *sp.OutPort {
+	return p.Out("log")
+}
+
+// sampleTrainAndTest samples train and test data with one of the Go sampling
+// methods, and logs the distribution of responses in them
+func sampleTrainAndTest(conf SampleTrainAndTestConf, signPath string, datesPath string, trainPath string, testPath string, logPath string) error {
+	lines := []string{}
+	records := []chem.SignatureRecord{}
+	responses := []float64{}
+	if err := ForEachLine(signPath, func(lineNo int, line string) error {
+		rec, err := chem.ParseSignatureRecord(line)
+		if err != nil {
+			return fmt.Errorf("%s, line %d: %v", signPath, lineNo, err)
+		}
+		resp, err := strconv.ParseFloat(rec.Response, 64)
+		if err != nil {
+			return fmt.Errorf("%s, line %d: invalid response: %v", signPath, lineNo, err)
+		}
+		lines = append(lines, line)
+		records = append(records, rec)
+		responses = append(responses, resp)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	seed := int64(conf.Seed)
+	if seed == 0 {
+		// Differ between replicates, but be reproducible
+		h := fnv.New64a()
+		h.Write([]byte(conf.ReplicateID))
+		seed = int64(h.Sum64())
+	}
+	rnd := rand.New(rand.NewSource(seed))
+
+	info := &strings.Builder{}
+	fmt.Fprintf(info, "method: %s\nseed: %d\ncompounds: %d\n", conf.SamplingMethod, seed, len(records))
+	var train, test []int
+	var err error
+	switch conf.SamplingMethod {
+	case SamplingMethodTemporal:
+		compoundDates, err := readCompoundDates(datesPath)
+		if err != nil {
+			return err
+		}
+		dated, dates := []int{}, []time.Time{}
+		for i, rec := range records {
+			canon, _, err := standardizedSMILES(rec.SMILES)
+			if err != nil {
+				canon = rec.SMILES
+			}
+			if date, ok := compoundDates[canon]; ok {
+				dated = append(dated, i)
+				dates = append(dates, date)
+			}
+		}
+		fmt.Fprintf(info, "compounds without date: %d\n", len(records)-len(dated))
+		var datedTrain, datedTest []int
+		if datedTrain, datedTest, err = sampleTemporal(dates, conf.TrainSize, conf.TestSize, rnd); err != nil {
+			return err
+		}
+		train, test = make([]int, len(datedTrain)), make([]int, len(datedTest))
+		for i, idx := range datedTrain {
+			train[i] = dated[idx]
+		}
+		for i, idx := range datedTest {
+			test[i] = dated[idx]
+		}
+		fmt.Fprintf(info, "train dates: %s\ntest dates: %s\n", dateRange(dates, datedTrain), dateRange(dates, datedTest))
+	case SamplingMethodCluster:
+		voc := chem.NewVocabulary()
+		fps := make([][]sparseEntry, len(records))
+		for i, rec := range records {
+			for sig, cnt := range rec.Signatures {
+				fps[i] = append(fps[i], sparseEntry{voc.Add(sig), float64(cnt)})
+			}
+			sort.Slice(fps[i], func(a, b int) bool { return fps[i][a].col < fps[i][b].col })
+		}
+		clusters := butinaClusters(fps, conf.ClusterDistance)
+		largest := 0
+		for _, c := range clusters {
+			if len(c) > largest {
+				largest = len(c)
+			}
+		}
+		fmt.Fprintf(info, "cluster distance: %g\nclusters: %d\nlargest cluster: %d\n", conf.ClusterDistance, len(clusters), largest)
+		if train, test, err = sampleClusters(clusters, conf.TrainSize, conf.TestSize, rnd); err != nil {
+			return err
+		}
+	case SamplingMethodStratified:
+		fmt.Fprintf(info, "strata: %d\n", conf.StrataCnt)
+		if train, test, err = sampleStratified(responses, conf.TrainSize, conf.TestSize, conf.StrataCnt, rnd); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("sampling method %s is not implemented in Go", conf.SamplingMethod)
+	}
+
+	for _, set := range []struct {
+		path string
+		idxs []int
+	}{{trainPath, train}, {testPath, test}} {
+		f, err := createFile(set.path)
+		if err != nil {
+			return err
+		}
+		bw := bufio.NewWriter(f)
+		for _, idx := range set.idxs {
+			fmt.Fprintln(bw, lines[idx])
+		}
+		if err := bw.Flush(); err != nil {
+			f.Close()
+			return err
+		}
+		f.Close()
+	}
+
+	logFile, err := createFile(logPath)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	_, err = fmt.Fprintf(logFile, "%s\nresponse distribution:\n%s", info.String(), responseDistributions(responses, train, test))
+	return err
+}
+
+// dateRange formats the earliest and latest of the dates at idxs
+func dateRange(dates []time.Time, idxs []int) string {
+	if len(idxs) == 0 {
+		return "-"
+	}
+	first, last := dates[idxs[0]], dates[idxs[0]]
+	for _, idx := range idxs {
+		if dates[idx].Before(first) {
+			first = dates[idx]
+		}
+		if dates[idx].After(last) {
+			last = dates[idx]
+		}
+	}
+	return first.Format("2006-01-02") + " to " + last.Format("2006-01-02")
+}
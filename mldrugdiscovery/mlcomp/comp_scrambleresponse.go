@@ -0,0 +1,103 @@
+package mlcomp
+
+import (
+	"bufio"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+// ScrambleResponse randomly permutes the response values (the first column)
+// of a sparse dataset, keeping the features of each row, for use in
+// Y-randomization control experiments. As creating sparse datasets keeps the
+// order of rows, this is the same as scrambling the sampled train data.
+type ScrambleResponse struct {
+	*Process
+}
+
+// ScrambleResponseConf contains parameters for initializing a
+// ScrambleResponse process
+type ScrambleResponseConf struct {
+	Seed int64
+	// Index numbers the scrambles of the same data, in the name of the
+	// scrambled file. Defaults to the seed.
+	Index int
+}
+
+// NewScrambleResponse returns a new ScrambleResponse process
+func NewScrambleResponse(wf *sp.Workflow, name string, params ScrambleResponseConf) *ScrambleResponse {
+	p := newProcess(wf, name, "# Go response scrambling: {i:in} {o:scrambled} {p:index} {p:seed}")
+	index := params.Index
+	if index == 0 {
+		index = int(params.Seed)
+	}
+	p.InParam("index").FromInt(index)
+	p.InParam("seed").FromStr(strconv.FormatInt(params.Seed, 10))
+	p.SetOut("scrambled", "{i:in}.yrnd{p:index}")
+	p.CustomExecute = func(t *sp.Task) {
+		if err := scrambleResponse(t.InPath("in"), t.OutIP("scrambled").TempPath(), params.Seed); err != nil {
+			sp.Failf("Could not scramble responses in %s: %v", t.InPath("in"), err)
+		}
+	}
+	return &ScrambleResponse{p}
+}
+
+// InData returns the Data in-port
+func (p *ScrambleResponse) InData() *sp.InPort {
+	return p.In("in")
+}
+
+// OutScrambled returns the Scrambled out-port
+func (p *ScrambleResponse) OutScrambled() *sp.OutPort {
+	return p.Out("scrambled")
+}
+
+func scrambleResponse(inPath string, outPath string, seed int64) error {
+	inFile, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+	responses := []string{}
+	features := []string{}
+	sc := bufio.NewScanner(inFile)
+	sc.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for sc.Scan() {
+		parts := strings.SplitN(sc.Text(), " ", 2)
+		responses = append(responses, parts[0])
+		if len(parts) == 2 {
+			features = append(features, parts[1])
+		} else {
+			features = append(features, "")
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	rnd := rand.New(rand.NewSource(seed))
+	rnd.Shuffle(len(responses), func(i, j int) {
+		responses[i], responses[j] = responses[j], responses[i]
+	})
+
+	outFile, err := createFile(outPath)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(outFile)
+	for i, resp := range responses {
+		if features[i] == "" {
+			bw.WriteString(resp + "\n")
+		} else {
+			bw.WriteString(resp + " " + features[i] + "\n")
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		outFile.Close()
+		return err
+	}
+	return outFile.Close()
+}
@@ -0,0 +1,74 @@
+package mlcomp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestScrambleResponse(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "scramble")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	rows := []string{}
+	for i := 1; i <= 20; i++ {
+		rows = append(rows, fs("%d.5 %d:1 %d:2", i, i, i+100))
+	}
+	rows = append(rows, "7.0")
+	inPath := filepath.Join(tmpDir, "train")
+	if err := ioutil.WriteFile(inPath, []byte(strings.Join(rows, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scramble := func(seed int64) []string {
+		outPath := filepath.Join(tmpDir, fs("train.yrnd%d", seed))
+		if err := scrambleResponse(inPath, outPath, seed); err != nil {
+			t.Fatal(err)
+		}
+		dat, err := ioutil.ReadFile(outPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSuffix(string(dat), "\n"), "\n")
+	}
+
+	scrambled := scramble(1)
+	if len(scrambled) != len(rows) {
+		t.Fatalf("Expected %d rows, got %d", len(rows), len(scrambled))
+	}
+	expectedResponses, responses := []string{}, []string{}
+	moved := 0
+	for i, row := range scrambled {
+		expectedFields := strings.SplitN(rows[i], " ", 2)
+		fields := strings.SplitN(row, " ", 2)
+		expectedResponses = append(expectedResponses, expectedFields[0])
+		responses = append(responses, fields[0])
+		if len(fields) != len(expectedFields) || (len(fields) == 2 && fields[1] != expectedFields[1]) {
+			t.Errorf("Expected the features of row %d to stay with the row:\nEXPECTED: %q\nACTUAL: %q", i, rows[i], row)
+		}
+		if fields[0] != expectedFields[0] {
+			moved++
+		}
+	}
+	sort.Strings(expectedResponses)
+	sort.Strings(responses)
+	if !reflect.DeepEqual(responses, expectedResponses) {
+		t.Errorf("Expected the same responses after scrambling:\nEXPECTED: %v\nACTUAL: %v", expectedResponses, responses)
+	}
+	if moved == 0 {
+		t.Error("Expected responses to be moved between rows")
+	}
+
+	if !reflect.DeepEqual(scramble(1), scrambled) {
+		t.Error("Expected the same permutation with the same seed")
+	}
+	if reflect.DeepEqual(scramble(2), scrambled) {
+		t.Error("Expected different permutations with different seeds")
+	}
+}
@@ -0,0 +1,196 @@
+package mlcomp
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+// SelectEndpoint selects one endpoint of a multi-endpoint dataset, in a
+// sparse dataset and in the signatures file it was created from. Signatures
+// and sparse datasets are created once for all endpoints, with the response
+// of the first endpoint that a compound has a value for. Here, the responses
+// are replaced with the values of the selected endpoint, from the endpoints
+// table written by LoadDataset, and compounds without a value are dropped.
+// As creating sparse datasets keeps the order of rows, the rows of the sparse
+// dataset and the signatures file are matched by position.
+type SelectEndpoint struct {
+	*Process
+}
+
+// SelectEndpointConf contains parameters for initializing a SelectEndpoint
+// process
+type SelectEndpointConf struct {
+	// Endpoint is the name of the endpoint column
+	Endpoint string
+}
+
+// NewSelectEndpoint returns a new SelectEndpoint process
+func NewSelectEndpoint(wf *sp.Workflow, name string, params SelectEndpointConf) *SelectEndpoint {
+	p := newProcess(wf, name, "# Go endpoint selection: {i:sparse} {i:signatures} {i:endpoints} {o:sparse} {o:signatures} {p:endpoint}")
+	p.InParam("endpoint").FromStr(EndpointFileName(params.Endpoint))
+	p.SetOut("sparse", "{i:sparse}.{p:endpoint}")
+	p.SetOut("signatures", "{i:signatures}.{p:endpoint}")
+	p.CustomExecute = func(t *sp.Task) {
+		values, err := readEndpointValues(t.InPath("endpoints"), params.Endpoint)
+		if err != nil {
+			sp.Fail(err)
+		}
+		kept, dropped, err := selectEndpoint(values,
+			t.InPath("sparse"),
+			t.InPath("signatures"),
+			t.OutIP("sparse").TempPath(),
+			t.OutIP("signatures").TempPath())
+		if err != nil {
+			sp.Failf("Could not select endpoint %s in %s: %v", params.Endpoint, t.InPath("sparse"), err)
+		}
+		sp.Info.Printf("Endpoint %s: kept %d compounds in %s, and dropped %d without values\n", params.Endpoint, kept, t.InPath("sparse"), dropped)
+	}
+	return &SelectEndpoint{p}
+}
+
+// InSparse returns the Sparse in-port, taking an (un-gzipped) sparse dataset
+func (p *SelectEndpoint) InSparse() *sp.InPort {
+	return p.In("sparse")
+}
+
+// InSignatures returns the Signatures in-port, taking the signatures file
+// that the sparse dataset was created from
+func (p *SelectEndpoint) InSignatures() *sp.InPort {
+	return p.In("signatures")
+}
+
+// InEndpoints returns the Endpoints in-port, taking the endpoints table of
+// LoadDataset
+func (p *SelectEndpoint) InEndpoints() *sp.InPort {
+	return p.In("endpoints")
+}
+
+// OutSparse returns the Sparse out-port, with the sparse dataset of the
+// endpoint
+func (p *SelectEndpoint) OutSparse() *sp.OutPort {
+	return p.Out("sparse")
+}
+
+// OutSignatures returns the Signatures out-port, with the signatures file of
+// the endpoint
+func (p *SelectEndpoint) OutSignatures() *sp.OutPort {
+	return p.Out("signatures")
+}
+
+var endpointFileNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// EndpointFileName returns an endpoint name usable in file and process names
+func EndpointFileName(endpoint string) string {
+	return endpointFileNameUnsafe.ReplaceAllString(endpoint, "_")
+}
+
+// endpointValues maps standardized SMILES to the values of an endpoint, with
+// duplicate structures merged by their mean value
+type endpointValues map[string]float64
+
+// readEndpointValues reads the values of endpoint from an endpoints table
+// written by LoadDataset
+func readEndpointValues(path string, endpoint string) (endpointValues, error) {
+	col := -1
+	valsByCanon := map[string][]float64{}
+	err := ForEachLine(path, func(lineNo int, line string) error {
+		fields := strings.Split(line, "\t")
+		if lineNo == 1 {
+			for i, field := range fields {
+				if field == endpoint && i > 0 {
+					col = i
+				}
+			}
+			if col < 0 {
+				return fmt.Errorf("%s: no endpoint %q in header: %s", path, endpoint, strings.Join(fields[1:], ", "))
+			}
+			return nil
+		}
+		if col >= len(fields) || fields[col] == "" {
+			return nil
+		}
+		val, err := strconv.ParseFloat(fields[col], 64)
+		if err != nil {
+			return fmt.Errorf("%s, line %d: %v", path, lineNo, err)
+		}
+		if canon, _, err := standardizedSMILES(fields[0]); err == nil {
+			valsByCanon[canon] = append(valsByCanon[canon], val)
+		}
+		return nil
+	})
+	values := endpointValues{}
+	for canon, vals := range valsByCanon {
+		values[canon] = aggregate(vals, AggregationMean)
+	}
+	return values, err
+}
+
+// lookup returns the endpoint value of the compound with the given SMILES,
+// which is standardized again, as for compoundIDIndex
+func (ev endpointValues) lookup(smiles string) (float64, bool) {
+	canon, _, err := standardizedSMILES(smiles)
+	if err != nil {
+		canon = smiles
+	}
+	val, ok := ev[canon]
+	return val, ok
+}
+
+// selectEndpoint writes the rows of the sparse dataset and the signatures
+// file with values in values, with the responses replaced by the values, and
+// returns the numbers of kept and dropped rows
+func selectEndpoint(values endpointValues, sparsePath string, signPath string, outSparsePath string, outSignPath string) (int, int, error) {
+	records, err := readSignatureRecords(signPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	sparseRows := []string{}
+	err = ForEachLine(sparsePath, func(lineNo int, line string) error {
+		sparseRows = append(sparseRows, line)
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(sparseRows) != len(records) {
+		return 0, 0, fmt.Errorf("%d rows in %s, but %d records in %s", len(sparseRows), sparsePath, len(records), signPath)
+	}
+
+	sparseFile, err := createFile(outSparsePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer sparseFile.Close()
+	sparseOut := bufio.NewWriter(sparseFile)
+	signFile, err := createFile(outSignPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer signFile.Close()
+	signOut := bufio.NewWriter(signFile)
+
+	kept := 0
+	for i, rec := range records {
+		val, ok := values.lookup(rec.SMILES)
+		if !ok {
+			continue
+		}
+		kept++
+		rec.Response = strconv.FormatFloat(val, 'g', -1, 64)
+		fmt.Fprintln(signOut, rec.String())
+		features := ""
+		if parts := strings.SplitN(sparseRows[i], " ", 2); len(parts) == 2 {
+			features = " " + parts[1]
+		}
+		fmt.Fprintln(sparseOut, rec.Response+features)
+	}
+	if err := sparseOut.Flush(); err != nil {
+		return 0, 0, err
+	}
+	return kept, len(records) - kept, signOut.Flush()
+}
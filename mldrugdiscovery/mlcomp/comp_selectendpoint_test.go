@@ -0,0 +1,69 @@
+package mlcomp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelectEndpoint(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "selectendpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+	files := map[string]string{
+		// Ethanol is listed twice, once as a salt, and has no pKi value.
+		// Phenol has no pIC50 value.
+		"endpoints.tsv": "smiles\tpIC50\tpKi\n" +
+			"CCO\t5\t\n" +
+			"CCO.Cl\t6\t\n" +
+			"c1ccccc1O\t\t7.5\n" +
+			"CCN\t4\t8\n",
+		"train.sign": "OCC\t5.5\tC 2\tO 1\n" +
+			"Oc1ccccc1\t7.5\tC 6\tO 1\n" +
+			"NCC\t4\tC 2\tN 1\n",
+		"train.csr": "5.5 1:2 2:1\n" +
+			"7.5 1:6 2:1\n" +
+			"4 1:2 3:1\n",
+	}
+	for name, content := range files {
+		ioutil.WriteFile(path(name), []byte(content), 0644)
+	}
+
+	for _, tc := range []struct {
+		endpoint       string
+		expectedSparse string
+		expectedSigns  string
+	}{
+		{"pIC50", "5.5 1:2 2:1\n4 1:2 3:1\n", "OCC\t5.5\tC 2\tO 1\nNCC\t4\tC 2\tN 1\n"},
+		{"pKi", "7.5 1:6 2:1\n8 1:2 3:1\n", "Oc1ccccc1\t7.5\tC 6\tO 1\nNCC\t8\tC 2\tN 1\n"},
+	} {
+		values, err := readEndpointValues(path("endpoints.tsv"), tc.endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kept, dropped, err := selectEndpoint(values, path("train.csr"), path("train.sign"), path("out.csr"), path("out.sign"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kept != 2 || dropped != 1 {
+			t.Errorf("Expected 2 kept and 1 dropped compounds for %s, got %d and %d", tc.endpoint, kept, dropped)
+		}
+		for outPath, expected := range map[string]string{path("out.csr"): tc.expectedSparse, path("out.sign"): tc.expectedSigns} {
+			content, err := ioutil.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != expected {
+				t.Errorf("Wrong %s content for %s:\nEXPECTED:\n%s\nACTUAL:\n%s", filepath.Base(outPath), tc.endpoint, expected, content)
+			}
+		}
+	}
+
+	if _, err := readEndpointValues(path("endpoints.tsv"), "pEC50"); err == nil {
+		t.Errorf("Expected an error for a missing endpoint")
+	}
+}
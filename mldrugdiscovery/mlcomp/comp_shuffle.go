@@ -1,4 +1,4 @@
-package main
+package mlcomp
 
 import (
 	sp "github.com/scipipe/scipipe"
@@ -7,7 +7,7 @@ import (
 // ShuffleLines shuffles the lines in the file on the InData in-port, based on
 // random bytes in a file on the InRandBytes in-port
 type ShuffleLines struct {
-	*sp.Process
+	*Process
 }
 
 // ShuffleLinesConf contains parameters for initializing a
@@ -21,7 +21,7 @@ func NewShuffleLines(wf *sp.Workflow, name string, params ShuffleLinesConf) *Shu
 		`--random-source={i:randbytes} ` +
 		`{i:in} ` +
 		`> {o:shuffled}`
-	p := wf.NewProc(name, cmd)
+	p := newProcess(wf, name, cmd)
 	p.SetOut("shuffled", "{i:in}.shuf")
 	return &ShuffleLines{p}
 }
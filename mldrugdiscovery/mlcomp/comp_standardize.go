@@ -0,0 +1,199 @@
+package mlcomp
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pharmbio/scipipe-demo/mldrugdiscovery/chem"
+	sp "github.com/scipipe/scipipe"
+)
+
+// StandardizeSmiles validates and standardizes a SMILES file, with a SMILES
+// string and a response value on each line. Salts are stripped, and
+// duplicate structures (by canonical SMILES) are merged into one line, with
+// an aggregated response value. Lines that can not be used are written to a
+// rejects file, together with the reason.
+type StandardizeSmiles struct {
+	*Process
+}
+
+// Aggregation is a method for aggregating response values of duplicates
+type Aggregation string
+
+const (
+	AggregationMean   Aggregation = "mean"
+	AggregationMedian Aggregation = "median"
+)
+
+// StandardizeSmilesConf contains parameters for initializing a
+// StandardizeSmiles process
+type StandardizeSmilesConf struct {
+	Aggregation Aggregation
+}
+
+// NewStandardizeSmiles returns a new StandardizeSmiles process
+func NewStandardizeSmiles(wf *sp.Workflow, name string, params StandardizeSmilesConf) *StandardizeSmiles {
+	if params.Aggregation == "" {
+		params.Aggregation = AggregationMean
+	}
+	p := newProcess(wf, name, "# Go standardization: {i:smiles} {o:standardized} {o:rejects} {o:summary}")
+	p.SetOut("standardized", "{i:smiles|%.smi}.std.smi")
+	p.SetOut("rejects", "{i:smiles|%.smi}.std_rejects.tsv")
+	p.SetOut("summary", "{i:smiles|%.smi}.std_summary.md")
+	p.CustomExecute = func(t *sp.Task) {
+		err := standardizeSmiles(t.InPath("smiles"), params.Aggregation,
+			t.OutIP("standardized").TempPath(),
+			t.OutIP("rejects").TempPath(),
+			t.OutIP("summary").TempPath())
+		if err != nil {
+			sp.Failf("Could not standardize %s: %v", t.InPath("smiles"), err)
+		}
+	}
+	return &StandardizeSmiles{p}
+}
+
+// InSmiles returns the Smiles in-port
+func (p *StandardizeSmiles) InSmiles() *sp.InPort {
+	return p.In("smiles")
+}
+
+// OutStandardized returns the Standardized out-port, with one line per unique
+// structure
+func (p *StandardizeSmiles) OutStandardized() *sp.OutPort {
+	return p.Out("standardized")
+}
+
+// OutRejects returns the Rejects out-port, with rejected lines and reasons
+func (p *StandardizeSmiles) OutRejects() *sp.OutPort {
+	return p.Out("rejects")
+}
+
+// OutSummary returns the Summary out-port, with a Markdown section for the
+// run report
+func (p *StandardizeSmiles) OutSummary() *sp.OutPort {
+	return p.Out("summary")
+}
+
+func standardizeSmiles(smilesPath string, aggr Aggregation, outPath string, rejectsPath string, summaryPath string) error {
+	inFile, err := os.Open(smilesPath)
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+
+	rejectsFile, err := createFile(rejectsPath)
+	if err != nil {
+		return err
+	}
+	defer rejectsFile.Close()
+	rejects := bufio.NewWriter(rejectsFile)
+	fmt.Fprintln(rejects, "line\treason\trecord")
+
+	canonOrder := []string{}
+	responses := map[string][]float64{}
+	inputCnt, rejectCnt, saltCnt := 0, 0, 0
+	sc := bufio.NewScanner(inFile)
+	sc.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := sc.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		inputCnt++
+		reject := func(reason string) {
+			rejectCnt++
+			fmt.Fprintf(rejects, "%d\t%s\t%s\n", lineNo, reason, line)
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			reject("missing response value")
+			continue
+		}
+		response, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			reject(fmt.Sprintf("invalid response value: %s", fields[1]))
+			continue
+		}
+		canon, removed, err := standardizedSMILES(fields[0])
+		if err != nil {
+			reject(err.Error())
+			continue
+		}
+		if removed > 0 {
+			saltCnt++
+		}
+		if _, ok := responses[canon]; !ok {
+			canonOrder = append(canonOrder, canon)
+		}
+		responses[canon] = append(responses[canon], response)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if err := rejects.Flush(); err != nil {
+		return err
+	}
+
+	outFile, err := createFile(outPath)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+	out := bufio.NewWriter(outFile)
+	for _, canon := range canonOrder {
+		fmt.Fprintf(out, "%s\t%s\n", canon, strconv.FormatFloat(aggregate(responses[canon], aggr), 'g', -1, 64))
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	summaryFile, err := createFile(summaryPath)
+	if err != nil {
+		return err
+	}
+	defer summaryFile.Close()
+	_, err = fmt.Fprintf(summaryFile, "## Input standardization\n\n"+
+		"Input: `%s`\n\n"+
+		"| Input records | Rejected | Salts stripped | Duplicates merged | Unique structures |\n"+
+		"|---:|---:|---:|---:|---:|\n"+
+		"| %d | %d | %d | %d | %d |\n\n"+
+		"Duplicate response values aggregated with: %s\n\n",
+		smilesPath, inputCnt, rejectCnt, saltCnt, inputCnt-rejectCnt-len(canonOrder), len(canonOrder), aggr)
+	return err
+}
+
+// standardizedSMILES returns the canonical SMILES of the largest fragment of
+// a molecule, together with the number of removed (salt) fragments
+func standardizedSMILES(smiles string) (string, int, error) {
+	mol, err := chem.ParseSMILES(smiles)
+	if err != nil {
+		return "", 0, err
+	}
+	mol, removed := chem.StripSalts(mol)
+	for i := range mol.Atoms {
+		// Atom classes (atom maps) do not change the structure
+		mol.Atoms[i].Class = 0
+	}
+	return mol.CanonicalSMILES(), removed, nil
+}
+
+func aggregate(vals []float64, aggr Aggregation) float64 {
+	if aggr == AggregationMedian {
+		sorted := append([]float64{}, vals...)
+		sort.Float64s(sorted)
+		mid := len(sorted) / 2
+		if len(sorted)%2 == 0 {
+			return (sorted[mid-1] + sorted[mid]) / 2
+		}
+		return sorted[mid]
+	}
+	sum := 0.0
+	for _, v := range vals {
+		sum += v
+	}
+	return sum / float64(len(vals))
+}
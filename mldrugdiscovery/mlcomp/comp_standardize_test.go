@@ -0,0 +1,67 @@
+package mlcomp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStandardizeSmiles(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "standardize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+	// Ethanol is given three times, once as a salt, and ethylamine once with
+	// an atom map. The acetate salt keeps its largest fragment.
+	input := "CCO\t1.0\n" +
+		"CCO.Cl\t2.0\n" +
+		"C(O)C\t6\n" +
+		"c1ccccc1\t5\n" +
+		"CCN\n" +
+		"\n" +
+		"CCN\tabc\n" +
+		"C1CC\t1\n" +
+		"[CH3:1]CN\t4\n" +
+		"[Na+].[O-]C(=O)C\t2.5\n"
+	if err := ioutil.WriteFile(path("in.smi"), []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectedRejects := "line\treason\trecord\n" +
+		"5\tmissing response value\tCCN\n" +
+		"7\tinvalid response value: abc\tCCN\tabc\n" +
+		"8\tcould not parse SMILES \"C1CC\": 1 unclosed ring bond(s)\tC1CC\t1\n"
+
+	for _, tc := range []struct {
+		aggr             Aggregation
+		expectedStandard string
+	}{
+		{AggregationMean, "C(C)O\t3\nc1ccccc1\t5\nC(C)N\t4\nC(C)([O-])=O\t2.5\n"},
+		{AggregationMedian, "C(C)O\t2\nc1ccccc1\t5\nC(C)N\t4\nC(C)([O-])=O\t2.5\n"},
+	} {
+		if err := standardizeSmiles(path("in.smi"), tc.aggr, path("std.smi"), path("rejects.tsv"), path("summary.md")); err != nil {
+			t.Fatal(err)
+		}
+		for outPath, expected := range map[string]string{path("std.smi"): tc.expectedStandard, path("rejects.tsv"): expectedRejects} {
+			content, err := ioutil.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != expected {
+				t.Errorf("Wrong %s content with %s aggregation:\nEXPECTED:\n%s\nACTUAL:\n%s", filepath.Base(outPath), tc.aggr, expected, content)
+			}
+		}
+		summary, err := ioutil.ReadFile(path("summary.md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{"| 9 | 3 | 2 | 2 | 4 |", "aggregated with: " + string(tc.aggr)} {
+			if !strings.Contains(string(summary), expected) {
+				t.Errorf("Expected the summary to contain %q, got:\n%s", expected, summary)
+			}
+		}
+	}
+}
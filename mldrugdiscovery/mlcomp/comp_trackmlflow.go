@@ -0,0 +1,200 @@
+package mlcomp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+// TrackMLflow writes a final model as a run in an MLflow file store, with its
+// parameters, its cross-validation and test set RMSDs as metrics, and the
+// model, its signatures and the cost grid results as artifacts. Each cost in
+// the grid search becomes a child run, with the RMSD of each fold as a step
+// of its fold_rmsd metric.
+type TrackMLflow struct {
+	*Process
+}
+
+// TrackMLflowConf contains parameters for initializing a TrackMLflow process
+type TrackMLflowConf struct {
+	// Dir is the file store directory, typically mlruns
+	Dir        string
+	Experiment string
+	Keys       ResultKeys
+	// Params are logged as run parameters, in addition to the keys and the
+	// selected cost
+	Params map[string]string
+}
+
+// NewTrackMLflow returns a new TrackMLflow process
+func NewTrackMLflow(wf *sp.Workflow, name string, params TrackMLflowConf) *TrackMLflow {
+	p := newProcess(wf, name, "# Go MLflow tracking: {i:model} {i:signatures} {i:costrmsds} {i:bestcost} {i:testrmsd} {o:run}")
+	p.SetOut("run", "{i:model}.mlflow_run")
+	p.CustomExecute = func(t *sp.Task) {
+		runID, err := trackMLflowRun(params, t.InPath("model"), t.InPath("signatures"), t.InPath("costrmsds"), t.InPath("bestcost"), t.InPath("testrmsd"))
+		if err != nil {
+			sp.Failf("Could not track %s in MLflow file store %s: %v", t.InPath("model"), params.Dir, err)
+		}
+		if err := ioutil.WriteFile(t.OutIP("run").TempPath(), []byte(runID+"\n"), 0644); err != nil {
+			sp.Fail(err)
+		}
+	}
+	return &TrackMLflow{p}
+}
+
+// InModel returns the Model in-port, taking the final model
+func (p *TrackMLflow) InModel() *sp.InPort {
+	return p.In("model")
+}
+
+// InSignatures returns the Signatures in-port, taking the signatures file
+// written by CreateSparseTrain for the model's train data
+func (p *TrackMLflow) InSignatures() *sp.InPort {
+	return p.In("signatures")
+}
+
+// InCostRMSDs returns the CostRMSDs in-port, taking the cost grid results
+func (p *TrackMLflow) InCostRMSDs() *sp.InPort {
+	return p.In("costrmsds")
+}
+
+// InBestCost returns the BestCost in-port
+func (p *TrackMLflow) InBestCost() *sp.InPort {
+	return p.In("bestcost")
+}
+
+// InTestRMSD returns the TestRMSD in-port, taking the assessment of the final
+// model on the test set
+func (p *TrackMLflow) InTestRMSD() *sp.InPort {
+	return p.In("testrmsd")
+}
+
+// OutRun returns the Run out-port, with the MLflow run ID
+func (p *TrackMLflow) OutRun() *sp.OutPort {
+	return p.Out("run")
+}
+
+func trackMLflowRun(conf TrackMLflowConf, modelPath string, signaturesPath string, costRMSDsPath string, bestCostPath string, testRMSDPath string) (string, error) {
+	costRows, err := readCostRMSDs(costRMSDsPath)
+	if err != nil {
+		return "", err
+	}
+	bestCost, err := readBestCost(bestCostPath)
+	if err != nil {
+		return "", err
+	}
+	testRMSDBytes, err := ioutil.ReadFile(testRMSDPath)
+	if err != nil {
+		return "", err
+	}
+	testFields := strings.Fields(string(testRMSDBytes))
+	if len(testFields) == 0 {
+		return "", fmt.Errorf("empty test RMSD file: %s", testRMSDPath)
+	}
+	testRMSD, err := strconv.ParseFloat(testFields[0], 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid test RMSD in %s: %v", testRMSDPath, err)
+	}
+
+	now := time.Now()
+	store, err := newMLflowStore(conf.Dir)
+	if err != nil {
+		return "", err
+	}
+	expID, err := store.experiment(conf.Experiment, now)
+	if err != nil {
+		return "", err
+	}
+	keys := conf.Keys
+	runName := fs("%s %s heights %s train size %d", keys.RunID, keys.Replicate, keys.Heights, keys.TrainSize)
+	idParts := []string{keys.RunID, keys.Dataset, keys.Replicate, keys.Variant, keys.Heights, strconv.Itoa(keys.TrainSize)}
+	if keys.Endpoint != "" {
+		runName = keys.Endpoint + " " + runName
+		idParts = append(idParts, keys.Endpoint)
+	}
+	runID := mlflowRunID(idParts...)
+	run, err := store.createRun(expID, runID, runName, "", now)
+	if err != nil {
+		return "", err
+	}
+
+	params := map[string]string{
+		"run_id":     keys.RunID,
+		"dataset":    keys.Dataset,
+		"replicate":  keys.Replicate,
+		"heights":    keys.Heights,
+		"train_size": strconv.Itoa(keys.TrainSize),
+		"cost":       strconv.FormatFloat(bestCost, 'g', -1, 64),
+	}
+	if keys.Endpoint != "" {
+		params["endpoint"] = keys.Endpoint
+	}
+	for key, val := range conf.Params {
+		params[key] = val
+	}
+	for key, val := range params {
+		if err := run.logParam(key, val); err != nil {
+			return "", err
+		}
+	}
+	if err := run.logMetric("test_rmsd", testRMSD, 0); err != nil {
+		return "", err
+	}
+	for _, row := range costRows {
+		if !sameCost(row.cost, bestCost) {
+			continue
+		}
+		if err := run.logMetric("cv_rmsd", row.mean, 0); err != nil {
+			return "", err
+		}
+		if err := run.logMetric("cv_rmsd_sd", row.sd, 0); err != nil {
+			return "", err
+		}
+	}
+	for _, path := range []string{modelPath, signaturesPath, costRMSDsPath, bestCostPath} {
+		if err := run.logArtifact(path); err != nil {
+			return "", err
+		}
+	}
+
+	// Child runs for the cost grid
+	for _, row := range costRows {
+		costStr := strconv.FormatFloat(row.cost, 'g', -1, 64)
+		child, err := store.createRun(expID, mlflowRunID(runID, costStr), "cost "+costStr, runID, now)
+		if err != nil {
+			return "", err
+		}
+		if err := child.logParam("cost", costStr); err != nil {
+			return "", err
+		}
+		if err := child.logMetric("mean_rmsd", row.mean, 0); err != nil {
+			return "", err
+		}
+		if err := child.logMetric("sd_rmsd", row.sd, 0); err != nil {
+			return "", err
+		}
+		folds := []string{}
+		for fold := range row.folds {
+			folds = append(folds, fold)
+		}
+		sort.Strings(folds)
+		for i, fold := range folds {
+			step, err := strconv.Atoi(fold)
+			if err != nil {
+				step = i
+			}
+			if err := child.logMetric("fold_rmsd", row.folds[fold], step); err != nil {
+				return "", err
+			}
+		}
+		if err := child.finish(time.Now()); err != nil {
+			return "", err
+		}
+	}
+	return runID, run.finish(time.Now())
+}
@@ -0,0 +1,75 @@
+package mlcomp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrackMLflowRun(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "mlflow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	files := map[string]string{
+		"model.linmdl":   "solver_type L2R_L2LOSS_SVR_DUAL\nnr_feature 2\nbias -1\nw\n0.5\n-0.25\n",
+		"train.sign":     "1\t[C]\n2\t[O]\n",
+		"cost_rmsds.tsv": "500\t0.8\t0.1\t0.05\t0:0.75,1:0.85\n500\t0.9\t1\t0.1\t0:0.8,1:1.0\n",
+		"best_cost.txt":  "500\t0.8\t0.1\n",
+		"final.rmsd":     "0.95\t0.1\n",
+	}
+	for name, content := range files {
+		ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644)
+	}
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+	conf := TrackMLflowConf{
+		Dir:        path("mlruns"),
+		Experiment: "testdataset",
+		Keys:       ResultKeys{RunID: "testrun", Dataset: "testdataset", Replicate: "r1", Heights: "1-3", TrainSize: 500},
+		Params:     map[string]string{"solver_type": "12"},
+	}
+	runID, err := trackMLflowRun(conf, path("model.linmdl"), path("train.sign"), path("cost_rmsds.tsv"), path("best_cost.txt"), path("final.rmsd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expDir := filepath.Join(conf.Dir, mlflowExperimentID("testdataset"))
+	readFile := func(relPath string) string {
+		content, err := ioutil.ReadFile(filepath.Join(expDir, relPath))
+		if err != nil {
+			t.Errorf("Expected file %s in the experiment: %v", relPath, err)
+		}
+		return string(content)
+	}
+	if meta := readFile("meta.yaml"); !strings.Contains(meta, "name: 'testdataset'\n") {
+		t.Errorf("Expected experiment name in meta.yaml, got:\n%s", meta)
+	}
+	if meta := readFile(runID + "/meta.yaml"); !strings.Contains(meta, "run_id: "+runID+"\n") || !strings.Contains(meta, "status: 3\n") {
+		t.Errorf("Expected finished run %s in meta.yaml, got:\n%s", runID, meta)
+	}
+	for relPath, expected := range map[string]string{
+		"params/cost":        "0.1",
+		"params/solver_type": "12",
+		"params/train_size":  "500",
+	} {
+		if content := readFile(runID + "/" + relPath); content != expected {
+			t.Errorf("Expected %s to be %q, got %q", relPath, expected, content)
+		}
+	}
+	for _, metric := range []string{"test_rmsd", "cv_rmsd", "cv_rmsd_sd"} {
+		readFile(runID + "/metrics/" + metric)
+	}
+	readFile(runID + "/artifacts/model.linmdl")
+
+	childID := mlflowRunID(runID, "1")
+	if parent := readFile(childID + "/tags/mlflow.parentRunId"); parent != runID {
+		t.Errorf("Expected child run for cost 1 with parent %s, got %q", runID, parent)
+	}
+	if foldRMSDs := strings.Split(strings.TrimSpace(readFile(childID+"/metrics/fold_rmsd")), "\n"); len(foldRMSDs) != 2 ||
+		!strings.HasSuffix(foldRMSDs[1], " 1 1") {
+		t.Errorf("Expected fold RMSDs 0.8 and 1 at steps 0 and 1, got %q", foldRMSDs)
+	}
+}
@@ -1,12 +1,12 @@
-package main
+package mlcomp
 
 import (
 	sp "github.com/scipipe/scipipe"
 )
 
-// TrainLibLinear does blabla ...
+// TrainLibLinear trains a LIBLINEAR model, and records the training time
 type TrainLibLinear struct {
-	*sp.Process
+	*Process
 }
 
 // TrainLibLinearConf contains parameters for initializing a
@@ -15,13 +15,19 @@ type TrainLibLinearConf struct {
 	ReplicateID string
 	Cost        float64
 	SolverType  int
+	// ToolPath is the path of the LIBLINEAR train command, defaults to
+	// DefaultBinDir + "lin-train"
+	ToolPath string
+	// TimePath is the path of the GNU time command, used for recording the
+	// training time, defaults to /usr/bin/time
+	TimePath string
 }
 
 // NewTrainLibLinear returns a new TrainLibLinear process
 func NewTrainLibLinear(wf *sp.Workflow, name string, params TrainLibLinearConf) *TrainLibLinear {
-	cmd := `/usr/bin/time -f%e -o {o:traintime} ` +
-		`../bin/lin-train -s {p:solvertype} -c {p:cost} -q {i:traindata} {o:model}`
-	p := wf.NewProc(name, cmd)
+	cmd := commandPath(params.TimePath, "/usr/bin/time") + ` -f%e -o {o:traintime} ` +
+		toolPath(params.ToolPath, "lin-train") + ` -s {p:solvertype} -c {p:cost} -q {i:traindata} {o:model}`
+	p := newProcess(wf, name, cmd)
 
 	p.InParam("solvertype").FromInt(params.SolverType)
 	if params.Cost != 0 {
@@ -0,0 +1,235 @@
+package mlcomp
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+func TestComponents(t *testing.T) {
+	wf := sp.NewWorkflow("components", 1)
+	for _, tc := range []struct {
+		proc *Process
+		// cmd is the expected command, or, if it ends with "...", its
+		// expected start
+		cmd  string
+		outs map[string]string
+	}{
+		{
+			NewApplicabilityDomain(wf, "appdomain", ApplicabilityDomainConf{}).Process,
+			"# Go applicability domain: {i:traindata} {i:signatures} {i:testdata} {i:prediction} {o:annotated} {o:summary}",
+			map[string]string{"annotated": "{i:prediction}.ad.tsv", "summary": "{i:prediction}.ad_summary.md"},
+		},
+		{
+			NewAssessLibLinear(wf, "assess", AssessLibLinearConf{Fold: "fld1"}).Process,
+			`rmsd=$(awk 'FNR==NR { pred[FNR]=$1; next } ...`,
+			map[string]string{"rmsd_cost": "{i:prediction}.rmsd_cost"},
+		},
+		{
+			NewBootstrap(wf, "bootstrap", BootstrapConf{Seed: 1}).Process,
+			"# Go bootstrap sampling: {i:in} {o:sample} {p:seed}",
+			map[string]string{"sample": "{i:in}.bs{p:seed}"},
+		},
+		{
+			NewCheckLeakage(wf, "check_leakage", CheckLeakageConf{KeyBy: LeakageKeySMILES}).Process,
+			"# Go train/test leakage check (smiles): {i:train} {i:test} {o:log}",
+			map[string]string{"log": "{i:test}.leakcheck"},
+		},
+		{
+			NewCompareCosts(wf, "compare_costs", CompareCostsConf{}).Process,
+			"# Go cost comparison: {i:costrmsds} {i:bestcost} {o:comparison}",
+			map[string]string{"comparison": "{i:costrmsds}.comparison.md"},
+		},
+		{
+			NewCostHeatmap(wf, "cost_heatmap", CostHeatmapConf{}).Process,
+			"# Go cost heatmap: {i:costrmsds} {o:svg} {o:section}",
+			map[string]string{"svg": "{i:costrmsds}.heatmap.svg", "section": "{i:costrmsds}.heatmap.md"},
+		},
+		{
+			NewCountLines(wf, "countlines", CountLinesConf{UnGzip: true}).Process,
+			"zcat {i:in} | wc -l > {o:linecnt}",
+			map[string]string{"linecnt": "{i:in}.linecnt"},
+		},
+		{
+			NewCreateFolds(wf, "createfolds", CreateFoldsConf{FoldsCnt: 10, FoldIdx: 3}).Process,
+			"linecnt=$(cat {i:linecnt}) && \\\nfoldscnt=10 && \\\nfoldidx=3 && ...",
+			map[string]string{"foldinfo": "{i:in}.fld03_info", "traindata": "{i:in}.fld03_trn", "testdata": "{i:in}.fld03_tst"},
+		},
+		{
+			NewCreateSparseTest(wf, "sparsetest", CreateSparseTestConf{}).Process,
+			"java -jar ../bin/CreateSparseDataset.jar \\\n\t-inputfile {i:testdata} \\\n\t-signaturesinfile {i:signaturesinfile} ...",
+			map[string]string{"sparsetest": "{i:testdata}.csr", "signatures": "{i:testdata}.sign", "log": "{i:testdata}.csr.log"},
+		},
+		{
+			NewCreateSparseTest(wf, "sparsetest_go", CreateSparseTestConf{Engine: SignatureEngineGoSign}).Process,
+			"# Go sparse dataset creation: {i:testdata} {i:signaturesinfile} {o:sparsetest} {o:signatures} {o:log}",
+			map[string]string{"sparsetest": "{i:testdata}.csr", "signatures": "{i:testdata}.sign", "log": "{i:testdata}.csr.log"},
+		},
+		{
+			NewCreateSparseTrain(wf, "sparsetrain", CreateSparseTrainConf{ToolPath: "/opt/cpsign/CreateSparseDataset.jar", JavaPath: "/opt/jdk/bin/java"}).Process,
+			"/opt/jdk/bin/java -jar /opt/cpsign/CreateSparseDataset.jar \\\n\t-inputfile {i:traindata} ...",
+			map[string]string{"sparsetrain": "{i:traindata}.csr", "signatures": "{i:traindata}.sign", "log": "{i:traindata}.csr.log"},
+		},
+		{
+			NewDownload(wf, "download", DownloadConf{URL: "https://example.org/tools.tar.gz", Path: "tools.tar.gz"}).Process,
+			"# Go download: {o:file}",
+			map[string]string{"file": "tools.tar.gz"},
+		},
+		{
+			NewEnsembleBundle(wf, "ensemble_bundle", EnsembleBundleConf{}).Process,
+			"# Go ensemble bundle: {i:members} {o:bundle}",
+			map[string]string{"bundle": "{i:members|%.members.tsv}.tar"},
+		},
+		{
+			NewExportDataset(wf, "export", ExportDatasetConf{WithIDs: true}).Process,
+			"# Go dataset export: {i:traindata} {i:testdata} {i:trainsigns} {i:testsigns} {i:signatures} {o:export} {i:ids}",
+			map[string]string{"export": "{i:traindata}.export"},
+		},
+		{
+			NewFetchDataset(wf, "fetch_dataset", FetchDatasetConf{Source: "data.csv", Path: "data/data.csv"}).Process,
+			"# Go fetch dataset: {o:dataset}",
+			map[string]string{"dataset": "data/data.csv"},
+		},
+		{
+			NewFileToParams(wf, "filetoparams", FileToParamsConf{Format: ParamFormatTSV}).Process,
+			"# Go file to params (tsv): {i:file}",
+			map[string]string{},
+		},
+		{
+			NewGenRandBytes(wf, "genrand", GenRandBytesConf{SizeMB: 10, ReplicateID: "r1"}).Process,
+			"dd if=/dev/urandom of={o:randbytes} bs=1048576 count={p:sizemb} # {i:basepath}",
+			map[string]string{"randbytes": "{i:basepath}.{p:replid}.rand"},
+		},
+		{
+			NewGenSignFilterSubst(wf, "gensign", GenSignFilterSubstConf{ThreadsCnt: 2, MinHeight: 1, MaxHeight: 3}).Process,
+			"java -jar ../bin/GenerateSignatures.jar \\\n\t\t-inputfile {i:smiles} \\\n\t\t-threads {p:threads} ...",
+			map[string]string{"signatures": "{i:smiles}.{p:minheight}_{p:maxheight}.sign"},
+		},
+		{
+			NewGenSignFilterSubst(wf, "gensign_ecfp", GenSignFilterSubstConf{Engine: SignatureEngineGoECFP}).Process,
+			"# Go signature generation: {i:smiles} {p:threads} {p:minheight} {p:maxheight} {o:signatures}",
+			map[string]string{"signatures": "{i:smiles}.{p:minheight}_{p:maxheight}.ecfp.sign"},
+		},
+		{
+			NewInterpretModel(wf, "interpret", InterpretModelConf{TopN: 10}).Process,
+			"# Go model interpretation: {i:model} {i:signatures} {o:weights} {o:atomcontrib} {p:topn}",
+			map[string]string{"weights": "{i:model}.weights.tsv", "atomcontrib": "{i:model}.atomcontrib.tsv"},
+		},
+		{
+			NewLeaderboard(wf, "leaderboard", LeaderboardConf{}).Process,
+			"# Go leaderboard: {i:results} {o:table} {o:report}",
+			map[string]string{"table": "{i:results|%.tsv}.leaderboard.tsv", "report": "{i:results|%.tsv}.leaderboard.md"},
+		},
+		{
+			NewLoadDataset(wf, "load_dataset", LoadDatasetConf{Format: DatasetFormatCSV, EndpointColumns: []string{"pIC50"}}).Process,
+			"# Go dataset conversion (csv): {i:dataset} {o:smiles} {o:ids} {o:endpoints}",
+			map[string]string{"smiles": "{i:dataset}.smi", "ids": "{i:dataset}.ids.tsv", "endpoints": "{i:dataset}.endpoints.tsv"},
+		},
+		{
+			NewModelCard(wf, "model_card", ModelCardConf{}).Process,
+			"# Go model card: {i:dataset} {i:model} {i:costrmsds} {i:bestcost} {i:testrmsd} {i:adsummary} {o:markdown} {o:html}",
+			map[string]string{"markdown": "{i:model}.card.md", "html": "{i:model}.card.html"},
+		},
+		{
+			NewOOFReport(wf, "oof_report", OOFReportConf{}).Process,
+			"# Go out-of-fold report: {i:oof} {i:bestcost} {i:traindata} {i:trainsigns} {o:table} {o:html} {o:summary}",
+			map[string]string{"table": "{i:traindata}.oof.tsv", "html": "{i:traindata}.oof.html", "summary": "{i:traindata}.oof.md"},
+		},
+		{
+			NewPredictEnsemble(wf, "predict_ensemble", PredictEnsembleConf{}).Process,
+			"# Go ensemble prediction: {i:bundle} {i:compounds} {o:prediction} {o:spread} {o:summary}",
+			map[string]string{"prediction": "{i:bundle}.pred", "spread": "{i:bundle}.pred_spread.tsv", "summary": "{i:bundle}.pred_summary.md"},
+		},
+		{
+			NewPredictLibLinear(wf, "pred", PredictLibLinearConf{}).Process,
+			"../bin/lin-predict {i:testdata} {i:model} {o:prediction} ",
+			map[string]string{"prediction": "{i:model}.pred"},
+		},
+		{
+			NewRecordResults(wf, "record", RecordResultsConf{Kind: ResultFinalRMSD}).Process,
+			"# Go SQLite recording (final_rmsd): {i:result} {o:sql}",
+			map[string]string{"sql": "{i:result}.final_rmsd.sql"},
+		},
+		{
+			NewRunReport(wf, "run_report", RunReportConf{ReportPath: "data/report.md"}).Process,
+			`(echo "# {p:title}" && echo && cat {i:sections|join: }) > {o:report}`,
+			map[string]string{"report": "data/report.md"},
+		},
+		{
+			NewSampleTrainAndTest(wf, "sample", SampleTrainAndTestConf{TestSize: 100, TrainSize: 500, SamplingMethod: SamplingMethodRandom}).Process,
+			"java -jar ../bin/SampleTrainingAndTest.jar \\\n\t\t-inputfile {i:signatures} ...",
+			// Set with functions
+			map[string]string{"traindata": "", "testdata": "", "log": ""},
+		},
+		{
+			NewScrambleResponse(wf, "scramble", ScrambleResponseConf{Seed: 1}).Process,
+			"# Go response scrambling: {i:in} {o:scrambled} {p:index} {p:seed}",
+			map[string]string{"scrambled": "{i:in}.yrnd{p:index}"},
+		},
+		{
+			NewSelectEndpoint(wf, "select_endpoint", SelectEndpointConf{Endpoint: "pIC50"}).Process,
+			"# Go endpoint selection: {i:sparse} {i:signatures} {i:endpoints} {o:sparse} {o:signatures} {p:endpoint}",
+			map[string]string{"sparse": "{i:sparse}.{p:endpoint}", "signatures": "{i:signatures}.{p:endpoint}"},
+		},
+		{
+			NewShuffleLines(wf, "shuffle", ShuffleLinesConf{}).Process,
+			"shuf --random-source={i:randbytes} {i:in} > {o:shuffled}",
+			map[string]string{"shuffled": "{i:in}.shuf"},
+		},
+		{
+			NewStandardizeSmiles(wf, "standardize", StandardizeSmilesConf{}).Process,
+			"# Go standardization: {i:smiles} {o:standardized} {o:rejects} {o:summary}",
+			map[string]string{"standardized": "{i:smiles|%.smi}.std.smi", "rejects": "{i:smiles|%.smi}.std_rejects.tsv", "summary": "{i:smiles|%.smi}.std_summary.md"},
+		},
+		{
+			NewTrackMLflow(wf, "mlflow", TrackMLflowConf{}).Process,
+			"# Go MLflow tracking: {i:model} {i:signatures} {i:costrmsds} {i:bestcost} {i:testrmsd} {o:run}",
+			map[string]string{"run": "{i:model}.mlflow_run"},
+		},
+		{
+			NewTrainLibLinear(wf, "train", TrainLibLinearConf{Cost: 0.5, SolverType: 12}).Process,
+			"/usr/bin/time -f%e -o {o:traintime} ../bin/lin-train -s {p:solvertype} -c {p:cost} -q {i:traindata} {o:model}",
+			map[string]string{"model": "{i:traindata}.s12_c{p:cost}.linmdl", "traintime": "{o:model}.traintime"},
+		},
+		{
+			NewTrainLibLinear(wf, "train_tool", TrainLibLinearConf{SolverType: 12, ToolPath: "/usr/local/bin/liblinear-train", TimePath: "/usr/local/bin/gtime"}).Process,
+			"/usr/local/bin/gtime -f%e -o {o:traintime} /usr/local/bin/liblinear-train -s {p:solvertype} -c {p:cost} -q {i:traindata} {o:model}",
+			map[string]string{"model": "{i:traindata}.s12_c{p:cost}.linmdl", "traintime": "{o:model}.traintime"},
+		},
+		{
+			NewTrainLibLinear(wf, "train_spaced", TrainLibLinearConf{SolverType: 12, ToolPath: "/opt/my tools/lin-train", TimePath: "/opt/my tools/time"}).Process,
+			"'/opt/my tools/time' -f%e -o {o:traintime} '/opt/my tools/lin-train' -s {p:solvertype} -c {p:cost} -q {i:traindata} {o:model}",
+			map[string]string{"model": "{i:traindata}.s12_c{p:cost}.linmdl", "traintime": "{o:model}.traintime"},
+		},
+	} {
+		name := tc.proc.Name()
+		if prefix := strings.TrimSuffix(tc.cmd, "..."); prefix != tc.cmd {
+			if !strings.HasPrefix(tc.proc.CommandPattern, prefix) {
+				t.Errorf("%s: expected command starting with:\n%s\nACTUAL:\n%s", name, prefix, tc.proc.CommandPattern)
+			}
+		} else if tc.proc.CommandPattern != tc.cmd {
+			t.Errorf("%s: wrong command:\nEXPECTED:\n%s\nACTUAL:\n%s", name, tc.cmd, tc.proc.CommandPattern)
+		}
+
+		expectedPorts, ports := []string{}, []string{}
+		for port := range tc.outs {
+			expectedPorts = append(expectedPorts, port)
+		}
+		for port := range tc.proc.OutPorts() {
+			ports = append(ports, port)
+		}
+		sort.Strings(expectedPorts)
+		sort.Strings(ports)
+		if !reflect.DeepEqual(ports, expectedPorts) {
+			t.Errorf("%s: expected out-ports %v, got %v", name, expectedPorts, ports)
+		}
+		for port, pattern := range tc.outs {
+			if actual := tc.proc.OutPathPattern(port); actual != pattern {
+				t.Errorf("%s: wrong path pattern of out-port %s: expected %q, got %q", name, port, pattern, actual)
+			}
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package mlcomp
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pharmbio/scipipe-demo/mldrugdiscovery/chem"
+)
+
+// Bagged ensembles of final models, stored as a single tar bundle with the
+// member models and the signatures files their columns refer to:
+//
+//	info.tsv            key and value lines: method, keys, member count
+//	manifest.tsv        member, model file, signatures file, original model path
+//	member<n>.linmdl    LIBLINEAR model of each member
+//	signatures<n>.tsv   signatures file, shared by members trained on the
+//	                    same sparse dataset
+//
+// As each member has its own signatures file, members trained on different
+// samples, with different columns, can be combined. Predictions are made from
+// the signatures of compounds, and combined into the mean and the standard
+// deviation over the members, the latter as an estimate of the uncertainty.
+
+// EnsembleMethod is how the train data of ensemble members is sampled
+type EnsembleMethod string
+
+const (
+	// EnsembleNone is for no ensembles
+	EnsembleNone EnsembleMethod = ""
+	// EnsembleBootstrap trains members on bootstrap samples of the train data
+	// of each final model, with its selected cost
+	EnsembleBootstrap EnsembleMethod = "bootstrap"
+	// EnsembleReplicate combines the final models of all replicates, for each
+	// height range and train size. As the replicates have different test sets,
+	// these ensembles are not assessed.
+	EnsembleReplicate EnsembleMethod = "replicate"
+)
+
+// EnsembleConf contains the settings for bagged ensembles of final models
+type EnsembleConf struct {
+	Method EnsembleMethod
+	// Size is the number of bootstrap members. Replicate ensembles have one
+	// member per replicate.
+	Size int
+}
+
+// ensembleMember is a model of an ensemble, with the signatures its columns
+// refer to
+type ensembleMember struct {
+	model *libLinearModel
+	voc   *chem.Vocabulary
+}
+
+// writeEnsembleBundle writes the models and signatures files listed in
+// membersPath, with a model path and a signatures path on each line, to a tar
+// bundle at bundlePath, with info as key and value lines in info.tsv
+func writeEnsembleBundle(membersPath string, bundlePath string, info [][2]string) error {
+	type memberPaths struct{ model, signatures string }
+	members := []memberPaths{}
+	err := ForEachLine(membersPath, func(lineNo int, line string) error {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 {
+			return fmt.Errorf("%s, line %d: expected model and signatures paths", membersPath, lineNo)
+		}
+		members = append(members, memberPaths{fields[0], fields[1]})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		return fmt.Errorf("no ensemble members in %s", membersPath)
+	}
+	// The members come in the order they finished, so sort them for
+	// reproducible bundles
+	sort.Slice(members, func(i, j int) bool { return members[i].model < members[j].model })
+
+	bundleFile, err := createFile(bundlePath)
+	if err != nil {
+		return err
+	}
+	defer bundleFile.Close()
+	tw := tar.NewWriter(bundleFile)
+	now := time.Now()
+	addFile := func(name string, content []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: now}); err != nil {
+			return err
+		}
+		_, err := tw.Write(content)
+		return err
+	}
+
+	var infoLines strings.Builder
+	for _, kv := range append(info, [2]string{"members", strconv.Itoa(len(members))}) {
+		fmt.Fprintf(&infoLines, "%s\t%s\n", kv[0], kv[1])
+	}
+	if err := addFile("info.tsv", []byte(infoLines.String())); err != nil {
+		return err
+	}
+	var manifest strings.Builder
+	manifest.WriteString("member\tmodel\tsignatures\tsource\n")
+	signFiles := map[string]string{}
+	for i, member := range members {
+		modelName := fs("member%d.linmdl", i+1)
+		signName, ok := signFiles[member.signatures]
+		if !ok {
+			signName = fs("signatures%d.tsv", len(signFiles)+1)
+			signFiles[member.signatures] = signName
+			content, err := ioutil.ReadFile(member.signatures)
+			if err != nil {
+				return err
+			}
+			if err := addFile(signName, content); err != nil {
+				return err
+			}
+		}
+		content, err := ioutil.ReadFile(member.model)
+		if err != nil {
+			return err
+		}
+		if err := addFile(modelName, content); err != nil {
+			return err
+		}
+		fmt.Fprintf(&manifest, "%d\t%s\t%s\t%s\n", i+1, modelName, signName, member.model)
+	}
+	if err := addFile("manifest.tsv", []byte(manifest.String())); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return bundleFile.Close()
+}
+
+// readEnsembleBundle reads the members and the info of an ensemble bundle
+func readEnsembleBundle(path string) ([]ensembleMember, map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	files := map[string][]byte{}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if files[hdr.Name], err = ioutil.ReadAll(tr); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	info := map[string]string{}
+	for _, line := range strings.Split(string(files["info.tsv"]), "\n") {
+		if kv := strings.SplitN(line, "\t", 2); len(kv) == 2 {
+			info[kv[0]] = kv[1]
+		}
+	}
+	manifest, ok := files["manifest.tsv"]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s is not an ensemble bundle: no manifest.tsv", path)
+	}
+	members := []ensembleMember{}
+	vocs := map[string]*chem.Vocabulary{}
+	for lineNo, line := range strings.Split(strings.TrimSpace(string(manifest)), "\n")[1:] {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			return nil, nil, fmt.Errorf("%s, manifest line %d: expected member, model and signatures", path, lineNo+2)
+		}
+		modelContent, ok := files[fields[1]]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: missing model %s", path, fields[1])
+		}
+		model, err := parseLibLinearModel(strings.NewReader(string(modelContent)), path+":"+fields[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		voc, ok := vocs[fields[2]]
+		if !ok {
+			signContent, ok := files[fields[2]]
+			if !ok {
+				return nil, nil, fmt.Errorf("%s: missing signatures %s", path, fields[2])
+			}
+			if voc, err = chem.ReadVocabulary(strings.NewReader(string(signContent))); err != nil {
+				return nil, nil, fmt.Errorf("%s: could not read signatures %s: %v", path, fields[2], err)
+			}
+			vocs[fields[2]] = voc
+		}
+		members = append(members, ensembleMember{model, voc})
+	}
+	if len(members) == 0 {
+		return nil, nil, fmt.Errorf("%s: no ensemble members", path)
+	}
+	return members, info, nil
+}
+
+// ensemblePrediction is the combined prediction of the members of an
+// ensemble for a compound
+type ensemblePrediction struct {
+	mean, sd, min, max float64
+}
+
+// predictEnsemble returns the mean, standard deviation, min and max of the
+// predictions of the members for a compound with the signature counts in
+// signatures
+func predictEnsemble(members []ensembleMember, signatures map[string]int) ensemblePrediction {
+	preds := make([]float64, 0, len(members))
+	pred := ensemblePrediction{min: math.Inf(1), max: math.Inf(-1)}
+	for _, member := range members {
+		row := []sparseEntry{}
+		for sig, cnt := range signatures {
+			if col, ok := member.voc.Column(sig); ok {
+				row = append(row, sparseEntry{col, float64(cnt)})
+			}
+		}
+		p := member.model.Predict(row)
+		preds = append(preds, p)
+		pred.min, pred.max = math.Min(pred.min, p), math.Max(pred.max, p)
+	}
+	pred.mean, pred.sd = meanSD(preds)
+	return pred
+}
+
+// readSignatureRecords reads all records of a signatures file, as written by
+// GenSignFilterSubst and SampleTrainAndTest
+func readSignatureRecords(path string) ([]chem.SignatureRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records := []chem.SignatureRecord{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		rec, err := chem.ParseSignatureRecord(sc.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s, line %d: %v", path, lineNo, err)
+		}
+		records = append(records, rec)
+	}
+	return records, sc.Err()
+}
@@ -0,0 +1,51 @@
+package mlcomp
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsembleBundle(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ensemble")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+	files := map[string]string{
+		// Two members sharing signatures, and one with other columns and a
+		// bias term
+		"sign1.tsv": "1\t[C]\n2\t[O]\n",
+		"sign2.tsv": "1\t[N]\n2\t[C]\n",
+		"m1.linmdl": "solver_type L2R_L2LOSS_SVR_DUAL\nnr_feature 2\nbias -1\nw\n1\n2\n",
+		"m2.linmdl": "solver_type L2R_L2LOSS_SVR_DUAL\nnr_feature 2\nbias -1\nw\n2\n1\n",
+		"m3.linmdl": "solver_type L2R_L2LOSS_SVR_DUAL\nnr_feature 2\nbias 1\nw\n5\n3\n0.5\n",
+		"members.tsv": path("m2.linmdl") + "\t" + path("sign1.tsv") + "\n" +
+			path("m1.linmdl") + "\t" + path("sign1.tsv") + "\n" +
+			path("m3.linmdl") + "\t" + path("sign2.tsv") + "\n",
+	}
+	for name, content := range files {
+		ioutil.WriteFile(path(name), []byte(content), 0644)
+	}
+	if err := writeEnsembleBundle(path("members.tsv"), path("ensemble.tar"), [][2]string{{"method", "bootstrap"}}); err != nil {
+		t.Fatal(err)
+	}
+	members, info, err := readEnsembleBundle(path("ensemble.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 3 || info["method"] != "bootstrap" || info["members"] != "3" {
+		t.Fatalf("Expected 3 bootstrap members, got %d members and info %v", len(members), info)
+	}
+
+	// Predictions: m1 = 1*2 + 2*1 = 4, m2 = 2*2 + 1*1 = 5, m3 = 3*2 + 0.5 = 6.5
+	pred := predictEnsemble(members, map[string]int{"[C]": 2, "[O]": 1, "[S]": 4})
+	expectedMean := 15.5 / 3
+	expectedSD := math.Sqrt((math.Pow(4-expectedMean, 2) + math.Pow(5-expectedMean, 2) + math.Pow(6.5-expectedMean, 2)) / 2)
+	if math.Abs(pred.mean-expectedMean) > 1e-9 || math.Abs(pred.sd-expectedSD) > 1e-9 || pred.min != 4 || pred.max != 6.5 {
+		t.Errorf("Wrong ensemble prediction:\nEXPECTED: mean %g, SD %g, min 4, max 6.5\nACTUAL: %+v\n", expectedMean, expectedSD, pred)
+	}
+}
@@ -0,0 +1,193 @@
+package mlcomp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// libLinearModel is a linear model, as saved to file by LIBLINEAR's train
+// command
+type libLinearModel struct {
+	SolverType string
+	Bias       float64
+	// Weights holds the weight for each (1-based) feature column, at index
+	// column-1. For multi-class models, only the weights of the first class
+	// are kept.
+	Weights []float64
+	// BiasWeight is the weight of the bias term, if Bias >= 0
+	BiasWeight float64
+}
+
+// readLibLinearModel reads a LIBLINEAR model file
+func readLibLinearModel(path string) (*libLinearModel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseLibLinearModel(f, path)
+}
+
+// parseLibLinearModel reads a LIBLINEAR model from r, with path used in
+// error messages
+func parseLibLinearModel(r io.Reader, path string) (*libLinearModel, error) {
+	model := &libLinearModel{Bias: -1}
+	featureCnt := -1
+	sc := bufio.NewScanner(r)
+	inWeights := false
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var err error
+		if !inWeights {
+			switch fields[0] {
+			case "solver_type":
+				model.SolverType = fields[1]
+			case "nr_feature":
+				featureCnt, err = strconv.Atoi(fields[1])
+			case "bias":
+				model.Bias, err = strconv.ParseFloat(fields[1], 64)
+			case "w":
+				inWeights = true
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s, line %d: %v", path, lineNo, err)
+			}
+			continue
+		}
+		w, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s, line %d: invalid weight: %v", path, lineNo, err)
+		}
+		model.Weights = append(model.Weights, w)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if featureCnt < 0 || !inWeights {
+		return nil, fmt.Errorf("%s does not look like a LIBLINEAR model file", path)
+	}
+	if model.Bias >= 0 && len(model.Weights) == featureCnt+1 {
+		model.BiasWeight = model.Weights[featureCnt]
+		model.Weights = model.Weights[:featureCnt]
+	}
+	if len(model.Weights) != featureCnt {
+		return nil, fmt.Errorf("%s: expected %d weights, found %d", path, featureCnt, len(model.Weights))
+	}
+	return model, nil
+}
+
+// Weight returns the weight of a (1-based) feature column, which is 0 for
+// columns not seen in training
+func (m *libLinearModel) Weight(col int) float64 {
+	if col < 1 || col > len(m.Weights) {
+		return 0
+	}
+	return m.Weights[col-1]
+}
+
+// Predict returns the predicted value for a row of (1-based) columns and
+// values, as LIBLINEAR's predict command does for regression models
+func (m *libLinearModel) Predict(row []sparseEntry) float64 {
+	pred := 0.0
+	for _, e := range row {
+		pred += m.Weight(e.col) * e.val
+	}
+	if m.Bias >= 0 {
+		pred += m.Bias * m.BiasWeight
+	}
+	return pred
+}
+
+// sparseEntry is a (1-based) column and its value in a sparse dataset row
+type sparseEntry struct {
+	col int
+	val float64
+}
+
+// parseSparseRow parses a row in the sparse LIBLINEAR format,
+// "response col:value col:value ...", returning the entries sorted by column
+func parseSparseRow(line string) (float64, []sparseEntry, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return 0, nil, fmt.Errorf("empty row")
+	}
+	resp, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid response value: %v", err)
+	}
+	entries := make([]sparseEntry, 0, len(fields)-1)
+	for _, field := range fields[1:] {
+		sepIdx := strings.IndexByte(field, ':')
+		if sepIdx < 0 {
+			return 0, nil, fmt.Errorf("invalid sparse entry: %q", field)
+		}
+		col, err := strconv.Atoi(field[:sepIdx])
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid column in %q: %v", field, err)
+		}
+		val, err := strconv.ParseFloat(field[sepIdx+1:], 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid value in %q: %v", field, err)
+		}
+		entries = append(entries, sparseEntry{col, val})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].col < entries[j].col })
+	return resp, entries, nil
+}
+
+// readSparseDataset reads all rows of a sparse dataset file
+func readSparseDataset(path string) ([]float64, [][]sparseEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	responses := []float64{}
+	rows := [][]sparseEntry{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		resp, row, err := parseSparseRow(sc.Text())
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s, line %d: %v", path, lineNo, err)
+		}
+		responses = append(responses, resp)
+		rows = append(rows, row)
+	}
+	return responses, rows, sc.Err()
+}
+
+// readPredictions reads a prediction file, as written by LIBLINEAR's predict
+// command, with one predicted value per line
+func readPredictions(path string) ([]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	preds := []float64{}
+	sc := bufio.NewScanner(f)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		pred, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s, line %d: invalid prediction: %v", path, lineNo, err)
+		}
+		preds = append(preds, pred)
+	}
+	return preds, sc.Err()
+}
@@ -0,0 +1,184 @@
+package mlcomp
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Writing of experiment tracking data in the file store layout of MLflow
+// (mlruns/), so that the MLflow UI can show it without a tracking server:
+//
+//	mlruns/<experiment id>/meta.yaml
+//	mlruns/<experiment id>/<run id>/meta.yaml
+//	mlruns/<experiment id>/<run id>/{params,metrics,tags,artifacts}/...
+
+// mlflowStore is an MLflow file store in a directory
+type mlflowStore struct {
+	dir string
+}
+
+func newMLflowStore(dir string) (*mlflowStore, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &mlflowStore{absDir}, nil
+}
+
+// mlflowExperimentID returns a numeric experiment ID derived from the
+// experiment name, so that concurrent processes agree on it without
+// coordination
+func mlflowExperimentID(name string) string {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return fmt.Sprintf("%d", h.Sum64()>>1)
+}
+
+// mlflowRunID returns a run ID derived from the parts identifying a run, so
+// that re-running a workflow step replaces the run rather than adding one
+func mlflowRunID(parts ...string) string {
+	sum := md5.Sum([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// experiment creates the experiment with the given name, if it does not exist,
+// and returns its ID
+func (s *mlflowStore) experiment(name string, now time.Time) (string, error) {
+	expID := mlflowExperimentID(name)
+	expDir := filepath.Join(s.dir, expID)
+	if _, err := os.Stat(filepath.Join(expDir, "meta.yaml")); err == nil {
+		return expID, nil
+	}
+	ms := mlflowMillis(now)
+	meta := fmt.Sprintf("artifact_location: %s\ncreation_time: %d\nexperiment_id: %s\nlast_update_time: %d\nlifecycle_stage: active\nname: %s\n",
+		yamlQuote("file://"+filepath.ToSlash(expDir)), ms, yamlQuote(expID), ms, yamlQuote(name))
+	return expID, writeFileAtomic(filepath.Join(expDir, "meta.yaml"), meta)
+}
+
+// mlflowRun is a run in an MLflow file store
+type mlflowRun struct {
+	dir       string
+	expID     string
+	runID     string
+	name      string
+	startTime time.Time
+}
+
+// createRun creates a run, replacing any earlier run with the same ID. Runs
+// with a parentRunID are shown as child runs of that run.
+func (s *mlflowStore) createRun(expID string, runID string, name string, parentRunID string, start time.Time) (*mlflowRun, error) {
+	run := &mlflowRun{filepath.Join(s.dir, expID, runID), expID, runID, name, start}
+	if err := os.RemoveAll(run.dir); err != nil {
+		return nil, err
+	}
+	for _, sub := range []string{"params", "metrics", "tags", "artifacts"} {
+		if err := os.MkdirAll(filepath.Join(run.dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	if err := run.setTag("mlflow.runName", name); err != nil {
+		return nil, err
+	}
+	if parentRunID != "" {
+		if err := run.setTag("mlflow.parentRunId", parentRunID); err != nil {
+			return nil, err
+		}
+	}
+	return run, nil
+}
+
+func (r *mlflowRun) logParam(key string, value string) error {
+	return ioutil.WriteFile(filepath.Join(r.dir, "params", key), []byte(value), 0644)
+}
+
+func (r *mlflowRun) setTag(key string, value string) error {
+	return ioutil.WriteFile(filepath.Join(r.dir, "tags", key), []byte(value), 0644)
+}
+
+// logMetric appends a value of a metric, at a step
+func (r *mlflowRun) logMetric(key string, value float64, step int) error {
+	f, err := os.OpenFile(filepath.Join(r.dir, "metrics", key), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%d %v %d\n", mlflowMillis(time.Now()), value, step); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// logArtifact copies a file into the artifacts of the run
+func (r *mlflowRun) logArtifact(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(filepath.Join(r.dir, "artifacts", filepath.Base(path)))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// finish writes the metadata of the run, as finished at end. The MLflow UI
+// only shows runs with metadata.
+func (r *mlflowRun) finish(end time.Time) error {
+	user := os.Getenv("USER")
+	meta := fmt.Sprintf("artifact_uri: %s\nend_time: %d\nentry_point_name: ''\nexperiment_id: %s\nlifecycle_stage: active\n"+
+		"name: ''\nrun_id: %s\nrun_name: %s\nrun_uuid: %s\nsource_name: ''\nsource_type: 4\nsource_version: ''\n"+
+		"start_time: %d\nstatus: 3\ntags: []\nuser_id: %s\n",
+		yamlQuote("file://"+filepath.ToSlash(filepath.Join(r.dir, "artifacts"))), mlflowMillis(end), yamlQuote(r.expID),
+		r.runID, yamlQuote(r.name), r.runID, mlflowMillis(r.startTime), yamlQuote(user))
+	return writeFileAtomic(filepath.Join(r.dir, "meta.yaml"), meta)
+}
+
+func mlflowMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// yamlQuote returns s as a single-quoted YAML string
+func yamlQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// writeFileAtomic writes content to a temporary file next to path, and then
+// renames it to path, so that readers never see a partly written file
+func writeFileAtomic(path string, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp_"+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	// Temporary files are only readable by the owner, which is not wanted
+	// on shared file systems
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,122 @@
+package mlcomp
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// Writing of NumPy .npy arrays and .npz archives, for use from Python
+// without parsing text formats
+
+// npyArray is a named NumPy array, with its data in little-endian byte order
+type npyArray struct {
+	name  string
+	descr string
+	shape []int
+	data  []byte
+}
+
+func npyFloat64s(name string, vals []float64) npyArray {
+	data := make([]byte, 8*len(vals))
+	for i, v := range vals {
+		binary.LittleEndian.PutUint64(data[8*i:], math.Float64bits(v))
+	}
+	return npyArray{name, "<f8", []int{len(vals)}, data}
+}
+
+func npyInt32s(name string, vals []int) npyArray {
+	data := make([]byte, 4*len(vals))
+	for i, v := range vals {
+		binary.LittleEndian.PutUint32(data[4*i:], uint32(int32(v)))
+	}
+	return npyArray{name, "<i4", []int{len(vals)}, data}
+}
+
+func npyInt64s(name string, vals []int) npyArray {
+	data := make([]byte, 8*len(vals))
+	for i, v := range vals {
+		binary.LittleEndian.PutUint64(data[8*i:], uint64(int64(v)))
+	}
+	return npyArray{name, "<i8", []int{len(vals)}, data}
+}
+
+// npyByteString returns a 0-dimensional array with a byte string, as used by
+// SciPy for the format of sparse matrices
+func npyByteString(name string, s string) npyArray {
+	return npyArray{name, fmt.Sprintf("|S%d", len(s)), []int{}, []byte(s)}
+}
+
+// npyStrings returns an array of unicode strings, which NumPy stores as
+// fixed-width UTF-32
+func npyStrings(name string, strs []string) npyArray {
+	width := 1
+	for _, s := range strs {
+		if n := utf8.RuneCountInString(s); n > width {
+			width = n
+		}
+	}
+	data := make([]byte, 4*width*len(strs))
+	for i, s := range strs {
+		j := 0
+		for _, r := range s {
+			binary.LittleEndian.PutUint32(data[4*(i*width+j):], uint32(r))
+			j++
+		}
+	}
+	return npyArray{name, fmt.Sprintf("<U%d", width), []int{len(strs)}, data}
+}
+
+// npyHeader returns the header of an .npy file (format version 1.0), padded
+// so that the data starts at a multiple of 64 bytes
+func npyHeader(descr string, shape []int) []byte {
+	dims := make([]string, len(shape))
+	for i, d := range shape {
+		dims[i] = fmt.Sprintf("%d", d)
+	}
+	shapeStr := "(" + strings.Join(dims, ", ") + ")"
+	if len(shape) == 1 {
+		shapeStr = "(" + dims[0] + ",)"
+	}
+	dict := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': %s, }", descr, shapeStr)
+	// Magic string (6), version (2), header length (2), dict, and a newline
+	padding := 63 - (10+len(dict))%64
+	headerLen := len(dict) + padding + 1
+	buf := &bytes.Buffer{}
+	buf.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(buf, binary.LittleEndian, uint16(headerLen))
+	buf.WriteString(dict)
+	buf.WriteString(strings.Repeat(" ", padding))
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+// writeNPZ writes arrays to a NumPy .npz archive
+func writeNPZ(path string, arrays []npyArray) error {
+	f, err := createFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, arr := range arrays {
+		w, err := zw.Create(arr.name + ".npy")
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(npyHeader(arr.descr, arr.shape)); err != nil {
+			return err
+		}
+		if _, err := w.Write(arr.data); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,31 @@
+package mlcomp
+
+import (
+	"testing"
+)
+
+func TestNpyHeader(t *testing.T) {
+	for _, tc := range []struct {
+		descr         string
+		shape         []int
+		expectedShape string
+	}{
+		{"<f8", []int{3}, "'shape': (3,), }"},
+		{"|S3", []int{}, "'shape': (), }"},
+		{"<i8", []int{2, 1000}, "'shape': (2, 1000), }"},
+	} {
+		header := npyHeader(tc.descr, tc.shape)
+		if string(header[:8]) != "\x93NUMPY\x01\x00" {
+			t.Errorf("Wrong magic string and version in header: %q", header[:8])
+		}
+		headerLen := int(header[8]) | int(header[9])<<8
+		if len(header) != 10+headerLen || len(header)%64 != 0 || header[len(header)-1] != '\n' {
+			t.Errorf("Header not padded to a multiple of 64 bytes and ended by a newline: %q", header)
+		}
+		dict := string(header[10:])
+		expectedDict := "{'descr': '" + tc.descr + "', 'fortran_order': False, " + tc.expectedShape
+		if len(dict) < len(expectedDict) || dict[:len(expectedDict)] != expectedDict {
+			t.Errorf("Wrong header dict:\nEXPECTED: %s\nACTUAL: %s\n", expectedDict, dict)
+		}
+	}
+}
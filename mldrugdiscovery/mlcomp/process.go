@@ -0,0 +1,65 @@
+// Package mlcomp contains the SciPipe components of the drug discovery
+// workflow, for use in other workflows. Each component is created with a
+// NewXxx(wf, name, XxxConf{...}) function, and is connected through its port
+// accessor methods, such as InTrainData() and OutModel(). The names and port
+// accessors of the components are kept stable within a major Version.
+//
+// External tools are found in DefaultBinDir, unless a ToolPath is set in the
+// config of a component.
+package mlcomp
+
+import (
+	"github.com/pharmbio/scipipe-demo/toolreg"
+	sp "github.com/scipipe/scipipe"
+)
+
+// Version is the version of the component API
+const Version = "1.0.0"
+
+// Process is the SciPipe process of a component, which also keeps the path
+// patterns of its out-ports, for inspecting a component without running it
+type Process struct {
+	*sp.Process
+	outPathPatterns map[string]string
+}
+
+// newProcess returns a new Process, added to wf
+func newProcess(wf *sp.Workflow, name string, cmd string) *Process {
+	return &Process{wf.NewProc(name, cmd), map[string]string{}}
+}
+
+// SetOut sets the path pattern of an out-port, as for sp.Process
+func (p *Process) SetOut(outPortName string, pathPattern string) {
+	p.Process.SetOut(outPortName, pathPattern)
+	p.outPathPatterns[outPortName] = pathPattern
+}
+
+// OutPathPattern returns the path pattern of an out-port, or an empty string
+// for out-ports with paths from a function
+func (p *Process) OutPathPattern(outPortName string) string {
+	return p.outPathPatterns[outPortName]
+}
+
+// DefaultBinDir is the directory of the jars and the LIBLINEAR binaries used
+// by components without a configured tool path. It is relative to the
+// directories that SciPipe runs tasks in, which are subdirectories of the
+// workflow directory.
+const DefaultBinDir = "../bin/"
+
+// commandPath returns path, quoted for the shell, or command, to run from
+// PATH, if path is empty
+func commandPath(path string, command string) string {
+	if path == "" {
+		return command
+	}
+	return toolreg.Quote(path)
+}
+
+// toolPath returns path, quoted for the shell, or the path of the tool named
+// name in DefaultBinDir if path is empty
+func toolPath(path string, name string) string {
+	if path == "" {
+		return DefaultBinDir + name
+	}
+	return toolreg.Quote(path)
+}
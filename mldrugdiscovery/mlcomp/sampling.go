@@ -0,0 +1,193 @@
+package mlcomp
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Go-native train and test sampling methods. They all take and return
+// indexes of compounds, with train and test indexes in ascending order.
+
+// sampleTemporal puts the testSize most recent compounds in the test set, and
+// a random sample of trainSize of the older ones in the train set. Compounds
+// with the same date are ordered randomly.
+func sampleTemporal(dates []time.Time, trainSize int, testSize int, rnd *rand.Rand) ([]int, []int, error) {
+	if trainSize+testSize > len(dates) {
+		return nil, nil, fmt.Errorf("can not sample %d train and %d test compounds from %d compounds with dates", trainSize, testSize, len(dates))
+	}
+	idxs := rnd.Perm(len(dates))
+	sort.SliceStable(idxs, func(i, j int) bool { return dates[idxs[i]].Before(dates[idxs[j]]) })
+	older := idxs[:len(idxs)-testSize]
+	test := append([]int{}, idxs[len(idxs)-testSize:]...)
+	train := make([]int, trainSize)
+	for i, j := range rnd.Perm(len(older))[:trainSize] {
+		train[i] = older[j]
+	}
+	sort.Ints(train)
+	sort.Ints(test)
+	return train, test, nil
+}
+
+// sampleStratified splits the compounds into strataCnt strata of about equal
+// size by their responses, and samples the test set, and then the train set
+// from the remaining compounds, with the same fraction from each stratum
+func sampleStratified(responses []float64, trainSize int, testSize int, strataCnt int, rnd *rand.Rand) ([]int, []int, error) {
+	if trainSize+testSize > len(responses) {
+		return nil, nil, fmt.Errorf("can not sample %d train and %d test compounds from %d compounds", trainSize, testSize, len(responses))
+	}
+	if strataCnt < 1 {
+		strataCnt = 1
+	}
+	if strataCnt > len(responses) {
+		strataCnt = len(responses)
+	}
+	idxs := rnd.Perm(len(responses))
+	sort.SliceStable(idxs, func(i, j int) bool { return responses[idxs[i]] < responses[idxs[j]] })
+	strata := make([][]int, strataCnt)
+	for s := range strata {
+		strata[s] = idxs[s*len(idxs)/strataCnt : (s+1)*len(idxs)/strataCnt]
+	}
+	test, strata := pickStratified(strata, testSize, rnd)
+	train, _ := pickStratified(strata, trainSize, rnd)
+	sort.Ints(train)
+	sort.Ints(test)
+	return train, test, nil
+}
+
+// pickStratified randomly picks size indexes from strata, proportionally to
+// the size of each stratum (with largest remainder rounding), and returns the
+// picked indexes and the remaining strata
+func pickStratified(strata [][]int, size int, rnd *rand.Rand) ([]int, [][]int) {
+	total := 0
+	for _, stratum := range strata {
+		total += len(stratum)
+	}
+	counts := make([]int, len(strata))
+	remainders := make([]float64, len(strata))
+	allocated := 0
+	for s, stratum := range strata {
+		exact := float64(size) * float64(len(stratum)) / float64(total)
+		counts[s] = int(math.Floor(exact))
+		remainders[s] = exact - float64(counts[s])
+		allocated += counts[s]
+	}
+	order := rnd.Perm(len(strata))
+	sort.SliceStable(order, func(i, j int) bool { return remainders[order[i]] > remainders[order[j]] })
+	for i := 0; allocated < size; i = (i + 1) % len(order) {
+		if s := order[i]; counts[s] < len(strata[s]) {
+			counts[s]++
+			allocated++
+		}
+	}
+	picked := []int{}
+	rest := make([][]int, len(strata))
+	for s, stratum := range strata {
+		shuffled := make([]int, len(stratum))
+		for i, j := range rnd.Perm(len(stratum)) {
+			shuffled[i] = stratum[j]
+		}
+		picked = append(picked, shuffled[:counts[s]]...)
+		rest[s] = shuffled[counts[s]:]
+	}
+	return picked, rest
+}
+
+// butinaClusters clusters compounds with the Butina (sphere exclusion)
+// algorithm: The compound with the most neighbours within the Tanimoto
+// distance maxDist becomes a cluster centroid, and its unassigned neighbours
+// the members of its cluster, until all compounds are assigned. Clusters are
+// returned in the order they were formed, with the centroid first.
+func butinaClusters(fps [][]sparseEntry, maxDist float64) [][]int {
+	neighbours := make([][]int, len(fps))
+	for i := range fps {
+		for j := i + 1; j < len(fps); j++ {
+			if 1-tanimoto(fps[i], fps[j]) <= maxDist {
+				neighbours[i] = append(neighbours[i], j)
+				neighbours[j] = append(neighbours[j], i)
+			}
+		}
+	}
+	order := make([]int, len(fps))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return len(neighbours[order[i]]) > len(neighbours[order[j]]) })
+	assigned := make([]bool, len(fps))
+	clusters := [][]int{}
+	for _, centroid := range order {
+		if assigned[centroid] {
+			continue
+		}
+		assigned[centroid] = true
+		cluster := []int{centroid}
+		for _, nb := range neighbours[centroid] {
+			if !assigned[nb] {
+				assigned[nb] = true
+				cluster = append(cluster, nb)
+			}
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
+
+// sampleClusters fills the test set with whole clusters, in random order,
+// skipping clusters that would make it larger than testSize, and samples the
+// train set randomly from the compounds in the other clusters. No cluster
+// thus has compounds in both sets.
+func sampleClusters(clusters [][]int, trainSize int, testSize int, rnd *rand.Rand) ([]int, []int, error) {
+	test, rest := []int{}, []int{}
+	for _, c := range rnd.Perm(len(clusters)) {
+		if len(test)+len(clusters[c]) <= testSize {
+			test = append(test, clusters[c]...)
+		} else {
+			rest = append(rest, clusters[c]...)
+		}
+	}
+	if len(test) < testSize {
+		return nil, nil, fmt.Errorf("could only fill the test set with %d of %d compounds from whole clusters", len(test), testSize)
+	}
+	if trainSize > len(rest) {
+		return nil, nil, fmt.Errorf("can not sample %d train compounds from the %d compounds outside the test clusters", trainSize, len(rest))
+	}
+	train := make([]int, trainSize)
+	for i, j := range rnd.Perm(len(rest))[:trainSize] {
+		train[i] = rest[j]
+	}
+	sort.Ints(train)
+	sort.Ints(test)
+	return train, test, nil
+}
+
+// responseDistribution formats the count, mean, standard deviation and
+// quantiles of the responses at idxs, as a line in a table
+func responseDistribution(label string, responses []float64, idxs []int) string {
+	vals := make([]float64, len(idxs))
+	for i, idx := range idxs {
+		vals[i] = responses[idx]
+	}
+	if len(vals) == 0 {
+		return fmt.Sprintf("%-6s %6d\n", label, 0)
+	}
+	sort.Float64s(vals)
+	mean, sd := meanSD(vals)
+	quantile := func(q float64) float64 {
+		return vals[int(math.Round(q*float64(len(vals)-1)))]
+	}
+	return fmt.Sprintf("%-6s %6d %8.3f %8.3f %8.3f %8.3f %8.3f %8.3f %8.3f\n",
+		label, len(vals), mean, sd, vals[0], quantile(0.25), quantile(0.5), quantile(0.75), vals[len(vals)-1])
+}
+
+// responseDistributions formats a table with the distribution of responses
+// in the train and test sets
+func responseDistributions(responses []float64, train []int, test []int) string {
+	return strings.Join([]string{
+		fmt.Sprintf("%-6s %6s %8s %8s %8s %8s %8s %8s %8s\n", "set", "n", "mean", "sd", "min", "q1", "median", "q3", "max"),
+		responseDistribution("train", responses, train),
+		responseDistribution("test", responses, test),
+	}, "")
+}
@@ -0,0 +1,111 @@
+package mlcomp
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSampleTemporal(t *testing.T) {
+	dates := []time.Time{}
+	for i := 0; i < 20; i++ {
+		dates = append(dates, time.Date(2000+i, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+	// Shuffle the dates, so that the order of compounds does not matter
+	rnd := rand.New(rand.NewSource(1))
+	rnd.Shuffle(len(dates), func(i, j int) { dates[i], dates[j] = dates[j], dates[i] })
+
+	train, test, err := sampleTemporal(dates, 10, 5, rnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(train) != 10 || len(test) != 5 {
+		t.Fatalf("Expected 10 train and 5 test compounds, got %d and %d", len(train), len(test))
+	}
+	for _, idx := range test {
+		if dates[idx].Year() < 2015 {
+			t.Errorf("Expected only the 5 most recent compounds in the test set, got one from %d", dates[idx].Year())
+		}
+	}
+	for _, idx := range train {
+		if dates[idx].Year() >= 2015 {
+			t.Errorf("Expected only compounds older than the test set in the train set, got one from %d", dates[idx].Year())
+		}
+	}
+	if _, _, err := sampleTemporal(dates, 16, 5, rnd); err == nil {
+		t.Errorf("Expected an error when sampling more compounds than available")
+	}
+}
+
+func TestSampleStratified(t *testing.T) {
+	responses := []float64{}
+	for i := 0; i < 100; i++ {
+		responses = append(responses, float64(i))
+	}
+	train, test, err := sampleStratified(responses, 50, 20, 10, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(train) != 50 || len(test) != 20 {
+		t.Fatalf("Expected 50 train and 20 test compounds, got %d and %d", len(train), len(test))
+	}
+	seen := map[int]bool{}
+	testPerStratum := make([]int, 10)
+	trainPerStratum := make([]int, 10)
+	for _, idx := range test {
+		seen[idx] = true
+		testPerStratum[idx/10]++
+	}
+	for _, idx := range train {
+		if seen[idx] {
+			t.Errorf("Compound %d in both train and test", idx)
+		}
+		trainPerStratum[idx/10]++
+	}
+	for s := range testPerStratum {
+		if testPerStratum[s] != 2 || trainPerStratum[s] != 5 {
+			t.Errorf("Expected 2 test and 5 train compounds in stratum %d, got %d and %d", s, testPerStratum[s], trainPerStratum[s])
+		}
+	}
+}
+
+func TestButinaClusterSampling(t *testing.T) {
+	// Two groups of similar compounds, and two singletons
+	fps := [][]sparseEntry{
+		{{1, 1}, {2, 1}, {3, 1}},
+		{{1, 1}, {2, 1}, {3, 1}, {4, 1}},
+		{{1, 1}, {2, 1}, {3, 1}, {5, 1}},
+		{{10, 1}, {11, 1}},
+		{{10, 1}, {11, 1}, {12, 1}},
+		{{20, 1}},
+		{{30, 1}},
+	}
+	clusters := butinaClusters(fps, 0.4)
+	if len(clusters) != 4 {
+		t.Fatalf("Expected 4 clusters, got %d: %v", len(clusters), clusters)
+	}
+	if len(clusters[0]) != 3 || len(clusters[1]) != 2 {
+		t.Errorf("Expected clusters of sizes 3 and 2 first, got %v", clusters)
+	}
+	clusterOf := map[int]int{}
+	for c, cluster := range clusters {
+		for _, idx := range cluster {
+			clusterOf[idx] = c
+		}
+	}
+	for seed := int64(1); seed <= 5; seed++ {
+		train, test, err := sampleClusters(clusters, 3, 2, rand.New(rand.NewSource(seed)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		testClusters := map[int]bool{}
+		for _, idx := range test {
+			testClusters[clusterOf[idx]] = true
+		}
+		for _, idx := range train {
+			if testClusters[clusterOf[idx]] {
+				t.Errorf("Cluster %d has compounds in both train %v and test %v", clusterOf[idx], train, test)
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package mlcomp
+
+import (
+	"math"
+	"sort"
+)
+
+// Statistical tests for comparing paired per-fold results
+
+// meanSD returns the mean and the sample standard deviation of vals
+func meanSD(vals []float64) (float64, float64) {
+	if len(vals) == 0 {
+		return math.NaN(), math.NaN()
+	}
+	sum := 0.0
+	for _, v := range vals {
+		sum += v
+	}
+	mean := sum / float64(len(vals))
+	if len(vals) < 2 {
+		return mean, 0
+	}
+	sqSum := 0.0
+	for _, v := range vals {
+		sqSum += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sqSum / float64(len(vals)-1))
+}
+
+// wilcoxonSignedRank returns the two-sided p-value of the Wilcoxon signed-rank
+// test, for the paired differences diffs. Zero differences are dropped, and
+// tied absolute differences get their average rank. The p-value is exact for
+// up to 50 non-zero differences, and from the normal approximation otherwise.
+func wilcoxonSignedRank(diffs []float64) float64 {
+	nonZero := []float64{}
+	for _, d := range diffs {
+		if d != 0 {
+			nonZero = append(nonZero, d)
+		}
+	}
+	n := len(nonZero)
+	if n == 0 {
+		return 1
+	}
+	sort.Slice(nonZero, func(i, j int) bool { return math.Abs(nonZero[i]) < math.Abs(nonZero[j]) })
+	// Ranks are doubled, to keep average ranks of ties integers
+	ranks2 := make([]int, n)
+	for i := 0; i < n; {
+		j := i
+		for j < n && math.Abs(nonZero[j]) == math.Abs(nonZero[i]) {
+			j++
+		}
+		for k := i; k < j; k++ {
+			ranks2[k] = i + j + 1
+		}
+		i = j
+	}
+	wPlus2, total2 := 0, 0
+	for i, d := range nonZero {
+		total2 += ranks2[i]
+		if d > 0 {
+			wPlus2 += ranks2[i]
+		}
+	}
+	w2 := wPlus2
+	if total2-wPlus2 < w2 {
+		w2 = total2 - wPlus2
+	}
+
+	if n > 50 {
+		nf := float64(n)
+		mean := nf * (nf + 1) / 4
+		sd := math.Sqrt(nf * (nf + 1) * (2*nf + 1) / 24)
+		z := (float64(w2)/2 - mean + 0.5) / sd
+		return math.Min(1, 2*normalCDF(z))
+	}
+
+	// Exact distribution: counts[s] is the number of sign assignments with
+	// (doubled) positive rank sum s
+	counts := make([]float64, total2+1)
+	counts[0] = 1
+	for _, r := range ranks2 {
+		for s := total2; s >= r; s-- {
+			counts[s] += counts[s-r]
+		}
+	}
+	lowerTail := 0.0
+	for s := 0; s <= w2; s++ {
+		lowerTail += counts[s]
+	}
+	return math.Min(1, 2*lowerTail/math.Pow(2, float64(n)))
+}
+
+// correctedResampledTTest returns the two-sided p-value of the corrected
+// resampled t-test (Nadeau & Bengio, 2003) for the paired per-fold
+// differences diffs, where each fold was tested on testFrac of the data and
+// trained on the rest. For k-fold cross-validation, testFrac is 1/k.
+func correctedResampledTTest(diffs []float64, testFrac float64) float64 {
+	k := len(diffs)
+	if k < 2 {
+		return 1
+	}
+	mean, sd := meanSD(diffs)
+	if sd == 0 {
+		if mean == 0 {
+			return 1
+		}
+		return 0
+	}
+	t := mean / math.Sqrt((1/float64(k)+testFrac/(1-testFrac))*sd*sd)
+	return studentTTwoSidedP(t, float64(k-1))
+}
+
+// studentTTwoSidedP returns P(|T| >= |t|) for Student's t distribution with
+// df degrees of freedom
+func studentTTwoSidedP(t float64, df float64) float64 {
+	return regIncBeta(df/2, 0.5, df/(df+t*t))
+}
+
+func normalCDF(z float64) float64 {
+	return 0.5 * math.Erfc(-z/math.Sqrt2)
+}
+
+// regIncBeta returns the regularized incomplete beta function I_x(a, b)
+func regIncBeta(a float64, b float64, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lgab, _ := math.Lgamma(a + b)
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+	// The continued fraction converges fast only for x < (a+1)/(a+b+2)
+	if x > (a+1)/(a+b+2) {
+		return 1 - front*betaContFrac(b, a, 1-x)/b
+	}
+	return front * betaContFrac(a, b, x) / a
+}
+
+// betaContFrac evaluates the continued fraction for the incomplete beta
+// function, with the modified Lentz method
+func betaContFrac(a float64, b float64, x float64) float64 {
+	const tiny = 1e-300
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	f := d
+	for m := 1; m <= 300; m++ {
+		mf := float64(m)
+		for _, num := range []float64{
+			mf * (b - mf) * x / ((a + 2*mf - 1) * (a + 2*mf)),
+			-(a + mf) * (a + b + mf) * x / ((a + 2*mf) * (a + 2*mf + 1)),
+		} {
+			d = 1 + num*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + num/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			f *= c * d
+		}
+		if math.Abs(c*d-1) < 1e-14 {
+			break
+		}
+	}
+	return f
+}
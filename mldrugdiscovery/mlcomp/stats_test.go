@@ -0,0 +1,40 @@
+package mlcomp
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWilcoxonSignedRank(t *testing.T) {
+	for _, tc := range []struct {
+		diffs     []float64
+		expectedP float64
+	}{
+		{[]float64{1, 2, 3, 4, 5}, 0.0625},
+		{[]float64{-1, -2, -3, -4, -5}, 0.0625},
+		// W- = 6, and 13 of the 32 sign assignments give W <= 6
+		{[]float64{1, -2, 3, -4, 5, 0}, 2 * 13.0 / 32},
+		{[]float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1.0}, 2.0 / 1024},
+	} {
+		p := wilcoxonSignedRank(tc.diffs)
+		if math.Abs(p-tc.expectedP) > 1e-9 {
+			t.Errorf("Wrong Wilcoxon p-value for %v:\nEXPECTED: %g\nACTUAL: %g\n", tc.diffs, tc.expectedP, p)
+		}
+	}
+}
+
+func TestStudentTTwoSidedP(t *testing.T) {
+	for _, tc := range []struct {
+		t, df, expectedP float64
+	}{
+		{0, 9, 1},
+		{2.262157, 9, 0.05},
+		{3.249836, 9, 0.01},
+		{1.959964, 1e7, 0.05},
+	} {
+		p := studentTTwoSidedP(tc.t, tc.df)
+		if math.Abs(p-tc.expectedP) > 1e-5 {
+			t.Errorf("Wrong p-value for t=%g, df=%g:\nEXPECTED: %g\nACTUAL: %g\n", tc.t, tc.df, tc.expectedP, p)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package mlcomp
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+)
+
+// Simple SVG plots, for embedding in HTML reports without external
+// dependencies
+
+const (
+	svgWidth  = 480
+	svgHeight = 360
+	svgMargin = 50
+)
+
+// svgAxes maps data coordinates to the plot area of an SVG image
+type svgAxes struct {
+	minX, maxX, minY, maxY float64
+}
+
+func newSVGAxes(xs []float64, ys []float64) svgAxes {
+	minX, maxX := valueRange(xs)
+	minY, maxY := valueRange(ys)
+	return svgAxes{minX, maxX, minY, maxY}
+}
+
+// valueRange returns the min and max of vals, widened to a non-empty range
+func valueRange(vals []float64) (float64, float64) {
+	if len(vals) == 0 {
+		return 0, 1
+	}
+	min, max := vals[0], vals[0]
+	for _, v := range vals {
+		min, max = math.Min(min, v), math.Max(max, v)
+	}
+	if min == max {
+		return min - 1, max + 1
+	}
+	return min, max
+}
+
+func (ax svgAxes) px(x float64) float64 {
+	return svgMargin + (x-ax.minX)/(ax.maxX-ax.minX)*(svgWidth-2*svgMargin)
+}
+
+func (ax svgAxes) py(y float64) float64 {
+	return svgHeight - svgMargin - (y-ax.minY)/(ax.maxY-ax.minY)*(svgHeight-2*svgMargin)
+}
+
+// frame returns the SVG elements for the axis lines, min/max tick labels and
+// axis labels
+func (ax svgAxes) frame(title string, xLabel string, yLabel string) string {
+	var sb strings.Builder
+	left, right := float64(svgMargin), float64(svgWidth-svgMargin)
+	top, bottom := float64(svgMargin), float64(svgHeight-svgMargin)
+	fmt.Fprintf(&sb, `<text x="%d" y="20" text-anchor="middle" font-weight="bold">%s</text>`+"\n", svgWidth/2, html.EscapeString(title))
+	fmt.Fprintf(&sb, `<polyline points="%.1f,%.1f %.1f,%.1f %.1f,%.1f" fill="none" stroke="black"/>`+"\n", left, top, left, bottom, right, bottom)
+	fmt.Fprintf(&sb, `<text x="%.1f" y="%.1f" text-anchor="start">%.3g</text>`+"\n", left, bottom+15, ax.minX)
+	fmt.Fprintf(&sb, `<text x="%.1f" y="%.1f" text-anchor="end">%.3g</text>`+"\n", right, bottom+15, ax.maxX)
+	fmt.Fprintf(&sb, `<text x="%.1f" y="%.1f" text-anchor="end">%.3g</text>`+"\n", left-5, bottom, ax.minY)
+	fmt.Fprintf(&sb, `<text x="%.1f" y="%.1f" text-anchor="end">%.3g</text>`+"\n", left-5, top+10, ax.maxY)
+	fmt.Fprintf(&sb, `<text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n", svgWidth/2, svgHeight-10, html.EscapeString(xLabel))
+	fmt.Fprintf(&sb, `<text x="15" y="%d" text-anchor="middle" transform="rotate(-90 15 %d)">%s</text>`+"\n", svgHeight/2, svgHeight/2, html.EscapeString(yLabel))
+	return sb.String()
+}
+
+func svgDocument(body string) string {
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`+"\n%s</svg>\n",
+		svgWidth, svgHeight, body)
+}
+
+// svgScatter returns an SVG scatter plot of ys against xs. If diagonal is
+// true, the line y = x is drawn, and both axes get the same range.
+func svgScatter(title string, xLabel string, yLabel string, xs []float64, ys []float64, diagonal bool) string {
+	ax := newSVGAxes(xs, ys)
+	if diagonal {
+		lo, hi := math.Min(ax.minX, ax.minY), math.Max(ax.maxX, ax.maxY)
+		ax = svgAxes{lo, hi, lo, hi}
+	}
+	var sb strings.Builder
+	sb.WriteString(ax.frame(title, xLabel, yLabel))
+	if diagonal {
+		fmt.Fprintf(&sb, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="gray" stroke-dasharray="4"/>`+"\n",
+			ax.px(ax.minX), ax.py(ax.minY), ax.px(ax.maxX), ax.py(ax.maxY))
+	}
+	for i := range xs {
+		fmt.Fprintf(&sb, `<circle cx="%.1f" cy="%.1f" r="2.5" fill="steelblue" fill-opacity="0.6"/>`+"\n", ax.px(xs[i]), ax.py(ys[i]))
+	}
+	return svgDocument(sb.String())
+}
+
+// svgHistogram returns an SVG histogram of vals, with binCnt bins
+func svgHistogram(title string, xLabel string, vals []float64, binCnt int) string {
+	ax := newSVGAxes(vals, nil)
+	counts := make([]float64, binCnt)
+	binWidth := (ax.maxX - ax.minX) / float64(binCnt)
+	for _, v := range vals {
+		bin := int((v - ax.minX) / binWidth)
+		if bin >= binCnt {
+			bin = binCnt - 1
+		}
+		counts[bin]++
+	}
+	maxCnt := 1.0
+	for _, c := range counts {
+		maxCnt = math.Max(maxCnt, c)
+	}
+	ax.minY, ax.maxY = 0, maxCnt
+	var sb strings.Builder
+	sb.WriteString(ax.frame(title, xLabel, "Count"))
+	for i, c := range counts {
+		x0 := ax.px(ax.minX + float64(i)*binWidth)
+		x1 := ax.px(ax.minX + float64(i+1)*binWidth)
+		fmt.Fprintf(&sb, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="steelblue" stroke="white"/>`+"\n",
+			x0, ax.py(c), x1-x0, ax.py(0)-ax.py(c))
+	}
+	return svgDocument(sb.String())
+}
+
+// svgHeatmap returns an SVG heatmap of values, indexed by row and column, with
+// lower values in darker color. NaN values are left blank. The lowest value
+// in each column is outlined.
+func svgHeatmap(title string, xLabel string, yLabel string, colLabels []string, rowLabels []string, values [][]float64) string {
+	all := []float64{}
+	for _, row := range values {
+		for _, v := range row {
+			if !math.IsNaN(v) {
+				all = append(all, v)
+			}
+		}
+	}
+	min, max := valueRange(all)
+	cellW := float64(svgWidth-2*svgMargin) / float64(len(colLabels))
+	cellH := float64(svgHeight-2*svgMargin) / float64(len(rowLabels))
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<text x="%d" y="20" text-anchor="middle" font-weight="bold">%s</text>`+"\n", svgWidth/2, html.EscapeString(title))
+	for j, label := range colLabels {
+		fmt.Fprintf(&sb, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`+"\n",
+			svgMargin+(float64(j)+0.5)*cellW, svgHeight-svgMargin+15, html.EscapeString(label))
+	}
+	for i, label := range rowLabels {
+		fmt.Fprintf(&sb, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`+"\n",
+			svgMargin-5, svgMargin+(float64(i)+0.6)*cellH, html.EscapeString(label))
+	}
+	for j := range colLabels {
+		minRow := -1
+		for i := range rowLabels {
+			v := values[i][j]
+			if math.IsNaN(v) {
+				continue
+			}
+			if minRow < 0 || v < values[minRow][j] {
+				minRow = i
+			}
+			// Lightness from 30% (lowest) to 95% (highest)
+			lightness := 30 + 65*(v-min)/(max-min)
+			fmt.Fprintf(&sb, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="hsl(210, 70%%, %.0f%%)"><title>%.4g</title></rect>`+"\n",
+				svgMargin+float64(j)*cellW, svgMargin+float64(i)*cellH, cellW, cellH, lightness, v)
+		}
+		if minRow >= 0 {
+			fmt.Fprintf(&sb, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="none" stroke="black" stroke-width="2"/>`+"\n",
+				svgMargin+float64(j)*cellW, svgMargin+float64(minRow)*cellH, cellW, cellH)
+		}
+	}
+	fmt.Fprintf(&sb, `<text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n", svgWidth/2, svgHeight-10, html.EscapeString(xLabel))
+	fmt.Fprintf(&sb, `<text x="12" y="%d" text-anchor="middle" transform="rotate(-90 12 %d)">%s</text>`+"\n", svgHeight/2, svgHeight/2, html.EscapeString(yLabel))
+	return svgDocument(sb.String())
+}
@@ -0,0 +1,45 @@
+package mlcomp
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fs is a short for fmt.Sprintf
+func fs(pat string, v ...interface{}) string {
+	return fmt.Sprintf(pat, v...)
+}
+
+// createFile creates a file for writing, including any missing parent
+// directories
+func createFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+// ForEachLine calls fn for every non-empty line in a file, with 1-based line
+// numbers
+func ForEachLine(path string, fn func(lineNo int, line string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := fn(lineNo, line); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
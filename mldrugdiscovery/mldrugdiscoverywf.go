@@ -12,41 +12,152 @@ package main
 import (
 	"flag"
 	"fmt"
+	"hash/fnv"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	sp "github.com/scipipe/scipipe"
 	spcomp "github.com/scipipe/scipipe/components"
+
+	"github.com/pharmbio/scipipe-demo/doctor"
+	"github.com/pharmbio/scipipe-demo/download"
+	"github.com/pharmbio/scipipe-demo/mldrugdiscovery/mlcomp"
+	"github.com/pharmbio/scipipe-demo/sweepgraph"
+	"github.com/pharmbio/scipipe-demo/toolreg"
+)
+
+const (
+	dataDir        = "data/"
+	testDatasetURL = "https://zenodo.org/record/1324443/files/testdataset.smi?download=1"
+	toolsURL       = "https://ndownloader.figshare.com/files/6330402"
 )
 
+// Expected SHA-256 checksums of the downloads, which are not pinned yet. An
+// empty checksum is not verified, but the checksum of the downloaded file is
+// logged, to pin it here with, and -offline runs fail without one.
 const (
-	dataDir = "data/"
+	testDatasetSHA256 = ""
+	toolsSHA256       = ""
 )
 
 var (
 	plot     = flag.Bool("plot", false, "Plot the workflow graph in (GraphViz) dot format")
+	plotColl = flag.Bool("plot-collapsed", false, "Plot the workflow graph with the processes of parameter sweeps (replicates, heights, train sizes, costs, folds, ...) collapsed, in dot, SVG and Mermaid format")
 	maxtasks = flag.Int("maxtasks", 2, "Number of concurrent tasks to run, which should probably correspond roughly to the number of CPU maxtasks.")
+	engine   = flag.String("signengine", string(mlcomp.SignatureEngineJava), "Engine for generating signatures and sparse datasets: java, gosign (pure Go signatures) or goecfp (pure Go ECFP-style). The Go engines require a Go sampling method")
+	dataset  = flag.String("dataset", "", "Path to a dataset in .smi, .csv, .tsv or .sdf format, to use instead of the downloaded test dataset")
+	datasets = flag.String("datasets", "", "Path to a tab-separated list of datasets to benchmark, with a name, a path or URL, and optionally a SHA-256 checksum on each line")
+	smiCol   = flag.String("smilescol", "smiles", "Name of the SMILES column, for CSV/TSV datasets")
+	idCol    = flag.String("idcol", "", "Name of the compound ID column (CSV/TSV) or data item (SDF). Row numbers, or SDF titles, are used if empty")
+	respCol  = flag.String("responsecol", "activity", "Name of the response column (CSV/TSV) or data item (SDF)")
+	dateCol  = flag.String("datecol", "", "Name of the date column (CSV/TSV) or data item (SDF), for temporal sampling")
+	sampling = flag.String("sampling", string(mlcomp.SamplingMethodRandom), "Train and test sampling method: rand, signcnt (both java only), temporal (requires -datecol), cluster or stratified")
+	yRandCnt = flag.Int("yrandomizations", 0, "Number of Y-randomization runs (with scrambled train responses) per train size, to compare the real models against")
+	interpN  = flag.Int("interpret", 20, "Number of most positive and most negative signatures to list for each final model, or 0 to skip model interpretation")
+	explain  = flag.String("explain", "", "Comma-separated SMILES of compounds to list atom contributions for, with each final model (requires a Go signature engine)")
+	adMinCov = flag.Float64("admincoverage", 0.7, "Minimum fraction of the signatures of a compound seen in the train data, for predictions to be in the applicability domain")
+	export   = flag.Bool("export", false, "Export the sampled train and test sets in SVMLight, MatrixMarket, NumPy .npz and (for small sets) CSV format")
+	sqliteDB = flag.Bool("resultsdb", false, "Also record RMSDs and selected costs in a SQLite database (results.sqlite in the run directory), with the sqlite3 tool")
+	mlflow   = flag.String("mlflow", "", "MLflow file store directory (such as mlruns) to track final models and cost grids in, or empty for no tracking")
+	ensemble = flag.String("ensemble", "", "Bagged ensembles of final models: bootstrap (members trained on bootstrap samples of the train data) or replicate (final models of all replicates). Empty for none")
+	ensSize  = flag.Int("ensemblesize", 10, "Number of bootstrap ensemble members, or of replicates for replicate ensembles")
+	heights  = flag.String("heights", "1-3", "Comma-separated signature height ranges to build models for, such as 1-3,0-2")
+	respConv = flag.String("transform", "", "Conversion of response values: p-nM, p-uM or p-M (e.g. IC50 to pIC50), or log10. Empty for none")
+	endpts   = flag.String("endpoints", "", "Comma-separated response columns (CSV/TSV) or data items (SDF) of a dataset with several endpoints, to model each of them with shared signatures and sparse datasets, instead of -responsecol")
+	cacheDir = flag.String("cachedir", "downloads", "Directory of the content-addressed cache of downloaded tools and datasets, or empty for no caching")
+	mirror   = flag.String("mirror", "", "Local directory with copies of the downloaded tools and datasets, to use before downloading")
+	offline  = flag.Bool("offline", false, "Resolve tools and datasets from the download cache or the -mirror directory only, without downloading")
+	toolConf = flag.String("toolconf", "", "Tool config file, with the name and path of a tool on each line, for tools not in the downloaded tools bundle (see also the "+toolreg.EnvPrefix+"[NAME] environment variables)")
 )
 
 func main() {
+	runDoctor := doctor.Requested()
 	flag.Parse()
+	if e := mlcomp.SignatureEngine(*engine); e != mlcomp.SignatureEngineJava && !e.IsGo() {
+		sp.Failf("Unknown signature engine: %s\n", e)
+	}
+	if _, err := mlcomp.ResponseTransform(*respConv).Apply(1); err != nil {
+		sp.Fail(err)
+	}
+	switch m := mlcomp.SamplingMethod(*sampling); {
+	case m == mlcomp.SamplingMethodTemporal && *dateCol == "":
+		sp.Fail("Temporal sampling requires a date column, given with -datecol")
+	case m != mlcomp.SamplingMethodRandom && m != mlcomp.SamplingMethodSignCnt && !m.IsGo():
+		sp.Failf("Unknown sampling method: %s\n", m)
+	case mlcomp.SignatureEngine(*engine).IsGo() && !m.IsGo():
+		sp.Failf("The %s signature engine requires one of the Go sampling methods (temporal, cluster or stratified), since the sampling jars only read the signature files of the java engine\n", *engine)
+	}
+	switch m := mlcomp.EnsembleMethod(*ensemble); {
+	case m != mlcomp.EnsembleNone && m != mlcomp.EnsembleBootstrap && m != mlcomp.EnsembleReplicate:
+		sp.Failf("Unknown ensemble method: %s\n", m)
+	case m != mlcomp.EnsembleNone && *ensSize < 2:
+		sp.Fail("Ensembles need at least two members")
+	}
+	tools := newToolRegistry(mlcomp.SignatureEngine(*engine), mlcomp.SamplingMethod(*sampling), *sqliteDB)
+	if err := tools.Resolve(*toolConf); err != nil {
+		if !runDoctor {
+			sp.Fail(err)
+		}
+		sp.Warning.Println(err)
+	}
+	sp.Info.Println("Tools:\n" + tools.Table())
+	heightRanges, err := parseHeightRanges(*heights)
+	if err != nil {
+		sp.Fail(err)
+	}
+	if len(heightRanges) == 0 {
+		sp.Fail("No signature height ranges given")
+	}
 
+	downloads := download.Cache{
+		Dir:       *cacheDir,
+		MirrorDir: *mirror,
+		Offline:   *offline,
+	}
 	dlWf := sp.NewWorkflow("download_tools_wf", *maxtasks)
-	downloadTools := dlWf.NewProc("download_tools", "wget https://ndownloader.figshare.com/files/6330402 -O {o:tarball}")
-	downloadTools.SetOut("tarball", "jars.tar.gz")
+	downloadTools := mlcomp.NewDownload(dlWf, "download_tools", mlcomp.DownloadConf{
+		URL:    toolsURL,
+		SHA256: toolsSHA256,
+		Path:   "jars.tar.gz",
+		Cache:  downloads,
+	})
 	unpackJars := dlWf.NewProc("unpack_tools", "mkdir {o:unpackdir} && tar -zxf {i:tarball} -C {o:unpackdir}")
 	unpackJars.SetOut("unpackdir", "bin")
-	unpackJars.In("tarball").From(downloadTools.Out("tarball"))
-	downloadRawData := dlWf.NewProc("download_rawdata", "wget https://zenodo.org/record/1324443/files/testdataset.smi?download=1 -O {o:dataset}")
-	downloadRawData.SetOut("dataset", dataDir+"testdataset.smi")
+	unpackJars.In("tarball").From(downloadTools.OutFile())
+	if *datasets == "" && *dataset == "" {
+		mlcomp.NewDownload(dlWf, "download_rawdata", mlcomp.DownloadConf{
+			URL:    testDatasetURL,
+			SHA256: testDatasetSHA256,
+			Path:   dataDir + "testdataset.smi",
+			Cache:  downloads,
+		})
+	}
+
+	datasetName := "testdataset"
+	datasetSource := testDatasetURL
+	if *dataset != "" {
+		datasetName = strings.TrimSuffix(filepath.Base(*dataset), filepath.Ext(*dataset))
+		datasetSource = *dataset
+	}
 
-	crossValWF := NewCrossValidateWorkflow(*maxtasks, CrossValidateWorkflowParams{
-		DatasetName:      "testdataset",
+	params := CrossValidateWorkflowParams{
+		DatasetName: datasetName,
+		DatasetFile: *dataset,
+		DatasetLoad: mlcomp.LoadDatasetConf{
+			Format:         mlcomp.DatasetFormatFromPath(*dataset),
+			SmilesColumn:   *smiCol,
+			IDColumn:       *idCol,
+			ResponseColumn: *respCol,
+			DateColumn:     *dateCol,
+			Transform:      mlcomp.ResponseTransform(*respConv),
+		},
 		RunID:            "testrun",
 		ReplicateID:      "r1",
 		FoldsCount:       10,
-		MinHeight:        1,
-		MaxHeight:        3,
+		HeightRanges:     heightRanges,
+		SamplingMethod:   mlcomp.SamplingMethod(*sampling),
 		TestSize:         1000,
 		TrainSizes:       []int{500, 1000, 2000, 4000, 8000},
 		CostVals:         []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 0.75, 1, 2, 3, 4, 5},
@@ -54,7 +165,68 @@ func main() {
 		RandomDataSizeMB: 10,
 		Runmode:          RunModeLocal,
 		SlurmProject:     "N/A",
-	})
+		SignatureEngine:  mlcomp.SignatureEngine(*engine),
+		YRandomizations:  *yRandCnt,
+		AppDomain: mlcomp.ApplicabilityDomainConf{
+			MinCoverage:      *adMinCov,
+			LeverageFeatures: 50,
+		},
+		InterpretTopN:    *interpN,
+		ExplainCompounds: splitNonEmpty(*explain, ","),
+		Export:           *export,
+		ResultsDB:        *sqliteDB,
+		MLflowDir:        *mlflow,
+		DatasetSource:    datasetSource,
+		Ensemble: mlcomp.EnsembleConf{
+			Method: mlcomp.EnsembleMethod(*ensemble),
+			Size:   *ensSize,
+		},
+		Endpoints: splitNonEmpty(*endpts, ","),
+		Downloads: downloads,
+		Tools:     tools,
+	}
+	if params.Ensemble.Method == mlcomp.EnsembleReplicate {
+		params.ReplicateID = ""
+		for i := 1; i <= *ensSize; i++ {
+			params.ReplicateIDs = append(params.ReplicateIDs, fs("r%d", i))
+		}
+	}
+	var crossValWF *sp.Workflow
+	var sweeps *sweepgraph.Sweeps
+	if *datasets != "" {
+		benchDatasets, err := readBenchmarkDatasets(*datasets)
+		if err != nil {
+			sp.Fail(err)
+		}
+		if len(benchDatasets) == 0 {
+			sp.Failf("No datasets listed in %s\n", *datasets)
+		}
+		benchWF := NewBenchmarkWorkflow(*maxtasks, benchDatasets, params)
+		crossValWF, sweeps = benchWF.Workflow, benchWF.Sweeps
+	} else {
+		cvWF := NewCrossValidateWorkflow(*maxtasks, params)
+		crossValWF, sweeps = cvWF.Workflow, cvWF.Sweeps
+	}
+	if runDoctor {
+		d := doctor.New(tools)
+		d.AddWorkflow(dlWf)
+		d.AddWorkflow(crossValWF)
+		if tools.Has("sqlite3") {
+			// The results are recorded by Go processes, which run sqlite3
+			recordProcs := []string{}
+			for name := range crossValWF.Procs() {
+				if strings.HasPrefix(name, "record_") {
+					recordProcs = append(recordProcs, name)
+				}
+			}
+			sort.Strings(recordProcs)
+			d.AddExecutable(tools.Path("sqlite3"), recordProcs...)
+		}
+		if !doctor.WriteTable(os.Stdout, d.Run()) {
+			os.Exit(1)
+		}
+		return
+	}
 	if *plot {
 		//crossValWF.PlotConf.EdgeLabels = fals
 		graphFile := "mmdag.dot"
@@ -62,6 +234,14 @@ func main() {
 		crossValWF.PlotGraph(graphFile)
 		return
 	}
+	if *plotColl {
+		graphBase := "mmdag.collapsed"
+		fmt.Println("Writing collapsed workflow graph to: " + graphBase + ".{dot,svg,mmd}")
+		if err := sweeps.Collapse(crossValWF).WriteFiles(graphBase); err != nil {
+			sp.Fail(err)
+		}
+		return
+	}
 	dlWf.Run()
 	crossValWF.Run()
 }
@@ -70,18 +250,28 @@ func main() {
 // with cross-validation
 type CrossValidateWorkflow struct {
 	*sp.Workflow
+	// Sweeps has the sweep dimensions of the process names, for collapsed
+	// workflow graphs
+	Sweeps *sweepgraph.Sweeps
 }
 
 // CrossValidateWorkflowParams is a container for parameters to
 // CrossValidateWorkflow workflows
 type CrossValidateWorkflowParams struct {
-	DatasetName      string
-	RunID            string
-	ReplicateID      string
-	ReplicateIDs     []string
-	FoldsCount       int
-	MinHeight        int
-	MaxHeight        int
+	DatasetName  string
+	DatasetFile  string // Defaults to data/[DatasetName].smi
+	DataDir      string // Directory for result files, defaults to data/
+	DatasetLoad  mlcomp.LoadDatasetConf
+	RunID        string
+	ReplicateID  string
+	ReplicateIDs []string
+	FoldsCount   int
+	MinHeight    int
+	MaxHeight    int
+	// HeightRanges are the signature height ranges to build models for.
+	// Defaults to the single range MinHeight-MaxHeight.
+	HeightRanges     []HeightRange
+	SamplingMethod   mlcomp.SamplingMethod // Defaults to random sampling
 	TestSize         int
 	TrainSizes       []int
 	CostVals         []float64
@@ -89,6 +279,116 @@ type CrossValidateWorkflowParams struct {
 	RandomDataSizeMB int
 	Runmode          RunMode
 	SlurmProject     string
+	SignatureEngine  mlcomp.SignatureEngine
+	// YRandomizations is the number of Y-randomization (response scrambling)
+	// control runs per train size, or 0 for none
+	YRandomizations int
+	// AppDomain contains the applicability domain criteria for predictions
+	// on the test set. The title is set per train size.
+	AppDomain mlcomp.ApplicabilityDomainConf
+	// InterpretTopN is the number of top positive and negative signatures to
+	// list for final models, or 0 to skip model interpretation
+	InterpretTopN int
+	// ExplainCompounds are SMILES strings of compounds to list atom
+	// contributions for, in the model interpretation
+	ExplainCompounds []string
+	// Export is true for exporting the sampled train and test sets to
+	// formats for other machine learning tools
+	Export bool
+	// ResultsDB is true for also recording the RMSDs and selected costs in a
+	// SQLite database, results.sqlite in the run directory
+	ResultsDB bool
+	// MLflowDir is an MLflow file store directory to track final models in,
+	// as runs in an experiment named after the dataset, or empty for no
+	// tracking
+	MLflowDir string
+	// DatasetSource is the URL or path the dataset was obtained from, for
+	// model cards
+	DatasetSource string
+	// Ensemble contains the settings for bagged ensembles of final models.
+	// Replicate ensembles need several ReplicateIDs.
+	Ensemble mlcomp.EnsembleConf
+	// Endpoints are the response columns of a dataset with several
+	// endpoints, which are modelled separately, with shared signatures and
+	// sparse datasets. Requires a CSV, TSV or SDF dataset. Empty for a single
+	// endpoint, in DatasetLoad.ResponseColumn.
+	Endpoints []string
+	// Downloads is the download cache for benchmark datasets
+	Downloads download.Cache
+	// Tools has the paths of the external tools. Tools not in the registry,
+	// or all tools if nil, are run from mlcomp.DefaultBinDir and PATH.
+	Tools *toolreg.Registry
+}
+
+// tool returns the path of the tool named name in p.Tools, or an empty
+// string, for the default path of a component, if not in p.Tools
+func (p CrossValidateWorkflowParams) tool(name string) string {
+	if p.Tools == nil || !p.Tools.Has(name) {
+		return ""
+	}
+	return p.Tools.Path(name)
+}
+
+// newToolRegistry returns a registry with the external tools used with
+// signature engine engine and sampling method sampling, and with sqlite3 if
+// resultsDB is true. The tools in the downloaded tools bundle default to the
+// bin directory it is unpacked in.
+func newToolRegistry(engine mlcomp.SignatureEngine, sampling mlcomp.SamplingMethod, resultsDB bool) *toolreg.Registry {
+	tools := toolreg.NewRegistry(
+		toolreg.Tool{Name: "time", Command: "time", Default: "/usr/bin/time"},
+		toolreg.Tool{Name: "lin-train", Default: "bin/lin-train", Bundled: true},
+		toolreg.Tool{Name: "lin-predict", Default: "bin/lin-predict", Bundled: true},
+	)
+	if engine == mlcomp.SignatureEngineJava || !sampling.IsGo() {
+		tools.Add(toolreg.Tool{Name: "java", Command: "java"})
+	}
+	if engine == mlcomp.SignatureEngineJava {
+		tools.Add(
+			toolreg.Tool{Name: "generatesignatures", Default: "bin/GenerateSignatures.jar", Bundled: true},
+			toolreg.Tool{Name: "createsparsedataset", Default: "bin/CreateSparseDataset.jar", Bundled: true},
+		)
+	}
+	switch sampling {
+	case mlcomp.SamplingMethodRandom:
+		tools.Add(toolreg.Tool{Name: "sampletrainingandtest", Default: "bin/SampleTrainingAndTest.jar", Bundled: true})
+	case mlcomp.SamplingMethodSignCnt:
+		tools.Add(toolreg.Tool{Name: "sampletrainingandtestsizebased", Default: "bin/SampleTrainingAndTestSizeBased.jar", Bundled: true})
+	}
+	if resultsDB {
+		tools.Add(toolreg.Tool{Name: "sqlite3", Command: "sqlite3"})
+	}
+	return tools
+}
+
+func (p CrossValidateWorkflowParams) dataDir() string {
+	if p.DataDir == "" {
+		return dataDir
+	}
+	return p.DataDir
+}
+
+// HeightRange is an (inclusive) range of signature heights
+type HeightRange struct {
+	Min int
+	Max int
+}
+
+// String formats the height range as min-max
+func (hr HeightRange) String() string {
+	return fs("%d-%d", hr.Min, hr.Max)
+}
+
+// parseHeightRanges parses a comma-separated list of min-max height ranges
+func parseHeightRanges(s string) ([]HeightRange, error) {
+	ranges := []HeightRange{}
+	for _, part := range splitNonEmpty(s, ",") {
+		hr := HeightRange{}
+		if _, err := fmt.Sscanf(part, "%d-%d", &hr.Min, &hr.Max); err != nil || hr.Min < 0 || hr.Max < hr.Min {
+			return nil, fmt.Errorf("invalid height range: %q", part)
+		}
+		ranges = append(ranges, hr)
+	}
+	return ranges, nil
 }
 
 // ================================================================================
@@ -99,15 +399,126 @@ type CrossValidateWorkflowParams struct {
 func NewCrossValidateWorkflow(maxTasks int, params CrossValidateWorkflowParams) *CrossValidateWorkflow {
 	wf := sp.NewWorkflow("cross_validate", maxTasks)
 
+	datasetFile := params.DatasetFile
+	if datasetFile == "" {
+		datasetFile = fs("data/%s.smi", params.DatasetName)
+	}
 	mmTestData := spcomp.NewFileSource(
 		wf,
 		"testdata",
-		fs("data/%s.smi", params.DatasetName))
+		datasetFile)
+
+	sweeps := sweepgraph.New()
+	newCrossValidation(wf, params, sweeps, mmTestData.Out())
+	return &CrossValidateWorkflow{wf, sweeps}
+}
+
+// crossValidationProcs are the processes summarizing the cross-validation of
+// one dataset
+type crossValidationProcs struct {
+	report *mlcomp.RunReport
+	// results writes a table with the dataset, replicate, height range, train
+	// size, selected cost, cross-validation RMSD and test RMSD of every final
+	// model to its "results" out-port
+	results *sp.Process
+}
+
+// newCrossValidation adds the processes for cross-validating models on one
+// dataset, to wf. Process names are suffixed with the dataset name, and files
+// not named after the dataset file are written in params.DataDir.
+func newCrossValidation(wf *sp.Workflow, params CrossValidateWorkflowParams, sweeps *sweepgraph.Sweeps, dataset *sp.OutPort) *crossValidationProcs {
+	dsDir := params.dataDir()
+	uniqDs := sweeps.Suffix("", "dataset", params.DatasetName, "_"+params.DatasetName)
+
+	// ------------------------------------------------------------------------
+	// Convert datasets in other formats than .smi
+	// ------------------------------------------------------------------------
+	smilesData := dataset
+	var compoundIDs, endpointsTable *sp.OutPort
+	if format := params.DatasetLoad.Format; format != "" && format != mlcomp.DatasetFormatSmi {
+		loadConf := params.DatasetLoad
+		loadConf.EndpointColumns = params.Endpoints
+		loadDataset := mlcomp.NewLoadDataset(wf, "load_dataset"+uniqDs, loadConf)
+		loadDataset.InDataset().From(dataset)
+		smilesData = loadDataset.OutSmiles()
+		compoundIDs = loadDataset.OutIDs()
+		if len(params.Endpoints) > 0 {
+			endpointsTable = loadDataset.OutEndpoints()
+		}
+	}
+
+	// ------------------------------------------------------------------------
+	// Report collecting summaries from the run
+	// ------------------------------------------------------------------------
+	reportPath := fs("%s%s/report.md", dsDir, params.RunID)
+	runReport := mlcomp.NewRunReport(wf, "run_report"+uniqDs, mlcomp.RunReportConf{
+		Title:      fs("Cross-validation run %s, dataset %s", params.RunID, params.DatasetName),
+		ReportPath: reportPath,
+	})
+
+	// ------------------------------------------------------------------------
+	// Validate and standardize input molecules
+	// ------------------------------------------------------------------------
+	standardize := mlcomp.NewStandardizeSmiles(wf, "standardize"+uniqDs, mlcomp.StandardizeSmilesConf{
+		Aggregation: mlcomp.AggregationMean,
+	})
+	standardize.InSmiles().From(smilesData)
+	runReport.InSection().From(standardize.OutSummary())
 
 	//procs := []sp.WorkflowProcess{}
 	//lowestRMSDs := []float64{}
 	//mainWFRunners := []*sp.Workflow{}
 
+	samplingMethod := params.SamplingMethod
+	if samplingMethod == "" {
+		samplingMethod = mlcomp.SamplingMethodRandom
+	}
+	samplingTool := map[mlcomp.SamplingMethod]string{
+		mlcomp.SamplingMethodRandom:  "sampletrainingandtest",
+		mlcomp.SamplingMethodSignCnt: "sampletrainingandtestsizebased",
+	}[samplingMethod]
+	if samplingMethod == mlcomp.SamplingMethodTemporal && (compoundIDs == nil || params.DatasetLoad.DateColumn == "") {
+		sp.Fail("Temporal sampling requires a CSV, TSV or SDF dataset with a date column")
+	}
+	if params.SignatureEngine.IsGo() && !samplingMethod.IsGo() {
+		sp.Failf("Sampling method %s can not be used with the %s signature engine\n", samplingMethod, params.SignatureEngine)
+	}
+
+	heightRanges := params.HeightRanges
+	if len(heightRanges) == 0 {
+		heightRanges = []HeightRange{{params.MinHeight, params.MaxHeight}}
+	}
+
+	// Single-endpoint datasets have one, unnamed, endpoint
+	endpoints := []string{""}
+	if len(params.Endpoints) > 0 {
+		if endpointsTable == nil {
+			sp.Fail("Endpoints require a CSV, TSV or SDF dataset")
+		}
+		endpoints = params.Endpoints
+	}
+	// withEndpoint returns uniq and desc, extended with endpoint, unless empty
+	withEndpoint := func(uniq string, desc string, endpoint string) (string, string) {
+		if endpoint == "" {
+			return uniq, desc
+		}
+		return sweeps.Suffix(uniq, "endpoint", endpoint, "_"+mlcomp.EndpointFileName(endpoint)), desc + ", endpoint " + endpoint
+	}
+
+	resultRowsSubstr := spcomp.NewStreamToSubStream(wf, "result_rows"+uniqDs)
+
+	// Members of replicate ensembles, per height range, train size and
+	// endpoint, and the train and test data of the first replicate, for
+	// predicting its test compounds with them
+	replEnsembleMembers := map[string]*spcomp.StreamToSubStream{}
+	replEnsembleData := map[string]replicateEnsembleData{}
+	uniqDsHgtTrsEp := func(heights HeightRange, trainSize int, endpoint string) string {
+		uniqDsHgt := sweeps.Suffix(uniqDs, "heights", heights, fs("_h%d_%d", heights.Min, heights.Max))
+		uniqDsHgtTrs := sweeps.Suffix(uniqDsHgt, "train size", trainSize, fs("_tr%d", trainSize))
+		uniqDsHgtTrsEp, _ := withEndpoint(uniqDsHgtTrs, "", endpoint)
+		return uniqDsHgtTrsEp
+	}
+
 	replicateIds := params.ReplicateIDs
 	if params.ReplicateID != "" {
 		replicateIds = []string{params.ReplicateID}
@@ -115,218 +526,773 @@ func NewCrossValidateWorkflow(maxTasks int, params CrossValidateWorkflowParams)
 
 	for _, replID := range replicateIds {
 		replID := replID // Create local copy of variable to avoid access to global loop variable from closures
-		uniqRpl := fs("_%s", replID)
-
-		// ------------------------------------------------------------------------
-		// Generate signatures and filter substances
-		// ------------------------------------------------------------------------
-		genSign := NewGenSignFilterSubst(wf, "gensign"+uniqRpl,
-			GenSignFilterSubstConf{
-				replicateID: replID,
-				threadsCnt:  8,
-				minHeight:   params.MinHeight,
-				maxHeight:   params.MaxHeight,
-			})
-		genSign.InSmiles().From(mmTestData.Out())
-
-		// ------------------------------------------------------------------------
-		// Create a unique copy per run
-		// ------------------------------------------------------------------------
-		createRunCopy := wf.NewProc("create_runcopy"+uniqRpl, "cp {i:orig} {o:copy} # {p:runid}")
-		createRunCopy.SetOut("copy", fs("%s/{i:orig}", params.RunID))
-		createRunCopy.SetOutFunc("copy", func(t *sp.Task) string {
-			origPath := t.InPath("orig")
-			return filepath.Dir(origPath) + "/" + t.Param("runid") + "/" + filepath.Base(origPath)
-		})
-		createRunCopy.InParam("runid").FromStr(params.RunID)
-		createRunCopy.In("orig").From(genSign.OutSignatures())
+		uniqRpl := sweeps.Suffix(uniqDs, "replicate", replID, "_"+replID)
+		descriptorRowsSubstr := spcomp.NewStreamToSubStream(wf, "descriptor_rows"+uniqRpl)
 
 		// ------------------------------------------------------------------------
-		// Create a unique copy per replicate
+		// Loop over signature height ranges
 		// ------------------------------------------------------------------------
-		createReplCopy := wf.NewProc("create_replcopy_"+uniqRpl, "cp {i:orig} {o:copy} # {p:replid}")
-		createReplCopy.SetOutFunc("copy", func(t *sp.Task) string {
-			origPath := t.InPath("orig")
-			return filepath.Dir(origPath) + "/" + t.Param("replid") + "/" + filepath.Base(origPath)
-		})
-		createReplCopy.InParam("replid").FromStr(replID)
-		createReplCopy.In("orig").From(genSign.OutSignatures())
+		for _, heights := range heightRanges {
+			uniqRplHgt := sweeps.Suffix(uniqRpl, "heights", heights, fs("_h%d_%d", heights.Min, heights.Max))
 
-		// ------------------------------------------------------------------------
-		// Loop over sizes for the training set data
-		// ------------------------------------------------------------------------
-		for _, trainSize := range params.TrainSizes {
-			uniqRplTrs := uniqRpl + fs("_tr%d", trainSize)
-			selBestCostPerTrainSizeSubstr := spcomp.NewStreamToSubStream(wf, "select_cost"+uniqRplTrs)
 			// ------------------------------------------------------------------------
-			// Sample train and test
+			// Generate signatures and filter substances
 			// ------------------------------------------------------------------------
-			sampleTrainTest := NewSampleTrainAndTest(wf, "sample_train_test"+uniqRplTrs,
-				SampleTrainAndTestConf{
-					ReplicateID:    replID,
-					SamplingMethod: SamplingMethodRandom,
-					TrainSize:      trainSize,
-					TestSize:       params.TestSize,
+			genSign := mlcomp.NewGenSignFilterSubst(wf, "gensign"+uniqRplHgt,
+				mlcomp.GenSignFilterSubstConf{
+					ReplicateID: replID,
+					ThreadsCnt:  8,
+					MinHeight:   heights.Min,
+					MaxHeight:   heights.Max,
+					Engine:      params.SignatureEngine,
+					ToolPath:    params.tool("generatesignatures"),
+					JavaPath:    params.tool("java"),
 				})
-			sampleTrainTest.InSignatures().From(createReplCopy.Out("copy"))
+			genSign.InSmiles().From(standardize.OutStandardized())
 
 			// ------------------------------------------------------------------------
-			// Create sparse train dataset
+			// Create a unique copy per run
 			// ------------------------------------------------------------------------
-			sparseTrain := NewCreateSparseTrain(wf, "sparsetrain"+uniqRplTrs, CreateSparseTrainConf{
-				ReplicateID: replID,
+			createRunCopy := wf.NewProc("create_runcopy"+uniqRplHgt, "cp {i:orig} {o:copy} # {p:runid}")
+			createRunCopy.SetOut("copy", fs("%s/{i:orig}", params.RunID))
+			createRunCopy.SetOutFunc("copy", func(t *sp.Task) string {
+				origPath := t.InPath("orig")
+				return filepath.Dir(origPath) + "/" + t.Param("runid") + "/" + filepath.Base(origPath)
 			})
-			sparseTrain.InTraindata().From(sampleTrainTest.OutTraindata())
-			// Ad-hoc process to un-gzip the sparse train data file
-			gunzipSparseTrain := wf.NewProc("gunzip_sparsetrain"+uniqRplTrs, "zcat {i:orig} > {o:ungzipped}")
-			gunzipSparseTrain.In("orig").From(sparseTrain.OutSparseTraindata())
-			gunzipSparseTrain.SetOut("ungzipped", "{i:orig}.ungz")
+			createRunCopy.InParam("runid").FromStr(params.RunID)
+			createRunCopy.In("orig").From(genSign.OutSignatures())
 
 			// ------------------------------------------------------------------------
-			// Create sparse test dataset
+			// Create a unique copy per replicate
 			// ------------------------------------------------------------------------
-			sparseTest := NewCreateSparseTest(wf, "sparsetest"+uniqRplTrs, CreateSparseTestConf{
-				ReplicateID: replID,
+			createReplCopy := wf.NewProc("create_replcopy_"+uniqRplHgt, "cp {i:orig} {o:copy} # {p:replid}")
+			createReplCopy.SetOutFunc("copy", func(t *sp.Task) string {
+				origPath := t.InPath("orig")
+				return filepath.Dir(origPath) + "/" + t.Param("replid") + "/" + filepath.Base(origPath)
 			})
-			sparseTest.InTestdata().From(sampleTrainTest.OutTraindata())
-			sparseTest.InSignatures().From(sparseTrain.OutSignatures())
-			// Ad-hoc process to un-gzip the sparse train data file
-			gunzipSparseTest := wf.NewProc("gunzip_sparsetest"+uniqRplTrs, "zcat {i:orig} > {o:ungzipped}")
-			gunzipSparseTest.In("orig").From(sparseTest.OutSparseTestdata())
-			gunzipSparseTest.SetOut("ungzipped", "{i:orig}.ungz")
+			createReplCopy.InParam("replid").FromStr(replID)
+			createReplCopy.In("orig").From(genSign.OutSignatures())
 
-			// ------------------------------------------------------------------------
-			// Count train data
-			// ------------------------------------------------------------------------
-			cntTrainData := NewCountLines(wf, "cnttrain"+uniqRplTrs, CountLinesConf{})
-			cntTrainData.InFile().From(gunzipSparseTrain.Out("ungzipped"))
+			costRMSDsSubstrs := map[string]*spcomp.StreamToSubStream{}
+			yRandRowsSubstrs := map[string]*spcomp.StreamToSubStream{}
+			for _, endpoint := range endpoints {
+				uniqRplHgtEp, _ := withEndpoint(uniqRplHgt, "", endpoint)
+				costRMSDsSubstrs[endpoint] = spcomp.NewStreamToSubStream(wf, "cost_rmsds_substr"+uniqRplHgtEp)
+				if params.YRandomizations > 0 {
+					yRandRowsSubstrs[endpoint] = spcomp.NewStreamToSubStream(wf, "yrand_rows"+uniqRplHgtEp)
+				}
+			}
 
 			// ------------------------------------------------------------------------
-			// Generate random data
+			// Loop over sizes for the training set data
 			// ------------------------------------------------------------------------
-			genRandBytes := NewGenRandBytes(wf, "genrand"+uniqRplTrs,
-				GenRandBytesConf{
-					SizeMB:      params.RandomDataSizeMB,
+			for _, trainSize := range params.TrainSizes {
+				uniqRplTrs := sweeps.Suffix(uniqRplHgt, "train size", trainSize, fs("_tr%d", trainSize))
+				// ------------------------------------------------------------------------
+				// Sample train and test
+				// ------------------------------------------------------------------------
+				sampleTrainTest := mlcomp.NewSampleTrainAndTest(wf, "sample_train_test"+uniqRplTrs,
+					mlcomp.SampleTrainAndTestConf{
+						ReplicateID:     replID,
+						SamplingMethod:  samplingMethod,
+						TrainSize:       trainSize,
+						TestSize:        params.TestSize,
+						ClusterDistance: 0.4,
+						StrataCnt:       10,
+						ToolPath:        params.tool(samplingTool),
+						JavaPath:        params.tool("java"),
+					})
+				sampleTrainTest.InSignatures().From(createReplCopy.Out("copy"))
+				if samplingMethod == mlcomp.SamplingMethodTemporal {
+					sampleTrainTest.InDates().From(compoundIDs)
+				}
+
+				// Fail if any compound ends up in both the train and test data
+				checkSampleLeakage := mlcomp.NewCheckLeakage(wf, "check_leakage"+uniqRplTrs, mlcomp.CheckLeakageConf{
+					KeyBy:   mlcomp.LeakageKeySMILES,
+					WithIDs: compoundIDs != nil,
+				})
+				checkSampleLeakage.InTrain().From(sampleTrainTest.OutTraindata())
+				checkSampleLeakage.InTest().From(sampleTrainTest.OutTestdata())
+				if compoundIDs != nil {
+					checkSampleLeakage.InIDs().From(compoundIDs)
+				}
+
+				// ------------------------------------------------------------------------
+				// Create sparse train dataset
+				// ------------------------------------------------------------------------
+				sparseTrain := mlcomp.NewCreateSparseTrain(wf, "sparsetrain"+uniqRplTrs, mlcomp.CreateSparseTrainConf{
 					ReplicateID: replID,
+					Engine:      params.SignatureEngine,
+					ToolPath:    params.tool("createsparsedataset"),
+					JavaPath:    params.tool("java"),
 				})
-			genRandBytes.InBasePath().From(gunzipSparseTrain.Out("ungzipped"))
+				sparseTrain.InTraindata().From(sampleTrainTest.OutTraindata())
+				// Ad-hoc process to un-gzip the sparse train data file
+				gunzipSparseTrain := wf.NewProc("gunzip_sparsetrain"+uniqRplTrs, "zcat {i:orig} > {o:ungzipped}")
+				gunzipSparseTrain.In("orig").From(sparseTrain.OutSparseTraindata())
+				gunzipSparseTrain.SetOut("ungzipped", "{i:orig}.ungz")
 
-			// ------------------------------------------------------------------------
-			// Shuffle train data
-			// ------------------------------------------------------------------------
-			shufTrain := NewShuffleLines(wf, "shuftrain"+uniqRplTrs, ShuffleLinesConf{})
-			shufTrain.InData().From(gunzipSparseTrain.Out("ungzipped"))
-			shufTrain.InRandBytes().From(genRandBytes.OutRandBytes())
+				// ------------------------------------------------------------------------
+				// Create sparse test dataset
+				// ------------------------------------------------------------------------
+				sparseTest := mlcomp.NewCreateSparseTest(wf, "sparsetest"+uniqRplTrs, mlcomp.CreateSparseTestConf{
+					ReplicateID: replID,
+					Engine:      params.SignatureEngine,
+					ToolPath:    params.tool("createsparsedataset"),
+					JavaPath:    params.tool("java"),
+				})
+				sparseTest.InTestdata().From(sampleTrainTest.OutTestdata())
+				sparseTest.InSignatures().From(sparseTrain.OutSignatures())
+				// Ad-hoc process to un-gzip the sparse train data file
+				gunzipSparseTest := wf.NewProc("gunzip_sparsetest"+uniqRplTrs, "zcat {i:orig} > {o:ungzipped}")
+				gunzipSparseTest.In("orig").From(sparseTest.OutSparseTestdata())
+				gunzipSparseTest.SetOut("ungzipped", "{i:orig}.ungz")
 
-			// ------------------------------------------------------------------------
-			// Loop over cost values to try
-			// ------------------------------------------------------------------------
-			for _, cost := range params.CostVals {
-				uniqRplTrsCst := uniqRplTrs + fs("_c%f", cost)
-				avgRMSDPerCostSubstr := spcomp.NewStreamToSubStream(wf, "cost_substr"+uniqRplTrsCst)
+				// ------------------------------------------------------------------------
+				// Export the train and test sets for use with other tools
+				// ------------------------------------------------------------------------
+				if params.Export {
+					exportDataset := mlcomp.NewExportDataset(wf, "export"+uniqRplTrs, mlcomp.ExportDatasetConf{
+						WithIDs:       compoundIDs != nil,
+						MaxDenseCells: 10000000,
+					})
+					exportDataset.InTrainData().From(gunzipSparseTrain.Out("ungzipped"))
+					exportDataset.InTestData().From(gunzipSparseTest.Out("ungzipped"))
+					exportDataset.InTrainSigns().From(sampleTrainTest.OutTraindata())
+					exportDataset.InTestSigns().From(sampleTrainTest.OutTestdata())
+					exportDataset.InSignatures().From(sparseTrain.OutSignatures())
+					if compoundIDs != nil {
+						exportDataset.InIDs().From(compoundIDs)
+					}
+				}
 
 				// ------------------------------------------------------------------------
-				// Loop over cross validation folds
+				// Branch per endpoint, for multi-endpoint datasets. The signatures
+				// and sparse datasets above are shared by all endpoints.
 				// ------------------------------------------------------------------------
-				for foldIdx := 0; foldIdx < params.FoldsCount; foldIdx++ {
-					uniqRplTrsCstFld := uniqRplTrsCst + fs("_fld%d", foldIdx)
-					createFolds := NewCreateFolds(wf, "createfolds"+uniqRplTrsCstFld,
-						CreateFoldsConf{
-							FoldIdx:  foldIdx,
-							FoldsCnt: params.FoldsCount,
-							// Seed?
+				for _, endpoint := range endpoints {
+					endpoint := endpoint // Create local copy of variable to avoid access to global loop variable from closures
+					uniqRplTrsEp, cfgDesc := withEndpoint(uniqRplTrs, fs("replicate %s, heights %s, train size %d", replID, heights, trainSize), endpoint)
+					trainData, testData := gunzipSparseTrain.Out("ungzipped"), gunzipSparseTest.Out("ungzipped")
+					trainSigns, testSigns := sampleTrainTest.OutTraindata(), sampleTrainTest.OutTestdata()
+					if endpoint != "" {
+						selectTrain := mlcomp.NewSelectEndpoint(wf, "select_endpoint_train"+uniqRplTrsEp, mlcomp.SelectEndpointConf{Endpoint: endpoint})
+						selectTrain.InSparse().From(trainData)
+						selectTrain.InSignatures().From(trainSigns)
+						selectTrain.InEndpoints().From(endpointsTable)
+						selectTest := mlcomp.NewSelectEndpoint(wf, "select_endpoint_test"+uniqRplTrsEp, mlcomp.SelectEndpointConf{Endpoint: endpoint})
+						selectTest.InSparse().From(testData)
+						selectTest.InSignatures().From(testSigns)
+						selectTest.InEndpoints().From(endpointsTable)
+						trainData, testData = selectTrain.OutSparse(), selectTest.OutSparse()
+						trainSigns, testSigns = selectTrain.OutSignatures(), selectTest.OutSignatures()
+					}
+					// ------------------------------------------------------------------------
+					// Find best cost with cross-validation, and train final model
+					// ------------------------------------------------------------------------
+					resultKeys := mlcomp.ResultKeys{
+						RunID:     params.RunID,
+						Dataset:   params.DatasetName,
+						Replicate: replID,
+						Heights:   heights.String(),
+						TrainSize: trainSize,
+						Endpoint:  endpoint,
+					}
+					finalModel := newGridSearchAndFinalModel(wf, params, sweeps, resultKeys, uniqRplTrsEp, trainData, trainSigns, compoundIDs, testData)
+
+					// Rows of multi-endpoint datasets end with the endpoint
+					endpointCol := ""
+					if endpoint != "" {
+						endpointCol = `"\t{p:endpoint}"`
+					}
+					resultRow := wf.NewProc("result_row"+uniqRplTrsEp, `awk 'FNR == NR { cvrmsd = $2; cost = $3; next } `+
+						`{ print "{p:dataset}\t{p:replid}\t{p:heights}\t{p:trainsize}\t" cost "\t" cvrmsd "\t" $1 `+endpointCol+` }' {i:bestcost} {i:testrmsd} > {o:row}`)
+					if endpoint != "" {
+						resultRow.InParam("endpoint").FromStr(endpoint)
+					}
+					resultRow.InParam("dataset").FromStr(params.DatasetName)
+					resultRow.InParam("replid").FromStr(replID)
+					resultRow.InParam("heights").FromStr(heights.String())
+					resultRow.InParam("trainsize").FromInt(trainSize)
+					resultRow.In("bestcost").From(finalModel.bestCost.Out("bestcost"))
+					resultRow.In("testrmsd").From(finalModel.assess.OutRMSDCost())
+					resultRow.SetOut("row", dsDir+"results/results"+uniqRplTrsEp+".tsv")
+					descriptorRowsSubstr.In().From(resultRow.Out("row"))
+
+					// ------------------------------------------------------------------------
+					// Track the final model and its cost grid in MLflow
+					// ------------------------------------------------------------------------
+					if params.MLflowDir != "" {
+						trackMLflow := mlcomp.NewTrackMLflow(wf, "track_mlflow"+uniqRplTrsEp, mlcomp.TrackMLflowConf{
+							Dir:        params.MLflowDir,
+							Experiment: params.DatasetName,
+							Keys:       resultKeys,
+							Params: map[string]string{
+								"folds":            fs("%d", params.FoldsCount),
+								"sampling_method":  string(samplingMethod),
+								"signature_engine": string(params.SignatureEngine),
+								"solver_type":      fs("%d", params.SolverType),
+								"test_size":        fs("%d", params.TestSize),
+							},
 						})
-					createFolds.InData().From(shufTrain.OutShuffled())
-					createFolds.InLineCnt().From(cntTrainData.OutLineCount())
-
-					// ----------------------------------------------------------------
-					// Train
-					// ----------------------------------------------------------------
-					trainLibLin := NewTrainLibLinear(wf, "train"+uniqRplTrsCstFld,
-						TrainLibLinearConf{
-							ReplicateID: replID,
-							Cost:        cost,
-							SolverType:  params.SolverType,
+						trackMLflow.InModel().From(finalModel.train.OutModel())
+						trackMLflow.InSignatures().From(sparseTrain.OutSignatures())
+						trackMLflow.InCostRMSDs().From(finalModel.costRMSDs.Out("costrmsds"))
+						trackMLflow.InBestCost().From(finalModel.bestCost.Out("bestcost"))
+						trackMLflow.InTestRMSD().From(finalModel.assess.OutRMSDCost())
+					}
+					resultRowsSubstr.In().From(resultRow.Out("row"))
+
+					// ------------------------------------------------------------------------
+					// Compare the selected cost with the other costs
+					// ------------------------------------------------------------------------
+					compareCosts := mlcomp.NewCompareCosts(wf, "compare_costs"+uniqRplTrsEp, mlcomp.CompareCostsConf{
+						Title: "Cost selection, " + cfgDesc,
+					})
+					compareCosts.InCostRMSDs().From(finalModel.costRMSDs.Out("costrmsds"))
+					compareCosts.InBestCost().From(finalModel.bestCost.Out("bestcost"))
+					runReport.InSection().From(compareCosts.OutComparison())
+					costRMSDsSubstrs[endpoint].In().From(finalModel.costRMSDs.Out("costrmsds"))
+
+					// ------------------------------------------------------------------------
+					// Out-of-fold predictions for the selected cost, with residuals
+					// ------------------------------------------------------------------------
+					oofReport := mlcomp.NewOOFReport(wf, "oof_report"+uniqRplTrsEp, mlcomp.OOFReportConf{
+						Title:    "Out-of-fold predictions, " + cfgDesc,
+						WithIDs:  compoundIDs != nil,
+						WorstCnt: 20,
+					})
+					oofReport.InOOF().From(finalModel.oofCollect.Out("oof"))
+					oofReport.InBestCost().From(finalModel.bestCost.Out("bestcost"))
+					oofReport.InTrainData().From(trainData)
+					oofReport.InTrainSigns().From(trainSigns)
+					if compoundIDs != nil {
+						oofReport.InIDs().From(compoundIDs)
+					}
+					runReport.InSection().From(oofReport.OutSummary())
+
+					// ------------------------------------------------------------------------
+					// Annotate test set predictions with the applicability domain
+					// ------------------------------------------------------------------------
+					appDomainConf := params.AppDomain
+					appDomainConf.Title = "Applicability domain, " + cfgDesc
+					appDomain := mlcomp.NewApplicabilityDomain(wf, "appdomain"+uniqRplTrsEp, appDomainConf)
+					appDomain.InTrainData().From(trainData)
+					appDomain.InSignatures().From(sparseTrain.OutSignatures())
+					appDomain.InTestData().From(testSigns)
+					appDomain.InPrediction().From(finalModel.pred.OutPrediction())
+					runReport.InSection().From(appDomain.OutSummary())
+
+					// ------------------------------------------------------------------------
+					// Bagged ensembles of final models
+					// ------------------------------------------------------------------------
+					switch params.Ensemble.Method {
+					case mlcomp.EnsembleBootstrap:
+						ensembleMembersSubstr := spcomp.NewStreamToSubStream(wf, "ensemble_member_rows"+uniqRplTrsEp)
+						for memberIdx := 1; memberIdx <= params.Ensemble.Size; memberIdx++ {
+							uniqRplTrsEpBs := sweeps.Suffix(uniqRplTrsEp, "ensemble member", memberIdx, fs("_bs%d", memberIdx))
+							bootstrap := mlcomp.NewBootstrap(wf, "bootstrap"+uniqRplTrsEpBs, mlcomp.BootstrapConf{
+								Seed: int64(memberIdx),
+							})
+							bootstrap.InData().From(trainData)
+							trainMember := mlcomp.NewTrainLibLinear(wf, "train_member"+uniqRplTrsEpBs, mlcomp.TrainLibLinearConf{
+								ReplicateID: replID,
+								SolverType:  params.SolverType,
+								ToolPath:    params.tool("lin-train"),
+								TimePath:    params.tool("time"),
+							})
+							trainMember.InTrainData().From(bootstrap.OutSample())
+							trainMember.InParam("cost").From(finalModel.cost)
+							ensembleMembersSubstr.In().From(newEnsembleMemberRow(wf, "ensemble_member"+uniqRplTrsEpBs, trainMember.OutModel(), sparseTrain.OutSignatures()))
+						}
+						ensembleBundle := newEnsembleBundleFromRows(wf, params, resultKeys, uniqRplTrsEp, ensembleMembersSubstr)
+						predEnsemble := mlcomp.NewPredictEnsemble(wf, "pred_ensemble"+uniqRplTrsEp, mlcomp.PredictEnsembleConf{
+							Title: "Bootstrap ensemble, " + cfgDesc,
 						})
-					trainLibLin.InTrainData().From(createFolds.OutTrainData())
-
-					// ----------------------------------------------------------------
-					// Predict
-					// ----------------------------------------------------------------
-					predLibLin := NewPredictLibLinear(wf, "pred"+uniqRplTrsCstFld,
-						PredictLibLinearConf{
-							ReplicateID: replID,
+						predEnsemble.InBundle().From(ensembleBundle.OutBundle())
+						predEnsemble.InCompounds().From(testSigns)
+						runReport.InSection().From(predEnsemble.OutSummary())
+						ensembleAppDomainConf := params.AppDomain
+						ensembleAppDomainConf.Title = "Applicability domain, bootstrap ensemble, " + cfgDesc
+						ensembleAppDomain := mlcomp.NewApplicabilityDomain(wf, "appdomain_ensemble"+uniqRplTrsEp, ensembleAppDomainConf)
+						ensembleAppDomain.InTrainData().From(trainData)
+						ensembleAppDomain.InSignatures().From(sparseTrain.OutSignatures())
+						ensembleAppDomain.InTestData().From(testSigns)
+						ensembleAppDomain.InPrediction().From(predEnsemble.OutPrediction())
+						runReport.InSection().From(ensembleAppDomain.OutSummary())
+					case mlcomp.EnsembleReplicate:
+						uniqHgtTrsEp := uniqDsHgtTrsEp(heights, trainSize, endpoint)
+						if replEnsembleMembers[uniqHgtTrsEp] == nil {
+							replEnsembleMembers[uniqHgtTrsEp] = spcomp.NewStreamToSubStream(wf, "ensemble_member_rows"+uniqHgtTrsEp)
+						}
+						replEnsembleMembers[uniqHgtTrsEp].In().From(newEnsembleMemberRow(wf, "ensemble_member"+uniqRplTrsEp, finalModel.train.OutModel(), sparseTrain.OutSignatures()))
+						if replID == replicateIds[0] {
+							replEnsembleData[uniqHgtTrsEp] = replicateEnsembleData{trainData, sparseTrain.OutSignatures(), testSigns}
+						}
+					}
+
+					// ------------------------------------------------------------------------
+					// Model card for the final model
+					// ------------------------------------------------------------------------
+					modelCard := mlcomp.NewModelCard(wf, "model_card"+uniqRplTrsEp, mlcomp.ModelCardConf{
+						Keys:            resultKeys,
+						DatasetSource:   params.DatasetSource,
+						SamplingMethod:  samplingMethod,
+						SignatureEngine: params.SignatureEngine,
+						SolverType:      params.SolverType,
+						FoldsCount:      params.FoldsCount,
+						TestSize:        params.TestSize,
+					})
+					modelCard.InDataset().From(dataset)
+					modelCard.InModel().From(finalModel.train.OutModel())
+					modelCard.InCostRMSDs().From(finalModel.costRMSDs.Out("costrmsds"))
+					modelCard.InBestCost().From(finalModel.bestCost.Out("bestcost"))
+					modelCard.InTestRMSD().From(finalModel.assess.OutRMSDCost())
+					modelCard.InAppDomainSummary().From(appDomain.OutSummary())
+
+					// ------------------------------------------------------------------------
+					// Map model weights back to signatures
+					// ------------------------------------------------------------------------
+					if params.InterpretTopN > 0 {
+						interpret := mlcomp.NewInterpretModel(wf, "interpret"+uniqRplTrsEp, mlcomp.InterpretModelConf{
+							TopN:      params.InterpretTopN,
+							Compounds: params.ExplainCompounds,
+							Engine:    params.SignatureEngine,
+							MinHeight: heights.Min,
+							MaxHeight: heights.Max,
 						})
-					predLibLin.InModel().From(trainLibLin.OutModel())
-					predLibLin.InTestData().From(createFolds.OutTestData())
+						interpret.InModel().From(finalModel.train.OutModel())
+						interpret.InSignatures().From(sparseTrain.OutSignatures())
+					}
 
-					// ----------------------------------------------------------------
-					// Assess
-					// ----------------------------------------------------------------
-					assessLibLin := NewAssessLibLinear(wf, "assess"+uniqRplTrsCstFld, AssessLibLinearConf{})
-					assessLibLin.InTestData().From(createFolds.OutTestData())
-					assessLibLin.InPrediction().From(predLibLin.OutPrediction())
-					assessLibLin.InParamCost().FromFloat(cost)
+					// ------------------------------------------------------------------------
+					// Y-randomization: The same grid search and final model, but with
+					// scrambled responses in the train data
+					// ------------------------------------------------------------------------
+					if params.YRandomizations > 0 {
+						yRandRMSDsSubstr := spcomp.NewStreamToSubStream(wf, "yrand_rmsds"+uniqRplTrsEp)
+						for yRandIdx := 1; yRandIdx <= params.YRandomizations; yRandIdx++ {
+							uniqRplTrsEpYRnd := sweeps.Suffix(uniqRplTrsEp, "y-randomization", yRandIdx, fs("_yrnd%d", yRandIdx))
+							scrambleTrain := mlcomp.NewScrambleResponse(wf, "scramble"+uniqRplTrsEpYRnd, mlcomp.ScrambleResponseConf{
+								Seed:  yRandSeed(uniqRplTrsEpYRnd),
+								Index: yRandIdx,
+							})
+							scrambleTrain.InData().From(trainData)
+							yRandKeys := resultKeys
+							yRandKeys.Variant = fs("yrnd%d", yRandIdx)
+							scrambledModel := newGridSearchAndFinalModel(wf, params, sweeps, yRandKeys, uniqRplTrsEpYRnd,
+								scrambleTrain.OutScrambled(),
+								trainSigns,
+								compoundIDs,
+								testData)
+							yRandRMSDsSubstr.In().From(scrambledModel.assess.OutRMSDCost())
+						}
+						// Compare the real final RMSD to the distribution of scrambled ones.
+						// The p-value is the fraction of scrambled models at least as good.
+						yRandRow := wf.NewProc("yrand_row"+uniqRplTrsEp, `real=$(cut -f1 {i:real}) && cat {i:scrambled|join: } | `+
+							`awk -v real=$real '{ x = $1; n++; s += x; ss += x*x; if (n == 1 || x < min) min = x; if (n == 1 || x > max) max = x; if (x <= real) le++ } `+
+							`END { m = s/n; sd = sqrt((ss - n*m*m) / (n > 1 ? n-1 : 1)); `+
+							`printf "| %d | %g | %d | %g | %g | %g | %g | %.3f |\n", {p:trainsize}, real, n, m, sd, min, max, (le+1)/(n+1) }' > {o:row}`)
+						yRandRow.InParam("trainsize").FromInt(trainSize)
+						yRandRow.In("real").From(finalModel.assess.OutRMSDCost())
+						yRandRow.In("scrambled").From(yRandRMSDsSubstr.OutSubStream())
+						yRandRow.SetOut("row", dsDir+"yrand/yrand"+uniqRplTrsEp+".row.md")
+						yRandRowsSubstrs[endpoint].In().From(yRandRow.Out("row"))
+					}
+				} // end for endpoint
+			} // end for train size
 
-					avgRMSDPerCostSubstr.In().From(assessLibLin.OutRMSDCost())
-				} // end for foldIdx
+			for _, endpoint := range endpoints {
+				uniqRplHgtEp, hgtDesc := withEndpoint(uniqRplHgt, fs("replicate %s, heights %s", replID, heights), endpoint)
+				costRMSDsAll := wf.NewProc("cost_rmsds_all"+uniqRplHgtEp, "cat {i:costrmsds|join: } > {o:costrmsds}")
+				costRMSDsAll.SetOut("costrmsds", dsDir+"best_cost/cost_rmsds"+uniqRplHgtEp+".tsv")
+				costRMSDsAll.In("costrmsds").From(costRMSDsSubstrs[endpoint].OutSubStream())
+				costHeatmap := mlcomp.NewCostHeatmap(wf, "cost_heatmap"+uniqRplHgtEp, mlcomp.CostHeatmapConf{
+					Title:     "Cross-validation RMSD, " + hgtDesc,
+					ReportDir: filepath.Dir(reportPath),
+				})
+				costHeatmap.InCostRMSDs().From(costRMSDsAll.Out("costrmsds"))
+				runReport.InSection().From(costHeatmap.OutSection())
 
-				avgRMSD := wf.NewProc("avg_rmsd"+uniqRplTrsCst, `cat {i:rmsdcost|join: } | awk '{ c += $1; n++ } END { print c / n "\t" {p:cost} }' > {o:avgrmsd}`)
-				avgRMSD.SetOut("avgrmsd", "data/avg_rmsd/avg_rmsd"+uniqRplTrsCst+".txt")
-				avgRMSD.InParam("cost").FromFloat(cost)
-				avgRMSD.In("rmsdcost").From(avgRMSDPerCostSubstr.OutSubStream())
+				if params.YRandomizations > 0 {
+					yRandSection := wf.NewProc("yrand_section"+uniqRplHgtEp, `(echo "## Y-randomization, {p:desc}" && echo && `+
+						`echo "Final model RMSD on the test set, for models trained on real and scrambled responses." && echo && `+
+						`echo "| Train size | Real RMSD | Scrambled runs | Scrambled mean | Scrambled SD | Scrambled min | Scrambled max | p |" && `+
+						`echo "|---:|---:|---:|---:|---:|---:|---:|---:|" && `+
+						`cat {i:rows|join: } | sort -n -t'|' -k2 && echo) > {o:section}`)
+					yRandSection.InParam("desc").FromStr(hgtDesc)
+					yRandSection.In("rows").From(yRandRowsSubstrs[endpoint].OutSubStream())
+					yRandSection.SetOut("section", dsDir+"yrand/yrand"+uniqRplHgtEp+".md")
+					runReport.InSection().From(yRandSection.Out("section"))
+				}
+			} // end for endpoint
+		} // end for height range
 
-				selBestCostPerTrainSizeSubstr.In().From(avgRMSD.Out("avgrmsd"))
-			} // end for cost
+		// ------------------------------------------------------------------------
+		// Compare the height ranges, and the endpoints of multi-endpoint
+		// datasets
+		// ------------------------------------------------------------------------
+		descriptorCmd := `(echo "## Signature height ranges, replicate {p:replid}" && echo && ` +
+			`echo "Cross-validation RMSD for the selected cost, and final model RMSD on the test set, per height range and train size." && echo && ` +
+			`echo "| Heights | Train size | Selected cost | CV RMSD | Test RMSD |" && ` +
+			`echo "|---|---:|---:|---:|---:|" && ` +
+			`cat {i:rows|join: } | sort -t$'\t' -k4,4n -k3,3 | awk -F'\t' '{ print "| " $3 " | " $4 " | " $5 " | " $6 " | " $7 " |" }' && echo) > {o:section}`
+		if len(params.Endpoints) > 0 {
+			descriptorCmd = `(echo "## Endpoints and signature height ranges, replicate {p:replid}" && echo && ` +
+				`echo "Cross-validation RMSD for the selected cost, and final model RMSD on the test set, per endpoint, height range and train size." && echo && ` +
+				`echo "| Endpoint | Heights | Train size | Selected cost | CV RMSD | Test RMSD |" && ` +
+				`echo "|---|---|---:|---:|---:|---:|" && ` +
+				`cat {i:rows|join: } | sort -t$'\t' -k8,8 -k4,4n -k3,3 | awk -F'\t' '{ print "| " $8 " | " $3 " | " $4 " | " $5 " | " $6 " | " $7 " |" }' && echo) > {o:section}`
+		}
+		descriptorSection := wf.NewProc("descriptor_section"+uniqRpl, descriptorCmd)
+		descriptorSection.InParam("replid").FromStr(replID)
+		descriptorSection.In("rows").From(descriptorRowsSubstr.OutSubStream())
+		descriptorSection.SetOut("section", dsDir+"descriptors/descriptors"+uniqRpl+".md")
+		runReport.InSection().From(descriptorSection.Out("section"))
+	} // end for replicate id
 
-			// ----------------------------------------------------------------
-			// Select best cost
-			// ----------------------------------------------------------------
-			selBestCostPerTrainSize := wf.NewProc("selbestcost"+uniqRplTrs, `cat {i:rmsdcost|join: } | awk 'BEGIN { rmsd = 1 } ($1 < rmsd) { rmsd = $1; cost = $2 } END { print {p:trainsize} "\t" rmsd "\t" cost }' > {o:bestcost}`)
-			selBestCostPerTrainSize.InParam("trainsize").FromInt(trainSize)
-			selBestCostPerTrainSize.SetOut("bestcost", "data/best_cost/"+uniqRplTrs+"/best_cost"+uniqRplTrs+".txt")
-			selBestCostPerTrainSize.In("rmsdcost").From(selBestCostPerTrainSizeSubstr.OutSubStream())
-
-			costFileToParam := wf.NewProc("cost_filetoparam"+uniqRplTrs, "# {i:costfile}")
-			costFileToParam.InitOutParamPort(costFileToParam, "costparam")
-			costFileToParam.CustomExecute = func(t *sp.Task) {
-				fileBytes := t.InIP("costfile").Read()
-				fileStr := strings.Trim(string(fileBytes), " \n")
-				parts := strings.Split(fileStr, "	")
-				cost := parts[2]
-				t.Process.OutParam("costparam").Send(cost)
+	// Replicate ensembles are bundled when the final models of all replicates
+	// are done, and predict the test set of the first replicate
+	for _, heights := range heightRanges {
+		for _, trainSize := range params.TrainSizes {
+			for _, endpoint := range endpoints {
+				uniqHgtTrsEp := uniqDsHgtTrsEp(heights, trainSize, endpoint)
+				members := replEnsembleMembers[uniqHgtTrsEp]
+				if members == nil {
+					continue
+				}
+				ensembleBundle := newEnsembleBundleFromRows(wf, params, mlcomp.ResultKeys{
+					RunID:     params.RunID,
+					Dataset:   params.DatasetName,
+					Heights:   heights.String(),
+					TrainSize: trainSize,
+					Endpoint:  endpoint,
+				}, uniqHgtTrsEp, members)
+				ensDesc := fs("heights %s, train size %d", heights, trainSize)
+				if endpoint != "" {
+					ensDesc += ", endpoint " + endpoint
+				}
+				predEnsemble := mlcomp.NewPredictEnsemble(wf, "pred_ensemble"+uniqHgtTrsEp, mlcomp.PredictEnsembleConf{
+					Title: "Replicate ensemble, " + ensDesc,
+					Note: fs("Predictions for the test set of replicate %s. The members of the other replicates were trained on "+
+						"their own samples, which may include some of these compounds, so the errors are optimistic.", replicateIds[0]),
+				})
+				predEnsemble.InBundle().From(ensembleBundle.OutBundle())
+				predEnsemble.InCompounds().From(replEnsembleData[uniqHgtTrsEp].testSigns)
+				runReport.InSection().From(predEnsemble.OutSummary())
+				// The domain is that of the first replicate's train data
+				ensembleAppDomainConf := params.AppDomain
+				ensembleAppDomainConf.Title = fs("Applicability domain, replicate ensemble, %s, train data of replicate %s", ensDesc, replicateIds[0])
+				ensembleAppDomain := mlcomp.NewApplicabilityDomain(wf, "appdomain_ensemble"+uniqHgtTrsEp, ensembleAppDomainConf)
+				ensembleAppDomain.InTrainData().From(replEnsembleData[uniqHgtTrsEp].trainData)
+				ensembleAppDomain.InSignatures().From(replEnsembleData[uniqHgtTrsEp].trainSignatures)
+				ensembleAppDomain.InTestData().From(replEnsembleData[uniqHgtTrsEp].testSigns)
+				ensembleAppDomain.InPrediction().From(predEnsemble.OutPrediction())
+				runReport.InSection().From(ensembleAppDomain.OutSummary())
 			}
-			costFileToParam.In("costfile").From(selBestCostPerTrainSize.Out("bestcost"))
+		}
+	}
+
+	results := wf.NewProc("results"+uniqDs, "cat {i:rows|join: } > {o:results}")
+	results.SetOut("results", fs("%s%s/results.tsv", dsDir, params.RunID))
+	results.In("rows").From(resultRowsSubstr.OutSubStream())
+	return &crossValidationProcs{
+		report:  runReport,
+		results: results,
+	}
+}
+
+// yRandSeed returns the seed for scrambling the responses of the
+// Y-randomization run with the unique suffix uniq, which differs between
+// replicates, height ranges, train sizes and endpoints, so that equal-sized
+// train sets are not scrambled with the same permutation
+func yRandSeed(uniq string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(uniq))
+	return int64(h.Sum64() >> 1)
+}
 
-			// --------------------------------------------------------------------------------
-			// Main training and assessment
-			// --------------------------------------------------------------------------------
+// replicateEnsembleData is the data of the first replicate, that replicate
+// ensembles are applied to: the sparse train data, the signatures file of its
+// columns, and the test compounds
+type replicateEnsembleData struct {
+	trainData       *sp.OutPort
+	trainSignatures *sp.OutPort
+	testSigns       *sp.OutPort
+}
+
+// newEnsembleMemberRow adds a process writing the paths of an ensemble member
+// model and its signatures file on a line, for EnsembleBundle
+func newEnsembleMemberRow(wf *sp.Workflow, name string, model *sp.OutPort, signatures *sp.OutPort) *sp.OutPort {
+	memberRow := wf.NewProc(name, `printf '%s\t%s\n' {i:model} {i:signatures} > {o:row}`)
+	memberRow.In("model").From(model)
+	memberRow.In("signatures").From(signatures)
+	memberRow.SetOut("row", "{i:model}.member")
+	return memberRow.Out("row")
+}
+
+// newEnsembleBundleFromRows adds processes collecting the ensemble member rows
+// in memberRows, and bundling the members
+func newEnsembleBundleFromRows(wf *sp.Workflow, params CrossValidateWorkflowParams, keys mlcomp.ResultKeys, uniq string, memberRows *spcomp.StreamToSubStream) *mlcomp.EnsembleBundle {
+	members := wf.NewProc("ensemble_members"+uniq, "cat {i:rows|join: } > {o:members}")
+	members.In("rows").From(memberRows.OutSubStream())
+	members.SetOut("members", params.dataDir()+"final_models/ensemble"+uniq+".members.tsv")
+	bundle := mlcomp.NewEnsembleBundle(wf, "ensemble_bundle"+uniq, mlcomp.EnsembleBundleConf{
+		Method: params.Ensemble.Method,
+		Keys:   keys,
+	})
+	bundle.InMembers().From(members.Out("members"))
+	return bundle
+}
+
+// newGridSearchAndFinalModel adds processes for finding the best cost value
+// with cross-validation on trainData, for training a final model on all of
+// trainData with that cost, and for assessing the final model on testData.
+// TrainSigns is the signatures file trainData was created from, which
+// identifies the compounds in the folds. CompoundIDs, if not nil, is the
+// compound ID file of the dataset, and the folds are then also checked for
+// compound IDs in both train and test data. If params.ResultsDB is set, the
+// results are also recorded in a SQLite database, with keys. It returns the
+// processes for the final model.
+func newGridSearchAndFinalModel(wf *sp.Workflow, params CrossValidateWorkflowParams, sweeps *sweepgraph.Sweeps, keys mlcomp.ResultKeys, uniqRplTrs string, trainData *sp.OutPort, trainSigns *sp.OutPort, compoundIDs *sp.OutPort, testData *sp.OutPort) *finalModelProcs {
+	dsDir := params.dataDir()
+	recordResult := func(name string, kind mlcomp.ResultKind, result *sp.OutPort) {
+		if params.ResultsDB {
+			record := mlcomp.NewRecordResults(wf, name, mlcomp.RecordResultsConf{
+				DBPath:     fs("%s%s/results.sqlite", dsDir, params.RunID),
+				Kind:       kind,
+				Keys:       keys,
+				SQLitePath: params.tool("sqlite3"),
+			})
+			record.InResult().From(result)
+		}
+	}
+	selBestCostPerTrainSizeSubstr := spcomp.NewStreamToSubStream(wf, "select_cost"+uniqRplTrs)
+	oofPredsSubstr := spcomp.NewStreamToSubStream(wf, "oof_substr"+uniqRplTrs)
+
+	// ------------------------------------------------------------------------
+	// Count train data
+	// ------------------------------------------------------------------------
+	cntTrainData := mlcomp.NewCountLines(wf, "cnttrain"+uniqRplTrs, mlcomp.CountLinesConf{})
+	cntTrainData.InFile().From(trainData)
+
+	// ------------------------------------------------------------------------
+	// Generate random data
+	// ------------------------------------------------------------------------
+	genRandBytes := mlcomp.NewGenRandBytes(wf, "genrand"+uniqRplTrs,
+		mlcomp.GenRandBytesConf{
+			SizeMB:      params.RandomDataSizeMB,
+			ReplicateID: keys.Replicate,
+		})
+	genRandBytes.InBasePath().From(trainData)
+
+	// ------------------------------------------------------------------------
+	// Shuffle train data
+	// ------------------------------------------------------------------------
+	shufTrain := mlcomp.NewShuffleLines(wf, "shuftrain"+uniqRplTrs, mlcomp.ShuffleLinesConf{})
+	shufTrain.InData().From(trainData)
+	shufTrain.InRandBytes().From(genRandBytes.OutRandBytes())
+
+	// The compounds of the train rows, shuffled in the same order, as shuf
+	// permutes files with the same number of lines and random bytes the same
+	// way, to identify the compounds in the folds
+	compoundRows := mlcomp.NewCompoundRows(wf, "compound_rows"+uniqRplTrs, mlcomp.CompoundRowsConf{})
+	compoundRows.InData().From(trainData)
+	compoundRows.InSignatures().From(trainSigns)
+	shufRows := mlcomp.NewShuffleLines(wf, "shufrows"+uniqRplTrs, mlcomp.ShuffleLinesConf{})
+	shufRows.InData().From(compoundRows.OutRows())
+	shufRows.InRandBytes().From(genRandBytes.OutRandBytes())
+
+	// The compounds of each fold, which are the same for all costs, checked
+	// for leakage between the train and test parts
+	foldRows := []*mlcomp.CreateFolds{}
+	for foldIdx := 0; foldIdx < params.FoldsCount; foldIdx++ {
+		uniqRplTrsFld := sweeps.Suffix(uniqRplTrs, "fold", foldIdx, fs("_fld%d", foldIdx))
+		createFoldRows := mlcomp.NewCreateFolds(wf, "createfoldrows"+uniqRplTrsFld,
+			mlcomp.CreateFoldsConf{
+				FoldIdx:  foldIdx,
+				FoldsCnt: params.FoldsCount,
+			})
+		createFoldRows.InData().From(shufRows.OutShuffled())
+		createFoldRows.InLineCnt().From(cntTrainData.OutLineCount())
+
+		checkFoldLeakage := mlcomp.NewCheckLeakage(wf, "check_leakage"+uniqRplTrsFld, mlcomp.CheckLeakageConf{
+			KeyBy:   mlcomp.LeakageKeySMILES,
+			WithIDs: compoundIDs != nil,
+		})
+		checkFoldLeakage.InTrain().From(createFoldRows.OutTrainData())
+		checkFoldLeakage.InTest().From(createFoldRows.OutTestData())
+		if compoundIDs != nil {
+			checkFoldLeakage.InIDs().From(compoundIDs)
+		}
+		foldRows = append(foldRows, createFoldRows)
+	}
+
+	// ------------------------------------------------------------------------
+	// Loop over cost values to try
+	// ------------------------------------------------------------------------
+	for _, cost := range params.CostVals {
+		uniqRplTrsCst := sweeps.Suffix(uniqRplTrs, "cost", cost, fs("_c%f", cost))
+		avgRMSDPerCostSubstr := spcomp.NewStreamToSubStream(wf, "cost_substr"+uniqRplTrsCst)
+
+		// ------------------------------------------------------------------------
+		// Loop over cross validation folds
+		// ------------------------------------------------------------------------
+		for foldIdx := 0; foldIdx < params.FoldsCount; foldIdx++ {
+			uniqRplTrsCstFld := sweeps.Suffix(uniqRplTrsCst, "fold", foldIdx, fs("_fld%d", foldIdx))
+			createFolds := mlcomp.NewCreateFolds(wf, "createfolds"+uniqRplTrsCstFld,
+				mlcomp.CreateFoldsConf{
+					FoldIdx:  foldIdx,
+					FoldsCnt: params.FoldsCount,
+					// Seed?
+				})
+			createFolds.InData().From(shufTrain.OutShuffled())
+			createFolds.InLineCnt().From(cntTrainData.OutLineCount())
+
+			// ----------------------------------------------------------------
 			// Train
-			trainLibLin := NewTrainLibLinear(wf, "train_final"+uniqRplTrs,
-				TrainLibLinearConf{
-					ReplicateID: replID,
+			// ----------------------------------------------------------------
+			trainLibLin := mlcomp.NewTrainLibLinear(wf, "train"+uniqRplTrsCstFld,
+				mlcomp.TrainLibLinearConf{
+					ReplicateID: keys.Replicate,
+					Cost:        cost,
 					SolverType:  params.SolverType,
+					ToolPath:    params.tool("lin-train"),
+					TimePath:    params.tool("time"),
 				})
-			trainLibLin.SetOut("model", fs("data/final_models/finalmodel"+uniqRplTrs+".s%d_c{p:cost}.linmdl", params.SolverType))
-			trainLibLin.InTrainData().From(gunzipSparseTrain.Out("ungzipped"))
-			trainLibLin.InParam("cost").From(costFileToParam.OutParam("costparam"))
+			trainLibLin.InTrainData().From(createFolds.OutTrainData())
 
+			// ----------------------------------------------------------------
 			// Predict
-			predLibLin := NewPredictLibLinear(wf, "pred_final"+uniqRplTrs,
-				PredictLibLinearConf{
-					ReplicateID: replID,
+			// ----------------------------------------------------------------
+			predLibLin := mlcomp.NewPredictLibLinear(wf, "pred"+uniqRplTrsCstFld,
+				mlcomp.PredictLibLinearConf{
+					ReplicateID: keys.Replicate,
+					ToolPath:    params.tool("lin-predict"),
 				})
 			predLibLin.InModel().From(trainLibLin.OutModel())
-			predLibLin.InTestData().From(gunzipSparseTest.Out("ungzipped"))
+			predLibLin.InTestData().From(createFolds.OutTestData())
 
+			// ----------------------------------------------------------------
 			// Assess
-			assessLibLin := NewAssessLibLinear(wf, "assess_final"+uniqRplTrs,
-				AssessLibLinearConf{})
-			assessLibLin.InTestData().From(gunzipSparseTest.Out("ungzipped"))
+			// ----------------------------------------------------------------
+			assessLibLin := mlcomp.NewAssessLibLinear(wf, "assess"+uniqRplTrsCstFld, mlcomp.AssessLibLinearConf{
+				Fold: fs("%d", foldIdx),
+			})
+			assessLibLin.InTestData().From(createFolds.OutTestData())
 			assessLibLin.InPrediction().From(predLibLin.OutPrediction())
-			assessLibLin.InParam("cost").From(costFileToParam.OutParam("costparam"))
+			assessLibLin.InParamCost().FromFloat(cost)
 
-		} // end for train size
-	} // end for replicate id
-	return &CrossValidateWorkflow{wf}
+			avgRMSDPerCostSubstr.In().From(assessLibLin.OutRMSDCost())
+			recordResult("record_assess"+uniqRplTrsCstFld, mlcomp.ResultFoldRMSD, assessLibLin.OutRMSDCost())
+
+			// Keep the out-of-fold predictions next to the numbers of the train
+			// rows they are for, and the rows themselves
+			oofPreds := wf.NewProc("oof_preds"+uniqRplTrsCstFld, `paste {i:prediction} {i:testrows} {i:testdata} | awk -F '\t' -v OFS='\t' -v cost={p:cost} '{ print cost, $1, $3, $4 }' > {o:oof}`)
+			oofPreds.SetOut("oof", "{i:prediction}.oof")
+			oofPreds.InParam("cost").FromFloat(cost)
+			oofPreds.In("prediction").From(predLibLin.OutPrediction())
+			oofPreds.In("testrows").From(foldRows[foldIdx].OutTestData())
+			oofPreds.In("testdata").From(createFolds.OutTestData())
+			oofPredsSubstr.In().From(oofPreds.Out("oof"))
+		} // end for foldIdx
+
+		// Mean and standard deviation of the RMSDs, keeping the per-fold
+		// values for comparing costs
+		avgRMSD := wf.NewProc("avg_rmsd"+uniqRplTrsCst, `cat {i:rmsdcost|join: } | sort -n -k3 | `+
+			`awk '{ c += $1; cc += $1*$1; n++; folds = folds (n > 1 ? "," : "") $3 ":" $1 } `+
+			`END { m = c/n; print m "\t" {p:cost} "\t" sqrt((cc - n*m*m) / (n > 1 ? n-1 : 1)) "\t" folds }' > {o:avgrmsd}`)
+		avgRMSD.SetOut("avgrmsd", dsDir+"avg_rmsd/avg_rmsd"+uniqRplTrsCst+".txt")
+		avgRMSD.InParam("cost").FromFloat(cost)
+		avgRMSD.In("rmsdcost").From(avgRMSDPerCostSubstr.OutSubStream())
+
+		selBestCostPerTrainSizeSubstr.In().From(avgRMSD.Out("avgrmsd"))
+		recordResult("record_avg_rmsd"+uniqRplTrsCst, mlcomp.ResultCostRMSD, avgRMSD.Out("avgrmsd"))
+	} // end for cost
+
+	// ----------------------------------------------------------------
+	// Select best cost
+	// ----------------------------------------------------------------
+	costRMSDs := wf.NewProc("cost_rmsds"+uniqRplTrs, `cat {i:rmsdcost|join: } | awk '{ print {p:trainsize} "\t" $0 }' | sort -g -k3 > {o:costrmsds}`)
+	costRMSDs.InParam("trainsize").FromInt(keys.TrainSize)
+	costRMSDs.SetOut("costrmsds", dsDir+"best_cost/"+uniqRplTrs+"/cost_rmsds"+uniqRplTrs+".tsv")
+	costRMSDs.In("rmsdcost").From(selBestCostPerTrainSizeSubstr.OutSubStream())
+
+	selBestCostPerTrainSize := wf.NewProc("selbestcost"+uniqRplTrs, `awk '(NR == 1 || $2 < rmsd) { rmsd = $2; cost = $3 } END { print {p:trainsize} "\t" rmsd "\t" cost }' {i:costrmsds} > {o:bestcost}`)
+	selBestCostPerTrainSize.InParam("trainsize").FromInt(keys.TrainSize)
+	selBestCostPerTrainSize.SetOut("bestcost", dsDir+"best_cost/"+uniqRplTrs+"/best_cost"+uniqRplTrs+".txt")
+	selBestCostPerTrainSize.In("costrmsds").From(costRMSDs.Out("costrmsds"))
+	recordResult("record_selbestcost"+uniqRplTrs, mlcomp.ResultBestCost, selBestCostPerTrainSize.Out("bestcost"))
+
+	oofCollect := wf.NewProc("oof_collect"+uniqRplTrs, "cat {i:oof|join: } > {o:oof}")
+	oofCollect.SetOut("oof", dsDir+"oof/oof"+uniqRplTrs+".tsv")
+	oofCollect.In("oof").From(oofPredsSubstr.OutSubStream())
+
+	costFileToParam := mlcomp.NewFileToParams(wf, "cost_filetoparam"+uniqRplTrs, mlcomp.FileToParamsConf{
+		Format: mlcomp.ParamFormatTSV,
+		Params: []mlcomp.FileParam{
+			{Name: "cost", Column: 3, Type: mlcomp.ParamTypeFloat, Validate: mlcomp.ValidatePositive},
+		},
+	})
+	costFileToParam.InFile().From(selBestCostPerTrainSize.Out("bestcost"))
+
+	// --------------------------------------------------------------------------------
+	// Main training and assessment
+	// --------------------------------------------------------------------------------
+	// Train
+	trainLibLin := mlcomp.NewTrainLibLinear(wf, "train_final"+uniqRplTrs,
+		mlcomp.TrainLibLinearConf{
+			ReplicateID: keys.Replicate,
+			SolverType:  params.SolverType,
+			ToolPath:    params.tool("lin-train"),
+			TimePath:    params.tool("time"),
+		})
+	trainLibLin.SetOut("model", fs(dsDir+"final_models/finalmodel"+uniqRplTrs+".s%d_c{p:cost}.linmdl", params.SolverType))
+	trainLibLin.InTrainData().From(trainData)
+	trainLibLin.InParam("cost").From(costFileToParam.OutParam("cost"))
+
+	// Predict
+	predLibLin := mlcomp.NewPredictLibLinear(wf, "pred_final"+uniqRplTrs,
+		mlcomp.PredictLibLinearConf{
+			ReplicateID: keys.Replicate,
+			ToolPath:    params.tool("lin-predict"),
+		})
+	predLibLin.InModel().From(trainLibLin.OutModel())
+	predLibLin.InTestData().From(testData)
+
+	// Assess
+	assessLibLin := mlcomp.NewAssessLibLinear(wf, "assess_final"+uniqRplTrs,
+		mlcomp.AssessLibLinearConf{})
+	assessLibLin.InTestData().From(testData)
+	assessLibLin.InPrediction().From(predLibLin.OutPrediction())
+	assessLibLin.InParam("cost").From(costFileToParam.OutParam("cost"))
+	recordResult("record_assess_final"+uniqRplTrs, mlcomp.ResultFinalRMSD, assessLibLin.OutRMSDCost())
+	return &finalModelProcs{
+		costRMSDs:  costRMSDs,
+		bestCost:   selBestCostPerTrainSize,
+		cost:       costFileToParam.OutParam("cost"),
+		oofCollect: oofCollect,
+		train:      trainLibLin,
+		pred:       predLibLin,
+		assess:     assessLibLin,
+	}
+}
+
+// finalModelProcs are the processes selecting the cost for, training,
+// predicting with and assessing the final model for a train size
+type finalModelProcs struct {
+	// costRMSDs writes the mean, standard deviation and per-fold RMSDs of
+	// all costs to its "costrmsds" out-port
+	costRMSDs *sp.Process
+	// bestCost writes the selected cost to its "bestcost" out-port
+	bestCost *sp.Process
+	// cost sends the selected cost
+	cost *sp.OutParamPort
+	// oofCollect writes the out-of-fold predictions for all costs to its
+	// "oof" out-port
+	oofCollect *sp.Process
+	train      *mlcomp.TrainLibLinear
+	pred       *mlcomp.PredictLibLinear
+	assess     *mlcomp.AssessLibLinear
 }
@@ -0,0 +1,597 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pharmbio/scipipe-demo/mldrugdiscovery/chem"
+	"github.com/pharmbio/scipipe-demo/mldrugdiscovery/mlcomp"
+	"github.com/pharmbio/scipipe-demo/toolreg"
+	sp "github.com/scipipe/scipipe"
+)
+
+func TestCrossValidateWorkflow(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "crossvalidate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origDir)
+	defer installStubTools(t, tmpDir)()
+	tools := newToolRegistry(mlcomp.SignatureEngineJava, mlcomp.SamplingMethodRandom, false)
+	if err := tools.Resolve(""); err != nil {
+		t.Fatal(err)
+	}
+
+	// 40 unique compounds: carbon chains of length 1 to 10, with one of four
+	// substituents
+	smiles := []string{}
+	for chainLen := 1; chainLen <= 10; chainLen++ {
+		for i, subst := range []string{"O", "N", "Cl", "C(=O)O"} {
+			smiles = append(smiles, fmt.Sprintf("%s%s\t%.1f", strings.Repeat("C", chainLen), subst, float64(chainLen)*0.5+float64(i)))
+		}
+	}
+	os.MkdirAll("data", 0755)
+	if err := writeStubLines("data/stubset.smi", smiles); err != nil {
+		t.Fatal(err)
+	}
+
+	wf := NewCrossValidateWorkflow(2, CrossValidateWorkflowParams{
+		DatasetName:      "stubset",
+		DatasetFile:      "data/stubset.smi",
+		RunID:            "testrun",
+		ReplicateID:      "r1",
+		FoldsCount:       3,
+		HeightRanges:     []HeightRange{{1, 2}},
+		TestSize:         10,
+		TrainSizes:       []int{20},
+		CostVals:         []float64{0.1, 1},
+		SolverType:       12,
+		RandomDataSizeMB: 1,
+		Runmode:          RunModeLocal,
+		SlurmProject:     "N/A",
+		SignatureEngine:  mlcomp.SignatureEngineJava,
+		Tools:            tools,
+	})
+
+	// Graph wiring
+	procs := wf.Procs()
+	for _, name := range []string{
+		"gensign_stubset_r1_h1_2",
+		"compound_rows_stubset_r1_h1_2_tr20",
+		"shufrows_stubset_r1_h1_2_tr20",
+		"check_leakage_stubset_r1_h1_2_tr20",
+		"train_stubset_r1_h1_2_tr20_c0.100000_fld0",
+		"train_stubset_r1_h1_2_tr20_c1.000000_fld2",
+		"check_leakage_stubset_r1_h1_2_tr20_fld2",
+		"oof_report_stubset_r1_h1_2_tr20",
+		"appdomain_stubset_r1_h1_2_tr20",
+		"train_final_stubset_r1_h1_2_tr20",
+		"model_card_stubset_r1_h1_2_tr20",
+		"results_stubset",
+		"run_report_stubset",
+	} {
+		if _, ok := procs[name]; !ok {
+			t.Errorf("Missing process: %s", name)
+		}
+	}
+	// Training is timed with the time tool of the registry
+	if train, ok := procs["train_stubset_r1_h1_2_tr20_c0.100000_fld0"].(*sp.Process); ok && !strings.HasPrefix(train.CommandPattern, tools.ShellPath("time")+" ") {
+		t.Errorf("Expected training to be timed with %s, got command: %s", tools.ShellPath("time"), train.CommandPattern)
+	}
+	g := wf.Sweeps.Collapse(wf.Workflow)
+	procCnts := map[string]int{}
+	for _, n := range g.Nodes {
+		procCnts[n.Base] = n.ProcCnt
+	}
+	for base, cnt := range map[string]int{"gensign": 1, "createfolds": 6, "createfoldrows": 3, "train": 6, "pred": 6, "oof_preds": 6, "train_final": 1, "model_card": 1} {
+		if procCnts[base] != cnt {
+			t.Errorf("Expected %d %s processes, got %d", cnt, base, procCnts[base])
+		}
+	}
+	edges := map[string]bool{}
+	for _, e := range g.Edges {
+		edges[e.From+" -> "+e.To] = true
+	}
+	const (
+		hgt = "[dataset, replicate, heights]"
+		trs = "[dataset, replicate, heights, train size]"
+		fld = "[dataset, replicate, heights, train size, cost, fold]"
+		rfl = "[dataset, replicate, heights, train size, fold]"
+	)
+	for _, edge := range []string{
+		"testdata -> standardize [dataset]",
+		"standardize [dataset] -> gensign " + hgt,
+		"gensign " + hgt + " -> create_replcopy " + hgt,
+		"create_replcopy " + hgt + " -> sample_train_test " + trs,
+		"sample_train_test " + trs + " -> sparsetrain " + trs,
+		"sparsetrain " + trs + " -> sparsetest " + trs,
+		"sparsetrain " + trs + " -> gunzip_sparsetrain " + trs,
+		"shuftrain " + trs + " -> createfolds " + fld,
+		"sample_train_test " + trs + " -> compound_rows " + trs,
+		"gunzip_sparsetrain " + trs + " -> compound_rows " + trs,
+		"compound_rows " + trs + " -> shufrows " + trs,
+		"shufrows " + trs + " -> createfoldrows " + rfl,
+		"createfoldrows " + rfl + " -> check_leakage " + rfl,
+		"createfoldrows " + rfl + " -> oof_preds " + fld,
+		"createfolds " + fld + " -> train " + fld,
+		"train " + fld + " -> pred " + fld,
+		"pred " + fld + " -> assess " + fld,
+		"selbestcost " + trs + " -> cost_filetoparam " + trs,
+		"cost_filetoparam " + trs + " -> train_final " + trs,
+		"train_final " + trs + " -> pred_final " + trs,
+		"pred_final " + trs + " -> assess_final " + trs,
+		"assess_final " + trs + " -> result_row " + trs,
+		"result_rows [dataset] -> results [dataset]",
+		"run_report_stubset_sections -> run_report [dataset]",
+	} {
+		if !edges[edge] {
+			t.Errorf("Missing connection: %s", edge)
+		}
+	}
+
+	// Running the workflow
+	if testing.Short() {
+		t.Skip("Skipping the workflow run in short mode")
+	}
+	wf.Run()
+
+	results, err := ioutil.ReadFile("data/testrun/results.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := splitNonEmpty(string(results), "\n")
+	if len(rows) != 1 {
+		t.Fatalf("Expected 1 results row, got %d:\n%s", len(rows), results)
+	}
+	expectedFields := []string{"stubset", "r1", "1-2", "20"}
+	if fields := strings.Split(rows[0], "\t"); len(fields) < 7 || !reflect.DeepEqual(fields[:4], expectedFields) {
+		t.Errorf("Expected a results row starting with %q, got: %q", expectedFields, rows[0])
+	}
+	if report, err := ioutil.ReadFile("data/testrun/report.md"); err != nil {
+		t.Error(err)
+	} else if !strings.HasPrefix(string(report), "# Cross-validation run testrun, dataset stubset\n") {
+		t.Errorf("Unexpected report start:\n%s", report)
+	}
+	if models, _ := filepath.Glob("data/final_models/finalmodel_stubset_r1_h1_2_tr20.s12_c*.linmdl"); len(models) != 1 {
+		t.Errorf("Expected 1 final model, got: %v", models)
+	}
+}
+
+func TestReplicateEnsembleWorkflow(t *testing.T) {
+	wf := NewCrossValidateWorkflow(2, CrossValidateWorkflowParams{
+		DatasetName:      "stubset",
+		DatasetFile:      "data/stubset.smi",
+		RunID:            "testrun",
+		ReplicateIDs:     []string{"r1", "r2"},
+		FoldsCount:       3,
+		HeightRanges:     []HeightRange{{1, 2}},
+		TestSize:         10,
+		TrainSizes:       []int{20},
+		CostVals:         []float64{0.1},
+		SolverType:       12,
+		RandomDataSizeMB: 1,
+		Runmode:          RunModeLocal,
+		SlurmProject:     "N/A",
+		SignatureEngine:  mlcomp.SignatureEngineJava,
+		Ensemble:         mlcomp.EnsembleConf{Method: mlcomp.EnsembleReplicate, Size: 2},
+	})
+	predEnsemble, ok := wf.Procs()["pred_ensemble_stubset_h1_2_tr20"]
+	if !ok {
+		t.Fatal("Missing the prediction of the replicate ensemble")
+	}
+	// The ensemble of both replicates predicts the test set of the first
+	for inPort, expected := range map[string]string{
+		"bundle":    "ensemble_bundle_stubset_h1_2_tr20",
+		"compounds": "sample_train_test_stubset_r1_h1_2_tr20",
+	} {
+		if from := sourceProcs(predEnsemble, inPort); !reflect.DeepEqual(from, []string{expected}) {
+			t.Errorf("Expected the %s in-port to be connected from %s, got: %v", inPort, expected, from)
+		}
+	}
+	// Its predictions are annotated with the domain of the first replicate
+	appDomain, ok := wf.Procs()["appdomain_ensemble_stubset_h1_2_tr20"]
+	if !ok {
+		t.Fatal("Missing the applicability domain of the replicate ensemble")
+	}
+	for inPort, expected := range map[string]string{
+		"prediction": "pred_ensemble_stubset_h1_2_tr20",
+		"testdata":   "sample_train_test_stubset_r1_h1_2_tr20",
+		"traindata":  "gunzip_sparsetrain_stubset_r1_h1_2_tr20",
+		"signatures": "sparsetrain_stubset_r1_h1_2_tr20",
+	} {
+		if from := sourceProcs(appDomain, inPort); !reflect.DeepEqual(from, []string{expected}) {
+			t.Errorf("Expected the %s in-port to be connected from %s, got: %v", inPort, expected, from)
+		}
+	}
+	edges := map[string]bool{}
+	for _, e := range wf.Sweeps.Collapse(wf.Workflow).Edges {
+		edges[e.From+" -> "+e.To] = true
+	}
+	for _, edge := range []string{
+		"ensemble_member [dataset, replicate, heights, train size] -> ensemble_member_rows [dataset, heights, train size]",
+		"pred_ensemble [dataset, heights, train size] -> run_report_stubset_sections",
+	} {
+		if !edges[edge] {
+			t.Errorf("Missing connection: %s", edge)
+		}
+	}
+}
+
+// sourceProcs returns the names of the processes connected to the in-port
+// named inPort of proc
+func sourceProcs(proc sp.WorkflowProcess, inPort string) []string {
+	names := []string{}
+	for _, rp := range proc.InPorts()[inPort].RemotePorts {
+		names = append(names, rp.Process().Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestYRandSeed(t *testing.T) {
+	seeds := map[int64]string{}
+	for _, uniq := range []string{"_ds_r1_h1_3_tr500_yrnd1", "_ds_r1_h1_3_tr500_yrnd2", "_ds_r2_h1_3_tr500_yrnd1", "_ds_r1_h0_2_tr500_yrnd1", "_ds_r1_h1_3_tr1000_yrnd1", "_ds_r1_h1_3_tr500_pIC50_yrnd1"} {
+		seed := yRandSeed(uniq)
+		if other, ok := seeds[seed]; ok {
+			t.Errorf("Expected different seeds for %s and %s, got %d for both", uniq, other, seed)
+		}
+		if seed != yRandSeed(uniq) {
+			t.Errorf("Expected the same seed for %s every time", uniq)
+		}
+		seeds[seed] = uniq
+	}
+}
+
+func TestStubTools(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "stubtools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	defer installStubTools(t, tmpDir)()
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+	writeStubLines(path("data.smi"), []string{"CCO\t1", "CCN\t2", "CCCl\t3", "CCC(=O)O\t4"})
+
+	for _, cmd := range []string{
+		"java -jar bin/GenerateSignatures.jar -inputfile data.smi -threads 1 -minheight 1 -maxheight 2 -outputfile data.sign -silent",
+		"java -jar bin/SampleTrainingAndTest.jar -inputfile data.sign -testfile test.sign -trainingfile train.sign -testsize 1 -trainingsize 3 -silent",
+		"java -jar bin/CreateSparseDataset.jar -inputfile train.sign -datasetfile train.csr -signaturesoutfile train.voc -silent",
+		"java -jar bin/CreateSparseDataset.jar -inputfile test.sign -signaturesinfile train.voc -datasetfile test.csr -signaturesoutfile test.voc -silent",
+		"zcat train.csr > train.csr.txt && zcat test.csr > test.csr.txt",
+		"bin/lin-train -s 12 -c 0.5 -q train.csr.txt model.linmdl",
+		"bin/lin-predict test.csr.txt model.linmdl test.pred",
+		"stubs/time -f%e -o train.time bin/lin-train -s 12 -c 0.5 -q train.csr.txt timed.linmdl",
+	} {
+		c := exec.Command("sh", "-c", cmd)
+		c.Dir = tmpDir
+		if out, err := c.CombinedOutput(); err != nil {
+			t.Fatalf("%s: %v\n%s", cmd, err, out)
+		}
+	}
+	preds, err := ioutil.ReadFile(path("test.pred"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pred, err := strconv.ParseFloat(strings.TrimSpace(string(preds)), 64); err != nil || pred <= 0 {
+		t.Errorf("Expected one positive prediction, got %q", preds)
+	}
+	if secs, err := ioutil.ReadFile(path("train.time")); err != nil {
+		t.Error(err)
+	} else if _, err := strconv.ParseFloat(strings.TrimSpace(string(secs)), 64); err != nil {
+		t.Errorf("Expected the training time in seconds, got %q", secs)
+	}
+	for _, name := range []string{"train.csr.log", "train.sign.log", "timed.linmdl"} {
+		if _, err := os.Stat(path(name)); err != nil {
+			t.Errorf("Missing log file: %v", err)
+		}
+	}
+}
+
+// The cross-validation workflow needs GenerateSignatures.jar,
+// CreateSparseDataset.jar, SampleTrainingAndTest.jar and the LIBLINEAR
+// binaries, and training is timed with GNU time. For testing, these are
+// replaced by stubs, which are shell scripts running the test binary itself,
+// as TestStubTool, with the tool name in the STUB_TOOL environment variable.
+// The stubs write files in the formats of the tools they stand in for, using
+// the Go signature and sparse dataset implementations, and a trivial
+// "training".
+
+// stubToolEnv is the environment variable with the name of the stubbed tool
+const stubToolEnv = "STUB_TOOL"
+
+// stubTools are the stubbed tools, with the paths, relative to the test
+// working directory, to install their stubs at. Workflow tasks run in a
+// subdirectory, and so call them as ../bin/[tool]. The jars are run by the
+// java stub, which is put first in PATH. The time stub is set as the path of
+// the time tool, since the registry prefers /usr/bin/time over PATH.
+var stubTools = map[string]string{
+	"java":        "stubs/java",
+	"time":        "stubs/time",
+	"lin-train":   "bin/lin-train",
+	"lin-predict": "bin/lin-predict",
+}
+
+// stubJars are the jars that the java stub stands in for
+var stubJars = []string{
+	"GenerateSignatures.jar",
+	"CreateSparseDataset.jar",
+	"SampleTrainingAndTest.jar",
+}
+
+// installStubTools installs the stub tools in dir, puts the java stub first
+// in PATH, and sets the path of the time tool to its stub, until the returned
+// function is called
+func installStubTools(t *testing.T, dir string) func() {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for tool, relPath := range stubTools {
+		script := fmt.Sprintf("#!/bin/sh\n%s=%s exec '%s' -test.run='^TestStubTool$' -- \"$@\"\n", stubToolEnv, tool, exe)
+		path := filepath.Join(dir, relPath)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, jar := range stubJars {
+		// Only the names are used, by the java stub
+		ioutil.WriteFile(filepath.Join(dir, "bin", jar), nil, 0644)
+	}
+	timeEnv := toolreg.Tool{Name: "time"}.EnvVar()
+	origPath, origTime := os.Getenv("PATH"), os.Getenv(timeEnv)
+	os.Setenv("PATH", filepath.Join(dir, "stubs")+string(os.PathListSeparator)+origPath)
+	os.Setenv(timeEnv, filepath.Join(dir, stubTools["time"]))
+	return func() {
+		os.Setenv("PATH", origPath)
+		os.Setenv(timeEnv, origTime)
+	}
+}
+
+// TestStubTool runs a stub tool, when the test binary is run by a stub
+// script, and does nothing otherwise
+func TestStubTool(t *testing.T) {
+	tool := os.Getenv(stubToolEnv)
+	if tool == "" {
+		return
+	}
+	args := []string{}
+	for i, arg := range os.Args {
+		if arg == "--" {
+			args = os.Args[i+1:]
+			break
+		}
+	}
+	if err := runStubTool(tool, args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s stub: %v\n", tool, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// runStubTool runs the stub of tool with args
+func runStubTool(tool string, args []string) error {
+	switch tool {
+	case "java":
+		if len(args) < 2 || args[0] != "-jar" {
+			return fmt.Errorf("expected -jar [jar] as first arguments, got: %v", args)
+		}
+		return runStubJar(filepath.Base(args[1]), stubFlags(args[2:]))
+	case "lin-train":
+		// lin-train -s [solver] -c [cost] -q [traindata] [model]
+		if len(args) != 7 {
+			return fmt.Errorf("expected 7 arguments, got: %v", args)
+		}
+		return stubTrain(args[1], args[3], args[5], args[6])
+	case "lin-predict":
+		// lin-predict [testdata] [model] [predictions]
+		if len(args) != 3 {
+			return fmt.Errorf("expected 3 arguments, got: %v", args)
+		}
+		return stubPredict(args[0], args[1], args[2])
+	case "time":
+		return stubTime(args)
+	}
+	return fmt.Errorf("unknown tool")
+}
+
+// stubTime runs a command, as time -f%e -o [file] [command] [args...], and
+// writes its elapsed seconds to the file, like GNU time
+func stubTime(args []string) error {
+	outPath := ""
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch {
+		case args[0] == "-f%e":
+			args = args[1:]
+		case args[0] == "-o" && len(args) > 1:
+			outPath = args[1]
+			args = args[2:]
+		default:
+			return fmt.Errorf("unsupported option: %s", args[0])
+		}
+	}
+	if outPath == "" || len(args) == 0 {
+		return fmt.Errorf("expected -o [file] and a command")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	start := time.Now()
+	runErr := cmd.Run()
+	if err := writeStubLines(outPath, []string{fmt.Sprintf("%.2f", time.Since(start).Seconds())}); err != nil {
+		return err
+	}
+	return runErr
+}
+
+// stubFlags parses -name value flags, as used by the jars. Flags without
+// value, such as -silent, get an empty value.
+func stubFlags(args []string) map[string]string {
+	flags := map[string]string{}
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimPrefix(args[i], "-")
+		if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			flags[name] = args[i+1]
+			i++
+			continue
+		}
+		flags[name] = ""
+	}
+	return flags
+}
+
+// runStubJar runs the stub of jar
+func runStubJar(jar string, flags map[string]string) error {
+	switch jar {
+	case "GenerateSignatures.jar":
+		threads, _ := strconv.Atoi(flags["threads"])
+		minHeight, _ := strconv.Atoi(flags["minheight"])
+		maxHeight, _ := strconv.Atoi(flags["maxheight"])
+		_, err := mlcomp.GenSignatures(flags["inputfile"], flags["outputfile"], threads,
+			chem.FingerprintConf{Type: chem.FingerprintSignature, MinHeight: minHeight, MaxHeight: maxHeight})
+		return err
+	case "CreateSparseDataset.jar":
+		voc := chem.NewVocabulary()
+		grow := true
+		if vocPath, ok := flags["signaturesinfile"]; ok {
+			vocFile, err := os.Open(vocPath)
+			if err != nil {
+				return err
+			}
+			voc, err = chem.ReadVocabulary(vocFile)
+			vocFile.Close()
+			if err != nil {
+				return err
+			}
+			grow = false
+		}
+		return mlcomp.CreateSparseDataset(flags["inputfile"], voc, grow,
+			flags["datasetfile"], flags["signaturesoutfile"], flags["datasetfile"]+".log")
+	case "SampleTrainingAndTest.jar":
+		// The first lines are the test set, and the following ones the train set
+		testSize, _ := strconv.Atoi(flags["testsize"])
+		trainSize, _ := strconv.Atoi(flags["trainingsize"])
+		lines := []string{}
+		if err := mlcomp.ForEachLine(flags["inputfile"], func(lineNo int, line string) error {
+			lines = append(lines, line)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if testSize+trainSize > len(lines) {
+			return fmt.Errorf("%d test and %d train compounds requested, but %s has %d", testSize, trainSize, flags["inputfile"], len(lines))
+		}
+		if err := writeStubLines(flags["testfile"], lines[:testSize]); err != nil {
+			return err
+		}
+		if err := writeStubLines(flags["trainingfile"], lines[testSize:testSize+trainSize]); err != nil {
+			return err
+		}
+		return writeStubLines(flags["trainingfile"]+".log", []string{fmt.Sprintf("test: %d\ntrain: %d", testSize, trainSize)})
+	}
+	return fmt.Errorf("unknown jar %s", jar)
+}
+
+// stubTrain writes a LIBLINEAR model, with the same weight, depending on
+// the cost, for all features of the train data
+func stubTrain(solverType string, cost string, trainPath string, modelPath string) error {
+	rows, err := readStubSparseRows(trainPath)
+	if err != nil {
+		return err
+	}
+	featureCnt := 0
+	for _, row := range rows {
+		for col := range row {
+			if col > featureCnt {
+				featureCnt = col
+			}
+		}
+	}
+	costVal, err := strconv.ParseFloat(cost, 64)
+	if err != nil {
+		return err
+	}
+	lines := []string{"solver_type L2R_L2LOSS_SVR_DUAL", "nr_feature " + strconv.Itoa(featureCnt), "bias -1", "w"}
+	for i := 0; i < featureCnt; i++ {
+		lines = append(lines, strconv.FormatFloat(0.01*costVal, 'g', -1, 64))
+	}
+	return writeStubLines(modelPath, lines)
+}
+
+// stubPredict writes the predictions of a LIBLINEAR model, without bias, for
+// test data
+func stubPredict(testPath string, modelPath string, predPath string) error {
+	weights := []float64{}
+	inWeights := false
+	if err := mlcomp.ForEachLine(modelPath, func(lineNo int, line string) error {
+		if !inWeights {
+			inWeights = line == "w"
+			return nil
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(line), 64)
+		weights = append(weights, w)
+		return err
+	}); err != nil {
+		return err
+	}
+	rows, err := readStubSparseRows(testPath)
+	if err != nil {
+		return err
+	}
+	lines := []string{}
+	for _, row := range rows {
+		pred := 0.0
+		for col, val := range row {
+			if col <= len(weights) {
+				pred += weights[col-1] * val
+			}
+		}
+		lines = append(lines, strconv.FormatFloat(pred, 'g', -1, 64))
+	}
+	return writeStubLines(predPath, lines)
+}
+
+// readStubSparseRows reads the feature values of the rows of a sparse
+// dataset, by (1-based) column
+func readStubSparseRows(path string) ([]map[int]float64, error) {
+	rows := []map[int]float64{}
+	err := mlcomp.ForEachLine(path, func(lineNo int, line string) error {
+		row := map[int]float64{}
+		for _, field := range strings.Fields(line)[1:] {
+			parts := strings.SplitN(field, ":", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("%s, line %d: invalid entry %q", path, lineNo, field)
+			}
+			col, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return err
+			}
+			if row[col], err = strconv.ParseFloat(parts[1], 64); err != nil {
+				return err
+			}
+		}
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, err
+}
+
+func writeStubLines(path string, lines []string) error {
+	return ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"strings"
 	"time"
 )
 
@@ -65,3 +66,14 @@ func parseDuration(durStr string) time.Duration {
 func fs(pat string, v ...interface{}) string {
 	return fmt.Sprintf(pat, v...)
 }
+
+// splitNonEmpty splits s on sep, dropping empty (or space-only) parts
+func splitNonEmpty(s string, sep string) []string {
+	parts := []string{}
+	for _, part := range strings.Split(s, sep) {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
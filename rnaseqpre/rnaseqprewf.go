@@ -4,18 +4,35 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 
 	sp "github.com/scipipe/scipipe"
 	spcomp "github.com/scipipe/scipipe/components"
+
+	"github.com/pharmbio/scipipe-demo/doctor"
+	"github.com/pharmbio/scipipe-demo/download"
+	"github.com/pharmbio/scipipe-demo/toolreg"
 )
 
+const appsURL = "https://zenodo.org/record/1336607/files/scipipe-demo-apps.tar.gz?download=1"
+
+// appsSHA256 is the expected SHA-256 checksum of the apps bundle, which is not
+// pinned yet. An empty checksum is not verified, but the checksum of the
+// downloaded file is logged, to pin it here with, and -offline runs fail
+// without one.
+const appsSHA256 = ""
+
 var (
 	plot       = flag.Bool("plot", false, "Plot graph and nothing more")
 	maxTasks   = flag.Int("maxtasks", 4, "Max number of local cores to use")
 	procsRegex = flag.String("procs", "create_multiqc_report", "A regex specifying which processes (by name) to run up to")
+	toolConf   = flag.String("toolconf", "", "Tool config file, with the name and path of a tool on each line, for tools not in the downloaded apps bundle (see also the "+toolreg.EnvPrefix+"[NAME] environment variables)")
+	cacheDir   = flag.String("cachedir", "downloads", "Directory of the content-addressed cache of the downloaded apps bundle, or empty for no caching")
+	mirror     = flag.String("mirror", "", "Local directory with a copy of the apps bundle, to use before downloading")
+	offline    = flag.Bool("offline", false, "Take the apps bundle from the download cache or the -mirror directory only, without downloading")
 )
 
 func main() {
@@ -28,18 +45,48 @@ func main() {
 	origDataDir := appsDir + "/data"
 	dataDir := "data"
 
+	runDoctor := doctor.Requested()
+	flag.Parse()
+
+	// ------------------------------------------------
+	// Resolve tool paths
+	// ------------------------------------------------
+	tools := toolreg.NewRegistry(
+		toolreg.Tool{Name: "fastqc", Default: appsDir + "/FastQC-0.11.5/fastqc", Bundled: true},
+		toolreg.Tool{Name: "star", Default: appsDir + "/STAR-2.5.3a/STAR", Bundled: true},
+		toolreg.Tool{Name: "samtools", Default: appsDir + "/samtools-1.3.1/samtools", Bundled: true},
+		toolreg.Tool{Name: "qualimap", Default: appsDir + "/QualiMap-2.2/qualimap", Bundled: true},
+		toolreg.Tool{Name: "featurecounts", Default: appsDir + "/subread-1.5.2/bin/featureCounts", Bundled: true},
+		toolreg.Tool{Name: "multiqc", Default: appsDir + "/MultiQC-1.5/bin/multiqc", Bundled: true},
+		toolreg.Tool{Name: "python", Command: "python"},
+	)
+	if err := tools.Resolve(*toolConf); err != nil {
+		if !runDoctor {
+			sp.Fail(err)
+		}
+		sp.Warning.Println(err)
+	}
+	sp.Info.Println("Tools:\n" + tools.Table())
+
 	// ----------------------------------------------------------------------------
 	// Data Download part of the workflow
 	// ----------------------------------------------------------------------------
-	flag.Parse()
 	wf := sp.NewWorkflow("rnaseqpre", *maxTasks)
 
-	downloadApps := wf.NewProc("download_apps", "wget https://zenodo.org/record/1336607/files/scipipe-demo-apps.tar.gz?download=1 -O {o:apps}")
-	downloadApps.SetOut("apps", dataDir+"/apps.tar.gz")
+	downloadApps := download.NewProc(wf, "download_apps", download.Conf{
+		URL:    appsURL,
+		SHA256: appsSHA256,
+		Path:   dataDir + "/apps.tar.gz",
+		Cache: download.Cache{
+			Dir:       *cacheDir,
+			MirrorDir: *mirror,
+			Offline:   *offline,
+		},
+	})
 
 	unTgzApps := wf.NewProc("untgz_apps", "tar -zxvf {i:tgz} -C "+dataDir+" && echo untar_done > {o:done}")
 	unTgzApps.SetOut("done", dataDir+"/apps/done.flag")
-	unTgzApps.In("tgz").From(downloadApps.Out("apps"))
+	unTgzApps.In("tgz").From(downloadApps.Out("file"))
 
 	// ----------------------------------------------------------------------------
 	// Main Workflow
@@ -68,7 +115,7 @@ func main() {
 			// Quality reporting
 			// --------------------------------------------------------------------------------
 			fastQSamples := wf.NewProc("fastqc_sample_"+samplePrefix+"_"+sj,
-				"../"+appsDir+"/FastQC-0.11.5/fastqc {i:reads} -o "+tmpDir+"/rnaseqpre/fastqc && echo fastqc_done > {o:done} # {i:untardone}")
+				tools.ShellPath("fastqc")+" {i:reads} -o "+tmpDir+"/rnaseqpre/fastqc && echo fastqc_done > {o:done} # {i:untardone}")
 			fastQSamples.In("reads").From(readsSourceFastQ.Out())
 			fastQSamples.In("untardone").From(unTgzApps.Out("done"))
 			fastQSamples.SetOutFunc("done", func(t *sp.Task) string {
@@ -88,7 +135,7 @@ func main() {
 		readsSourceFastQ2 := spcomp.NewFileSource(wf, "fastqFile_align_"+samplePrefix+"_2.chr11.fq.gz", fastqPath2)
 
 		alignSamples := wf.NewProc("align_samples_"+samplePrefix,
-			"../"+appsDir+"/STAR-2.5.3a/STAR \\\n"+
+			tools.ShellPath("star")+" \\\n"+
 				" --genomeDir ../"+starIndex+
 				" --readFilesIn {i:reads1} {i:reads2} \\\n"+
 				fs(" --runThreadN %d \\\n", *maxTasks)+
@@ -100,12 +147,12 @@ func main() {
 		alignSamples.In("fastqc").From(strToSubstrs[samplePrefix].OutSubStream())
 		alignSamples.SetOut("bam_aligned", tmpDir+"/rnaseqpre/star/"+samplePrefix+".chr11.Aligned.sortedByCoord.out.bam")
 
-		createIndex := wf.NewProc("create_index_"+samplePrefix, `../`+appsDir+`/samtools-1.3.1/samtools index {i:bam_aligned}`)
+		createIndex := wf.NewProc("create_index_"+samplePrefix, tools.ShellPath("samtools")+` index {i:bam_aligned}`)
 		createIndex.SetOut("index", "{i:bam_aligned}.bai")
 		createIndex.In("bam_aligned").From(alignSamples.Out("bam_aligned"))
 
 		// QualiMap
-		qcAlignment := wf.NewProc("qc_alignment_"+samplePrefix, `../`+appsDir+`/QualiMap-2.2/qualimap rnaseq -pe \
+		qcAlignment := wf.NewProc("qc_alignment_"+samplePrefix, tools.ShellPath("qualimap")+` rnaseq -pe \
 			-bam {i:bam_aligned} \
 			-gtf ../`+refDir+`/Mus_musculus.GRCm38.92.chr11.gtf \
 			--outdir `+tmpDir+`/rnaseqpre/qualimap/ \
@@ -114,7 +161,7 @@ func main() {
 		qcAlignment.SetOut("stdout", "{i:bam_aligned|%.bam}.qualimap.stdout.log")
 
 		// Count features
-		countFeatures := wf.NewProc("count_features_"+samplePrefix, `../`+appsDir+`/subread-1.5.2/bin/featureCounts -p \
+		countFeatures := wf.NewProc("count_features_"+samplePrefix, tools.ShellPath("featurecounts")+` -p \
 			-a ../`+refDir+`/Mus_musculus.GRCm38.92.chr11.gtf -t gene -g gene_id -s 0 \
 			-o {o:feature_counts} \
 			{i:bam_aligned} # Extra dependency: {i:index}`)
@@ -132,10 +179,18 @@ func main() {
 	}
 
 	// MultiQC
-	multiQC := wf.NewProc("create_multiqc_report", `export PYTHONPATH=../`+appsDir+`/MultiQC-1.5/lib/python2.7/site-packages:$PYTHONPATH && \
-		python ../`+appsDir+`/MultiQC-1.5/bin/multiqc -f \
-		-d ../`+tmpDir+`/rnaseqpre/ \
-		-o $(o={o:report}; echo ${o%/multiqc_report.html}) # Depend: {i:count_features|join: }`)
+	multiQCCmd := tools.ShellPath("python") + ` ` + tools.ShellPath("multiqc") + ` -f \
+		-d ../` + tmpDir + `/rnaseqpre/ \
+		-o $(o={o:report}; echo ${o%/multiqc_report.html}) # Depend: {i:count_features|join: }`
+	// The python packages of the bundled MultiQC are next to its bin
+	// directory. A MultiQC from elsewhere is run with the packages of its
+	// python.
+	if tools.Source("multiqc") == toolreg.SourceDefault {
+		multiQCPackages := filepath.Dir(filepath.Dir(tools.Path("multiqc"))) + "/lib/python2.7/site-packages"
+		multiQCCmd = `export PYTHONPATH=` + toolreg.Quote(multiQCPackages) + `:$PYTHONPATH && \
+		` + multiQCCmd
+	}
+	multiQC := wf.NewProc("create_multiqc_report", multiQCCmd)
 	multiQC.In("count_features").From(featureCountS2SS.OutSubStream())
 	multiQC.SetOut("report", tmpDir+"/rnaseqpre/multiqc/multiqc_report.html")
 
@@ -146,6 +201,21 @@ func main() {
 	}
 	sort.Strings(procNames)
 
+	if runDoctor {
+		d := doctor.New(tools)
+		d.AddWorkflow(wf)
+		// MultiQC 1.5 is run with Python 2.7
+		pythonCheck := d.Versions["python"]
+		pythonCheck.Min, pythonCheck.Max = "2.7", "2.7"
+		d.Versions["python"] = pythonCheck
+		d.AddCheck("markupsafe", doctor.CheckPythonModule(tools.Path("python"), "markupsafe"))
+		d.AddCheck("libgomp", doctor.CheckLibrary("libgomp.so.1"))
+		if !doctor.WriteTable(os.Stdout, d.Run()) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *plot {
 		dotFile := "rnaseqpre.dot"
 		wf.PlotGraph(dotFile)
@@ -0,0 +1,141 @@
+package sweepgraph
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+)
+
+const (
+	svgNodeWidth  = 230.0
+	svgLineHeight = 14.0
+	svgNodePad    = 8.0
+	svgColGap     = 60.0
+	svgRowGap     = 16.0
+	svgMargin     = 20.0
+)
+
+// SVG returns the graph as an SVG image, drawn left to right, with the nodes
+// in columns by their longest path from a node without inputs, so that it
+// can be viewed without GraphViz
+func (g *Graph) SVG() string {
+	ranks := g.ranks()
+	cols := map[int][]*Node{}
+	maxRank := 0
+	for _, n := range g.Nodes {
+		cols[ranks[n.ID]] = append(cols[ranks[n.ID]], n)
+		if ranks[n.ID] > maxRank {
+			maxRank = ranks[n.ID]
+		}
+	}
+
+	// Order the nodes in each column by the mean position of their inputs,
+	// to keep edges short
+	preds := map[string][]string{}
+	for _, e := range g.Edges {
+		preds[e.To] = append(preds[e.To], e.From)
+	}
+	type box struct{ x, y, h float64 }
+	boxes := map[string]box{}
+	height := 0.0
+	for r := 0; r <= maxRank; r++ {
+		col := cols[r]
+		centre := map[string]float64{}
+		for _, n := range col {
+			sum, cnt := 0.0, 0.0
+			for _, p := range preds[n.ID] {
+				if b, ok := boxes[p]; ok {
+					sum += b.y + b.h/2
+					cnt++
+				}
+			}
+			if cnt > 0 {
+				centre[n.ID] = sum / cnt
+			}
+		}
+		sort.SliceStable(col, func(i, j int) bool { return centre[col[i].ID] < centre[col[j].ID] })
+		y := svgMargin
+		for _, n := range col {
+			h := float64(len(n.labelLines()))*svgLineHeight + 2*svgNodePad
+			boxes[n.ID] = box{svgMargin + float64(r)*(svgNodeWidth+svgColGap), y, h}
+			y += h + svgRowGap
+		}
+		if y > height {
+			height = y
+		}
+	}
+	width := 2*svgMargin + float64(maxRank+1)*svgNodeWidth + float64(maxRank)*svgColGap
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" font-family="Arial" font-size="11">`+"\n", width, height+svgMargin-svgRowGap)
+	sb.WriteString(`<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="7" markerHeight="7" orient="auto"><path d="M0,0 L10,5 L0,10 z" fill="#384A52"/></marker></defs>` + "\n")
+	fmt.Fprintf(&sb, "<title>%s</title>\n", html.EscapeString(g.Name))
+	for _, e := range g.Edges {
+		from, to := boxes[e.From], boxes[e.To]
+		x1, y1 := from.x+svgNodeWidth, from.y+from.h/2
+		x2, y2 := to.x, to.y+to.h/2
+		c1, c2 := (x1+x2)/2, (x1+x2)/2
+		if x2 <= x1 {
+			// Edges within a column, or back, go around the right side
+			x2 = to.x + svgNodeWidth
+			c1, c2 = x1+svgColGap/2, x2+svgColGap/2
+		}
+		fmt.Fprintf(&sb, `<path d="M%.1f,%.1f C%.1f,%.1f %.1f,%.1f %.1f,%.1f" fill="none" stroke="#384A52" marker-end="url(#arrow)"/>`+"\n",
+			x1, y1, c1, y1, c2, y2, x2, y2)
+	}
+	for _, n := range g.Nodes {
+		b := boxes[n.ID]
+		fmt.Fprintf(&sb, `<rect x="%.1f" y="%.1f" width="%.0f" height="%.1f" rx="3" fill="#EFF2F5" stroke="#384A52"/>`+"\n", b.x, b.y, svgNodeWidth, b.h)
+		for i, line := range n.labelLines() {
+			weight := ""
+			if i == 0 {
+				weight = ` font-weight="bold"`
+			}
+			fmt.Fprintf(&sb, `<text x="%.1f" y="%.1f" fill="#384A52"%s>%s</text>`+"\n",
+				b.x+svgNodePad, b.y+svgNodePad+float64(i+1)*svgLineHeight-3, weight, html.EscapeString(line))
+		}
+	}
+	sb.WriteString("</svg>\n")
+	return sb.String()
+}
+
+// ranks returns the column of each node, as the length of the longest path
+// to it from a node without inputs. Nodes in cycles are put after the others.
+func (g *Graph) ranks() map[string]int {
+	inDegree := map[string]int{}
+	succs := map[string][]string{}
+	for _, e := range g.Edges {
+		inDegree[e.To]++
+		succs[e.From] = append(succs[e.From], e.To)
+	}
+	ranks := map[string]int{}
+	queue := []string{}
+	for _, n := range g.Nodes {
+		if inDegree[n.ID] == 0 {
+			queue = append(queue, n.ID)
+		}
+	}
+	maxRank := 0
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, succ := range succs[id] {
+			if ranks[id]+1 > ranks[succ] {
+				ranks[succ] = ranks[id] + 1
+			}
+			if inDegree[succ]--; inDegree[succ] == 0 {
+				queue = append(queue, succ)
+			}
+		}
+		if ranks[id] > maxRank {
+			maxRank = ranks[id]
+		}
+	}
+	for _, n := range g.Nodes {
+		if inDegree[n.ID] > 0 {
+			ranks[n.ID] = maxRank + 1
+		}
+	}
+	return ranks
+}
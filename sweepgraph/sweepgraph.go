@@ -0,0 +1,280 @@
+// Package sweepgraph plots collapsed graphs of SciPipe workflows with
+// parameter sweeps, where the processes created in loops over parameter
+// values, such as train sizes, costs and cross-validation folds, are shown as
+// a single node per kind of process, with the ranges of the swept values.
+//
+// The sweep dimensions are declared when building the unique suffixes of
+// process names in the loops:
+//
+//	sweeps := sweepgraph.New()
+//	for _, trainSize := range trainSizes {
+//		uniqTrs := sweeps.Suffix("", "train size", trainSize, fmt.Sprintf("_tr%d", trainSize))
+//		for _, cost := range costs {
+//			uniqTrsCst := sweeps.Suffix(uniqTrs, "cost", cost, fmt.Sprintf("_c%f", cost))
+//			train := wf.NewProc("train"+uniqTrsCst, ...)
+//
+// The collapsed graph is then built from the connections between the
+// processes of the workflow, and written in GraphViz dot, SVG and Mermaid
+// format.
+package sweepgraph
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+// Sweeps records the sweep dimension values of the suffixes of process names
+type Sweeps struct {
+	mu sync.Mutex
+	// suffixes maps name suffixes to the dimension values they stand for
+	suffixes map[string][]DimValue
+	// valueOrder keeps the values of each dimension in declaration order
+	valueOrder map[string][]string
+}
+
+// DimValue is the value of a sweep dimension
+type DimValue struct {
+	Dim   string
+	Value string
+}
+
+// New returns a new, empty, Sweeps
+func New() *Sweeps {
+	return &Sweeps{suffixes: map[string][]DimValue{}, valueOrder: map[string][]string{}}
+}
+
+// Suffix returns parent, a suffix returned by an earlier call or an empty
+// string, with suffix added, and records that it stands for the value of
+// dimension dim, in addition to the values of parent. Suffix may be called on
+// a nil Sweeps, which records nothing.
+func (s *Sweeps) Suffix(parent string, dim string, value interface{}, suffix string) string {
+	full := parent + suffix
+	if s == nil {
+		return full
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	valStr := fmt.Sprint(value)
+	dims := append(append([]DimValue{}, s.suffixes[parent]...), DimValue{dim, valStr})
+	s.suffixes[full] = dims
+	known := false
+	for _, v := range s.valueOrder[dim] {
+		known = known || v == valStr
+	}
+	if !known {
+		s.valueOrder[dim] = append(s.valueOrder[dim], valStr)
+	}
+	return full
+}
+
+// dimsOf returns the base name and the dimension values of a process name,
+// from the longest recorded suffix of the name
+func (s *Sweeps) dimsOf(name string) (string, []DimValue) {
+	if s == nil {
+		return name, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	best := ""
+	for suffix := range s.suffixes {
+		if len(suffix) > len(best) && len(suffix) < len(name) && strings.HasSuffix(name, suffix) {
+			best = suffix
+		}
+	}
+	if best == "" {
+		return name, nil
+	}
+	return strings.TrimRight(strings.TrimSuffix(name, best), "_"), s.suffixes[best]
+}
+
+// Graph is a collapsed workflow graph
+type Graph struct {
+	Name  string
+	Nodes []*Node
+	Edges []Edge
+}
+
+// Node is a kind of process in a collapsed graph, standing for all processes
+// with the same base name and sweep dimensions
+type Node struct {
+	ID   string
+	Base string
+	// Dims are the sweep dimensions, with the values of all processes of the
+	// node, in declaration order
+	Dims []DimValues
+	// ProcCnt is the number of processes of the node
+	ProcCnt int
+}
+
+// DimValues are the values of a sweep dimension
+type DimValues struct {
+	Dim    string
+	Values []string
+}
+
+// Edge is a connection between nodes in a collapsed graph, standing for
+// ConnCnt connections between processes
+type Edge struct {
+	From    string
+	To      string
+	ConnCnt int
+}
+
+// Collapse returns the collapsed graph of wf, with the sweep dimensions
+// recorded in s
+func (s *Sweeps) Collapse(wf *sp.Workflow) *Graph {
+	procs := wf.Procs()
+	nodes := map[string]*Node{}
+	nodeValues := map[string]map[string]map[string]bool{}
+	nodeOf := map[string]string{}
+	for name := range procs {
+		base, dims := s.dimsOf(name)
+		dimNames := []string{}
+		for _, dv := range dims {
+			dimNames = append(dimNames, dv.Dim)
+		}
+		id := base
+		if len(dimNames) > 0 {
+			id += " [" + strings.Join(dimNames, ", ") + "]"
+		}
+		nodeOf[name] = id
+		node, ok := nodes[id]
+		if !ok {
+			node = &Node{ID: id, Base: base}
+			for _, dim := range dimNames {
+				node.Dims = append(node.Dims, DimValues{Dim: dim})
+			}
+			nodes[id] = node
+			nodeValues[id] = map[string]map[string]bool{}
+		}
+		node.ProcCnt++
+		for _, dv := range dims {
+			if nodeValues[id][dv.Dim] == nil {
+				nodeValues[id][dv.Dim] = map[string]bool{}
+			}
+			nodeValues[id][dv.Dim][dv.Value] = true
+		}
+	}
+	g := &Graph{Name: wf.Name()}
+	for id, node := range nodes {
+		for i, dim := range node.Dims {
+			for _, val := range s.valueOrder[dim.Dim] {
+				if nodeValues[id][dim.Dim][val] {
+					node.Dims[i].Values = append(node.Dims[i].Values, val)
+				}
+			}
+		}
+		g.Nodes = append(g.Nodes, node)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+
+	edgeCnts := map[[2]string]int{}
+	addEdge := func(from string, to sp.WorkflowProcess) {
+		if to == nil {
+			return
+		}
+		if _, ok := procs[to.Name()]; !ok || to.Name() == from {
+			return
+		}
+		edgeCnts[[2]string{nodeOf[from], nodeOf[to.Name()]}]++
+	}
+	for name, proc := range procs {
+		for _, op := range proc.OutPorts() {
+			for _, rp := range op.RemotePorts {
+				addEdge(name, rp.Process())
+			}
+		}
+		for _, pop := range proc.OutParamPorts() {
+			if pop == nil {
+				continue
+			}
+			for _, rp := range pop.RemotePorts {
+				addEdge(name, rp.Process())
+			}
+		}
+	}
+	for fromTo, cnt := range edgeCnts {
+		g.Edges = append(g.Edges, Edge{fromTo[0], fromTo[1], cnt})
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	return g
+}
+
+// labelLines returns the lines of the label of a node: the base name, the
+// ranges of the sweep dimensions and, for swept nodes, the process count
+func (n *Node) labelLines() []string {
+	lines := []string{n.Base}
+	for _, dim := range n.Dims {
+		vals := dim.Values
+		if len(vals) > 3 {
+			vals = []string{vals[0], "…", vals[len(vals)-1] + fs(" (%d)", len(dim.Values))}
+			lines = append(lines, dim.Dim+": "+strings.Join(vals, " "))
+			continue
+		}
+		lines = append(lines, dim.Dim+": "+strings.Join(vals, ", "))
+	}
+	if n.ProcCnt > 1 {
+		lines = append(lines, fs("× %d processes", n.ProcCnt))
+	}
+	return lines
+}
+
+// Dot returns the graph in GraphViz dot format
+func (g *Graph) Dot() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph %q {\n", g.Name)
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString(`  graph [fontname="Arial",fontsize=13,color="#384A52",fontcolor="#384A52"];` + "\n")
+	sb.WriteString(`  node  [fontname="Arial",fontsize=11,color="#384A52",fontcolor="#384A52",fillcolor="#EFF2F5",shape=box,style=filled];` + "\n")
+	sb.WriteString(`  edge  [fontname="Arial",fontsize=9, color="#384A52",fontcolor="#384A52"];` + "\n")
+	for _, n := range g.Nodes {
+		label := strings.Replace(strings.Join(n.labelLines(), "\n"), `"`, `\"`, -1)
+		fmt.Fprintf(&sb, "  %q [label=%s];\n", n.ID, `"`+strings.Replace(label, "\n", `\n`, -1)+`"`)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&sb, "  %q -> %q;\n", e.From, e.To)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Mermaid returns the graph as a Mermaid flowchart
+func (g *Graph) Mermaid() string {
+	ids := map[string]string{}
+	var sb strings.Builder
+	sb.WriteString("flowchart LR\n")
+	for i, n := range g.Nodes {
+		ids[n.ID] = fs("n%d", i+1)
+		label := strings.Replace(strings.Join(n.labelLines(), "<br/>"), `"`, "#quot;", -1)
+		fmt.Fprintf(&sb, "  %s[\"%s\"]\n", ids[n.ID], label)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&sb, "  %s --> %s\n", ids[e.From], ids[e.To])
+	}
+	return sb.String()
+}
+
+// WriteFiles writes the graph to basePath with the extensions .dot, .svg and
+// .mmd (Mermaid)
+func (g *Graph) WriteFiles(basePath string) error {
+	for ext, content := range map[string]string{".dot": g.Dot(), ".svg": g.SVG(), ".mmd": g.Mermaid()} {
+		if err := ioutil.WriteFile(basePath+ext, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fs(pat string, v ...interface{}) string {
+	return fmt.Sprintf(pat, v...)
+}
@@ -0,0 +1,58 @@
+package sweepgraph
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+func TestCollapse(t *testing.T) {
+	wf := sp.NewWorkflow("sweep", 1)
+	sweeps := New()
+	data := wf.NewProc("data", "echo data > {o:data}")
+	summary := wf.NewProc("summarize", "cat {i:results|join: } > {o:summary}")
+	for _, trainSize := range []int{500, 1000, 2000, 4000, 8000} {
+		uniqTrs := sweeps.Suffix("", "train size", trainSize, fmt.Sprintf("_tr%d", trainSize))
+		sample := wf.NewProc("sample"+uniqTrs, "head -n "+fmt.Sprint(trainSize)+" {i:data} > {o:train}")
+		sample.In("data").From(data.Out("data"))
+		for _, cost := range []float64{0.1, 1} {
+			uniqTrsCst := sweeps.Suffix(uniqTrs, "cost", cost, fmt.Sprintf("_c%f", cost))
+			train := wf.NewProc("train"+uniqTrsCst, "train {i:train} > {o:model}")
+			train.In("train").From(sample.Out("train"))
+			summary.In("results").From(train.Out("model"))
+		}
+	}
+	g := sweeps.Collapse(wf)
+
+	labels := []string{}
+	for _, n := range g.Nodes {
+		labels = append(labels, strings.Join(n.labelLines(), " | "))
+	}
+	expectedLabels := []string{
+		"data",
+		"sample | train size: 500 … 8000 (5) | × 5 processes",
+		"summarize",
+		"train | train size: 500 … 8000 (5) | cost: 0.1, 1 | × 10 processes",
+	}
+	if !reflect.DeepEqual(labels, expectedLabels) {
+		t.Errorf("Wrong node labels:\nEXPECTED: %q\nACTUAL: %q\n", expectedLabels, labels)
+	}
+	expectedEdges := []Edge{
+		{"data", "sample [train size]", 5},
+		{"sample [train size]", "train [train size, cost]", 10},
+		{"train [train size, cost]", "summarize", 10},
+	}
+	if !reflect.DeepEqual(g.Edges, expectedEdges) {
+		t.Errorf("Wrong edges:\nEXPECTED: %v\nACTUAL: %v\n", expectedEdges, g.Edges)
+	}
+
+	if ranks := g.ranks(); ranks["summarize"] != 3 || ranks["data"] != 0 {
+		t.Errorf("Wrong SVG columns: %v", ranks)
+	}
+	if mmd := g.Mermaid(); !strings.Contains(mmd, "  n1 --> n2\n") {
+		t.Errorf("Missing data -> sample edge in Mermaid graph:\n%s", mmd)
+	}
+}
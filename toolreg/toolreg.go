@@ -0,0 +1,361 @@
+// Package toolreg resolves the paths of the external tools used by the
+// workflows, so that they can be run from system installs, cluster modules or
+// the apps bundles downloaded by the workflows.
+//
+// The path of a tool is taken from, in this order:
+//
+//  1. A tool config file, with the name and the path of a tool on each line
+//  2. The environment variable SCIPIPE_TOOL_[NAME], such as
+//     SCIPIPE_TOOL_LIN_TRAIN for lin-train
+//  3. The default path of the tool, relative to the workflow directory
+//  4. The command of the tool, looked up in PATH
+//
+// All paths are made absolute, since SciPipe runs tasks in subdirectories of
+// the workflow directory, and are validated before the workflow is run:
+//
+//	tools := toolreg.NewRegistry(
+//		toolreg.Tool{Name: "samtools", Default: "data/apps/samtools-1.3.1/samtools", Bundled: true},
+//		toolreg.Tool{Name: "java", Command: "java"},
+//	)
+//	if err := tools.Resolve(*toolsConf); err != nil {
+//		sp.Fail(err)
+//	}
+//	index := wf.NewProc("index", tools.ShellPath("samtools")+" index {i:bam}")
+package toolreg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// EnvPrefix is the prefix of the environment variables with tool paths
+const EnvPrefix = "SCIPIPE_TOOL_"
+
+// Tool is an external tool used by a workflow
+type Tool struct {
+	// Name is the name of the tool in config files and environment variables
+	Name string
+	// Command is the name of the executable to look for in PATH, if the tool
+	// is not configured and is not at its default path. Empty for tools that
+	// are not looked for in PATH, such as jars and bundled tools.
+	Command string
+	// Default is the path of the tool if it is not configured, relative to
+	// the workflow directory, or absolute
+	Default string
+	// Bundled is true for tools that are installed at the default path by the
+	// workflow itself, such as the tools in downloaded apps bundles, which do
+	// not need to exist before the workflow is run
+	Bundled bool
+}
+
+// EnvVar returns the name of the environment variable with the path of the
+// tool, with the name of the tool in upper case and other characters than
+// letters and digits replaced by underscores
+func (t Tool) EnvVar() string {
+	return EnvPrefix + strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, t.Name)
+}
+
+// Source is where the path of a tool was found
+type Source string
+
+const (
+	SourceConfig  Source = "config"
+	SourceEnv     Source = "env"
+	SourceDefault Source = "default"
+	SourcePath    Source = "PATH"
+	// SourceMissing is for tools that could not be resolved, which get
+	// their default path, or command
+	SourceMissing Source = "missing"
+)
+
+// Resolved is a tool with its resolved, absolute, path
+type Resolved struct {
+	Tool
+	Path   string
+	Source Source
+}
+
+// Registry contains the tools used by a workflow, and their paths once
+// resolved
+type Registry struct {
+	tools    []Tool
+	resolved map[string]Resolved
+}
+
+// NewRegistry returns a new Registry with tools. Tools with the same name as
+// an earlier tool replace it.
+func NewRegistry(tools ...Tool) *Registry {
+	r := &Registry{}
+	r.Add(tools...)
+	return r
+}
+
+// Add adds tools to the registry, which needs to be resolved again after that
+func (r *Registry) Add(tools ...Tool) {
+	for _, tool := range tools {
+		replaced := false
+		for i := range r.tools {
+			if r.tools[i].Name == tool.Name {
+				r.tools[i] = tool
+				replaced = true
+			}
+		}
+		if !replaced {
+			r.tools = append(r.tools, tool)
+		}
+	}
+	r.resolved = nil
+}
+
+// Resolve resolves the paths of all the tools, with the tool config file at
+// configPath, or without config file if configPath is empty. The error lists
+// all the tools that are missing, or are configured with invalid paths, and
+// problems with the config file. Tools that are not resolved get their
+// default path, or command, so that a workflow can still be built with them,
+// to check its dependencies.
+func (r *Registry) Resolve(configPath string) error {
+	problems := []string{}
+	config := map[string]string{}
+	if configPath != "" {
+		var err error
+		if config, err = ReadConfig(configPath); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	unknown := []string{}
+	for name := range config {
+		if !r.Has(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		problems = append(problems, fmt.Sprintf("%s: unknown tool: %s (known tools: %s)", configPath, name, strings.Join(r.Names(), ", ")))
+	}
+
+	resolved := map[string]Resolved{}
+	for _, tool := range r.tools {
+		res, err := resolve(tool, config[tool.Name])
+		if err != nil {
+			problems = append(problems, err.Error())
+			res = Resolved{tool, fallbackPath(tool), SourceMissing}
+		}
+		resolved[tool.Name] = res
+	}
+	r.resolved = resolved
+	if len(problems) > 0 {
+		return fmt.Errorf("could not resolve tools (set their paths in a tool config file, or with %s[NAME] environment variables):\n  %s", EnvPrefix, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// resolve resolves the path of tool, configured as configured, or not
+// configured if empty
+func resolve(tool Tool, configured string) (Resolved, error) {
+	if configured != "" {
+		path, err := checkPath(configured)
+		if err != nil {
+			return Resolved{}, fmt.Errorf("%s: %v (from tool config)", tool.Name, err)
+		}
+		return Resolved{tool, path, SourceConfig}, nil
+	}
+	if env := os.Getenv(tool.EnvVar()); env != "" {
+		path, err := checkPath(env)
+		if err != nil {
+			return Resolved{}, fmt.Errorf("%s: %v (from %s)", tool.Name, err, tool.EnvVar())
+		}
+		return Resolved{tool, path, SourceEnv}, nil
+	}
+	if tool.Default != "" {
+		path, err := filepath.Abs(tool.Default)
+		if err != nil {
+			return Resolved{}, fmt.Errorf("%s: %v", tool.Name, err)
+		}
+		if _, err := checkPath(path); err == nil || tool.Bundled {
+			return Resolved{tool, path, SourceDefault}, nil
+		}
+	}
+	if tool.Command != "" {
+		if path, err := exec.LookPath(tool.Command); err == nil {
+			path, err = filepath.Abs(path)
+			if err != nil {
+				return Resolved{}, fmt.Errorf("%s: %v", tool.Name, err)
+			}
+			return Resolved{tool, path, SourcePath}, nil
+		}
+	}
+	tried := []string{}
+	if tool.Default != "" {
+		tried = append(tried, tool.Default)
+	}
+	if tool.Command != "" {
+		tried = append(tried, tool.Command+" in PATH")
+	}
+	return Resolved{}, fmt.Errorf("%s: not found (looked for %s)", tool.Name, strings.Join(tried, " and "))
+}
+
+// fallbackPath returns the path of tool if it could not be resolved: its
+// absolute default path, or else its command or name
+func fallbackPath(tool Tool) string {
+	if tool.Default != "" {
+		if path, err := filepath.Abs(tool.Default); err == nil {
+			return path
+		}
+	}
+	if tool.Command != "" {
+		return tool.Command
+	}
+	return tool.Name
+}
+
+// checkPath returns the absolute path of the tool at path, or at the path of
+// the command path in PATH, if path has no slashes, and an error if it is
+// missing, or is not an executable file. Jars only need to exist.
+func checkPath(path string) (string, error) {
+	if !strings.Contains(path, "/") {
+		found, err := exec.LookPath(path)
+		if err != nil {
+			return "", fmt.Errorf("%s not found in PATH", path)
+		}
+		path = found
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("%s does not exist", path)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+	if !strings.HasSuffix(path, ".jar") && info.Mode()&0111 == 0 {
+		return "", fmt.Errorf("%s is not executable", path)
+	}
+	return path, nil
+}
+
+// Path returns the resolved path of the tool named name. It panics if the
+// registry has not been resolved, or has no such tool, which are errors in
+// the workflow code.
+func (r *Registry) Path(name string) string {
+	if r.resolved == nil {
+		panic("toolreg: Path called before Resolve")
+	}
+	res, ok := r.resolved[name]
+	if !ok {
+		panic("toolreg: unknown tool: " + name)
+	}
+	return res.Path
+}
+
+// ShellPath returns the resolved path of the tool named name, quoted for use
+// in shell commands, as Quote does
+func (r *Registry) ShellPath(name string) string {
+	return Quote(r.Path(name))
+}
+
+// Source returns where the path of the tool named name was found. It panics
+// like Path.
+func (r *Registry) Source(name string) Source {
+	r.Path(name)
+	return r.resolved[name].Source
+}
+
+// Has returns true if the registry has a tool named name
+func (r *Registry) Has(name string) bool {
+	for _, tool := range r.tools {
+		if tool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolved returns the resolved tools, in the order they were added
+func (r *Registry) Resolved() []Resolved {
+	resolved := []Resolved{}
+	for _, tool := range r.tools {
+		if res, ok := r.resolved[tool.Name]; ok {
+			resolved = append(resolved, res)
+		}
+	}
+	return resolved
+}
+
+// Names returns the sorted names of the tools
+func (r *Registry) Names() []string {
+	names := []string{}
+	for _, tool := range r.tools {
+		names = append(names, tool.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadConfig reads a tool config file, with the name and the path of a tool,
+// separated by whitespace or an equals sign, on each line. The path is the
+// rest of the line, and may contain spaces. Paths without slashes are
+// commands to look for in PATH, and relative paths are relative to the
+// workflow directory. Empty lines and lines starting with # are ignored.
+func ReadConfig(path string) (map[string]string, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]string{}
+	for i, line := range strings.Split(string(dat), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sep := strings.IndexFunc(line, func(r rune) bool { return r == '=' || unicode.IsSpace(r) })
+		if sep < 0 {
+			return nil, fmt.Errorf("%s, line %d: expected a tool name and a path", path, i+1)
+		}
+		name := line[:sep]
+		toolPath := strings.TrimSpace(line[sep+1:])
+		if unicode.IsSpace(rune(line[sep])) {
+			toolPath = strings.TrimSpace(strings.TrimPrefix(toolPath, "="))
+		}
+		if name == "" || toolPath == "" {
+			return nil, fmt.Errorf("%s, line %d: expected a tool name and a path", path, i+1)
+		}
+		if _, ok := config[name]; ok {
+			return nil, fmt.Errorf("%s, line %d: duplicate tool: %s", path, i+1, name)
+		}
+		config[name] = toolPath
+	}
+	return config, nil
+}
+
+// Quote quotes path for use in shell commands, in single quotes, unless it
+// only has characters that need no quoting
+func Quote(path string) string {
+	if path != "" && strings.Trim(path, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-") == "" {
+		return path
+	}
+	return "'" + strings.Replace(path, "'", `'\''`, -1) + "'"
+}
+
+// Table formats the resolved tools as a table, with the name, source and
+// path of each tool, for logging
+func (r *Registry) Table() string {
+	rows := []string{}
+	for _, res := range r.Resolved() {
+		rows = append(rows, fmt.Sprintf("%-24s %-8s %s", res.Name, res.Source, res.Path))
+	}
+	return strings.Join(rows, "\n")
+}
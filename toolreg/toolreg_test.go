@@ -0,0 +1,177 @@
+package toolreg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "toolreg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	writeFile := func(name string, mode os.FileMode) string {
+		path := filepath.Join(tmpDir, name)
+		if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"), mode); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	binDir := filepath.Join(tmpDir, "bin")
+	for _, dir := range []string{binDir, filepath.Join(tmpDir, "my tools")} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inPath := writeFile("bin/inpath", 0755)
+	configured := writeFile("configured", 0755)
+	fromEnv := writeFile("fromenv", 0755)
+	jar := writeFile("tool.jar", 0644)
+	notExecutable := writeFile("notexecutable", 0644)
+	spaced := writeFile("my tools/spaced", 0755)
+
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", binDir)
+	os.Setenv("SCIPIPE_TOOL_ENV_TOOL", fromEnv)
+	defer os.Unsetenv("SCIPIPE_TOOL_ENV_TOOL")
+	configPath := filepath.Join(tmpDir, "tools.conf")
+	config := "# Tools\nconfigured " + configured + "\n\nlookedup = inpath\nspaced=" + spaced + "\n"
+	if err := ioutil.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tools := NewRegistry(
+		Tool{Name: "configured", Command: "inpath", Default: jar},
+		Tool{Name: "lookedup"},
+		Tool{Name: "env-tool", Command: "inpath"},
+		Tool{Name: "jar", Default: jar},
+		Tool{Name: "bundled", Command: "inpath", Default: filepath.Join(tmpDir, "apps/bundled"), Bundled: true},
+		Tool{Name: "path", Command: "inpath", Default: filepath.Join(tmpDir, "missing")},
+		Tool{Name: "spaced"},
+	)
+	if err := tools.Resolve(configPath); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{
+		"configured": configured,
+		"lookedup":   inPath,
+		"env-tool":   fromEnv,
+		"jar":        jar,
+		"bundled":    filepath.Join(tmpDir, "apps/bundled"),
+		"path":       inPath,
+		"spaced":     spaced,
+	} {
+		if path := tools.Path(name); path != expected {
+			t.Errorf("Expected path %s for %s, got %s", expected, name, path)
+		}
+	}
+	sources := []string{}
+	for _, res := range tools.Resolved() {
+		sources = append(sources, string(res.Source))
+	}
+	if strings.Join(sources, " ") != "config config env default default PATH config" {
+		t.Errorf("Wrong sources: %v", sources)
+	}
+	if quoted := tools.ShellPath("spaced"); quoted != "'"+spaced+"'" {
+		t.Errorf("Expected the quoted path '%s' for spaced, got %s", spaced, quoted)
+	}
+	if tools.Source("path") != SourcePath {
+		t.Errorf("Expected source PATH for path, got %s", tools.Source("path"))
+	}
+
+	tools = NewRegistry(
+		Tool{Name: "missing", Command: "missing", Default: "missing"},
+		Tool{Name: "not-executable", Default: notExecutable},
+		Tool{Name: "jar", Default: jar},
+	)
+	err = tools.Resolve("")
+	if err == nil {
+		t.Fatal("Expected an error for missing tools")
+	}
+	for _, problem := range []string{"missing: not found (looked for missing and missing in PATH)", "not-executable: not found"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("Expected error to contain %q, got:\n%s", problem, err)
+		}
+	}
+	if strings.Contains(err.Error(), "jar:") {
+		t.Errorf("Did not expect an error for the jar, got:\n%s", err)
+	}
+	if expected, _ := filepath.Abs("missing"); tools.Path("missing") != expected {
+		t.Errorf("Expected the default path %s for the missing tool, got %s", expected, tools.Path("missing"))
+	}
+
+	if err := ioutil.WriteFile(configPath, []byte("unknown /bin/sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := tools.Resolve(configPath); err == nil || !strings.Contains(err.Error(), "unknown tool: unknown") {
+		t.Errorf("Expected an error for an unknown configured tool, got: %v", err)
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "toolreg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	configPath := filepath.Join(tmpDir, "tools.conf")
+	for _, tc := range []struct {
+		config   string
+		expected map[string]string
+		err      string
+	}{
+		{"java /usr/bin/java\n", map[string]string{"java": "/usr/bin/java"}, ""},
+		{"java=/opt/my tools/java \n", map[string]string{"java": "/opt/my tools/java"}, ""},
+		{"java = /opt/my tools/java\n", map[string]string{"java": "/opt/my tools/java"}, ""},
+		{"  java\t/opt/my tools/java\n", map[string]string{"java": "/opt/my tools/java"}, ""},
+		{"java\n", nil, "line 1: expected a tool name and a path"},
+		{"java =\n", nil, "line 1: expected a tool name and a path"},
+		{"java a\njava b\n", nil, "line 2: duplicate tool: java"},
+	} {
+		if err := ioutil.WriteFile(configPath, []byte(tc.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config, err := ReadConfig(configPath)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Expected an error containing %q for config %q, got: %v", tc.err, tc.config, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(config, tc.expected) {
+			t.Errorf("Wrong config for %q:\nEXPECTED: %v\nACTUAL: %v (%v)", tc.config, tc.expected, config, err)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for path, expected := range map[string]string{
+		"/usr/bin/java":       "/usr/bin/java",
+		"../bin/lin-train":    "../bin/lin-train",
+		"/opt/my tools/java":  "'/opt/my tools/java'",
+		"/opt/it's/java":      `'/opt/it'\''s/java'`,
+		"/opt/$HOME/bin/tool": "'/opt/$HOME/bin/tool'",
+		"":                    "''",
+	} {
+		if quoted := Quote(path); quoted != expected {
+			t.Errorf("Wrong quoting of %q:\nEXPECTED: %s\nACTUAL: %s", path, expected, quoted)
+		}
+	}
+}
+
+func TestEnvVar(t *testing.T) {
+	for name, expected := range map[string]string{
+		"lin-train": "SCIPIPE_TOOL_LIN_TRAIN",
+		"gatk":      "SCIPIPE_TOOL_GATK",
+		"tool.jar":  "SCIPIPE_TOOL_TOOL_JAR",
+	} {
+		if envVar := (Tool{Name: name}).EnvVar(); envVar != expected {
+			t.Errorf("Expected env var %s for %s, got %s", expected, name, envVar)
+		}
+	}
+}